@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/onsi/gomega/gexec"
@@ -16,7 +17,16 @@ import (
 )
 
 func StartServer(configYamlFile string) (session *gexec.Session) {
-	pathToWebserver, err := gexec.Build("github.com/cloudfoundry-incubator/bits-service/cmd/bitsgo")
+	return StartServerWithBuildTags(configYamlFile)
+}
+
+// StartServerWithBuildTags builds the bits-service with the given build tags, e.g. "fault_injection", and starts it.
+func StartServerWithBuildTags(configYamlFile string, tags ...string) (session *gexec.Session) {
+	var buildArgs []string
+	if len(tags) > 0 {
+		buildArgs = []string{"-tags", strings.Join(tags, " ")}
+	}
+	pathToWebserver, err := gexec.Build("github.com/cloudfoundry-incubator/bits-service/cmd/bitsgo", buildArgs...)
 	Ω(err).ShouldNot(HaveOccurred())
 
 	os.Setenv("BITS_LISTEN_ADDR", "127.0.0.1")
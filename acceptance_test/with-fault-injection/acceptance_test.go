@@ -0,0 +1,127 @@
+package acceptance_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	acceptance "github.com/cloudfoundry-incubator/bits-service/acceptance_test"
+	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	. "github.com/cloudfoundry-incubator/bits-service/testutil"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var (
+	session *gexec.Session
+	client  *http.Client
+)
+
+func TestEndToEnd(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+
+	BeforeSuite(func() {
+		session = acceptance.StartServerWithBuildTags("config.yml", "fault_injection")
+		client = &http.Client{}
+	})
+
+	AfterSuite(func() {
+		if session != nil {
+			session.Kill()
+		}
+		gexec.CleanupBuildArtifacts()
+	})
+
+	ginkgo.RunSpecs(t, "EndToEnd Fault Injection")
+}
+
+const privateEndpoint = "http://internal.127.0.0.1.nip.io:8889"
+
+func setFaults(rules string) *http.Response {
+	request, e := http.NewRequest("POST", privateEndpoint+"/admin/faults", strings.NewReader(rules))
+	Expect(e).NotTo(HaveOccurred())
+	request.SetBasicAuth("the-admin", "the-admin-password")
+	response, e := client.Do(request)
+	Expect(e).NotTo(HaveOccurred())
+	return response
+}
+
+func putPackage(guid string) *http.Response {
+	request, e := httputil.NewPutRequest(privateEndpoint+"/packages/"+guid, map[string]map[string]io.Reader{
+		"package": map[string]io.Reader{"somefilename": CreateZip(map[string]string{"somefile": "lalala\n\n"})},
+	})
+	Expect(e).NotTo(HaveOccurred())
+	request.SetBasicAuth("the-username", "the-password")
+	response, e := client.Do(request)
+	Expect(e).NotTo(HaveOccurred())
+	return response
+}
+
+func getPackage(guid string) *http.Response {
+	request, e := http.NewRequest("GET", privateEndpoint+"/packages/"+guid, nil)
+	Expect(e).NotTo(HaveOccurred())
+	request.SetBasicAuth("the-username", "the-password")
+	response, e := client.Do(request)
+	Expect(e).NotTo(HaveOccurred())
+	return response
+}
+
+var _ = Describe("Injecting faults through the admin API", func() {
+	BeforeEach(func() {
+		Expect(putPackage("myguid").StatusCode).To(Equal(http.StatusCreated))
+	})
+
+	AfterEach(func() {
+		Expect(setFaults(`[]`).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("fails downloads with a server error", func() {
+		Expect(setFaults(`[{"resource_type": "packages", "operation": "get_or_redirect", "error_rate": 1}]`).StatusCode).To(Equal(http.StatusOK))
+
+		Expect(getPackage("myguid").StatusCode).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("pretends blobs do not exist", func() {
+		Expect(setFaults(`[{"resource_type": "packages", "operation": "get_or_redirect", "not_found_rate": 1}]`).StatusCode).To(Equal(http.StatusOK))
+
+		Expect(getPackage("myguid").StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("pretends the blobstore is full", func() {
+		Expect(setFaults(`[{"resource_type": "packages", "operation": "put", "no_space_left_rate": 1}]`).StatusCode).To(Equal(http.StatusOK))
+
+		Expect(putPackage("otherguid").StatusCode).To(Equal(http.StatusInsufficientStorage))
+	})
+
+	It("slows down calls", func() {
+		Expect(setFaults(`[{"resource_type": "packages", "operation": "get_or_redirect", "latency_ms": 500}]`).StatusCode).To(Equal(http.StatusOK))
+
+		start := time.Now()
+		Expect(getPackage("myguid").StatusCode).To(Equal(http.StatusOK))
+		Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+	})
+
+	It("only affects the matching resource type", func() {
+		Expect(setFaults(`[{"resource_type": "droplets", "error_rate": 1}]`).StatusCode).To(Equal(http.StatusOK))
+
+		Expect(getPackage("myguid").StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("behaves normally again once the faults are cleared", func() {
+		Expect(setFaults(`[{"resource_type": "packages", "error_rate": 1}]`).StatusCode).To(Equal(http.StatusOK))
+		Expect(getPackage("myguid").StatusCode).To(Equal(http.StatusInternalServerError))
+
+		Expect(setFaults(`[]`).StatusCode).To(Equal(http.StatusOK))
+
+		Expect(getPackage("myguid").StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("rejects invalid rules", func() {
+		Expect(setFaults(`[{"operation": "list"}]`).StatusCode).To(Equal(http.StatusUnprocessableEntity))
+	})
+})
@@ -20,25 +20,25 @@ import (
 )
 
 type AppStashHandler struct {
-	blobstore        Blobstore
-	maxBodySizeLimit uint64
-	minimumSize      uint64
-	maximumSize      uint64
-	metricsService   MetricsService
+	blobstore      Blobstore
+	metricsService MetricsService
+	sizeLimits
 }
 
 func NewAppStashHandlerWithSizeThresholds(blobstore Blobstore, maxBodySizeLimit uint64, minimumSize uint64, maximumSize uint64, metricsService MetricsService) *AppStashHandler {
 	return &AppStashHandler{
-		blobstore:        blobstore,
-		maxBodySizeLimit: maxBodySizeLimit,
-		minimumSize:      minimumSize,
-		maximumSize:      maximumSize,
-		metricsService:   metricsService,
+		blobstore:      blobstore,
+		metricsService: metricsService,
+		sizeLimits: sizeLimits{
+			maxBodySizeLimit: maxBodySizeLimit,
+			minimumSize:      minimumSize,
+			maximumSize:      maximumSize,
+		},
 	}
 }
 
 func (handler *AppStashHandler) PostMatches(responseWriter http.ResponseWriter, request *http.Request) {
-	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
+	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySize()) {
 		return
 	}
 	body, e := ioutil.ReadAll(request.Body)
@@ -57,12 +57,13 @@ func (handler *AppStashHandler) PostMatches(responseWriter http.ResponseWriter,
 		util.FprintDescriptionAsJSON(responseWriter, "The request is semantically invalid: must be a non-empty array.")
 		return
 	}
+	minimumSize, maximumSize := handler.sizeThresholds()
 	matchedFingerprints := []Fingerprint{} // this must not be nil, because the JSON marshaller will not marshal it correctly in case of []
 	for _, entry := range fingerprints {
-		if entry.Size < handler.minimumSize || entry.Size > handler.maximumSize {
+		if entry.Size < minimumSize || entry.Size > maximumSize {
 			continue
 		}
-		exists, e := handler.blobstore.Exists(entry.Sha1)
+		exists, e := BlobstoreWithContext(request.Context(), handler.blobstore).Exists(entry.Sha1)
 		util.PanicOnError(e)
 		if exists {
 			matchedFingerprints = append(matchedFingerprints, entry)
@@ -74,7 +75,7 @@ func (handler *AppStashHandler) PostMatches(responseWriter http.ResponseWriter,
 }
 
 func (handler *AppStashHandler) PostEntries(responseWriter http.ResponseWriter, request *http.Request) {
-	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
+	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySize()) {
 		return
 	}
 	uploadedFile, _, e := request.FormFile("application")
@@ -104,11 +105,15 @@ func (handler *AppStashHandler) PostEntries(responseWriter http.ResponseWriter,
 		if !zipFileEntry.FileInfo().Mode().IsRegular() {
 			continue
 		}
-		sha, e := copyTo(handler.blobstore, zipFileEntry)
+		sha, e := copyTo(BlobstoreWithContext(request.Context(), handler.blobstore), zipFileEntry)
 		if _, isNoSpaceLeftError := e.(*NoSpaceLeftError); isNoSpaceLeftError {
 			http.Error(responseWriter, util.DescriptionAndCodeAsJSON(500000, "Request Entity Too Large"), http.StatusInsufficientStorage)
 			return
 		}
+		if IsUnavailableError(e) {
+			WriteServiceUnavailable(responseWriter, request, errors.Cause(e).(*UnavailableError))
+			return
+		}
 		util.PanicOnError(e)
 		logger.From(request).Debugw("Filemode in zip File Entry", "filemode", zipFileEntry.FileInfo().Mode().String())
 		fingerprints = append(fingerprints, Fingerprint{
@@ -179,7 +184,7 @@ type Fingerprint struct {
 }
 
 func (handler *AppStashHandler) PostBundles(responseWriter http.ResponseWriter, request *http.Request) {
-	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
+	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySize()) {
 		return
 	}
 
@@ -226,7 +231,8 @@ func (handler *AppStashHandler) PostBundles(responseWriter http.ResponseWriter,
 		return
 	}
 
-	tempZipFilename, e := CreateTempZipFileFrom(bundlesPayload, zipReader, handler.minimumSize, handler.maximumSize, handler.blobstore, handler.metricsService, logger.From(request))
+	minimumSize, maximumSize := handler.sizeThresholds()
+	tempZipFilename, e := CreateTempZipFileFrom(request.Context(), bundlesPayload, zipReader, minimumSize, maximumSize, handler.blobstore, handler.metricsService, logger.From(request))
 	if e != nil {
 		if notFoundError, ok := e.(*NotFoundError); ok {
 			responseWriter.WriteHeader(http.StatusNotFound)
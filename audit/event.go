@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	Upload    = "upload"
+	Copy      = "copy"
+	Delete    = "delete"
+	DeleteDir = "delete_dir"
+	Sign      = "sign"
+
+	ReloadSigningKeys = "reload_signing_keys"
+	ReloadConfig      = "reload_config"
+	ReconcileQuotas   = "reconcile_quotas"
+
+	EnableMaintenanceMode  = "enable_maintenance_mode"
+	DisableMaintenanceMode = "disable_maintenance_mode"
+
+	SetFaultRules = "set_fault_rules"
+)
+
+const (
+	BasicAuthActor   = "basic_auth"
+	BearerTokenActor = "bearer_token"
+	ClientCertActor  = "client_cert"
+	SignedURLActor   = "signed_url"
+	AnonymousActor   = "anonymous"
+)
+
+const (
+	Success  = "success"
+	Accepted = "accepted"
+	Failure  = "failure"
+)
+
+type Actor struct {
+	// One of BasicAuthActor, BearerTokenActor, ClientCertActor, SignedURLActor or AnonymousActor
+	Type string `json:"type"`
+	// The basic auth user, the subject of the bearer token or client certificate, or the ID of the signing key. Empty for anonymous actors and URLs signed with the legacy secret.
+	ID string `json:"id,omitempty"`
+}
+
+type Event struct {
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id"`
+	Action       string    `json:"action"`
+	Actor        Actor     `json:"actor"`
+	ResourceType string    `json:"resource_type"`
+	GUID         string    `json:"guid"`
+	SourceGUID   string    `json:"source_guid,omitempty"`
+	SignedVerb   string    `json:"signed_verb,omitempty"`
+	Sha1         string    `json:"sha1,omitempty"`
+	Sha256       string    `json:"sha256,omitempty"`
+	// Asynchronous uploads are "accepted". Their final result is reported to the Cloud Controller.
+	Outcome    string `json:"outcome"`
+	StatusCode int    `json:"status_code"`
+	ClientIP   string `json:"client_ip"`
+}
+
+type contextKey struct{}
+
+// WithEvent returns a copy of request which carries event, so that handlers can describe it via From.
+func WithEvent(request *http.Request, event *Event) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), contextKey{}, event))
+}
+
+// From returns the audit event of request. When auditing is disabled, it returns an event which is never
+// written, so that handlers do not need to care about whether auditing is enabled or not.
+func From(request *http.Request) *Event {
+	if event, ok := request.Context().Value(contextKey{}).(*Event); ok {
+		return event
+	}
+	return &Event{}
+}
+
+// Describe marks the event as auditable. Events without an action are not written.
+func (event *Event) Describe(action string, guid string) *Event {
+	event.Action = action
+	event.GUID = guid
+	return event
+}
+
+func (event *Event) WithChecksums(sha1 string, sha256 string) *Event {
+	event.Sha1 = sha1
+	event.Sha256 = sha256
+	return event
+}
+
+func (event *Event) WithSourceGUID(sourceGUID string) *Event {
+	event.SourceGUID = sourceGUID
+	return event
+}
+
+func (event *Event) WithResourceType(resourceType string) *Event {
+	event.ResourceType = resourceType
+	return event
+}
+
+func (event *Event) WithSignedVerb(verb string) *Event {
+	event.SignedVerb = verb
+	return event
+}
@@ -0,0 +1,32 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// Sink receives audit events as JSON lines, including the trailing newline.
+type Sink interface {
+	Write(line []byte) error
+}
+
+type Logger struct {
+	sink Sink
+}
+
+func NewLogger(sink Sink) *Logger {
+	return &Logger{sink: sink}
+}
+
+func (auditLogger *Logger) Log(event *Event) {
+	line, e := json.Marshal(event)
+	if e != nil {
+		logger.Log.Errorw("Could not marshal audit event", "error", e, "request-id", event.RequestID)
+		return
+	}
+	e = auditLogger.sink.Write(append(line, '\n'))
+	if e != nil {
+		logger.Log.Errorw("Could not write audit event", "error", e, "request-id", event.RequestID)
+	}
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bytes"
+	"log/syslog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// NewSinkFrom creates the sink named sink, which is one of "file", "syslog" or "webhook". Only the argument
+// belonging to that sink is used.
+func NewSinkFrom(sink string, file string, syslogTag string, webhookURL string) (Sink, error) {
+	switch sink {
+	case "file":
+		return NewFileSink(file)
+	case "syslog":
+		return NewSyslogSink(syslogTag)
+	case "webhook":
+		return NewWebhookSink(webhookURL, &http.Client{Timeout: 10 * time.Second}), nil
+	default:
+		return nil, errors.Errorf("Unknown audit sink \"%v\"", sink)
+	}
+}
+
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, e := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not open audit log file %v", path)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (sink *FileSink) Write(line []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	_, e := sink.file.Write(line)
+	return errors.WithStack(e)
+}
+
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	writer, e := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if e != nil {
+		return nil, errors.Wrap(e, "Could not connect to syslog")
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+func (sink *SyslogSink) Write(line []byte) error {
+	return errors.WithStack(sink.writer.Info(string(bytes.TrimRight(line, "\n"))))
+}
+
+// WebhookSink POSTs every event to a URL. Delivery happens in the background, so that a slow
+// webhook does not slow down requests. When the queue is full, events are dropped and logged as errors.
+type WebhookSink struct {
+	url        string
+	httpClient *http.Client
+	queue      chan []byte
+}
+
+const webhookQueueSize = 1000
+
+func NewWebhookSink(url string, httpClient *http.Client) *WebhookSink {
+	sink := &WebhookSink{
+		url:        url,
+		httpClient: httpClient,
+		queue:      make(chan []byte, webhookQueueSize),
+	}
+	go sink.deliver()
+	return sink
+}
+
+func (sink *WebhookSink) Write(line []byte) error {
+	select {
+	case sink.queue <- line:
+		return nil
+	default:
+		return errors.New("Audit webhook queue is full. Dropping event: " + string(line))
+	}
+}
+
+func (sink *WebhookSink) deliver() {
+	for line := range sink.queue {
+		response, e := sink.httpClient.Post(sink.url, "application/json", bytes.NewReader(line))
+		if e != nil {
+			logger.Log.Errorw("Could not deliver audit event to webhook", "error", e, "event", string(line))
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			logger.Log.Errorw("Audit webhook rejected event", "status-code", response.StatusCode, "event", string(line))
+		}
+	}
+}
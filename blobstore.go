@@ -1,8 +1,12 @@
 package bitsgo
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 type NotFoundError struct {
@@ -37,6 +41,23 @@ func NewNoSpaceLeftError() *NoSpaceLeftError {
 	return &NoSpaceLeftError{fmt.Errorf("NoSpaceLeftError")}
 }
 
+// UnavailableError is returned when a call is rejected without reaching the backend, e.g. because the backend
+// has been failing or is busy. Callers should not retry before RetryAfter.
+type UnavailableError struct {
+	error
+	RetryAfter time.Duration
+}
+
+func NewUnavailableError(message string, retryAfter time.Duration) *UnavailableError {
+	return &UnavailableError{error: errors.New(message), RetryAfter: retryAfter}
+}
+
+// IsUnavailableError also detects wrapped UnavailableErrors, since they usually surface through several layers.
+func IsUnavailableError(e error) bool {
+	_, unavailable := errors.Cause(e).(*UnavailableError)
+	return unavailable
+}
+
 //go:generate pegomock generate --use-experimental-model-gen --package bitsgo_test Blobstore
 type Blobstore interface {
 	Exists(path string) (bool, error)
@@ -53,3 +74,29 @@ type Blobstore interface {
 	Delete(path string) error
 	DeleteDir(prefix string) error
 }
+
+// ListingBlobstore is implemented by Blobstores that can enumerate their blobs, e.g. to migrate them to another
+// Blobstore.
+type ListingBlobstore interface {
+	Blobstore
+	// List calls visit with the path of every blob below the directory prefix, which is empty or ends with a slash.
+	// Paths are visited in lexical order. List stops at the first error visit returns.
+	List(prefix string, visit func(path string) error) error
+}
+
+// ContextualBlobstore is implemented by Blobstores that can make use of request-scoped
+// information, e.g. to record their operations as part of the request's trace or to pass
+// the request ID on to the backend.
+type ContextualBlobstore interface {
+	Blobstore
+	WithContext(ctx context.Context) Blobstore
+}
+
+// BlobstoreWithContext returns a Blobstore bound to ctx if blobstore is a ContextualBlobstore.
+// Otherwise it returns blobstore unchanged.
+func BlobstoreWithContext(ctx context.Context, blobstore Blobstore) Blobstore {
+	if contextualBlobstore, ok := blobstore.(ContextualBlobstore); ok {
+		return contextualBlobstore.WithContext(ctx)
+	}
+	return blobstore
+}
@@ -147,3 +147,23 @@ func getValidityPeriod(timestamp time.Time) int64 {
 	duration := timestamp.Sub(time.Now()).Seconds()
 	return int64(duration)
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	marker := oss.Marker("")
+	for {
+		objList, e := blobstore.bucket.ListObjects(oss.MaxKeys(1000), marker, oss.Prefix(prefix))
+		if e != nil {
+			return errors.Wrapf(e, "Prefix %v", prefix)
+		}
+		for _, object := range objList.Objects {
+			e = visit(object.Key)
+			if e != nil {
+				return e
+			}
+		}
+		if !objList.IsTruncated {
+			return nil
+		}
+		marker = oss.Marker(objList.NextMarker)
+	}
+}
@@ -264,3 +264,27 @@ func (blobstore *Blobstore) handleError(e error, context string, args ...interfa
 	}
 	return errors.Wrapf(e, context, args...)
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	marker := ""
+	for {
+		response, e := blobstore.client.GetContainerReference(blobstore.containerName).ListBlobs(storage.ListBlobsParameters{
+			Prefix:     prefix,
+			MaxResults: blobstore.maxListResults,
+			Marker:     marker,
+		})
+		if e != nil {
+			return errors.Wrapf(e, "Prefix %v", prefix)
+		}
+		for _, blob := range response.Blobs {
+			e = visit(blob.Name)
+			if e != nil {
+				return e
+			}
+		}
+		if response.NextMarker == "" {
+			return nil
+		}
+		marker = response.NextMarker
+	}
+}
@@ -0,0 +1,223 @@
+package decorator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// probeRetryAfter is what rejected calls are told while a half-open circuit waits for the result of its probe.
+const probeRetryAfter = time.Second
+
+var circuitBreakerOperations = []string{"exists", "head_or_redirect", "get", "get_or_redirect", "put", "copy", "delete", "delete_dir"}
+
+type circuit struct {
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+}
+
+// CircuitBreaker protects a blobstore backend. Each operation has its own circuit, which opens after
+// failureThreshold consecutive failures. While it is open, calls fail fast for openPeriod. Then a single call
+// probes the backend and either closes the circuit again or keeps it open for another openPeriod.
+// Independent of the circuits, at most maxConcurrentCalls calls may be in flight, so that a slow backend cannot
+// tie up all request handlers. Calls beyond that fail fast as well. Zero means no limit.
+type CircuitBreaker struct {
+	failureThreshold int
+	openPeriod       time.Duration
+	slots            chan struct{}
+	clock            clock.Clock
+	metricsService   bitsgo.MetricsService
+	name             string
+
+	mutex    sync.Mutex
+	circuits map[string]*circuit
+}
+
+func NewCircuitBreaker(failureThreshold int, openPeriod time.Duration, maxConcurrentCalls int, clock clock.Clock, metricsService bitsgo.MetricsService, name string) *CircuitBreaker {
+	breaker := &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openPeriod:       openPeriod,
+		clock:            clock,
+		metricsService:   metricsService,
+		name:             name,
+		circuits:         make(map[string]*circuit),
+	}
+	if maxConcurrentCalls > 0 {
+		breaker.slots = make(chan struct{}, maxConcurrentCalls)
+	}
+	for _, operation := range circuitBreakerOperations {
+		breaker.circuits[operation] = &circuit{state: bitsgo.CircuitClosed}
+	}
+	return breaker
+}
+
+// call calls f unless the CircuitBreaker rejects it with an *UnavailableError. Panics count as failures.
+func (breaker *CircuitBreaker) call(operation string, f func() error) error {
+	release, e := breaker.acquire(operation)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			release(fmt.Errorf("%v", recovered))
+			panic(recovered)
+		}
+	}()
+	e = f()
+	release(e)
+	return e
+}
+
+// acquire returns an *UnavailableError when the call must not reach the backend. Otherwise, the caller must
+// call release with the result of the call.
+func (breaker *CircuitBreaker) acquire(operation string) (release func(error), e error) {
+	e = breaker.enter(operation)
+	if e != nil {
+		breaker.countRejection(operation, "open")
+		return nil, e
+	}
+	if breaker.slots != nil {
+		select {
+		case breaker.slots <- struct{}{}:
+		default:
+			breaker.abandon(operation)
+			breaker.countRejection(operation, "concurrency_limit")
+			return nil, bitsgo.NewUnavailableError("Too many concurrent calls to the "+breaker.name+" blobstore", probeRetryAfter)
+		}
+	}
+	return func(e error) {
+		if breaker.slots != nil {
+			<-breaker.slots
+		}
+		breaker.leave(operation, e)
+	}, nil
+}
+
+func (breaker *CircuitBreaker) enter(operation string) error {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	c := breaker.circuits[operation]
+	switch c.state {
+	case bitsgo.CircuitOpen:
+		openFor := c.openedAt.Add(breaker.openPeriod).Sub(breaker.clock.Now())
+		if openFor > 0 {
+			return bitsgo.NewUnavailableError("The "+breaker.name+" blobstore is failing. Circuit for "+operation+" is open", openFor)
+		}
+		breaker.transition(operation, c, bitsgo.CircuitHalfOpen)
+		return nil
+	case bitsgo.CircuitHalfOpen:
+		return bitsgo.NewUnavailableError("The "+breaker.name+" blobstore is failing. Circuit for "+operation+" is being probed", probeRetryAfter)
+	default:
+		return nil
+	}
+}
+
+func (breaker *CircuitBreaker) leave(operation string, e error) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	c := breaker.circuits[operation]
+	if isCanceled(e) {
+		// Says nothing about the backend. A canceled probe is abandoned, so that the next call probes instead.
+		if c.state == bitsgo.CircuitHalfOpen {
+			breaker.transition(operation, c, bitsgo.CircuitOpen)
+		}
+		return
+	}
+	if !isBackendFailure(e) {
+		c.consecutiveFailures = 0
+		if c.state != bitsgo.CircuitClosed {
+			breaker.transition(operation, c, bitsgo.CircuitClosed)
+		}
+		return
+	}
+	c.consecutiveFailures++
+	if c.state == bitsgo.CircuitHalfOpen || c.consecutiveFailures >= breaker.failureThreshold {
+		c.openedAt = breaker.clock.Now()
+		if c.state != bitsgo.CircuitOpen {
+			breaker.transition(operation, c, bitsgo.CircuitOpen)
+		}
+	}
+}
+
+// abandon is called when a call passed the circuit, but never reached the backend. If it was meant to probe a
+// half-open circuit, the next call probes instead.
+func (breaker *CircuitBreaker) abandon(operation string) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	c := breaker.circuits[operation]
+	if c.state == bitsgo.CircuitHalfOpen {
+		breaker.transition(operation, c, bitsgo.CircuitOpen)
+	}
+}
+
+// transition must be called with the mutex held.
+func (breaker *CircuitBreaker) transition(operation string, c *circuit, state string) {
+	logger.Log.Infow("Circuit breaker changed state", "blobstore", breaker.name, "operation", operation, "from", c.state, "to", state)
+	c.state = state
+	breaker.metricsService.SendGaugeMetricWithTags(breaker.name+"-circuit_breaker-state", stateValueOf(state), map[string]string{"operation": operation})
+}
+
+func (breaker *CircuitBreaker) countRejection(operation string, reason string) {
+	breaker.metricsService.SendCounterMetricWithTags(breaker.name+"-circuit_breaker-rejections", 1, map[string]string{
+		"operation": operation,
+		"reason":    reason,
+	})
+}
+
+func (breaker *CircuitBreaker) CircuitBreakerStatus() []bitsgo.CircuitBreakerStatus {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	var result []bitsgo.CircuitBreakerStatus
+	for _, operation := range circuitBreakerOperations {
+		c := breaker.circuits[operation]
+		result = append(result, bitsgo.CircuitBreakerStatus{
+			Blobstore:           breaker.name,
+			Operation:           operation,
+			State:               c.state,
+			ConsecutiveFailures: c.consecutiveFailures,
+		})
+	}
+	return result
+}
+
+// isCanceled tells calls which the client canceled or which ran out of time on the client's side.
+func isCanceled(e error) bool {
+	cause := errors.Cause(e)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
+
+// isBackendFailure tells errors which indicate a failing backend from errors which are part of its normal operation.
+func isBackendFailure(e error) bool {
+	if e == nil {
+		return false
+	}
+	switch bitsgo.ErrorTypeOf(e) {
+	case bitsgo.NotFoundErrorType, bitsgo.NoSpaceLeftErrorType, bitsgo.StateForbiddenErrorType:
+		return false
+	default:
+		return true
+	}
+}
+
+// stateValueOf makes the state usable as a gauge: 0 is closed, 1 is half-open, 2 is open.
+func stateValueOf(state string) int64 {
+	switch state {
+	case bitsgo.CircuitOpen:
+		return 2
+	case bitsgo.CircuitHalfOpen:
+		return 1
+	default:
+		return 0
+	}
+}
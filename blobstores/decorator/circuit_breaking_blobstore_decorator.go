@@ -0,0 +1,71 @@
+package decorator
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+)
+
+// CircuitBreakingBlobstoreDecorator fails fast with *UnavailableError when its CircuitBreaker rejects a call.
+// Reading a body returned by Get or GetOrRedirect does not count as part of the call.
+type CircuitBreakingBlobstoreDecorator struct {
+	delegate bitsgo.Blobstore
+	breaker  *CircuitBreaker
+}
+
+func ForBlobstoreWithCircuitBreaker(delegate bitsgo.Blobstore, breaker *CircuitBreaker) *CircuitBreakingBlobstoreDecorator {
+	return &CircuitBreakingBlobstoreDecorator{delegate, breaker}
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &CircuitBreakingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.breaker}
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) Exists(path string) (exists bool, e error) {
+	e = decorator.breaker.call("exists", func() error {
+		exists, e = decorator.delegate.Exists(path)
+		return e
+	})
+	return
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, e error) {
+	e = decorator.breaker.call("head_or_redirect", func() error {
+		redirectLocation, e = decorator.delegate.HeadOrRedirectAsGet(path)
+		return e
+	})
+	return
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) Get(path string) (body io.ReadCloser, e error) {
+	e = decorator.breaker.call("get", func() error {
+		body, e = decorator.delegate.Get(path)
+		return e
+	})
+	return
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, e error) {
+	e = decorator.breaker.call("get_or_redirect", func() error {
+		body, redirectLocation, e = decorator.delegate.GetOrRedirect(path)
+		return e
+	})
+	return
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	return decorator.breaker.call("put", func() error { return decorator.delegate.Put(path, src) })
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) Copy(src, dest string) error {
+	return decorator.breaker.call("copy", func() error { return decorator.delegate.Copy(src, dest) })
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) Delete(path string) error {
+	return decorator.breaker.call("delete", func() error { return decorator.delegate.Delete(path) })
+}
+
+func (decorator *CircuitBreakingBlobstoreDecorator) DeleteDir(prefix string) error {
+	return decorator.breaker.call("delete_dir", func() error { return decorator.delegate.DeleteDir(prefix) })
+}
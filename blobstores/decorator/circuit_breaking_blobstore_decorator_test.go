@@ -0,0 +1,152 @@
+package decorator_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("CircuitBreakingBlobstoreDecorator", func() {
+	var (
+		backend   *flakyBlobstore
+		clk       *clock.Mock
+		breaker   *CircuitBreaker
+		blobstore *CircuitBreakingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		backend = newFlakyBlobstore()
+		clk = clock.NewMock()
+		breaker = NewCircuitBreaker(3, 30*time.Second, 0, clk, NewMockMetricsService(), "packages")
+		blobstore = ForBlobstoreWithCircuitBreaker(backend, breaker)
+	})
+
+	stateOf := func(operation string) string {
+		for _, status := range breaker.CircuitBreakerStatus() {
+			if status.Operation == operation {
+				return status.State
+			}
+		}
+		return ""
+	}
+
+	It("fails fast once an operation has failed repeatedly, and probes the backend after the open period", func() {
+		backend.setFailing(true)
+		for i := 0; i < 3; i++ {
+			e := blobstore.Put("some-path", strings.NewReader("content"))
+			Expect(e).To(HaveOccurred())
+			Expect(bitsgo.IsUnavailableError(e)).To(BeFalse())
+		}
+		Expect(stateOf("put")).To(Equal(bitsgo.CircuitOpen))
+
+		clk.Add(10 * time.Second)
+		e := blobstore.Put("some-path", strings.NewReader("content"))
+		Expect(bitsgo.IsUnavailableError(e)).To(BeTrue())
+		Expect(e.(*bitsgo.UnavailableError).RetryAfter).To(Equal(20 * time.Second))
+		Expect(backend.attempts()).To(Equal(3))
+
+		By("keeping other operations usable")
+		_, e = blobstore.Get("missing")
+		Expect(bitsgo.IsUnavailableError(e)).To(BeFalse())
+
+		By("opening again when the probe fails")
+		clk.Add(20 * time.Second)
+		e = blobstore.Put("some-path", strings.NewReader("content"))
+		Expect(bitsgo.IsUnavailableError(e)).To(BeFalse())
+		Expect(backend.attempts()).To(Equal(4))
+		Expect(bitsgo.IsUnavailableError(blobstore.Put("some-path", strings.NewReader("content")))).To(BeTrue())
+
+		By("closing when the probe succeeds")
+		backend.setFailing(false)
+		clk.Add(30 * time.Second)
+		Expect(blobstore.Put("some-path", strings.NewReader("content"))).To(Succeed())
+		Expect(stateOf("put")).To(Equal(bitsgo.CircuitClosed))
+		Expect(blobstore.Put("some-path", strings.NewReader("content"))).To(Succeed())
+	})
+
+	It("does not count missing blobs as failures", func() {
+		for i := 0; i < 5; i++ {
+			_, e := blobstore.Get("missing")
+			Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+		}
+		Expect(stateOf("get")).To(Equal(bitsgo.CircuitClosed))
+	})
+
+	It("does not count wrapped errors of normal operation or canceled calls as failures", func() {
+		failing := &failingTimesBlobstore{Blobstore: inmemory.NewBlobstore(), failures: 15}
+		blobstore = ForBlobstoreWithCircuitBreaker(failing, breaker)
+
+		for _, err := range []error{
+			errors.Wrap(bitsgo.NewNotFoundError(), "some context"),
+			errors.Wrap(context.Canceled, "some context"),
+			errors.Wrap(context.DeadlineExceeded, "some context"),
+		} {
+			failing.err = err
+			for i := 0; i < 5; i++ {
+				_, e := blobstore.Get("some-path")
+				Expect(errors.Cause(e)).To(Equal(errors.Cause(err)))
+			}
+		}
+		Expect(stateOf("get")).To(Equal(bitsgo.CircuitClosed))
+	})
+
+	It("leaves the circuit as it is for canceled calls, and lets the next call probe when a probe is canceled", func() {
+		failing := &failingTimesBlobstore{Blobstore: inmemory.NewBlobstore(), failures: 100}
+		blobstore = ForBlobstoreWithCircuitBreaker(failing, breaker)
+		getWith := func(err error) error {
+			failing.err = err
+			_, e := blobstore.Get("some-path")
+			return e
+		}
+
+		Expect(getWith(nil)).To(HaveOccurred())
+		Expect(getWith(nil)).To(HaveOccurred())
+		Expect(errors.Cause(getWith(errors.Wrap(context.Canceled, "some context")))).To(Equal(context.Canceled))
+		Expect(getWith(nil)).To(HaveOccurred())
+		Expect(stateOf("get")).To(Equal(bitsgo.CircuitOpen))
+
+		clk.Add(30 * time.Second)
+		Expect(errors.Cause(getWith(errors.Wrap(context.DeadlineExceeded, "some context")))).To(Equal(context.DeadlineExceeded))
+		Expect(stateOf("get")).To(Equal(bitsgo.CircuitOpen))
+
+		failing.failures = 0
+		Expect(bitsgo.IsNotFoundError(getWith(nil))).To(BeTrue())
+		Expect(failing.calls).To(Equal(6))
+		Expect(stateOf("get")).To(Equal(bitsgo.CircuitClosed))
+	})
+
+	It("rejects calls beyond the concurrency limit", func() {
+		blocking := &blockingBlobstore{inmemory.NewBlobstore(), make(chan struct{}, 2), make(chan struct{})}
+		blobstore = ForBlobstoreWithCircuitBreaker(blocking, NewCircuitBreaker(3, 30*time.Second, 1, clk, NewMockMetricsService(), "packages"))
+
+		go blobstore.Put("slow", strings.NewReader("content"))
+		Eventually(blocking.entered).Should(Receive())
+
+		e := blobstore.Put("other", strings.NewReader("content"))
+		Expect(bitsgo.IsUnavailableError(e)).To(BeTrue())
+
+		close(blocking.release)
+		Eventually(func() error { return blobstore.Put("other", strings.NewReader("content")) }).Should(Succeed())
+	})
+})
+
+type blockingBlobstore struct {
+	*inmemory.Blobstore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (blobstore *blockingBlobstore) Put(path string, src io.ReadSeeker) error {
+	blobstore.entered <- struct{}{}
+	<-blobstore.release
+	return nil
+}
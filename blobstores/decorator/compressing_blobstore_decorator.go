@@ -0,0 +1,161 @@
+package decorator
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+)
+
+// Mark compressed and uncompressed blobs. A plain gzip header would not do, because blobs might be gzip files themselves.
+// Both have the same length, so that one Peek tells them apart.
+const (
+	compressionMagic  = "BITSGZIP"
+	uncompressedMagic = "BITSRAW1"
+)
+
+// CompressingBlobstoreDecorator gzips blobs before they reach delegate. Blobs which do not get smaller are stored
+// as they are, behind a header of their own, so that their content can never be mistaken for a header. Blobs stored
+// before compression was enabled have no header and are read as they are. Like EncryptingBlobstoreDecorator,
+// it never redirects.
+type CompressingBlobstoreDecorator struct {
+	delegate bitsgo.Blobstore
+	level    int
+}
+
+func ForBlobstoreWithCompression(delegate bitsgo.Blobstore, level int) *CompressingBlobstoreDecorator {
+	return &CompressingBlobstoreDecorator{delegate, level}
+}
+
+func (decorator *CompressingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &CompressingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.level}
+}
+
+func (decorator *CompressingBlobstoreDecorator) Exists(path string) (bool, error) {
+	return decorator.delegate.Exists(path)
+}
+
+func (decorator *CompressingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	return headWithoutRedirect(decorator.delegate, path)
+}
+
+func (decorator *CompressingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	body, e := decorator.Get(path)
+	return body, "", e
+}
+
+func (decorator *CompressingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	body, e := decorator.delegate.Get(path)
+	if e != nil {
+		return nil, e
+	}
+	reader := bufio.NewReader(body)
+	magic, _ := reader.Peek(len(compressionMagic))
+	if string(magic) != compressionMagic && string(magic) != uncompressedMagic {
+		return &readerWithCloser{reader, body}, nil
+	}
+	_, e = reader.Discard(len(magic))
+	if e != nil {
+		body.Close()
+		return nil, e
+	}
+	if string(magic) == uncompressedMagic {
+		return &readerWithCloser{reader, body}, nil
+	}
+	gzipReader, e := gzip.NewReader(reader)
+	if e != nil {
+		body.Close()
+		return nil, e
+	}
+	return &gzipReadCloser{gzipReader, body}, nil
+}
+
+func (decorator *CompressingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	tempFile, e := ioutil.TempFile("", "bits-compress")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	_, e = tempFile.WriteString(compressionMagic)
+	if e != nil {
+		return e
+	}
+	gzipWriter, e := gzip.NewWriterLevel(tempFile, decorator.level)
+	if e != nil {
+		return e
+	}
+	uncompressedSize, e := io.Copy(gzipWriter, src)
+	if e != nil {
+		return e
+	}
+	e = gzipWriter.Close()
+	if e != nil {
+		return e
+	}
+
+	compressedSize, e := tempFile.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return e
+	}
+	if compressedSize >= int64(len(uncompressedMagic))+uncompressedSize {
+		e = storeUncompressed(tempFile, src)
+		if e != nil {
+			return e
+		}
+	}
+	_, e = tempFile.Seek(0, io.SeekStart)
+	if e != nil {
+		return e
+	}
+	return decorator.delegate.Put(path, tempFile)
+}
+
+// storeUncompressed replaces the content of tempFile with src behind the uncompressedMagic header.
+func storeUncompressed(tempFile *os.File, src io.ReadSeeker) error {
+	e := tempFile.Truncate(0)
+	if e != nil {
+		return e
+	}
+	_, e = tempFile.Seek(0, io.SeekStart)
+	if e != nil {
+		return e
+	}
+	_, e = tempFile.WriteString(uncompressedMagic)
+	if e != nil {
+		return e
+	}
+	_, e = src.Seek(0, io.SeekStart)
+	if e != nil {
+		return e
+	}
+	_, e = io.Copy(tempFile, src)
+	return e
+}
+
+func (decorator *CompressingBlobstoreDecorator) Copy(src, dest string) error {
+	return decorator.delegate.Copy(src, dest)
+}
+
+func (decorator *CompressingBlobstoreDecorator) Delete(path string) error {
+	return decorator.delegate.Delete(path)
+}
+
+func (decorator *CompressingBlobstoreDecorator) DeleteDir(prefix string) error {
+	return decorator.delegate.DeleteDir(prefix)
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (readCloser *gzipReadCloser) Close() error {
+	readCloser.Reader.Close()
+	return readCloser.body.Close()
+}
@@ -0,0 +1,74 @@
+package decorator_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CompressingBlobstoreDecorator", func() {
+	var (
+		delegate  *inmemory.Blobstore
+		blobstore *CompressingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		delegate = inmemory.NewBlobstore()
+		blobstore = ForBlobstoreWithCompression(delegate, 6)
+	})
+
+	contentOf := func(path string) []byte {
+		body, redirectLocation, e := blobstore.GetOrRedirect(path)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(redirectLocation).To(BeEmpty())
+		defer body.Close()
+		content, e := ioutil.ReadAll(body)
+		Expect(e).NotTo(HaveOccurred())
+		return content
+	}
+
+	It("stores compressible blobs compressed", func() {
+		content := bytes.Repeat([]byte("package main\n"), 1000)
+
+		Expect(blobstore.Put("some-path", bytes.NewReader(content))).To(Succeed())
+
+		Expect(delegate.Entries["some-path"]).To(HavePrefix("BITSGZIP"))
+		Expect(len(delegate.Entries["some-path"])).To(BeNumerically("<", len(content)/10))
+		Expect(contentOf("some-path")).To(Equal(content))
+	})
+
+	It("stores blobs as they are when they do not get smaller", func() {
+		content := make([]byte, 10000)
+		rand.Read(content)
+
+		Expect(blobstore.Put("some-path", bytes.NewReader(content))).To(Succeed())
+
+		Expect(delegate.Entries["some-path"]).To(Equal(append([]byte("BITSRAW1"), content...)))
+		Expect(contentOf("some-path")).To(Equal(content))
+
+		Expect(blobstore.Put("empty", bytes.NewReader(nil))).To(Succeed())
+		Expect(delegate.Entries["empty"]).To(Equal([]byte("BITSRAW1")))
+		Expect(contentOf("empty")).To(BeEmpty())
+	})
+
+	It("does not mistake uncompressed blobs starting like a header for compressed ones", func() {
+		content := []byte("BITSGZIP")
+
+		Expect(blobstore.Put("some-path", bytes.NewReader(content))).To(Succeed())
+
+		Expect(contentOf("some-path")).To(Equal(content))
+	})
+
+	It("reads blobs stored before compression was enabled", func() {
+		delegate.Entries["legacy"] = []byte("legacy content")
+		delegate.Entries["short"] = []byte("BITS")
+
+		Expect(contentOf("legacy")).To(Equal([]byte("legacy content")))
+		Expect(contentOf("short")).To(Equal([]byte("BITS")))
+	})
+})
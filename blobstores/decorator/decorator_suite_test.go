@@ -0,0 +1,15 @@
+package decorator_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/petergtz/pegomock"
+)
+
+func TestDecorator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	pegomock.RegisterMockFailHandler(Fail)
+	RunSpecs(t, "Decorator Suite")
+}
@@ -0,0 +1,193 @@
+package decorator
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// bounds the memory used for remembering missing blobs
+const maxMissingEntries = 100000
+
+// DiskCache stores blobs in a local directory and evicts the least recently used ones once their total size
+// exceeds maxSize. It also remembers for negativeTTL which blobs do not exist. One DiskCache can be shared
+// by several decorators.
+type DiskCache struct {
+	directory   string
+	maxSize     int64
+	negativeTTL time.Duration
+	clock       clock.Clock
+
+	mutex   sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	// front is the most recently used entry
+	lru *list.List
+	// expiry per key of blobs known to be missing
+	missing map[string]time.Time
+}
+
+type diskCacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewDiskCache uses a subdirectory of directory, which it empties first, since the index of cached blobs only lives in memory.
+func NewDiskCache(directory string, maxSize int64, negativeTTL time.Duration, clock clock.Clock) *DiskCache {
+	cacheDirectory := filepath.Join(directory, "bits-service-disk-cache")
+	util.PanicOnError(os.RemoveAll(cacheDirectory))
+	util.PanicOnError(os.MkdirAll(cacheDirectory, 0700))
+	return &DiskCache{
+		directory:   cacheDirectory,
+		maxSize:     maxSize,
+		negativeTTL: negativeTTL,
+		clock:       clock,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		missing:     make(map[string]time.Time),
+	}
+}
+
+// open returns nil when key is not cached.
+func (cache *DiskCache) open(key string) *os.File {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, exists := cache.entries[key]
+	if !exists {
+		return nil
+	}
+	file, e := os.Open(cache.filenameFor(key))
+	if e != nil {
+		cache.removeElement(element)
+		return nil
+	}
+	cache.lru.MoveToFront(element)
+	return file
+}
+
+func (cache *DiskCache) contains(key string) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	_, exists := cache.entries[key]
+	return exists
+}
+
+func (cache *DiskCache) createTempFile() (*os.File, error) {
+	return ioutil.TempFile(cache.directory, "download-")
+}
+
+// add takes over tempFilename. Blobs larger than the whole cache are not added. Already opened files stay readable
+// even when their blob gets evicted.
+func (cache *DiskCache) add(key string, tempFilename string, size int64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if size > cache.maxSize {
+		os.Remove(tempFilename)
+		return
+	}
+	if element, exists := cache.entries[key]; exists {
+		cache.removeElement(element)
+	}
+	if e := os.Rename(tempFilename, cache.filenameFor(key)); e != nil {
+		os.Remove(tempFilename)
+		return
+	}
+	cache.entries[key] = cache.lru.PushFront(&diskCacheEntry{key: key, size: size})
+	cache.size += size
+	delete(cache.missing, key)
+
+	for cache.size > cache.maxSize {
+		cache.removeElement(cache.lru.Back())
+	}
+}
+
+func (cache *DiskCache) remove(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, exists := cache.entries[key]; exists {
+		cache.removeElement(element)
+	}
+	delete(cache.missing, key)
+}
+
+func (cache *DiskCache) removeWithPrefix(prefix string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for key, element := range cache.entries {
+		if strings.HasPrefix(key, prefix) {
+			cache.removeElement(element)
+		}
+	}
+	for key := range cache.missing {
+		if strings.HasPrefix(key, prefix) {
+			delete(cache.missing, key)
+		}
+	}
+}
+
+func (cache *DiskCache) removeElement(element *list.Element) {
+	entry := cache.lru.Remove(element).(*diskCacheEntry)
+	delete(cache.entries, entry.key)
+	cache.size -= entry.size
+	os.Remove(cache.filenameFor(entry.key))
+}
+
+func (cache *DiskCache) knownMissing(key string) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	expiry, exists := cache.missing[key]
+	if !exists {
+		return false
+	}
+	if !cache.clock.Now().Before(expiry) {
+		delete(cache.missing, key)
+		return false
+	}
+	return true
+}
+
+func (cache *DiskCache) rememberMissing(key string) {
+	if cache.negativeTTL <= 0 {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if len(cache.missing) >= maxMissingEntries {
+		cache.removeExpiredMissing()
+	}
+	if len(cache.missing) >= maxMissingEntries {
+		cache.missing = make(map[string]time.Time)
+	}
+	cache.missing[key] = cache.clock.Now().Add(cache.negativeTTL)
+}
+
+func (cache *DiskCache) removeExpiredMissing() {
+	now := cache.clock.Now()
+	for key, expiry := range cache.missing {
+		if !now.Before(expiry) {
+			delete(cache.missing, key)
+		}
+	}
+}
+
+// filenameFor avoids any interpretation of key as a file path
+func (cache *DiskCache) filenameFor(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(cache.directory, hex.EncodeToString(hash[:]))
+}
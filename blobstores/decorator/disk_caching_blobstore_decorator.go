@@ -0,0 +1,238 @@
+package decorator
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// Only blobs whose path ends with a SHA-1 or SHA-256 digest of their content are cached, e.g. app stash entries
+// and droplets. Since their content never changes, cached blobs cannot become stale.
+var contentAddressedPath = regexp.MustCompile(`(^|/)([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// DiskCachingBlobstoreDecorator reads content-addressed blobs through a DiskCache, so that hot blobs are not fetched
+// from a remote blobstore again and again. Cached blobs are verified against their digest before being served.
+type DiskCachingBlobstoreDecorator struct {
+	delegate       bitsgo.Blobstore
+	cache          *DiskCache
+	metricsService bitsgo.MetricsService
+	resourceType   string
+}
+
+func ForBlobstoreWithDiskCache(delegate bitsgo.Blobstore, cache *DiskCache, metricsService bitsgo.MetricsService, resourceType string) *DiskCachingBlobstoreDecorator {
+	return &DiskCachingBlobstoreDecorator{delegate, cache, metricsService, resourceType}
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &DiskCachingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.cache, decorator.metricsService, decorator.resourceType}
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) Exists(path string) (bool, error) {
+	if !contentAddressedPath.MatchString(path) {
+		return decorator.delegate.Exists(path)
+	}
+	if decorator.cache.contains(decorator.keyFor(path)) {
+		decorator.countLookup("exists", "hit")
+		return true, nil
+	}
+	if decorator.cache.knownMissing(decorator.keyFor(path)) {
+		decorator.countLookup("exists", "negative_hit")
+		return false, nil
+	}
+	decorator.countLookup("exists", "miss")
+	exists, e := decorator.delegate.Exists(path)
+	if e == nil && !exists {
+		decorator.cache.rememberMissing(decorator.keyFor(path))
+	}
+	return exists, e
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	return decorator.delegate.HeadOrRedirectAsGet(path)
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	if !contentAddressedPath.MatchString(path) {
+		return decorator.delegate.Get(path)
+	}
+	if body := decorator.cachedBodyFor(path); body != nil {
+		decorator.countLookup("get", "hit")
+		return body, nil
+	}
+	decorator.countLookup("get", "miss")
+	body, e := decorator.delegate.Get(path)
+	if e != nil {
+		if _, notFound := e.(*bitsgo.NotFoundError); notFound {
+			decorator.cache.rememberMissing(decorator.keyFor(path))
+		}
+		return nil, e
+	}
+	return decorator.addToCache(path, body)
+}
+
+// GetOrRedirect only serves cached blobs. Other blobs are not cached, since redirected clients fetch them directly from the blobstore.
+func (decorator *DiskCachingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	if contentAddressedPath.MatchString(path) {
+		if body := decorator.cachedBodyFor(path); body != nil {
+			decorator.countLookup("get_or_redirect", "hit")
+			return body, "", nil
+		}
+		decorator.countLookup("get_or_redirect", "miss")
+	}
+	return decorator.delegate.GetOrRedirect(path)
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	e := decorator.delegate.Put(path, src)
+	decorator.cache.remove(decorator.keyFor(path))
+	return e
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) Copy(src, dest string) error {
+	e := decorator.delegate.Copy(src, dest)
+	decorator.cache.remove(decorator.keyFor(dest))
+	return e
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) Delete(path string) error {
+	e := decorator.delegate.Delete(path)
+	decorator.cache.remove(decorator.keyFor(path))
+	return e
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) DeleteDir(prefix string) error {
+	e := decorator.delegate.DeleteDir(prefix)
+	decorator.cache.removeWithPrefix(decorator.keyFor(prefix))
+	return e
+}
+
+// keyFor allows to share one DiskCache between resource types
+func (decorator *DiskCachingBlobstoreDecorator) keyFor(path string) string {
+	return decorator.resourceType + "/" + path
+}
+
+// cachedBodyFor returns nil when path is not cached or the cached blob is corrupted.
+func (decorator *DiskCachingBlobstoreDecorator) cachedBodyFor(path string) io.ReadCloser {
+	file := decorator.cache.open(decorator.keyFor(path))
+	if file == nil {
+		return nil
+	}
+	if valid, e := contentMatchesDigestIn(path, file); e != nil || !valid {
+		file.Close()
+		logger.Log.Errorw("Cached blob is corrupted. Removing it from disk cache.", "resource-type", decorator.resourceType, "path", path, "error", e)
+		decorator.countLookup("get", "corrupted")
+		decorator.cache.remove(decorator.keyFor(path))
+		return nil
+	}
+	return file
+}
+
+// addToCache returns body, copying it to disk while it is read. Only blobs which were read completely and match their
+// digest are added to the cache.
+func (decorator *DiskCachingBlobstoreDecorator) addToCache(path string, body io.ReadCloser) (io.ReadCloser, error) {
+	tempFile, e := decorator.cache.createTempFile()
+	if e != nil {
+		logger.Log.Errorw("Could not create file in disk cache. Not caching blob.", "resource-type", decorator.resourceType, "path", path, "error", e)
+		return body, nil
+	}
+	return &cachingReadCloser{ReadCloser: body, decorator: decorator, path: path, tempFile: tempFile, hash: hashFor(path)}, nil
+}
+
+type cachingReadCloser struct {
+	io.ReadCloser
+	decorator *DiskCachingBlobstoreDecorator
+	path      string
+	// nil once the blob was added to the cache or discarded
+	tempFile *os.File
+	hash     hash.Hash
+	size     int64
+}
+
+func (reader *cachingReadCloser) Read(p []byte) (int, error) {
+	n, e := reader.ReadCloser.Read(p)
+	if reader.tempFile != nil && n > 0 {
+		if _, writeError := reader.tempFile.Write(p[:n]); writeError != nil {
+			logger.Log.Errorw("Could not write to disk cache. Not caching blob.", "resource-type", reader.decorator.resourceType, "path", reader.path, "error", writeError)
+			reader.discard()
+		} else {
+			reader.hash.Write(p[:n])
+			reader.size += int64(n)
+		}
+	}
+	if reader.tempFile != nil && e == io.EOF {
+		reader.addToCache()
+	}
+	return n, e
+}
+
+func (reader *cachingReadCloser) Close() error {
+	if reader.tempFile != nil {
+		reader.discard()
+	}
+	return reader.ReadCloser.Close()
+}
+
+func (reader *cachingReadCloser) addToCache() {
+	e := reader.tempFile.Close()
+	if e != nil {
+		logger.Log.Errorw("Could not write to disk cache. Not caching blob.", "resource-type", reader.decorator.resourceType, "path", reader.path, "error", e)
+		os.Remove(reader.tempFile.Name())
+		reader.tempFile = nil
+		return
+	}
+	if hex.EncodeToString(reader.hash.Sum(nil)) != digestIn(reader.path) {
+		logger.Log.Errorw("Blob does not match its digest. Not caching it.", "resource-type", reader.decorator.resourceType, "path", reader.path)
+		os.Remove(reader.tempFile.Name())
+		reader.tempFile = nil
+		return
+	}
+	reader.decorator.cache.add(reader.decorator.keyFor(reader.path), reader.tempFile.Name(), reader.size)
+	reader.tempFile = nil
+}
+
+func (reader *cachingReadCloser) discard() {
+	reader.tempFile.Close()
+	os.Remove(reader.tempFile.Name())
+	reader.tempFile = nil
+}
+
+func (decorator *DiskCachingBlobstoreDecorator) countLookup(operation string, result string) {
+	decorator.metricsService.SendCounterMetricWithTags(decorator.resourceType+"-disk_cache-lookups", 1, map[string]string{
+		"operation": operation,
+		"result":    result,
+	})
+}
+
+func digestIn(blobPath string) string {
+	return path.Base(blobPath)
+}
+
+func hashFor(blobPath string) hash.Hash {
+	if len(digestIn(blobPath)) == 2*sha1.Size {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// contentMatchesDigestIn leaves file at its beginning.
+func contentMatchesDigestIn(blobPath string, file *os.File) (bool, error) {
+	hash := hashFor(blobPath)
+	_, e := io.Copy(hash, file)
+	if e != nil {
+		return false, e
+	}
+	_, e = file.Seek(0, io.SeekStart)
+	if e != nil {
+		return false, e
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == digestIn(blobPath), nil
+}
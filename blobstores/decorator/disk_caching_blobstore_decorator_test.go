@@ -0,0 +1,178 @@
+package decorator_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/petergtz/pegomock"
+)
+
+var _ = Describe("DiskCachingBlobstoreDecorator", func() {
+	var (
+		tempDir        string
+		delegate       *inmemory.Blobstore
+		metricsService *MockMetricsService
+		mockClock      *clock.Mock
+		blobstore      *DiskCachingBlobstoreDecorator
+		sha1Key        string
+		sha256Key      string
+	)
+
+	BeforeEach(func() {
+		var e error
+		tempDir, e = ioutil.TempDir("", "disk-cache")
+		Expect(e).NotTo(HaveOccurred())
+
+		sha1Sum := sha1.Sum([]byte("app stash entry"))
+		sha1Key = hex.EncodeToString(sha1Sum[:])
+		sha256Sum := sha256.Sum256([]byte("droplet"))
+		sha256Key = "some-guid/" + hex.EncodeToString(sha256Sum[:])
+
+		delegate = inmemory.NewBlobstoreWithEntries(map[string][]byte{
+			sha1Key:        []byte("app stash entry"),
+			sha256Key:      []byte("droplet"),
+			"not-a-digest": []byte("some content"),
+		})
+		metricsService = NewMockMetricsService()
+		mockClock = clock.NewMock()
+		blobstore = ForBlobstoreWithDiskCache(delegate, NewDiskCache(tempDir, 1024, 30*time.Second, mockClock), metricsService, "droplets")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	contentOf := func(key string) string {
+		body, e := blobstore.Get(key)
+		Expect(e).NotTo(HaveOccurred())
+		defer body.Close()
+		content, e := ioutil.ReadAll(body)
+		Expect(e).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	cachedFiles := func() []string {
+		files, e := filepath.Glob(filepath.Join(tempDir, "bits-service-disk-cache", "*"))
+		Expect(e).NotTo(HaveOccurred())
+		return files
+	}
+
+	It("serves content-addressed blobs from disk after the first Get", func() {
+		Expect(contentOf(sha1Key)).To(Equal("app stash entry"))
+		Expect(contentOf(sha256Key)).To(Equal("droplet"))
+
+		delete(delegate.Entries, sha1Key)
+		delete(delegate.Entries, sha256Key)
+
+		Expect(contentOf(sha1Key)).To(Equal("app stash entry"))
+		Expect(contentOf(sha256Key)).To(Equal("droplet"))
+		Expect(blobstore.Exists(sha1Key)).To(BeTrue())
+
+		body, redirectLocation, e := blobstore.GetOrRedirect(sha256Key)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(redirectLocation).To(BeEmpty())
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("droplet")))
+
+		metricsService.VerifyWasCalled(pegomock.Times(2)).SendCounterMetricWithTags("droplets-disk_cache-lookups", 1, map[string]string{"operation": "get", "result": "miss"})
+		metricsService.VerifyWasCalled(pegomock.Times(2)).SendCounterMetricWithTags("droplets-disk_cache-lookups", 1, map[string]string{"operation": "get", "result": "hit"})
+		metricsService.VerifyWasCalledOnce().SendCounterMetricWithTags("droplets-disk_cache-lookups", 1, map[string]string{"operation": "exists", "result": "hit"})
+	})
+
+	It("does not cache blobs whose path is not a digest", func() {
+		Expect(contentOf("not-a-digest")).To(Equal("some content"))
+		Expect(cachedFiles()).To(BeEmpty())
+	})
+
+	It("does not cache blobs which do not match their digest", func() {
+		delegate.Entries[sha1Key] = []byte("tampered")
+
+		Expect(contentOf(sha1Key)).To(Equal("tampered"))
+		Expect(cachedFiles()).To(BeEmpty())
+	})
+
+	It("only caches blobs which were read completely", func() {
+		body, e := blobstore.Get(sha1Key)
+		Expect(e).NotTo(HaveOccurred())
+		buffer := make([]byte, 3)
+		_, e = body.Read(buffer)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(string(buffer)).To(Equal("app"))
+		Expect(body.Close()).To(Succeed())
+
+		Expect(cachedFiles()).To(BeEmpty())
+
+		Expect(contentOf(sha1Key)).To(Equal("app stash entry"))
+		Expect(cachedFiles()).To(HaveLen(1))
+	})
+
+	It("removes corrupted blobs from the cache and fetches them again", func() {
+		Expect(contentOf(sha1Key)).To(Equal("app stash entry"))
+		Expect(cachedFiles()).To(HaveLen(1))
+		Expect(ioutil.WriteFile(cachedFiles()[0], []byte("corrupted"), 0600)).To(Succeed())
+
+		Expect(contentOf(sha1Key)).To(Equal("app stash entry"))
+
+		metricsService.VerifyWasCalledOnce().SendCounterMetricWithTags("droplets-disk_cache-lookups", 1, map[string]string{"operation": "get", "result": "corrupted"})
+		metricsService.VerifyWasCalled(pegomock.Times(2)).SendCounterMetricWithTags("droplets-disk_cache-lookups", 1, map[string]string{"operation": "get", "result": "miss"})
+	})
+
+	It("evicts the least recently used blobs when exceeding its size", func() {
+		keys := make([]string, 5)
+		for i := range keys {
+			content := bytes.Repeat([]byte{byte('a' + i)}, 300)
+			sum := sha1.Sum(content)
+			keys[i] = hex.EncodeToString(sum[:])
+			delegate.Entries[keys[i]] = content
+		}
+		contentOf(keys[0])
+		contentOf(keys[1])
+		contentOf(keys[2])
+		contentOf(keys[0])
+		contentOf(keys[3])
+
+		Expect(cachedFiles()).To(HaveLen(3))
+		for _, key := range keys {
+			delete(delegate.Entries, key)
+		}
+		Expect(blobstore.Exists(keys[0])).To(BeTrue())
+		Expect(blobstore.Exists(keys[1])).To(BeFalse())
+		Expect(blobstore.Exists(keys[2])).To(BeTrue())
+		Expect(blobstore.Exists(keys[3])).To(BeTrue())
+	})
+
+	It("remembers missing blobs for the negative TTL", func() {
+		delete(delegate.Entries, sha1Key)
+		Expect(blobstore.Exists(sha1Key)).To(BeFalse())
+
+		delegate.Entries[sha1Key] = []byte("app stash entry")
+		Expect(blobstore.Exists(sha1Key)).To(BeFalse())
+
+		mockClock.Add(30 * time.Second)
+		Expect(blobstore.Exists(sha1Key)).To(BeTrue())
+
+		metricsService.VerifyWasCalledOnce().SendCounterMetricWithTags("droplets-disk_cache-lookups", 1, map[string]string{"operation": "exists", "result": "negative_hit"})
+	})
+
+	It("forgets blobs which are overwritten or deleted", func() {
+		delete(delegate.Entries, sha1Key)
+		Expect(blobstore.Exists(sha1Key)).To(BeFalse())
+		Expect(blobstore.Put(sha1Key, bytes.NewReader([]byte("app stash entry")))).To(Succeed())
+		Expect(blobstore.Exists(sha1Key)).To(BeTrue())
+
+		Expect(contentOf(sha256Key)).To(Equal("droplet"))
+		Expect(blobstore.DeleteDir("some-guid")).To(Succeed())
+		Expect(cachedFiles()).To(BeEmpty())
+		Expect(blobstore.Exists(sha256Key)).To(BeFalse())
+	})
+})
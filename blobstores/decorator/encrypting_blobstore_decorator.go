@@ -0,0 +1,202 @@
+package decorator
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// EncryptingBlobstoreDecorator encrypts blobs before they reach delegate. It never redirects, because clients
+// could not decrypt the blobs they get redirected to. Blobs encrypted with a key other than the active one are
+// re-encrypted when they are read.
+type EncryptingBlobstoreDecorator struct {
+	delegate bitsgo.Blobstore
+	keyring  *EncryptionKeyring
+	// allows to enable encryption for blobstores which already contain blobs
+	allowUnencryptedBlobs bool
+	// optional. While it is enabled or resourceType is read-only, blobs are not re-encrypted
+	maintenanceMode *bitsgo.MaintenanceMode
+	resourceType    string
+	// serialize re-encryption with changes to the same path, so that it never writes back a replaced or deleted blob
+	locks *pathLocks
+}
+
+func ForBlobstoreWithEncryption(delegate bitsgo.Blobstore, keyring *EncryptionKeyring, allowUnencryptedBlobs bool) *EncryptingBlobstoreDecorator {
+	return &EncryptingBlobstoreDecorator{delegate: delegate, keyring: keyring, allowUnencryptedBlobs: allowUnencryptedBlobs, locks: newPathLocks()}
+}
+
+// WithMaintenanceMode makes reads leave blobs encrypted with older keys as they are while mode is enabled or
+// resourceType is read-only, since re-encrypting them would write to the blobstore.
+func (decorator *EncryptingBlobstoreDecorator) WithMaintenanceMode(mode *bitsgo.MaintenanceMode, resourceType string) *EncryptingBlobstoreDecorator {
+	decorator.maintenanceMode = mode
+	decorator.resourceType = resourceType
+	return decorator
+}
+
+func (decorator *EncryptingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	result := *decorator
+	result.delegate = bitsgo.BlobstoreWithContext(ctx, decorator.delegate)
+	return &result
+}
+
+func (decorator *EncryptingBlobstoreDecorator) Exists(path string) (bool, error) {
+	return decorator.delegate.Exists(path)
+}
+
+func (decorator *EncryptingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	return headWithoutRedirect(decorator.delegate, path)
+}
+
+func (decorator *EncryptingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	body, e := decorator.Get(path)
+	return body, "", e
+}
+
+func (decorator *EncryptingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	chunks, body, keyID, rawDataKey, e := decorator.open(path)
+	if e != nil {
+		return nil, e
+	}
+	if rawDataKey == nil {
+		return &readerWithCloser{chunks, body}, nil
+	}
+	if keyID != decorator.keyring.activeKeyID && decorator.writable() {
+		body.Close()
+		return decorator.reencrypt(path)
+	}
+	return newDecryptingReader(chunks, body, rawDataKey), nil
+}
+
+// open reads the envelope header of the blob at path, leaving chunks at the first chunk. rawDataKey is nil for
+// unencrypted blobs, and chunks at their start.
+func (decorator *EncryptingBlobstoreDecorator) open(path string) (chunks *bufio.Reader, body io.ReadCloser, keyID string, rawDataKey []byte, e error) {
+	body, e = decorator.delegate.Get(path)
+	if e != nil {
+		return nil, nil, "", nil, e
+	}
+	chunks = bufio.NewReaderSize(body, encryptionChunkSize)
+	if !isEnvelope(chunks) {
+		if decorator.allowUnencryptedBlobs {
+			return chunks, body, "", nil, nil
+		}
+		body.Close()
+		return nil, nil, "", nil, errors.Errorf("Blob %v is not encrypted", path)
+	}
+	keyID, rawDataKey, e = decorator.keyring.readEnvelopeHeader(chunks)
+	if e != nil {
+		body.Close()
+		return nil, nil, "", nil, errors.Wrapf(e, "Could not decrypt blob %v", path)
+	}
+	return chunks, body, keyID, rawDataKey, nil
+}
+
+// reencrypt wraps the data key with the active key and stores the blob with the new header. The chunks stay as they are.
+// The blob is read again while holding the lock for path, because it might have been replaced since it was first read.
+func (decorator *EncryptingBlobstoreDecorator) reencrypt(path string) (io.ReadCloser, error) {
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	chunks, body, keyID, rawDataKey, e := decorator.open(path)
+	if e != nil {
+		return nil, e
+	}
+	if rawDataKey == nil {
+		return &readerWithCloser{chunks, body}, nil
+	}
+	if keyID == decorator.keyring.activeKeyID {
+		return newDecryptingReader(chunks, body, rawDataKey), nil
+	}
+	defer body.Close()
+
+	tempFile, e := ioutil.TempFile("", "bits-reencrypt")
+	if e != nil {
+		return nil, e
+	}
+	// on Unix, the open file remains readable
+	defer os.Remove(tempFile.Name())
+
+	header := decorator.keyring.headerFor(rawDataKey)
+	_, e = tempFile.Write(header)
+	if e == nil {
+		_, e = io.Copy(tempFile, chunks)
+	}
+	if e == nil {
+		_, e = tempFile.Seek(0, io.SeekStart)
+	}
+	if e != nil {
+		tempFile.Close()
+		return nil, e
+	}
+
+	e = decorator.delegate.Put(path, tempFile)
+	if e != nil {
+		// the blob is still readable with the old key, so serve it anyway
+		logger.Log.Errorw("Could not re-encrypt blob with active key", "path", path, "key-id", keyID, "error", e)
+	} else {
+		logger.Log.Infow("Re-encrypted blob with active key", "path", path, "old-key-id", keyID, "active-key-id", decorator.keyring.activeKeyID)
+	}
+
+	_, e = tempFile.Seek(int64(len(header)), io.SeekStart)
+	if e != nil {
+		tempFile.Close()
+		return nil, e
+	}
+	return newDecryptingReader(bufio.NewReaderSize(tempFile, encryptionChunkSize), tempFile, rawDataKey), nil
+}
+
+func (decorator *EncryptingBlobstoreDecorator) writable() bool {
+	return decorator.maintenanceMode == nil || decorator.maintenanceMode.CheckWritableFor(decorator.resourceType) == nil
+}
+
+func (decorator *EncryptingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	header, dataKey := decorator.keyring.newEnvelope()
+	encryptedSrc, e := newEncryptingReader(header, dataKey, src)
+	if e != nil {
+		return e
+	}
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	return decorator.delegate.Put(path, encryptedSrc)
+}
+
+func (decorator *EncryptingBlobstoreDecorator) Copy(src, dest string) error {
+	unlock := decorator.locks.lock(dest)
+	defer unlock()
+
+	return decorator.delegate.Copy(src, dest)
+}
+
+func (decorator *EncryptingBlobstoreDecorator) Delete(path string) error {
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	return decorator.delegate.Delete(path)
+}
+
+func (decorator *EncryptingBlobstoreDecorator) DeleteDir(prefix string) error {
+	return decorator.delegate.DeleteDir(prefix)
+}
+
+// headWithoutRedirect is for decorators which transform blobs, so that clients cannot be redirected to the delegate.
+func headWithoutRedirect(delegate bitsgo.Blobstore, path string) (redirectLocation string, err error) {
+	exists, e := delegate.Exists(path)
+	if e != nil {
+		return "", e
+	}
+	if !exists {
+		return "", bitsgo.NewNotFoundErrorWithKey(path)
+	}
+	return "", nil
+}
+
+type readerWithCloser struct {
+	io.Reader
+	io.Closer
+}
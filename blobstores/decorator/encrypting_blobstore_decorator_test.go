@@ -0,0 +1,177 @@
+package decorator_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EncryptingBlobstoreDecorator", func() {
+	var (
+		key1     = bytes.Repeat([]byte{1}, 32)
+		key2     = bytes.Repeat([]byte{2}, 32)
+		delegate *inmemory.Blobstore
+	)
+
+	BeforeEach(func() {
+		delegate = inmemory.NewBlobstore()
+	})
+
+	contentOf := func(blobstore *EncryptingBlobstoreDecorator, path string) ([]byte, error) {
+		body, e := blobstore.Get(path)
+		if e != nil {
+			return nil, e
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	}
+
+	It("stores blobs encrypted and decrypts them on read", func() {
+		blobstore := ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false)
+
+		for _, size := range []int{0, 1, 64 * 1024, 64*1024 + 1, 3*64*1024 + 17} {
+			content := make([]byte, size)
+			rand.Read(content)
+
+			Expect(blobstore.Put("some-path", bytes.NewReader(content))).To(Succeed())
+
+			Expect(delegate.Entries["some-path"]).To(HavePrefix("BITSENC1"))
+			// short plaintexts may well occur in the ciphertext by chance
+			if size >= 64 {
+				Expect(bytes.Contains(delegate.Entries["some-path"], content)).To(BeFalse())
+			}
+			Expect(contentOf(blobstore, "some-path")).To(Equal(content))
+		}
+	})
+
+	It("never redirects", func() {
+		blobstore := ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false)
+		Expect(blobstore.Put("some-path", bytes.NewReader([]byte("content")))).To(Succeed())
+
+		body, redirectLocation, e := blobstore.GetOrRedirect("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(redirectLocation).To(BeEmpty())
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("content")))
+
+		redirectLocation, e = blobstore.HeadOrRedirectAsGet("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(redirectLocation).To(BeEmpty())
+
+		_, e = blobstore.HeadOrRedirectAsGet("non-existing-path")
+		Expect(e).To(MatchError(ContainSubstring("Not found")))
+	})
+
+	It("re-encrypts blobs with the active key when reading them", func() {
+		content := make([]byte, 100*1024)
+		rand.Read(content)
+		Expect(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false).
+			Put("some-path", bytes.NewReader(content))).To(Succeed())
+
+		rotatedBlobstore := ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1, "key-2": key2}, "key-2"), false)
+		Expect(contentOf(rotatedBlobstore, "some-path")).To(Equal(content))
+
+		Expect(contentOf(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-2": key2}, "key-2"), false), "some-path")).
+			To(Equal(content))
+	})
+
+	It("does not re-encrypt blobs while maintenance mode is enabled", func() {
+		Expect(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false).
+			Put("some-path", bytes.NewReader([]byte("content")))).To(Succeed())
+		stored := delegate.Entries["some-path"]
+
+		maintenanceMode := bitsgo.NewMaintenanceMode(clock.NewMock())
+		maintenanceMode.Enable("migrating")
+		rotatedBlobstore := ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1, "key-2": key2}, "key-2"), false).
+			WithMaintenanceMode(maintenanceMode, "droplets")
+		Expect(contentOf(rotatedBlobstore, "some-path")).To(Equal([]byte("content")))
+		Expect(delegate.Entries["some-path"]).To(Equal(stored))
+
+		maintenanceMode.Disable()
+		maintenanceMode.EnableFor("droplets", "migrating droplets")
+		Expect(contentOf(rotatedBlobstore, "some-path")).To(Equal([]byte("content")))
+		Expect(delegate.Entries["some-path"]).To(Equal(stored))
+
+		maintenanceMode.DisableFor("droplets")
+		Expect(contentOf(rotatedBlobstore, "some-path")).To(Equal([]byte("content")))
+		Expect(delegate.Entries["some-path"]).NotTo(Equal(stored))
+	})
+
+	It("does not write back blobs which were replaced or deleted while being re-encrypted", func() {
+		blobstore := ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false)
+		Expect(blobstore.Put("replaced", bytes.NewReader([]byte("old content")))).To(Succeed())
+		Expect(blobstore.Put("deleted", bytes.NewReader([]byte("old content")))).To(Succeed())
+
+		interleaving := &interleavingBlobstore{Blobstore: delegate}
+		rotatedBlobstore := ForBlobstoreWithEncryption(interleaving, NewEncryptionKeyring(map[string][]byte{"key-1": key1, "key-2": key2}, "key-2"), false)
+
+		interleaving.afterGet = func() {
+			Expect(rotatedBlobstore.Put("replaced", bytes.NewReader([]byte("new content")))).To(Succeed())
+		}
+		Expect(contentOf(rotatedBlobstore, "replaced")).To(Equal([]byte("new content")))
+		Expect(contentOf(rotatedBlobstore, "replaced")).To(Equal([]byte("new content")))
+
+		interleaving.afterGet = func() { Expect(rotatedBlobstore.Delete("deleted")).To(Succeed()) }
+		_, e := contentOf(rotatedBlobstore, "deleted")
+		Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+		Expect(delegate.Exists("deleted")).To(BeFalse())
+	})
+
+	It("rejects blobs encrypted with unknown keys", func() {
+		Expect(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false).
+			Put("some-path", bytes.NewReader([]byte("content")))).To(Succeed())
+
+		_, e := contentOf(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-2": key2}, "key-2"), false), "some-path")
+		Expect(e).To(MatchError(ContainSubstring("unknown key key-1")))
+	})
+
+	It("detects tampered and truncated blobs", func() {
+		blobstore := ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false)
+		content := make([]byte, 2*64*1024)
+		rand.Read(content)
+		Expect(blobstore.Put("some-path", bytes.NewReader(content))).To(Succeed())
+		encrypted := delegate.Entries["some-path"]
+
+		delegate.Entries["some-path"] = append([]byte{}, encrypted...)
+		delegate.Entries["some-path"][len(encrypted)-1] ^= 1
+		_, e := contentOf(blobstore, "some-path")
+		Expect(e).To(MatchError(ContainSubstring("corrupted")))
+
+		// cut off the second chunk, including its authentication tag
+		delegate.Entries["some-path"] = encrypted[:len(encrypted)-64*1024-16]
+		_, e = contentOf(blobstore, "some-path")
+		Expect(e).To(MatchError(ContainSubstring("truncated")))
+	})
+
+	It("only reads unencrypted blobs when allowed", func() {
+		delegate.Entries["some-path"] = []byte("legacy content")
+
+		_, e := contentOf(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), false), "some-path")
+		Expect(e).To(MatchError(ContainSubstring("not encrypted")))
+
+		Expect(contentOf(ForBlobstoreWithEncryption(delegate, NewEncryptionKeyring(map[string][]byte{"key-1": key1}, "key-1"), true), "some-path")).
+			To(Equal([]byte("legacy content")))
+	})
+})
+
+// interleavingBlobstore calls afterGet once, right after the next Get, to change a blob while it is being read.
+type interleavingBlobstore struct {
+	*inmemory.Blobstore
+	afterGet func()
+}
+
+func (blobstore *interleavingBlobstore) Get(path string) (io.ReadCloser, error) {
+	body, e := blobstore.Blobstore.Get(path)
+	if afterGet := blobstore.afterGet; afterGet != nil {
+		blobstore.afterGet = nil
+		afterGet()
+	}
+	return body, e
+}
@@ -0,0 +1,290 @@
+package decorator
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// Encrypted blobs start with a header:
+//
+//	magic | key ID length (1 byte) | key ID | wrapped data key length (1 byte) | wrapped data key
+//
+// followed by the blob content, split into chunks of encryptionChunkSize bytes, each sealed separately with the
+// data key. Chunk nonces are derived from the chunk index and mark the last chunk, so that reordered or truncated
+// chunks are detected. As data keys are unique per blob, rotating master keys only requires rewriting the header.
+const (
+	envelopeMagic       = "BITSENC1"
+	encryptionChunkSize = 64 * 1024
+	dataKeySize         = 32
+)
+
+// EncryptionKeyring holds the master keys data keys are wrapped with. New blobs are always encrypted with the active key.
+type EncryptionKeyring struct {
+	masterKeys  map[string]cipher.AEAD
+	activeKeyID string
+}
+
+// NewEncryptionKeyring expects 256 bit keys.
+func NewEncryptionKeyring(keys map[string][]byte, activeKeyID string) *EncryptionKeyring {
+	masterKeys := make(map[string]cipher.AEAD, len(keys))
+	for keyID, key := range keys {
+		if len(key) != dataKeySize {
+			panic("Encryption key " + keyID + " must be 256 bits long")
+		}
+		masterKeys[keyID] = newAESGCM(key)
+	}
+	if _, exists := masterKeys[activeKeyID]; !exists {
+		panic("Active encryption key " + activeKeyID + " is not among the encryption keys")
+	}
+	return &EncryptionKeyring{masterKeys: masterKeys, activeKeyID: activeKeyID}
+}
+
+func newAESGCM(key []byte) cipher.AEAD {
+	block, e := aes.NewCipher(key)
+	util.PanicOnError(e)
+	aead, e := cipher.NewGCM(block)
+	util.PanicOnError(e)
+	return aead
+}
+
+// newEnvelope returns the header and the data key for a new blob.
+func (keyring *EncryptionKeyring) newEnvelope() (header []byte, dataKey cipher.AEAD) {
+	rawDataKey := make([]byte, dataKeySize)
+	_, e := rand.Read(rawDataKey)
+	util.PanicOnError(e)
+	return keyring.headerFor(rawDataKey), newAESGCM(rawDataKey)
+}
+
+// headerFor wraps rawDataKey with the active key.
+func (keyring *EncryptionKeyring) headerFor(rawDataKey []byte) []byte {
+	masterKey := keyring.masterKeys[keyring.activeKeyID]
+	nonce := make([]byte, masterKey.NonceSize())
+	_, e := rand.Read(nonce)
+	util.PanicOnError(e)
+	wrappedDataKey := masterKey.Seal(nonce, nonce, rawDataKey, []byte(keyring.activeKeyID))
+
+	header := append([]byte(envelopeMagic), byte(len(keyring.activeKeyID)))
+	header = append(header, keyring.activeKeyID...)
+	header = append(header, byte(len(wrappedDataKey)))
+	return append(header, wrappedDataKey...)
+}
+
+func isEnvelope(reader *bufio.Reader) bool {
+	magic, _ := reader.Peek(len(envelopeMagic))
+	return string(magic) == envelopeMagic
+}
+
+// readEnvelopeHeader consumes the header from reader and returns the ID of the key used and the unwrapped data key.
+func (keyring *EncryptionKeyring) readEnvelopeHeader(reader *bufio.Reader) (keyID string, rawDataKey []byte, e error) {
+	if _, e = reader.Discard(len(envelopeMagic)); e != nil {
+		return "", nil, errors.Wrap(e, "Could not read encryption header")
+	}
+	rawKeyID, e := readLengthPrefixed(reader)
+	if e != nil {
+		return "", nil, errors.Wrap(e, "Could not read encryption key ID")
+	}
+	wrappedDataKey, e := readLengthPrefixed(reader)
+	if e != nil {
+		return "", nil, errors.Wrap(e, "Could not read data key")
+	}
+	keyID = string(rawKeyID)
+	masterKey, exists := keyring.masterKeys[keyID]
+	if !exists {
+		return "", nil, errors.Errorf("Blob is encrypted with unknown key %v", keyID)
+	}
+	if len(wrappedDataKey) < masterKey.NonceSize() {
+		return "", nil, errors.New("Data key is corrupted")
+	}
+	rawDataKey, e = masterKey.Open(nil, wrappedDataKey[:masterKey.NonceSize()], wrappedDataKey[masterKey.NonceSize():], rawKeyID)
+	if e != nil {
+		return "", nil, errors.Wrap(e, "Could not unwrap data key")
+	}
+	return keyID, rawDataKey, nil
+}
+
+func readLengthPrefixed(reader *bufio.Reader) ([]byte, error) {
+	length, e := reader.ReadByte()
+	if e != nil {
+		return nil, e
+	}
+	value := make([]byte, length)
+	_, e = io.ReadFull(reader, value)
+	return value, e
+}
+
+func chunkNonce(dataKey cipher.AEAD, index int64, last bool) []byte {
+	nonce := make([]byte, dataKey.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], uint64(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encryptingReader encrypts src on the fly. It supports seeking, since blobstore clients seek, e.g. to determine
+// the size of the content or to retry uploads.
+type encryptingReader struct {
+	header        []byte
+	src           io.ReadSeeker
+	plaintextSize int64
+	dataKey       cipher.AEAD
+
+	position   int64
+	chunkIndex int64
+	plaintext  []byte
+	chunk      []byte
+}
+
+func newEncryptingReader(header []byte, dataKey cipher.AEAD, src io.ReadSeeker) (*encryptingReader, error) {
+	plaintextSize, e := src.Seek(0, io.SeekEnd)
+	if e != nil {
+		return nil, e
+	}
+	return &encryptingReader{
+		header:        header,
+		src:           src,
+		plaintextSize: plaintextSize,
+		dataKey:       dataKey,
+		chunkIndex:    -1,
+		plaintext:     make([]byte, encryptionChunkSize),
+	}, nil
+}
+
+func (reader *encryptingReader) numChunks() int64 {
+	// empty blobs still have one chunk, so that truncation to the header is detected
+	if reader.plaintextSize == 0 {
+		return 1
+	}
+	return (reader.plaintextSize + encryptionChunkSize - 1) / encryptionChunkSize
+}
+
+func (reader *encryptingReader) size() int64 {
+	return int64(len(reader.header)) + reader.plaintextSize + reader.numChunks()*int64(reader.dataKey.Overhead())
+}
+
+func (reader *encryptingReader) Read(p []byte) (int, error) {
+	if reader.position >= reader.size() {
+		return 0, io.EOF
+	}
+	if reader.position < int64(len(reader.header)) {
+		n := copy(p, reader.header[reader.position:])
+		reader.position += int64(n)
+		return n, nil
+	}
+	sealedChunkSize := int64(encryptionChunkSize + reader.dataKey.Overhead())
+	offset := reader.position - int64(len(reader.header))
+	index := offset / sealedChunkSize
+	if index != reader.chunkIndex {
+		if e := reader.sealChunk(index); e != nil {
+			return 0, e
+		}
+	}
+	n := copy(p, reader.chunk[offset-index*sealedChunkSize:])
+	reader.position += int64(n)
+	return n, nil
+}
+
+func (reader *encryptingReader) sealChunk(index int64) error {
+	start := index * encryptionChunkSize
+	if _, e := reader.src.Seek(start, io.SeekStart); e != nil {
+		return e
+	}
+	plaintextLength := reader.plaintextSize - start
+	if plaintextLength > encryptionChunkSize {
+		plaintextLength = encryptionChunkSize
+	}
+	if _, e := io.ReadFull(reader.src, reader.plaintext[:plaintextLength]); e != nil {
+		return errors.Wrap(e, "Could not read content to encrypt")
+	}
+	reader.chunk = reader.dataKey.Seal(reader.chunk[:0], chunkNonce(reader.dataKey, index, index == reader.numChunks()-1), reader.plaintext[:plaintextLength], nil)
+	reader.chunkIndex = index
+	return nil
+}
+
+func (reader *encryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.position
+	case io.SeekEnd:
+		offset += reader.size()
+	default:
+		return 0, errors.Errorf("Invalid whence %v", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("Negative position")
+	}
+	reader.position = offset
+	return offset, nil
+}
+
+// decryptingReader expects src to be positioned right after the header.
+type decryptingReader struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	dataKey cipher.AEAD
+
+	chunkIndex int64
+	sealed     []byte
+	plaintext  []byte
+	done       bool
+}
+
+func newDecryptingReader(src *bufio.Reader, closer io.Closer, rawDataKey []byte) *decryptingReader {
+	dataKey := newAESGCM(rawDataKey)
+	return &decryptingReader{
+		src:     src,
+		closer:  closer,
+		dataKey: dataKey,
+		sealed:  make([]byte, encryptionChunkSize+dataKey.Overhead()),
+	}
+}
+
+func (reader *decryptingReader) Read(p []byte) (int, error) {
+	for len(reader.plaintext) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		if e := reader.openNextChunk(); e != nil {
+			return 0, e
+		}
+	}
+	n := copy(p, reader.plaintext)
+	reader.plaintext = reader.plaintext[n:]
+	return n, nil
+}
+
+func (reader *decryptingReader) openNextChunk() error {
+	n, e := io.ReadFull(reader.src, reader.sealed)
+	last := false
+	switch e {
+	case nil:
+		_, e = reader.src.Peek(1)
+		last = e == io.EOF
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return errors.New("Encrypted blob is truncated")
+	default:
+		return e
+	}
+	plaintext, e := reader.dataKey.Open(reader.sealed[:0], chunkNonce(reader.dataKey, reader.chunkIndex, last), reader.sealed[:n], nil)
+	if e != nil {
+		return errors.New("Encrypted blob is corrupted or truncated")
+	}
+	reader.plaintext = plaintext
+	reader.chunkIndex++
+	reader.done = last
+	return nil
+}
+
+func (reader *decryptingReader) Close() error {
+	return reader.closer.Close()
+}
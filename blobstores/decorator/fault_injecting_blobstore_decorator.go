@@ -0,0 +1,117 @@
+package decorator
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// FaultInjectingBlobstoreDecorator injects the faults of its FaultInjector into calls to its blobstore. Hung calls
+// are released when the request context is done.
+type FaultInjectingBlobstoreDecorator struct {
+	delegate     bitsgo.Blobstore
+	injector     *FaultInjector
+	resourceType string
+	ctx          context.Context
+}
+
+func ForBlobstoreWithFaultInjection(delegate bitsgo.Blobstore, injector *FaultInjector, resourceType string) *FaultInjectingBlobstoreDecorator {
+	return &FaultInjectingBlobstoreDecorator{delegate, injector, resourceType, context.Background()}
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &FaultInjectingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.injector, decorator.resourceType, ctx}
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) inject(operation string) (*bitsgo.FaultRule, error) {
+	rule, changed := decorator.injector.ruleFor(decorator.resourceType, operation)
+	if rule == nil {
+		return nil, nil
+	}
+	return rule, decorator.injector.inject(decorator.ctx, rule, changed, decorator.resourceType, operation)
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) Exists(path string) (bool, error) {
+	_, e := decorator.inject("exists")
+	if bitsgo.IsNotFoundError(e) {
+		return false, nil
+	}
+	if e != nil {
+		return false, e
+	}
+	return decorator.delegate.Exists(path)
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	if _, e := decorator.inject("head_or_redirect"); e != nil {
+		return "", e
+	}
+	return decorator.delegate.HeadOrRedirectAsGet(path)
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	rule, e := decorator.inject("get")
+	if e != nil {
+		return nil, e
+	}
+	body, e = decorator.delegate.Get(path)
+	if e != nil {
+		return nil, e
+	}
+	return decorator.truncated(rule, body, path), nil
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	rule, e := decorator.inject("get_or_redirect")
+	if e != nil {
+		return nil, "", e
+	}
+	body, redirectLocation, e = decorator.delegate.GetOrRedirect(path)
+	if e != nil || body == nil {
+		return body, redirectLocation, e
+	}
+	return decorator.truncated(rule, body, path), redirectLocation, nil
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) truncated(rule *bitsgo.FaultRule, body io.ReadCloser, path string) io.ReadCloser {
+	if rule == nil || decorator.injector.roll() >= rule.TruncateRate {
+		return body
+	}
+	logger.Log.Debugw("Injecting truncated read", "resource-type", decorator.resourceType, "path", path, "after-bytes", rule.TruncateAfterBytes)
+	return &truncatedReadCloser{Reader: io.MultiReader(io.LimitReader(body, rule.TruncateAfterBytes), &failingReader{io.ErrUnexpectedEOF}), Closer: body}
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	if _, e := decorator.inject("put"); e != nil {
+		return e
+	}
+	return decorator.delegate.Put(path, src)
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) Copy(src, dest string) error {
+	if _, e := decorator.inject("copy"); e != nil {
+		return e
+	}
+	return decorator.delegate.Copy(src, dest)
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) Delete(path string) error {
+	if _, e := decorator.inject("delete"); e != nil {
+		return e
+	}
+	return decorator.delegate.Delete(path)
+}
+
+func (decorator *FaultInjectingBlobstoreDecorator) DeleteDir(prefix string) error {
+	if _, e := decorator.inject("delete_dir"); e != nil {
+		return e
+	}
+	return decorator.delegate.DeleteDir(prefix)
+}
+
+type truncatedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,93 @@
+package decorator_test
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FaultInjectingBlobstoreDecorator", func() {
+	var (
+		mockClock *clock.Mock
+		injector  *FaultInjector
+		blobstore *FaultInjectingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		injector = NewFaultInjector(mockClock)
+		blobstore = ForBlobstoreWithFaultInjection(inmemory.NewBlobstoreWithEntries(map[string][]byte{"some-path": []byte("some content")}), injector, "packages")
+	})
+
+	It("injects errors into the operations and resource types of the matching rule", func() {
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{
+			{ResourceType: "droplets", ErrorRate: 1},
+			{Operation: "put", NoSpaceLeftRate: 1},
+			{Operation: "get", NotFoundRate: 1},
+			{Operation: "delete", ErrorRate: 1},
+		})).To(Succeed())
+
+		Expect(blobstore.Put("other-path", strings.NewReader("content"))).To(BeAssignableToTypeOf(&bitsgo.NoSpaceLeftError{}))
+		_, e := blobstore.Get("some-path")
+		Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+		Expect(blobstore.Delete("some-path")).To(MatchError(ContainSubstring("Injected fault in delete of packages blobstore")))
+		Expect(blobstore.Exists("some-path")).To(BeTrue())
+	})
+
+	It("truncates bodies", func() {
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{{Operation: "get", TruncateRate: 1, TruncateAfterBytes: 4}})).To(Succeed())
+
+		body, e := blobstore.Get("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		content, e := ioutil.ReadAll(body)
+		Expect(e).To(Equal(io.ErrUnexpectedEOF))
+		Expect(string(content)).To(Equal("some"))
+	})
+
+	It("delays calls", func() {
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{{LatencyMillis: 2000}})).To(Succeed())
+
+		done := make(chan error)
+		go func() { done <- blobstore.Copy("some-path", "other-path") }()
+
+		Consistently(done).ShouldNot(Receive())
+		Eventually(func() bool {
+			mockClock.Add(time.Second)
+			select {
+			case e := <-done:
+				Expect(e).NotTo(HaveOccurred())
+				return true
+			default:
+				return false
+			}
+		}).Should(BeTrue())
+	})
+
+	It("hangs calls until the rules change", func() {
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{{Operation: "delete_dir", HangRate: 1}})).To(Succeed())
+
+		done := make(chan error)
+		go func() { done <- blobstore.DeleteDir("") }()
+
+		Consistently(done).ShouldNot(Receive())
+		Expect(injector.SetFaultRules(nil)).To(Succeed())
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("rejects invalid rules and keeps the current ones", func() {
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{{Operation: "get", ErrorRate: 0.5}})).To(Succeed())
+
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{{Operation: "list"}})).To(MatchError(ContainSubstring(`unknown operation "list"`)))
+		Expect(injector.SetFaultRules([]bitsgo.FaultRule{{ErrorRate: 0.6, NotFoundRate: 0.6}})).To(MatchError(ContainSubstring("must not add up to more than 1")))
+
+		Expect(injector.FaultRules()).To(Equal([]bitsgo.FaultRule{{Operation: "get", ErrorRate: 0.5}}))
+	})
+})
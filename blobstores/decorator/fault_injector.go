@@ -0,0 +1,135 @@
+package decorator
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// FaultInjector injects faults into the calls of FaultInjectingBlobstoreDecorators according to its rules. Of the
+// rules, the first one matching resource type and operation of a call applies. It must only be used for testing.
+type FaultInjector struct {
+	clock clock.Clock
+
+	mutex sync.RWMutex
+	rules []bitsgo.FaultRule
+	// closed when the rules change, to release hung calls
+	changed chan struct{}
+	random  *rand.Rand
+}
+
+func NewFaultInjector(clock clock.Clock) *FaultInjector {
+	return &FaultInjector{
+		clock:   clock,
+		changed: make(chan struct{}),
+		random:  rand.New(rand.NewSource(clock.Now().UnixNano())),
+	}
+}
+
+func (injector *FaultInjector) FaultRules() []bitsgo.FaultRule {
+	injector.mutex.RLock()
+	defer injector.mutex.RUnlock()
+
+	return append([]bitsgo.FaultRule{}, injector.rules...)
+}
+
+func (injector *FaultInjector) SetFaultRules(rules []bitsgo.FaultRule) error {
+	for i, rule := range rules {
+		e := validateFaultRule(rule)
+		if e != nil {
+			return errors.Wrapf(e, "rule %v", i)
+		}
+	}
+
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	injector.rules = append([]bitsgo.FaultRule{}, rules...)
+	close(injector.changed)
+	injector.changed = make(chan struct{})
+	return nil
+}
+
+func validateFaultRule(rule bitsgo.FaultRule) error {
+	if rule.Operation != "" && !contains(circuitBreakerOperations, rule.Operation) {
+		return errors.Errorf("unknown operation \"%v\"", rule.Operation)
+	}
+	if rule.LatencyMillis < 0 || rule.TruncateAfterBytes < 0 {
+		return errors.New("latency_ms and truncate_after_bytes must not be negative")
+	}
+	for _, rate := range []float64{rule.ErrorRate, rule.NotFoundRate, rule.NoSpaceLeftRate, rule.TruncateRate, rule.HangRate} {
+		if rate < 0 || rate > 1 {
+			return errors.New("rates must be between 0 and 1")
+		}
+	}
+	if rule.ErrorRate+rule.NotFoundRate+rule.NoSpaceLeftRate > 1 {
+		return errors.New("error_rate, not_found_rate and no_space_left_rate must not add up to more than 1")
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFor returns the rule applying to a call, if any, and a channel which is closed when the rules change.
+func (injector *FaultInjector) ruleFor(resourceType, operation string) (*bitsgo.FaultRule, <-chan struct{}) {
+	injector.mutex.RLock()
+	defer injector.mutex.RUnlock()
+
+	for _, rule := range injector.rules {
+		if (rule.ResourceType == "" || rule.ResourceType == resourceType) && (rule.Operation == "" || rule.Operation == operation) {
+			rule := rule
+			return &rule, injector.changed
+		}
+	}
+	return nil, injector.changed
+}
+
+func (injector *FaultInjector) roll() float64 {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+
+	return injector.random.Float64()
+}
+
+// inject delays, hangs or fails a call according to rule. It returns nil when the call should proceed.
+func (injector *FaultInjector) inject(ctx context.Context, rule *bitsgo.FaultRule, changed <-chan struct{}, resourceType, operation string) error {
+	if rule.LatencyMillis > 0 {
+		select {
+		case <-injector.clock.After(time.Duration(rule.LatencyMillis) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if injector.roll() < rule.HangRate {
+		logger.Log.Debugw("Injecting hung call", "resource-type", resourceType, "operation", operation)
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r := injector.roll()
+	switch {
+	case r < rule.ErrorRate:
+		logger.Log.Debugw("Injecting error", "resource-type", resourceType, "operation", operation)
+		return errors.Errorf("Injected fault in %v of %v blobstore", operation, resourceType)
+	case r < rule.ErrorRate+rule.NotFoundRate:
+		return bitsgo.NewNotFoundError()
+	case r < rule.ErrorRate+rule.NotFoundRate+rule.NoSpaceLeftRate:
+		return bitsgo.NewNoSpaceLeftError()
+	}
+	return nil
+}
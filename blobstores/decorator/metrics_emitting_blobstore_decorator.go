@@ -1,6 +1,7 @@
 package decorator
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -17,29 +18,57 @@ func ForBlobstoreWithMetricsEmitter(delegate bitsgo.Blobstore, metricsService bi
 	return &MetricsEmittingBlobstoreDecorator{delegate, metricsService, resourceType}
 }
 
+func (decorator *MetricsEmittingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &MetricsEmittingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.metricsService, decorator.resourceType}
+}
+
 func (decorator *MetricsEmittingBlobstoreDecorator) Exists(path string) (bool, error) {
 	startTime := time.Now()
 	exists, e := decorator.delegate.Exists(path)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-exists_in_blobstore-time", time.Since(startTime))
+	decorator.countError("exists", e)
 	return exists, e
 }
 
 func (decorator *MetricsEmittingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
-	return decorator.delegate.HeadOrRedirectAsGet(path)
+	startTime := time.Now()
+	redirectLocation, e := decorator.delegate.HeadOrRedirectAsGet(path)
+	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-head_or_redirect_in_blobstore-time", time.Since(startTime))
+	decorator.countError("head_or_redirect", e)
+	return redirectLocation, e
 }
 
 func (decorator *MetricsEmittingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
-	return decorator.delegate.Get(path)
+	startTime := time.Now()
+	body, e := decorator.delegate.Get(path)
+	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-get_from_blobstore-time", time.Since(startTime))
+	decorator.countError("get", e)
+	if e != nil {
+		return nil, e
+	}
+	return decorator.byteCounting(body, "get"), nil
 }
 
 func (decorator *MetricsEmittingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	return decorator.delegate.GetOrRedirect(path)
+	startTime := time.Now()
+	body, redirectLocation, e := decorator.delegate.GetOrRedirect(path)
+	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-get_or_redirect_from_blobstore-time", time.Since(startTime))
+	decorator.countError("get_or_redirect", e)
+	if e != nil || body == nil {
+		return body, redirectLocation, e
+	}
+	return decorator.byteCounting(body, "get_or_redirect"), redirectLocation, nil
 }
 
 func (decorator *MetricsEmittingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	size, sizeErr := remainingSizeOf(src)
 	startTime := time.Now()
 	e := decorator.delegate.Put(path, src)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-cp_to_blobstore-time", time.Since(startTime))
+	decorator.countError("put", e)
+	if e == nil && sizeErr == nil {
+		decorator.metricsService.SendCounterMetric(decorator.resourceType+"-cp_to_blobstore-bytes", size)
+	}
 	return e
 }
 
@@ -47,6 +76,7 @@ func (decorator *MetricsEmittingBlobstoreDecorator) Copy(src, dest string) error
 	startTime := time.Now()
 	e := decorator.delegate.Copy(src, dest)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-copy_in_blobstore-time", time.Since(startTime))
+	decorator.countError("copy", e)
 	return e
 }
 
@@ -54,6 +84,7 @@ func (decorator *MetricsEmittingBlobstoreDecorator) Delete(path string) error {
 	startTime := time.Now()
 	e := decorator.delegate.Delete(path)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-delete_from_blobstore-time", time.Since(startTime))
+	decorator.countError("delete", e)
 	return e
 }
 
@@ -61,5 +92,65 @@ func (decorator *MetricsEmittingBlobstoreDecorator) DeleteDir(prefix string) err
 	startTime := time.Now()
 	e := decorator.delegate.DeleteDir(prefix)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-delete_dir_from_blobstore-time", time.Since(startTime))
+	decorator.countError("delete_dir", e)
+	return e
+}
+
+func (decorator *MetricsEmittingBlobstoreDecorator) countError(operation string, e error) {
+	if e == nil {
+		return
+	}
+	decorator.metricsService.SendCounterMetricWithTags(decorator.resourceType+"-blobstore-errors", 1, map[string]string{
+		"operation":  operation,
+		"error_type": bitsgo.ErrorTypeOf(e),
+	})
+}
+
+// remainingSizeOf determines how many bytes Put is going to read from src, without consuming it.
+func remainingSizeOf(src io.ReadSeeker) (int64, error) {
+	current, e := src.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return 0, e
+	}
+	end, e := src.Seek(0, io.SeekEnd)
+	if e != nil {
+		return 0, e
+	}
+	_, e = src.Seek(current, io.SeekStart)
+	if e != nil {
+		return 0, e
+	}
+	return end - current, nil
+}
+
+func (decorator *MetricsEmittingBlobstoreDecorator) byteCounting(body io.ReadCloser, operation string) io.ReadCloser {
+	return &byteCountingReadCloser{
+		ReadCloser: body,
+		onClose: func(bytesRead int64) {
+			decorator.metricsService.SendCounterMetric(decorator.resourceType+"-"+operation+"_from_blobstore-bytes", bytesRead)
+		},
+	}
+}
+
+// byteCountingReadCloser reports the number of bytes actually read once the body gets closed.
+type byteCountingReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+	onClose   func(bytesRead int64)
+	closed    bool
+}
+
+func (r *byteCountingReadCloser) Read(p []byte) (int, error) {
+	n, e := r.ReadCloser.Read(p)
+	r.bytesRead += int64(n)
+	return n, e
+}
+
+func (r *byteCountingReadCloser) Close() error {
+	e := r.ReadCloser.Close()
+	if !r.closed {
+		r.closed = true
+		r.onClose(r.bytesRead)
+	}
 	return e
 }
@@ -0,0 +1,103 @@
+package decorator_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+type recordedMetric struct {
+	name  string
+	value int64
+	tags  map[string]string
+}
+
+// recordingMetricsService records counters and the names of timings, since their durations vary.
+type recordingMetricsService struct {
+	timings  []string
+	counters []recordedMetric
+}
+
+func (metrics *recordingMetricsService) SendTimingMetric(name string, duration time.Duration) {
+	metrics.timings = append(metrics.timings, name)
+}
+
+func (metrics *recordingMetricsService) SendGaugeMetric(name string, value int64) {}
+
+func (metrics *recordingMetricsService) SendCounterMetric(name string, value int64) {
+	metrics.counters = append(metrics.counters, recordedMetric{name, value, nil})
+}
+
+func (metrics *recordingMetricsService) SendTimingMetricWithTags(name string, duration time.Duration, tags map[string]string) {
+	metrics.timings = append(metrics.timings, name)
+}
+
+func (metrics *recordingMetricsService) SendGaugeMetricWithTags(name string, value int64, tags map[string]string) {
+}
+
+func (metrics *recordingMetricsService) SendCounterMetricWithTags(name string, value int64, tags map[string]string) {
+	metrics.counters = append(metrics.counters, recordedMetric{name, value, tags})
+}
+
+var _ = Describe("MetricsEmittingBlobstoreDecorator", func() {
+	var (
+		metrics   *recordingMetricsService
+		delegate  *failingTimesBlobstore
+		blobstore *MetricsEmittingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		metrics = &recordingMetricsService{}
+		delegate = &failingTimesBlobstore{Blobstore: inmemory.NewBlobstoreWithEntries(map[string][]byte{"some-path": []byte("some content")})}
+		blobstore = ForBlobstoreWithMetricsEmitter(delegate, metrics, "droplets")
+	})
+
+	It("emits timings and the number of bytes uploaded", func() {
+		Expect(blobstore.Put("other-path", strings.NewReader("content"))).To(Succeed())
+
+		Expect(metrics.timings).To(Equal([]string{"droplets-cp_to_blobstore-time"}))
+		Expect(metrics.counters).To(Equal([]recordedMetric{{"droplets-cp_to_blobstore-bytes", 7, nil}}))
+	})
+
+	It("emits the number of bytes actually downloaded once the body is closed", func() {
+		body, e := blobstore.Get("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(metrics.timings).To(Equal([]string{"droplets-get_from_blobstore-time"}))
+
+		buffer := make([]byte, 4)
+		_, e = body.Read(buffer)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(metrics.counters).To(BeEmpty())
+
+		Expect(body.Close()).To(Succeed())
+		Expect(body.Close()).To(Succeed())
+
+		Expect(metrics.counters).To(Equal([]recordedMetric{{"droplets-get_from_blobstore-bytes", 4, nil}}))
+	})
+
+	It("counts errors by operation and type, also when they are wrapped", func() {
+		delegate.failures = 3
+
+		delegate.err = errors.Wrap(bitsgo.NewNotFoundError(), "some context")
+		_, e := blobstore.Get("some-path")
+		Expect(e).To(HaveOccurred())
+
+		delegate.err = errors.Wrap(bitsgo.NewNoSpaceLeftError(), "some context")
+		Expect(blobstore.Put("other-path", strings.NewReader("content"))).NotTo(Succeed())
+
+		delegate.err = nil
+		Expect(blobstore.Delete("some-path")).NotTo(Succeed())
+
+		Expect(metrics.counters).To(Equal([]recordedMetric{
+			{"droplets-blobstore-errors", 1, map[string]string{"operation": "get", "error_type": "not_found"}},
+			{"droplets-blobstore-errors", 1, map[string]string{"operation": "put", "error_type": "no_space_left"}},
+			{"droplets-blobstore-errors", 1, map[string]string{"operation": "delete", "error_type": "other"}},
+		}))
+	})
+})
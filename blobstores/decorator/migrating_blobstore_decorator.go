@@ -0,0 +1,254 @@
+package decorator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// MigratingBlobstoreDecorator moves blobs from an old to a new blobstore while serving them. It writes to the new
+// blobstore only, and reads from the new and then the old one. Blobs read from the old blobstore are copied to the
+// new one on the fly. Blobs which are never read are left to the backfill of "bitsgo migrate".
+// Copies never overwrite blobs which were put into the new blobstore meanwhile, and never bring back blobs which were
+// deleted meanwhile. This only holds for changes made through the same bits-service instance.
+type MigratingBlobstoreDecorator struct {
+	from           bitsgo.Blobstore
+	to             bitsgo.Blobstore
+	metricsService bitsgo.MetricsService
+	resourceType   string
+	locks          *pathLocks
+}
+
+func ForBlobstoreWithMigration(from bitsgo.Blobstore, to bitsgo.Blobstore, metricsService bitsgo.MetricsService, resourceType string) *MigratingBlobstoreDecorator {
+	return &MigratingBlobstoreDecorator{from, to, metricsService, resourceType, newPathLocks()}
+}
+
+func (decorator *MigratingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &MigratingBlobstoreDecorator{
+		bitsgo.BlobstoreWithContext(ctx, decorator.from),
+		bitsgo.BlobstoreWithContext(ctx, decorator.to),
+		decorator.metricsService,
+		decorator.resourceType,
+		decorator.locks,
+	}
+}
+
+func (decorator *MigratingBlobstoreDecorator) Exists(path string) (bool, error) {
+	exists, e := decorator.to.Exists(path)
+	if e != nil || exists {
+		return exists, e
+	}
+	return decorator.from.Exists(path)
+}
+
+func (decorator *MigratingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	redirectLocation, e := decorator.to.HeadOrRedirectAsGet(path)
+	if !bitsgo.IsNotFoundError(e) {
+		return redirectLocation, e
+	}
+	return decorator.from.HeadOrRedirectAsGet(path)
+}
+
+func (decorator *MigratingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	body, e := decorator.to.Get(path)
+	if !bitsgo.IsNotFoundError(e) {
+		return body, e
+	}
+	return decorator.migrate(path)
+}
+
+func (decorator *MigratingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	body, redirectLocation, e := decorator.to.GetOrRedirect(path)
+	if !bitsgo.IsNotFoundError(e) {
+		return body, redirectLocation, e
+	}
+	// not redirecting to the old blobstore, so that the blob gets copied
+	body, e = decorator.migrate(path)
+	return body, "", e
+}
+
+// migrate copies the blob from the old to the new blobstore and returns its content. Failing to store it in the
+// new blobstore does not fail reading it.
+func (decorator *MigratingBlobstoreDecorator) migrate(path string) (io.ReadCloser, error) {
+	tempFile, e := decorator.download(path)
+	if e != nil {
+		return nil, e
+	}
+
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	existsInNew, e := decorator.to.Exists(path)
+	if e == nil && existsInNew {
+		// put meanwhile, so it is newer than the blob read from the old blobstore
+		decorator.count("skipped")
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return decorator.to.Get(path)
+	}
+	decorator.count(decorator.copyUnlessDeleted(path, tempFile))
+
+	_, e = tempFile.Seek(0, io.SeekStart)
+	if e != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return nil, e
+	}
+	return &removingFileReadCloser{tempFile}, nil
+}
+
+// copyUnlessDeleted puts tempFile into the new blobstore unless path was deleted from the old one since it was read.
+// Must be called with the lock of path held.
+func (decorator *MigratingBlobstoreDecorator) copyUnlessDeleted(path string, tempFile *os.File) (result string) {
+	existsInOld, e := decorator.from.Exists(path)
+	if e == nil && !existsInOld {
+		return "skipped"
+	}
+	if e == nil {
+		e = decorator.to.Put(path, tempFile)
+	}
+	if e != nil {
+		logger.Log.Errorw("Could not copy blob to new blobstore. Serving it from old blobstore.", "resource-type", decorator.resourceType, "path", path, "error", e)
+		return "failed"
+	}
+	return "copied"
+}
+
+func (decorator *MigratingBlobstoreDecorator) download(path string) (*os.File, error) {
+	body, e := decorator.from.Get(path)
+	if e != nil {
+		return nil, e
+	}
+	defer body.Close()
+
+	tempFile, e := ioutil.TempFile("", "bits-migrate")
+	if e != nil {
+		return nil, e
+	}
+	_, e = io.Copy(tempFile, body)
+	if e == nil {
+		_, e = tempFile.Seek(0, io.SeekStart)
+	}
+	if e != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return nil, e
+	}
+	return tempFile, nil
+}
+
+func (decorator *MigratingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	return decorator.to.Put(path, src)
+}
+
+func (decorator *MigratingBlobstoreDecorator) Copy(src, dest string) error {
+	e := decorator.copyToNew(src)
+	if e != nil {
+		return e
+	}
+	unlock := decorator.locks.lock(dest)
+	defer unlock()
+
+	return decorator.to.Copy(src, dest)
+}
+
+func (decorator *MigratingBlobstoreDecorator) copyToNew(path string) error {
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	exists, e := decorator.to.Exists(path)
+	if e != nil || exists {
+		return e
+	}
+	return copyBlob(decorator.from, decorator.to, path)
+}
+
+func (decorator *MigratingBlobstoreDecorator) Delete(path string) error {
+	unlock := decorator.locks.lock(path)
+	defer unlock()
+
+	deleteErr := decorator.to.Delete(path)
+	if deleteErr != nil && !bitsgo.IsNotFoundError(deleteErr) {
+		return deleteErr
+	}
+	// not all blobstores report deleting a missing blob as *NotFoundError
+	existsInOld, e := decorator.from.Exists(path)
+	if e != nil {
+		return e
+	}
+	if existsInOld {
+		return decorator.from.Delete(path)
+	}
+	return deleteErr
+}
+
+func (decorator *MigratingBlobstoreDecorator) DeleteDir(prefix string) error {
+	e := decorator.to.DeleteDir(prefix)
+	if e != nil && !bitsgo.IsNotFoundError(e) {
+		return e
+	}
+	e = decorator.from.DeleteDir(prefix)
+	if e != nil && !bitsgo.IsNotFoundError(e) {
+		return e
+	}
+	return nil
+}
+
+func (decorator *MigratingBlobstoreDecorator) count(result string) {
+	decorator.metricsService.SendCounterMetricWithTags(decorator.resourceType+"-migration-lazy-copies", 1, map[string]string{"result": result})
+}
+
+// pathLocks serializes changes to the same path, without keeping a lock for every path ever used.
+type pathLocks struct {
+	mutex sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	users int
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{locks: make(map[string]*pathLock)}
+}
+
+func (locks *pathLocks) lock(path string) (unlock func()) {
+	locks.mutex.Lock()
+	lock, exists := locks.locks[path]
+	if !exists {
+		lock = &pathLock{}
+		locks.locks[path] = lock
+	}
+	lock.users++
+	locks.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		locks.mutex.Lock()
+		defer locks.mutex.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(locks.locks, path)
+		}
+	}
+}
+
+type removingFileReadCloser struct {
+	*os.File
+}
+
+func (file *removingFileReadCloser) Close() error {
+	e := file.File.Close()
+	os.Remove(file.Name())
+	return e
+}
@@ -0,0 +1,117 @@
+package decorator_test
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MigratingBlobstoreDecorator", func() {
+	var (
+		from      *inmemory.Blobstore
+		to        *inmemory.Blobstore
+		blobstore *MigratingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		from = inmemory.NewBlobstoreWithEntries(map[string][]byte{
+			"old":    []byte("old content"),
+			"stale":  []byte("stale content"),
+			"copied": []byte("copied content"),
+		})
+		to = inmemory.NewBlobstoreWithEntries(map[string][]byte{
+			"stale":  []byte("new content"),
+			"copied": []byte("copied content"),
+		})
+		blobstore = ForBlobstoreWithMigration(from, to, NewMockMetricsService(), "packages")
+	})
+
+	contentOf := func(path string) string {
+		body, redirectLocation, e := blobstore.GetOrRedirect(path)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(redirectLocation).To(BeEmpty())
+		defer body.Close()
+		content, e := ioutil.ReadAll(body)
+		Expect(e).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	It("reads from the new blobstore first", func() {
+		Expect(contentOf("stale")).To(Equal("new content"))
+	})
+
+	It("copies blobs from the old blobstore when reading them", func() {
+		Expect(contentOf("old")).To(Equal("old content"))
+		Expect(to.Entries["old"]).To(Equal([]byte("old content")))
+
+		Expect(blobstore.Exists("old")).To(BeTrue())
+		_, e := blobstore.Get("missing")
+		Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+	})
+
+	Context("when the blob changes while it is copied", func() {
+		var afterGet func()
+
+		BeforeEach(func() {
+			afterGet = func() {}
+			blobstore = ForBlobstoreWithMigration(&hookingBlobstore{from, func() { afterGet() }}, to, NewMockMetricsService(), "packages")
+		})
+
+		It("does not overwrite blobs put meanwhile", func() {
+			afterGet = func() { Expect(blobstore.Put("old", strings.NewReader("newer content"))).To(Succeed()) }
+
+			Expect(contentOf("old")).To(Equal("newer content"))
+			Expect(to.Entries["old"]).To(Equal([]byte("newer content")))
+		})
+
+		It("does not bring back blobs deleted meanwhile", func() {
+			afterGet = func() { Expect(blobstore.Delete("old")).To(Succeed()) }
+
+			Expect(contentOf("old")).To(Equal("old content"))
+			Expect(to.Entries).NotTo(HaveKey("old"))
+			Expect(from.Entries).NotTo(HaveKey("old"))
+		})
+	})
+
+	It("writes to the new blobstore only", func() {
+		Expect(blobstore.Put("new", strings.NewReader("content"))).To(Succeed())
+
+		Expect(to.Entries["new"]).To(Equal([]byte("content")))
+		Expect(from.Entries).NotTo(HaveKey("new"))
+	})
+
+	It("copies blobs which exist in the old blobstore only", func() {
+		Expect(blobstore.Copy("old", "dest")).To(Succeed())
+
+		Expect(to.Entries["dest"]).To(Equal([]byte("old content")))
+		Expect(from.Entries).NotTo(HaveKey("dest"))
+	})
+
+	It("deletes from both blobstores", func() {
+		Expect(blobstore.Delete("copied")).To(Succeed())
+		Expect(blobstore.Delete("old")).To(Succeed())
+
+		Expect(from.Entries).To(HaveLen(1))
+		Expect(to.Entries).To(HaveLen(1))
+		Expect(blobstore.Exists("copied")).To(BeFalse())
+		Expect(bitsgo.IsNotFoundError(blobstore.Delete("missing"))).To(BeTrue())
+	})
+})
+
+// hookingBlobstore calls afterGet once Get has returned, but before its caller continues.
+type hookingBlobstore struct {
+	*inmemory.Blobstore
+	afterGet func()
+}
+
+func (blobstore *hookingBlobstore) Get(path string) (io.ReadCloser, error) {
+	body, e := blobstore.Blobstore.Get(path)
+	blobstore.afterGet()
+	return body, e
+}
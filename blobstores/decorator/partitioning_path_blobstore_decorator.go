@@ -1,6 +1,7 @@
 package decorator
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -17,6 +18,10 @@ type PartitioningPathBlobstoreDecorator struct {
 	delegate bitsgo.Blobstore
 }
 
+func (decorator *PartitioningPathBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &PartitioningPathBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate)}
+}
+
 func (decorator *PartitioningPathBlobstoreDecorator) Exists(path string) (bool, error) {
 	return decorator.delegate.Exists(pathFor(path))
 }
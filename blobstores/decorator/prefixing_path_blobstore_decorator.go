@@ -1,6 +1,7 @@
 package decorator
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -16,6 +17,10 @@ func ForBlobstoreWithPathPrefixing(delegate bitsgo.Blobstore, prefix string) *Pr
 	return &PrefixingPathBlobstoreDecorator{delegate, prefix}
 }
 
+func (decorator *PrefixingPathBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &PrefixingPathBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.prefix}
+}
+
 func (decorator *PrefixingPathBlobstoreDecorator) Exists(path string) (bool, error) {
 	return decorator.delegate.Exists(decorator.prefix + path)
 }
@@ -0,0 +1,150 @@
+package decorator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/pkg/errors"
+)
+
+// QuotaEnforcingBlobstoreDecorator accounts uploads to the tenant of the request context, see bitsgo.TenantFrom,
+// and rejects them with a *bitsgo.QuotaExceededError when they would exceed the tenant's quota.
+type QuotaEnforcingBlobstoreDecorator struct {
+	delegate     bitsgo.Blobstore
+	tracker      *QuotaTracker
+	resourceType string
+	tenant       string
+}
+
+func ForBlobstoreWithQuotas(delegate bitsgo.Blobstore, tracker *QuotaTracker, resourceType string) *QuotaEnforcingBlobstoreDecorator {
+	return &QuotaEnforcingBlobstoreDecorator{delegate: delegate, tracker: tracker, resourceType: resourceType}
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &QuotaEnforcingBlobstoreDecorator{
+		delegate:     bitsgo.BlobstoreWithContext(ctx, decorator.delegate),
+		tracker:      decorator.tracker,
+		resourceType: decorator.resourceType,
+		tenant:       bitsgo.TenantFrom(ctx),
+	}
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) Exists(path string) (bool, error) {
+	return decorator.delegate.Exists(path)
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	return decorator.delegate.HeadOrRedirectAsGet(path)
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	return decorator.delegate.Get(path)
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	return decorator.delegate.GetOrRedirect(path)
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	key := quotaKey(decorator.resourceType, path)
+	if decorator.tenant == "" {
+		e := decorator.delegate.Put(path, src)
+		if e == nil {
+			// replaced by a blob nobody is accounted for
+			decorator.tracker.remove(key)
+		}
+		return e
+	}
+
+	size, e := sizeOf(src)
+	if e != nil {
+		return errors.Wrapf(e, "Could not determine size of %v", path)
+	}
+	return decorator.account(key, size, func() error { return decorator.delegate.Put(path, src) })
+}
+
+// Copy accounts dest to the tenant of the request. Sources which are not accounted, e.g. because they were uploaded
+// without a tenant or before quotas were enabled, are read to determine their size.
+func (decorator *QuotaEnforcingBlobstoreDecorator) Copy(src, dest string) error {
+	destKey := quotaKey(decorator.resourceType, dest)
+	if decorator.tenant == "" {
+		e := decorator.delegate.Copy(src, dest)
+		if e == nil {
+			decorator.tracker.remove(destKey)
+		}
+		return e
+	}
+
+	size, tracked := decorator.tracker.sizeOf(quotaKey(decorator.resourceType, src))
+	if !tracked {
+		var e error
+		size, e = decorator.readSizeOf(src)
+		if e != nil {
+			return e
+		}
+	}
+	return decorator.account(destKey, size, func() error { return decorator.delegate.Copy(src, dest) })
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) readSizeOf(path string) (int64, error) {
+	body, e := decorator.delegate.Get(path)
+	if e != nil {
+		return 0, e
+	}
+	defer body.Close()
+	size, e := io.Copy(ioutil.Discard, body)
+	if e != nil {
+		return 0, errors.Wrapf(e, "Could not determine size of %v", path)
+	}
+	return size, nil
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) account(key string, size int64, upload func() error) error {
+	e := decorator.tracker.reserve(decorator.tenant, decorator.resourceType, key, size)
+	if e != nil {
+		return e
+	}
+	e = upload()
+	if e != nil {
+		decorator.tracker.release(decorator.tenant, size)
+		return e
+	}
+	decorator.tracker.commit(decorator.tenant, key, size)
+	return nil
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) Delete(path string) error {
+	e := decorator.delegate.Delete(path)
+	if e == nil || bitsgo.IsNotFoundError(e) {
+		decorator.tracker.remove(quotaKey(decorator.resourceType, path))
+	}
+	return e
+}
+
+func (decorator *QuotaEnforcingBlobstoreDecorator) DeleteDir(prefix string) error {
+	e := decorator.delegate.DeleteDir(prefix)
+	if e == nil || bitsgo.IsNotFoundError(e) {
+		decorator.tracker.removeDir(decorator.resourceType, prefix)
+	}
+	return e
+}
+
+// sizeOf returns the number of bytes from the current position of src to its end, and leaves src at its
+// current position.
+func sizeOf(src io.ReadSeeker) (int64, error) {
+	start, e := src.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return 0, e
+	}
+	end, e := src.Seek(0, io.SeekEnd)
+	if e != nil {
+		return 0, e
+	}
+	_, e = src.Seek(start, io.SeekStart)
+	if e != nil {
+		return 0, e
+	}
+	return end - start, nil
+}
@@ -0,0 +1,122 @@
+package decorator_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuotaEnforcingBlobstoreDecorator", func() {
+	var (
+		backend   *inmemory.Blobstore
+		mockClock *clock.Mock
+		stateDir  string
+		tracker   *QuotaTracker
+		blobstore *QuotaEnforcingBlobstoreDecorator
+	)
+
+	newTracker := func() *QuotaTracker {
+		tracker, e := NewQuotaTracker(10, map[string]int64{"big-space": 100}, filepath.Join(stateDir, "quotas.json"), mockClock, NewMockMetricsService())
+		Expect(e).NotTo(HaveOccurred())
+		tracker.AddReconciliationSource("packages", backend, "")
+		return tracker
+	}
+
+	forTenant := func(tenant string) bitsgo.Blobstore {
+		return bitsgo.BlobstoreWithContext(bitsgo.ContextWithTenant(context.Background(), tenant), blobstore)
+	}
+
+	BeforeEach(func() {
+		var e error
+		stateDir, e = ioutil.TempDir("", "bits-quotas")
+		Expect(e).NotTo(HaveOccurred())
+		backend = inmemory.NewBlobstore()
+		mockClock = clock.NewMock()
+		tracker = newTracker()
+		blobstore = ForBlobstoreWithQuotas(ForBlobstoreWithPathPartitioning(backend), tracker, "packages")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(stateDir)
+	})
+
+	It("rejects uploads exceeding the quota of the tenant", func() {
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("123456"))).To(Succeed())
+
+		e := forTenant("some-space").Put("efgh", strings.NewReader("123456"))
+		Expect(bitsgo.IsQuotaExceededError(e)).To(BeTrue())
+		Expect(backend.Exists("ef/gh/efgh")).To(BeFalse())
+
+		Expect(forTenant("big-space").Put("efgh", strings.NewReader("123456"))).To(Succeed())
+		Expect(forTenant("").Put("ijkl", strings.NewReader("123456789012"))).To(Succeed())
+
+		Expect(tracker.QuotaUsage("some-space")).To(Equal(bitsgo.QuotaUsage{Tenant: "some-space", UsedBytes: 6, QuotaBytes: 10, Blobs: 1}))
+		Expect(tracker.AllQuotaUsage()).To(Equal([]bitsgo.QuotaUsage{
+			{Tenant: "big-space", UsedBytes: 6, QuotaBytes: 100, Blobs: 1},
+			{Tenant: "some-space", UsedBytes: 6, QuotaBytes: 10, Blobs: 1},
+		}))
+	})
+
+	It("only accounts the difference when replacing a blob", func() {
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("123456"))).To(Succeed())
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("12345678"))).To(Succeed())
+
+		Expect(tracker.QuotaUsage("some-space").UsedBytes).To(Equal(int64(8)))
+	})
+
+	It("accounts copies to the tenant of the request", func() {
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("123456"))).To(Succeed())
+		Expect(forTenant("big-space").Copy("abcd", "efgh")).To(Succeed())
+
+		Expect(tracker.QuotaUsage("big-space").UsedBytes).To(Equal(int64(6)))
+		Expect(bitsgo.IsQuotaExceededError(forTenant("some-space").Copy("abcd", "ijkl"))).To(BeTrue())
+	})
+
+	It("accounts copies of blobs uploaded without a tenant by their size", func() {
+		Expect(forTenant("").Put("abcd", strings.NewReader("123456"))).To(Succeed())
+		Expect(forTenant("big-space").Copy("abcd", "efgh")).To(Succeed())
+
+		Expect(tracker.QuotaUsage("big-space").UsedBytes).To(Equal(int64(6)))
+		Expect(forTenant("some-space").Put("ijkl", strings.NewReader("123456"))).To(Succeed())
+		Expect(bitsgo.IsQuotaExceededError(forTenant("some-space").Copy("abcd", "mnop"))).To(BeTrue())
+		Expect(backend.Exists("mn/op/mnop")).To(BeFalse())
+	})
+
+	It("frees usage when blobs are deleted", func() {
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("123456"))).To(Succeed())
+		Expect(forTenant("").Delete("abcd")).To(Succeed())
+
+		Expect(tracker.QuotaUsage("some-space").UsedBytes).To(BeZero())
+		Expect(forTenant("some-space").Put("efgh", strings.NewReader("123456"))).To(Succeed())
+	})
+
+	It("removes blobs which no longer exist when reconciling", func() {
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("123"))).To(Succeed())
+		Expect(forTenant("some-space").Put("efgh", strings.NewReader("456"))).To(Succeed())
+		Expect(backend.Delete("ab/cd/abcd")).To(Succeed())
+		mockClock.Add(time.Minute)
+
+		Expect(tracker.Reconcile()).To(Succeed())
+
+		Expect(tracker.QuotaUsage("some-space")).To(Equal(bitsgo.QuotaUsage{Tenant: "some-space", UsedBytes: 3, QuotaBytes: 10, Blobs: 1}))
+	})
+
+	It("restores usage from its state file", func() {
+		Expect(forTenant("some-space").Put("abcd", strings.NewReader("123456"))).To(Succeed())
+		Expect(tracker.Save()).To(Succeed())
+
+		tracker = newTracker()
+
+		Expect(tracker.QuotaUsage("some-space").UsedBytes).To(Equal(int64(6)))
+	})
+})
@@ -0,0 +1,354 @@
+package decorator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// quotaSaveInterval is how often Run persists changed usage.
+const quotaSaveInterval = time.Minute
+
+type quotaEntry struct {
+	Tenant    string    `json:"tenant"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type quotaState struct {
+	// keyed by resource type and path, see quotaKey
+	Entries map[string]*quotaEntry `json:"entries"`
+}
+
+type tenantUsage struct {
+	bytes int64
+	blobs int
+}
+
+type reconciliationSource struct {
+	listing bitsgo.ListingBlobstore
+	prefix  string
+}
+
+// QuotaTracker keeps a ledger of the blobs each tenant has uploaded and rejects uploads which would exceed
+// the tenant's quota. The ledger is updated incrementally by QuotaEnforcingBlobstoreDecorators and persisted
+// in stateFile. Since blobs can disappear without going through bits-service, Reconcile removes entries for
+// blobs which no longer exist in the blobstore. Blobs which were uploaded without a tenant are never accounted.
+//
+// Every bits-service instance keeps its own ledger. Quotas are therefore only exact when all uploads go through
+// the same instance or the instances share stateFile.
+type QuotaTracker struct {
+	defaultQuota   int64
+	quotas         map[string]int64
+	stateFile      string
+	clock          clock.Clock
+	metricsService bitsgo.MetricsService
+
+	mutex   sync.Mutex
+	entries map[string]*quotaEntry
+	usage   map[string]*tenantUsage
+	dirty   bool
+	sources map[string]reconciliationSource
+}
+
+// NewQuotaTracker creates a QuotaTracker which allows defaultQuota bytes for tenants not in quotas. A quota of 0
+// means unlimited.
+func NewQuotaTracker(defaultQuota int64, quotas map[string]int64, stateFile string, clock clock.Clock, metricsService bitsgo.MetricsService) (*QuotaTracker, error) {
+	tracker := &QuotaTracker{
+		defaultQuota:   defaultQuota,
+		quotas:         quotas,
+		stateFile:      stateFile,
+		clock:          clock,
+		metricsService: metricsService,
+		entries:        make(map[string]*quotaEntry),
+		sources:        make(map[string]reconciliationSource),
+	}
+	content, e := ioutil.ReadFile(stateFile)
+	if e != nil && !os.IsNotExist(e) {
+		return nil, errors.Wrapf(e, "Could not read quota state file %v", stateFile)
+	}
+	if e == nil {
+		var state quotaState
+		e = json.Unmarshal(content, &state)
+		if e != nil {
+			return nil, errors.Wrapf(e, "Could not parse quota state file %v", stateFile)
+		}
+		if state.Entries != nil {
+			tracker.entries = state.Entries
+		}
+	}
+	tracker.recomputeUsage()
+	return tracker, nil
+}
+
+// AddReconciliationSource makes Reconcile check the blobs of resourceType against listing. prefix is the path
+// prefix under which listing stores them.
+func (tracker *QuotaTracker) AddReconciliationSource(resourceType string, listing bitsgo.ListingBlobstore, prefix string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.sources[resourceType] = reconciliationSource{listing, prefix}
+}
+
+func quotaKey(resourceType, path string) string {
+	return resourceType + ":" + path
+}
+
+func (tracker *QuotaTracker) quotaOf(tenant string) int64 {
+	if quota, exists := tracker.quotas[tenant]; exists {
+		return quota
+	}
+	return tracker.defaultQuota
+}
+
+func (tracker *QuotaTracker) usageOf(tenant string) *tenantUsage {
+	usage, exists := tracker.usage[tenant]
+	if !exists {
+		usage = &tenantUsage{}
+		tracker.usage[tenant] = usage
+	}
+	return usage
+}
+
+// reserve accounts size bytes to tenant before they are uploaded to key. An upload replacing a blob of the same
+// tenant only needs to fit the difference. Every successful reserve must be followed by either commit or release.
+func (tracker *QuotaTracker) reserve(tenant, resourceType, key string, size int64) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	usage := tracker.usageOf(tenant)
+	var replacedSize int64
+	if entry, exists := tracker.entries[key]; exists && entry.Tenant == tenant {
+		replacedSize = entry.Size
+	}
+	quota := tracker.quotaOf(tenant)
+	if quota > 0 && usage.bytes-replacedSize+size > quota {
+		tracker.metricsService.SendCounterMetricWithTags("quota-exceeded", 1, map[string]string{"resource_type": resourceType})
+		return bitsgo.NewQuotaExceededError(tenant, quota, usage.bytes, size)
+	}
+	usage.bytes += size
+	return nil
+}
+
+// commit turns a reservation into an entry of the ledger, replacing the previous entry for key.
+func (tracker *QuotaTracker) commit(tenant, key string, size int64) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.removeEntry(key)
+	tracker.entries[key] = &quotaEntry{Tenant: tenant, Size: size, UpdatedAt: tracker.clock.Now()}
+	tracker.usageOf(tenant).blobs++
+	tracker.dirty = true
+}
+
+func (tracker *QuotaTracker) release(tenant string, size int64) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.usageOf(tenant).bytes -= size
+}
+
+func (tracker *QuotaTracker) remove(key string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.removeEntry(key)
+}
+
+// removeDir removes all entries of resourceType below the directory prefix. An empty prefix removes all of them.
+func (tracker *QuotaTracker) removeDir(resourceType, prefix string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	dirPrefix := quotaKey(resourceType, "")
+	if prefix != "" {
+		dirPrefix = quotaKey(resourceType, prefix+"/")
+	}
+	for key := range tracker.entries {
+		if key == quotaKey(resourceType, prefix) || strings.HasPrefix(key, dirPrefix) {
+			tracker.removeEntry(key)
+		}
+	}
+}
+
+// removeEntry must be called with mutex held.
+func (tracker *QuotaTracker) removeEntry(key string) {
+	entry, exists := tracker.entries[key]
+	if !exists {
+		return
+	}
+	usage := tracker.usageOf(entry.Tenant)
+	usage.bytes -= entry.Size
+	usage.blobs--
+	delete(tracker.entries, key)
+	tracker.dirty = true
+}
+
+// sizeOf returns the size of the blob at key and whether it is tracked at all.
+func (tracker *QuotaTracker) sizeOf(key string) (int64, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	entry, exists := tracker.entries[key]
+	if !exists {
+		return 0, false
+	}
+	return entry.Size, true
+}
+
+// usage also includes reservations, so it is only computed from scratch when loading the ledger.
+func (tracker *QuotaTracker) recomputeUsage() {
+	tracker.usage = make(map[string]*tenantUsage)
+	for _, entry := range tracker.entries {
+		usage := tracker.usageOf(entry.Tenant)
+		usage.bytes += entry.Size
+		usage.blobs++
+	}
+}
+
+// Reconcile removes entries for blobs which no longer exist in their reconciliation source, and saves the result.
+// Entries updated while Reconcile runs are kept, since the listing might not include them yet.
+func (tracker *QuotaTracker) Reconcile() error {
+	tracker.mutex.Lock()
+	started := tracker.clock.Now()
+	sources := make(map[string]reconciliationSource, len(tracker.sources))
+	for resourceType, source := range tracker.sources {
+		sources[resourceType] = source
+	}
+	tracker.mutex.Unlock()
+
+	for resourceType, source := range sources {
+		missing, e := tracker.missingBlobs(resourceType, source)
+		if e != nil {
+			return errors.Wrapf(e, "Could not list %v", resourceType)
+		}
+
+		tracker.mutex.Lock()
+		for _, key := range missing {
+			if entry, exists := tracker.entries[key]; exists && entry.UpdatedAt.Before(started) {
+				logger.Log.Infow("Removing blob which no longer exists from quota usage", "key", key, "tenant", entry.Tenant)
+				tracker.removeEntry(key)
+			}
+		}
+		tracker.mutex.Unlock()
+	}
+	return tracker.Save()
+}
+
+// missingBlobs returns the keys of all entries of resourceType which are not in the listing of source. Both
+// are walked in lexical order of their storage paths.
+func (tracker *QuotaTracker) missingBlobs(resourceType string, source reconciliationSource) ([]string, error) {
+	type trackedBlob struct{ storagePath, key string }
+	var tracked []trackedBlob
+	tracker.mutex.Lock()
+	for key := range tracker.entries {
+		if strings.HasPrefix(key, quotaKey(resourceType, "")) {
+			tracked = append(tracked, trackedBlob{source.prefix + pathFor(strings.TrimPrefix(key, quotaKey(resourceType, ""))), key})
+		}
+	}
+	tracker.mutex.Unlock()
+	sort.Slice(tracked, func(i, j int) bool { return tracked[i].storagePath < tracked[j].storagePath })
+
+	var missing []string
+	e := source.listing.List(source.prefix, func(path string) error {
+		for len(tracked) > 0 && tracked[0].storagePath < path {
+			missing = append(missing, tracked[0].key)
+			tracked = tracked[1:]
+		}
+		if len(tracked) > 0 && tracked[0].storagePath == path {
+			tracked = tracked[1:]
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, e
+	}
+	for _, blob := range tracked {
+		missing = append(missing, blob.key)
+	}
+	return missing, nil
+}
+
+// Save persists the ledger if it changed since the last Save.
+func (tracker *QuotaTracker) Save() error {
+	tracker.mutex.Lock()
+	if !tracker.dirty {
+		tracker.mutex.Unlock()
+		return nil
+	}
+	content, e := json.Marshal(quotaState{Entries: tracker.entries})
+	tracker.dirty = false
+	tracker.mutex.Unlock()
+	if e != nil {
+		return errors.Wrap(e, "Could not serialize quota state")
+	}
+
+	// Write and rename, so that a crash cannot leave a truncated state file behind
+	e = ioutil.WriteFile(tracker.stateFile+".tmp", content, 0600)
+	if e == nil {
+		e = os.Rename(tracker.stateFile+".tmp", tracker.stateFile)
+	}
+	if e != nil {
+		tracker.mutex.Lock()
+		tracker.dirty = true
+		tracker.mutex.Unlock()
+		return errors.Wrapf(e, "Could not write quota state file %v", tracker.stateFile)
+	}
+	return nil
+}
+
+// Run saves the ledger periodically and reconciles it every reconcileInterval. It never returns.
+func (tracker *QuotaTracker) Run(reconcileInterval time.Duration) {
+	saveTicker := tracker.clock.Ticker(quotaSaveInterval)
+	reconcileTicker := tracker.clock.Ticker(reconcileInterval)
+	for {
+		select {
+		case <-saveTicker.C:
+			if e := tracker.Save(); e != nil {
+				logger.Log.Errorw("Could not save quota usage", "error", e)
+			}
+		case <-reconcileTicker.C:
+			if e := tracker.Reconcile(); e != nil {
+				logger.Log.Errorw("Could not reconcile quota usage", "error", e)
+			}
+		}
+	}
+}
+
+func (tracker *QuotaTracker) QuotaUsage(tenant string) bitsgo.QuotaUsage {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	result := bitsgo.QuotaUsage{Tenant: tenant, QuotaBytes: tracker.quotaOf(tenant)}
+	if usage, exists := tracker.usage[tenant]; exists {
+		result.UsedBytes = usage.bytes
+		result.Blobs = usage.blobs
+	}
+	return result
+}
+
+func (tracker *QuotaTracker) AllQuotaUsage() []bitsgo.QuotaUsage {
+	tracker.mutex.Lock()
+	tenants := make([]string, 0, len(tracker.usage))
+	for tenant, usage := range tracker.usage {
+		if usage.bytes != 0 || usage.blobs != 0 {
+			tenants = append(tenants, tenant)
+		}
+	}
+	tracker.mutex.Unlock()
+
+	sort.Strings(tenants)
+	result := make([]bitsgo.QuotaUsage, 0, len(tenants))
+	for _, tenant := range tenants {
+		result = append(result, tracker.QuotaUsage(tenant))
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package decorator
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+)
+
+// ReadOnlyBlobstoreDecorator rejects all changes to its blobstore with a *bitsgo.UnavailableError while mode is
+// enabled or resourceType is read-only. This also covers writes which do not stem from a request, e.g. asynchronous
+// uploads.
+type ReadOnlyBlobstoreDecorator struct {
+	delegate     bitsgo.Blobstore
+	mode         *bitsgo.MaintenanceMode
+	resourceType string
+}
+
+func ForBlobstoreWithReadOnlyMode(delegate bitsgo.Blobstore, mode *bitsgo.MaintenanceMode, resourceType string) *ReadOnlyBlobstoreDecorator {
+	return &ReadOnlyBlobstoreDecorator{delegate, mode, resourceType}
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &ReadOnlyBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.mode, decorator.resourceType}
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) Exists(path string) (bool, error) {
+	return decorator.delegate.Exists(path)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	return decorator.delegate.HeadOrRedirectAsGet(path)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	return decorator.delegate.Get(path)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	return decorator.delegate.GetOrRedirect(path)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	if e := decorator.mode.CheckWritableFor(decorator.resourceType); e != nil {
+		return e
+	}
+	return decorator.delegate.Put(path, src)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) Copy(src, dest string) error {
+	if e := decorator.mode.CheckWritableFor(decorator.resourceType); e != nil {
+		return e
+	}
+	return decorator.delegate.Copy(src, dest)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) Delete(path string) error {
+	if e := decorator.mode.CheckWritableFor(decorator.resourceType); e != nil {
+		return e
+	}
+	return decorator.delegate.Delete(path)
+}
+
+func (decorator *ReadOnlyBlobstoreDecorator) DeleteDir(prefix string) error {
+	if e := decorator.mode.CheckWritableFor(decorator.resourceType); e != nil {
+		return e
+	}
+	return decorator.delegate.DeleteDir(prefix)
+}
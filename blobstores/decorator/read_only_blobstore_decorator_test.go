@@ -0,0 +1,54 @@
+package decorator_test
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadOnlyBlobstoreDecorator", func() {
+	var (
+		mode      *bitsgo.MaintenanceMode
+		blobstore *ReadOnlyBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		mode = bitsgo.NewMaintenanceMode(clock.NewMock())
+		blobstore = ForBlobstoreWithReadOnlyMode(inmemory.NewBlobstoreWithEntries(map[string][]byte{"some-path": []byte("content")}), mode, "droplets")
+	})
+
+	It("rejects changes but serves reads while maintenance mode is enabled", func() {
+		mode.Enable("incident")
+
+		Expect(bitsgo.IsUnavailableError(blobstore.Put("other-path", strings.NewReader("content")))).To(BeTrue())
+		Expect(bitsgo.IsUnavailableError(blobstore.Copy("some-path", "other-path"))).To(BeTrue())
+		Expect(bitsgo.IsUnavailableError(blobstore.Delete("some-path"))).To(BeTrue())
+		Expect(bitsgo.IsUnavailableError(blobstore.DeleteDir(""))).To(BeTrue())
+
+		body, e := blobstore.Get("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("content")))
+
+		mode.Disable()
+		Expect(blobstore.Delete("some-path")).To(Succeed())
+	})
+
+	It("rejects changes only while its own resource type is read-only", func() {
+		mode.EnableFor("packages", "migrating packages")
+		Expect(blobstore.Put("other-path", strings.NewReader("content"))).To(Succeed())
+
+		mode.EnableFor("droplets", "migrating droplets")
+		e := blobstore.Delete("some-path")
+		Expect(bitsgo.IsUnavailableError(e)).To(BeTrue())
+		Expect(e.Error()).To(Equal("droplets blobstore is read-only and does not accept changes: migrating droplets"))
+
+		mode.DisableFor("droplets")
+		Expect(blobstore.Delete("some-path")).To(Succeed())
+	})
+})
@@ -0,0 +1,178 @@
+package decorator
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// ReplicatingBlobstoreDecorator writes to a primary and any number of secondary blobstores, and reads from the
+// primary. Only when the primary fails, reads fall back to the secondaries. A write succeeds when it succeeds on
+// the primary. Secondaries are written either synchronously, with failed writes being repaired via the
+// ReplicationQueue, or asynchronously via the ReplicationQueue.
+type ReplicatingBlobstoreDecorator struct {
+	primary     bitsgo.Blobstore
+	secondaries []bitsgo.Blobstore
+	// replication in the background must not depend on the context of the request which triggered it
+	backgroundPrimary     bitsgo.Blobstore
+	backgroundSecondaries []bitsgo.Blobstore
+	queue                 *ReplicationQueue
+	async                 bool
+}
+
+func ForBlobstoreWithReplication(primary bitsgo.Blobstore, secondaries []bitsgo.Blobstore, queue *ReplicationQueue, async bool) *ReplicatingBlobstoreDecorator {
+	return &ReplicatingBlobstoreDecorator{primary, secondaries, primary, secondaries, queue, async}
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	secondaries := make([]bitsgo.Blobstore, len(decorator.secondaries))
+	for i, secondary := range decorator.secondaries {
+		secondaries[i] = bitsgo.BlobstoreWithContext(ctx, secondary)
+	}
+	return &ReplicatingBlobstoreDecorator{
+		primary:               bitsgo.BlobstoreWithContext(ctx, decorator.primary),
+		secondaries:           secondaries,
+		backgroundPrimary:     decorator.backgroundPrimary,
+		backgroundSecondaries: decorator.backgroundSecondaries,
+		queue:                 decorator.queue,
+		async:                 decorator.async,
+	}
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) Exists(path string) (bool, error) {
+	exists, e := decorator.primary.Exists(path)
+	if e == nil {
+		return exists, nil
+	}
+	for i, secondary := range decorator.secondaries {
+		decorator.logFallback("exists", path, i, e)
+		exists, e = secondary.Exists(path)
+		if e == nil {
+			return exists, nil
+		}
+	}
+	return false, e
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	redirectLocation, e := decorator.primary.HeadOrRedirectAsGet(path)
+	if e == nil || bitsgo.IsNotFoundError(e) {
+		return redirectLocation, e
+	}
+	for i, secondary := range decorator.secondaries {
+		decorator.logFallback("head_or_redirect", path, i, e)
+		redirectLocation, e = secondary.HeadOrRedirectAsGet(path)
+		if e == nil || bitsgo.IsNotFoundError(e) {
+			return redirectLocation, e
+		}
+	}
+	return "", e
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	body, e := decorator.primary.Get(path)
+	if e == nil || bitsgo.IsNotFoundError(e) {
+		return body, e
+	}
+	for i, secondary := range decorator.secondaries {
+		decorator.logFallback("get", path, i, e)
+		body, e = secondary.Get(path)
+		if e == nil || bitsgo.IsNotFoundError(e) {
+			return body, e
+		}
+	}
+	return nil, e
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	body, redirectLocation, e := decorator.primary.GetOrRedirect(path)
+	if e == nil || bitsgo.IsNotFoundError(e) {
+		return body, redirectLocation, e
+	}
+	for i, secondary := range decorator.secondaries {
+		decorator.logFallback("get_or_redirect", path, i, e)
+		body, redirectLocation, e = secondary.GetOrRedirect(path)
+		if e == nil || bitsgo.IsNotFoundError(e) {
+			return body, redirectLocation, e
+		}
+	}
+	return nil, "", e
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	e := decorator.primary.Put(path, src)
+	if e != nil {
+		return e
+	}
+	decorator.replicate(replicatePut, path, func(secondary bitsgo.Blobstore) error {
+		_, e := src.Seek(0, io.SeekStart)
+		if e != nil {
+			return e
+		}
+		return secondary.Put(path, src)
+	})
+	return nil
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) Copy(src, dest string) error {
+	e := decorator.primary.Copy(src, dest)
+	if e != nil {
+		return e
+	}
+	decorator.replicate(replicatePut, dest, func(secondary bitsgo.Blobstore) error {
+		return secondary.Copy(src, dest)
+	})
+	return nil
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) Delete(path string) error {
+	e := decorator.primary.Delete(path)
+	if e != nil {
+		return e
+	}
+	decorator.replicate(replicateDelete, path, func(secondary bitsgo.Blobstore) error {
+		e := secondary.Delete(path)
+		if bitsgo.IsNotFoundError(e) {
+			return nil
+		}
+		return e
+	})
+	return nil
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) DeleteDir(prefix string) error {
+	e := decorator.primary.DeleteDir(prefix)
+	if e != nil {
+		return e
+	}
+	decorator.replicate(replicateDeleteDir, prefix, func(secondary bitsgo.Blobstore) error {
+		return secondary.DeleteDir(prefix)
+	})
+	return nil
+}
+
+// replicate applies write to all secondaries, or queues it when replicating asynchronously. Failed writes get queued
+// for repair. Queued writes of blobs re-read them from the primary.
+func (decorator *ReplicatingBlobstoreDecorator) replicate(operation replicationOperation, path string, write func(secondary bitsgo.Blobstore) error) {
+	for i, secondary := range decorator.secondaries {
+		if !decorator.async {
+			e := write(secondary)
+			if e == nil {
+				continue
+			}
+			logger.Log.Errorw("Could not replicate to secondary blobstore. Queueing it for repair.", "operation", operation, "path", path, "secondary", i, "error", e)
+		}
+		decorator.queue.enqueue(replicationJob{
+			operation: operation,
+			source:    decorator.backgroundPrimary,
+			target:    decorator.backgroundSecondaries[i],
+			path:      path,
+		})
+	}
+}
+
+func (decorator *ReplicatingBlobstoreDecorator) logFallback(operation string, path string, secondary int, e error) {
+	logger.Log.Errorw("Blobstore failed. Falling back to secondary blobstore.", "operation", operation, "path", path, "secondary", secondary, "error", e)
+}
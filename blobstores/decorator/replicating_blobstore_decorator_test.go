@@ -0,0 +1,284 @@
+package decorator_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReplicatingBlobstoreDecorator", func() {
+	var (
+		primary        *flakyBlobstore
+		secondary      *flakyBlobstore
+		metricsService *MockMetricsService
+		mockClock      *clock.Mock
+		queue          *ReplicationQueue
+	)
+
+	BeforeEach(func() {
+		primary = newFlakyBlobstore()
+		secondary = newFlakyBlobstore()
+		metricsService = NewMockMetricsService()
+		mockClock = clock.NewMock()
+		queue = NewReplicationQueue(10, time.Minute, 3, mockClock, metricsService, "packages")
+	})
+
+	contentOf := func(blobstore bitsgo.Blobstore, path string) string {
+		body, e := blobstore.Get(path)
+		Expect(e).NotTo(HaveOccurred())
+		defer body.Close()
+		content, e := ioutil.ReadAll(body)
+		Expect(e).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	Context("synchronous", func() {
+		var blobstore *ReplicatingBlobstoreDecorator
+
+		BeforeEach(func() {
+			blobstore = ForBlobstoreWithReplication(primary, []bitsgo.Blobstore{secondary}, queue, false)
+		})
+
+		It("writes to primary and secondaries", func() {
+			Expect(blobstore.Put("some-path", strings.NewReader("some content"))).To(Succeed())
+			Expect(primary.entry("some-path")).To(Equal("some content"))
+			Expect(secondary.entry("some-path")).To(Equal("some content"))
+
+			Expect(blobstore.Copy("some-path", "other-path")).To(Succeed())
+			Expect(secondary.entry("other-path")).To(Equal("some content"))
+
+			Expect(blobstore.Delete("some-path")).To(Succeed())
+			Expect(primary.exists("some-path")).To(BeFalse())
+			Expect(secondary.exists("some-path")).To(BeFalse())
+		})
+
+		It("fails when the primary fails", func() {
+			primary.setFailing(true)
+
+			Expect(blobstore.Put("some-path", strings.NewReader("some content"))).NotTo(Succeed())
+			Expect(secondary.exists("some-path")).To(BeFalse())
+		})
+
+		It("repairs a secondary after a failed write", func() {
+			secondary.setFailing(true)
+
+			Expect(blobstore.Put("some-path", strings.NewReader("some content"))).To(Succeed())
+			Expect(primary.entry("some-path")).To(Equal("some content"))
+
+			secondary.setFailing(false)
+			Eventually(func() string {
+				mockClock.Add(time.Minute)
+				return secondary.entry("some-path")
+			}).Should(Equal("some content"))
+		})
+
+		It("gives up repairing after max attempts", func() {
+			secondary.setFailing(true)
+
+			Expect(blobstore.Put("some-path", strings.NewReader("some content"))).To(Succeed())
+
+			Eventually(func() int {
+				mockClock.Add(time.Minute)
+				return secondary.attempts()
+			}).Should(Equal(4)) // the synchronous write plus 3 attempts from the queue
+			mockClock.Add(time.Minute)
+			Consistently(secondary.attempts).Should(Equal(4))
+		})
+
+		It("reads from the primary", func() {
+			primary.Put("some-path", strings.NewReader("primary content"))
+			secondary.Put("some-path", strings.NewReader("secondary content"))
+
+			Expect(contentOf(blobstore, "some-path")).To(Equal("primary content"))
+		})
+
+		It("falls back to secondaries when the primary fails", func() {
+			secondary.Put("some-path", strings.NewReader("secondary content"))
+			primary.setFailing(true)
+
+			Expect(contentOf(blobstore, "some-path")).To(Equal("secondary content"))
+			Expect(blobstore.Exists("some-path")).To(BeTrue())
+		})
+
+		It("does not fall back to secondaries when the blob does not exist on the primary", func() {
+			secondary.Put("some-path", strings.NewReader("secondary content"))
+
+			_, e := blobstore.Get("some-path")
+			Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+		})
+	})
+
+	Context("asynchronous", func() {
+		var blobstore *ReplicatingBlobstoreDecorator
+
+		BeforeEach(func() {
+			blobstore = ForBlobstoreWithReplication(primary, []bitsgo.Blobstore{secondary}, queue, true)
+		})
+
+		It("writes to secondaries in the background", func() {
+			Expect(blobstore.Put("some-path", strings.NewReader("some content"))).To(Succeed())
+			Expect(primary.entry("some-path")).To(Equal("some content"))
+			Eventually(func() string { return secondary.entry("some-path") }).Should(Equal("some content"))
+
+			Expect(blobstore.DeleteDir("some")).To(Succeed())
+			Expect(primary.exists("some-path")).To(BeFalse())
+			Eventually(func() bool { return secondary.exists("some-path") }).Should(BeFalse())
+		})
+
+		It("replicates the latest content when retrying", func() {
+			secondary.setFailing(true)
+			Expect(blobstore.Put("some-path", strings.NewReader("old content"))).To(Succeed())
+			Eventually(secondary.attempts).Should(Equal(1))
+
+			primary.Put("some-path", strings.NewReader("new content"))
+			secondary.setFailing(false)
+			Eventually(func() string {
+				mockClock.Add(time.Minute)
+				return secondary.entry("some-path")
+			}).Should(Equal("new content"))
+		})
+
+		It("does not delete blobs which were created again before the delete got replicated", func() {
+			Expect(blobstore.Put("some-path", strings.NewReader("old content"))).To(Succeed())
+			Eventually(func() string { return secondary.entry("some-path") }).Should(Equal("old content"))
+
+			secondary.setFailing(true)
+			Expect(blobstore.Delete("some-path")).To(Succeed())
+			Eventually(secondary.attempts).Should(Equal(2))
+
+			secondary.setFailing(false)
+			Expect(blobstore.Put("some-path", strings.NewReader("new content"))).To(Succeed())
+			Eventually(func() string { return secondary.entry("some-path") }).Should(Equal("new content"))
+
+			mockClock.Add(time.Minute)
+			Consistently(func() string { return secondary.entry("some-path") }).Should(Equal("new content"))
+		})
+	})
+})
+
+// flakyBlobstore is a thread-safe in-memory blobstore whose operations can be made to fail.
+type flakyBlobstore struct {
+	mutex         sync.Mutex
+	delegate      *inmemory.Blobstore
+	failing       bool
+	writeAttempts int
+}
+
+func newFlakyBlobstore() *flakyBlobstore {
+	return &flakyBlobstore{delegate: inmemory.NewBlobstore()}
+}
+
+func (blobstore *flakyBlobstore) setFailing(failing bool) {
+	blobstore.mutex.Lock()
+	defer blobstore.mutex.Unlock()
+	blobstore.failing = failing
+}
+
+func (blobstore *flakyBlobstore) attempts() int {
+	blobstore.mutex.Lock()
+	defer blobstore.mutex.Unlock()
+	return blobstore.writeAttempts
+}
+
+func (blobstore *flakyBlobstore) entry(path string) string {
+	blobstore.mutex.Lock()
+	defer blobstore.mutex.Unlock()
+	return string(blobstore.delegate.Entries[path])
+}
+
+func (blobstore *flakyBlobstore) exists(path string) bool {
+	blobstore.mutex.Lock()
+	defer blobstore.mutex.Unlock()
+	_, exists := blobstore.delegate.Entries[path]
+	return exists
+}
+
+func (blobstore *flakyBlobstore) lock(write bool) error {
+	blobstore.mutex.Lock()
+	if write {
+		blobstore.writeAttempts++
+	}
+	if blobstore.failing {
+		blobstore.mutex.Unlock()
+		return errors.New("blobstore unavailable")
+	}
+	return nil
+}
+
+func (blobstore *flakyBlobstore) Exists(path string) (bool, error) {
+	if e := blobstore.lock(false); e != nil {
+		return false, e
+	}
+	defer blobstore.mutex.Unlock()
+	return blobstore.delegate.Exists(path)
+}
+
+func (blobstore *flakyBlobstore) HeadOrRedirectAsGet(path string) (string, error) {
+	if e := blobstore.lock(false); e != nil {
+		return "", e
+	}
+	defer blobstore.mutex.Unlock()
+	return blobstore.delegate.HeadOrRedirectAsGet(path)
+}
+
+func (blobstore *flakyBlobstore) Get(path string) (io.ReadCloser, error) {
+	if e := blobstore.lock(false); e != nil {
+		return nil, e
+	}
+	defer blobstore.mutex.Unlock()
+	body, e := blobstore.delegate.Get(path)
+	if e != nil {
+		return nil, e
+	}
+	// read while holding the lock
+	content, e := ioutil.ReadAll(body)
+	return ioutil.NopCloser(bytes.NewReader(content)), e
+}
+
+func (blobstore *flakyBlobstore) GetOrRedirect(path string) (io.ReadCloser, string, error) {
+	body, e := blobstore.Get(path)
+	return body, "", e
+}
+
+func (blobstore *flakyBlobstore) Put(path string, src io.ReadSeeker) error {
+	if e := blobstore.lock(true); e != nil {
+		return e
+	}
+	defer blobstore.mutex.Unlock()
+	return blobstore.delegate.Put(path, src)
+}
+
+func (blobstore *flakyBlobstore) Copy(src, dest string) error {
+	if e := blobstore.lock(true); e != nil {
+		return e
+	}
+	defer blobstore.mutex.Unlock()
+	return blobstore.delegate.Copy(src, dest)
+}
+
+func (blobstore *flakyBlobstore) Delete(path string) error {
+	if e := blobstore.lock(true); e != nil {
+		return e
+	}
+	defer blobstore.mutex.Unlock()
+	return blobstore.delegate.Delete(path)
+}
+
+func (blobstore *flakyBlobstore) DeleteDir(prefix string) error {
+	if e := blobstore.lock(true); e != nil {
+		return e
+	}
+	defer blobstore.mutex.Unlock()
+	return blobstore.delegate.DeleteDir(prefix)
+}
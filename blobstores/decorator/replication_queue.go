@@ -0,0 +1,156 @@
+package decorator
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+const replicationWorkers = 4
+
+type replicationOperation string
+
+const (
+	replicatePut       replicationOperation = "put"
+	replicateDelete    replicationOperation = "delete"
+	replicateDeleteDir replicationOperation = "delete_dir"
+)
+
+type replicationJob struct {
+	operation replicationOperation
+	// blobs are read from source when the job runs, so that retried jobs replicate the latest state
+	source   bitsgo.Blobstore
+	target   bitsgo.Blobstore
+	path     string
+	attempts int
+}
+
+// ReplicationQueue replicates blobs to secondary blobstores in the background. It is used for asynchronous
+// replication, and for repairing secondaries after failed synchronous writes. Failed jobs are retried after
+// retryInterval, up to maxAttempts times. The queue only lives in memory.
+// Jobs can run in any order, since they run concurrently and get retried. So jobs for the same path never run at
+// the same time, and every job checks the current state of the source rather than relying on the order of jobs.
+type ReplicationQueue struct {
+	jobs           chan replicationJob
+	locks          *pathLocks
+	retryInterval  time.Duration
+	maxAttempts    int
+	clock          clock.Clock
+	metricsService bitsgo.MetricsService
+	resourceType   string
+}
+
+func NewReplicationQueue(size int, retryInterval time.Duration, maxAttempts int, clock clock.Clock, metricsService bitsgo.MetricsService, resourceType string) *ReplicationQueue {
+	queue := &ReplicationQueue{
+		jobs:           make(chan replicationJob, size),
+		locks:          newPathLocks(),
+		retryInterval:  retryInterval,
+		maxAttempts:    maxAttempts,
+		clock:          clock,
+		metricsService: metricsService,
+		resourceType:   resourceType,
+	}
+	for i := 0; i < replicationWorkers; i++ {
+		go queue.work()
+	}
+	return queue
+}
+
+func (queue *ReplicationQueue) enqueue(job replicationJob) {
+	select {
+	case queue.jobs <- job:
+		queue.metricsService.SendGaugeMetric(queue.resourceType+"-replication-queue-length", int64(len(queue.jobs)))
+	default:
+		logger.Log.Errorw("Replication queue is full. Dropping replication job. Secondary blobstore is out of sync.",
+			"resource-type", queue.resourceType, "operation", job.operation, "path", job.path)
+		queue.count("dropped")
+	}
+}
+
+func (queue *ReplicationQueue) work() {
+	for job := range queue.jobs {
+		job.attempts++
+		unlock := queue.locks.lock(job.path)
+		e := job.run()
+		unlock()
+		if e == nil {
+			queue.count("replicated")
+			continue
+		}
+		if job.attempts >= queue.maxAttempts {
+			logger.Log.Errorw("Giving up replicating. Secondary blobstore is out of sync.",
+				"resource-type", queue.resourceType, "operation", job.operation, "path", job.path, "attempts", job.attempts, "error", e)
+			queue.count("failed")
+			continue
+		}
+		logger.Log.Infow("Replication failed. Retrying later.",
+			"resource-type", queue.resourceType, "operation", job.operation, "path", job.path, "attempts", job.attempts, "error", e)
+		queue.count("retried")
+		retriedJob := job
+		queue.clock.AfterFunc(queue.retryInterval, func() { queue.enqueue(retriedJob) })
+	}
+}
+
+func (queue *ReplicationQueue) count(result string) {
+	queue.metricsService.SendCounterMetricWithTags(queue.resourceType+"-replication", 1, map[string]string{"result": result})
+}
+
+func (job *replicationJob) run() error {
+	switch job.operation {
+	case replicatePut:
+		return copyBlob(job.source, job.target, job.path)
+	case replicateDelete:
+		exists, e := job.source.Exists(job.path)
+		if e != nil {
+			return e
+		}
+		if exists {
+			// created again in the meantime. The put gets replicated separately.
+			return nil
+		}
+		e = job.target.Delete(job.path)
+		if bitsgo.IsNotFoundError(e) {
+			return nil
+		}
+		return e
+	case replicateDeleteDir:
+		return job.target.DeleteDir(job.path)
+	default:
+		panic("Unexpected replication operation " + string(job.operation))
+	}
+}
+
+// copyBlob buffers the blob in a temporary file, because Put needs an io.ReadSeeker.
+func copyBlob(source bitsgo.Blobstore, target bitsgo.Blobstore, path string) error {
+	body, e := source.Get(path)
+	if bitsgo.IsNotFoundError(e) {
+		// deleted in the meantime. The delete gets replicated separately.
+		return nil
+	}
+	if e != nil {
+		return e
+	}
+	defer body.Close()
+
+	tempFile, e := ioutil.TempFile("", "bits-replicate")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	_, e = io.Copy(tempFile, body)
+	if e != nil {
+		return e
+	}
+	_, e = tempFile.Seek(0, io.SeekStart)
+	if e != nil {
+		return e
+	}
+	return target.Put(path, tempFile)
+}
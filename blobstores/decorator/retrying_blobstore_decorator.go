@@ -0,0 +1,152 @@
+package decorator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// RetryingBlobstoreDecorator retries failed calls according to its RetryPolicy, until the request's context is done.
+// Bodies of content-addressed blobs returned by Get and GetOrRedirect resume reading where they failed, by getting
+// the blob again and skipping what has been read already. Other blobs might have been replaced in the meantime, so
+// their bodies fail instead of mixing two different blobs.
+type RetryingBlobstoreDecorator struct {
+	delegate       bitsgo.Blobstore
+	policy         bitsgo.RetryPolicy
+	metricsService bitsgo.MetricsService
+	resourceType   string
+	ctx            context.Context
+}
+
+func ForBlobstoreWithRetries(delegate bitsgo.Blobstore, policy bitsgo.RetryPolicy, metricsService bitsgo.MetricsService, resourceType string) *RetryingBlobstoreDecorator {
+	return &RetryingBlobstoreDecorator{delegate, policy, metricsService, resourceType, context.Background()}
+}
+
+func (decorator *RetryingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &RetryingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.policy, decorator.metricsService, decorator.resourceType, ctx}
+}
+
+func (decorator *RetryingBlobstoreDecorator) retry(operation string, f func() error) error {
+	return decorator.policy.RetryWithContext(decorator.ctx, decorator.metricsService, decorator.resourceType+"-blobstore", operation, f)
+}
+
+func (decorator *RetryingBlobstoreDecorator) resumable(body io.ReadCloser, path string) io.ReadCloser {
+	if !contentAddressedPath.MatchString(path) {
+		return body
+	}
+	return &resumingReadCloser{body: body, path: path, decorator: decorator}
+}
+
+func (decorator *RetryingBlobstoreDecorator) Exists(path string) (exists bool, e error) {
+	e = decorator.retry("exists", func() error {
+		exists, e = decorator.delegate.Exists(path)
+		return e
+	})
+	return
+}
+
+func (decorator *RetryingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, e error) {
+	e = decorator.retry("head_or_redirect", func() error {
+		redirectLocation, e = decorator.delegate.HeadOrRedirectAsGet(path)
+		return e
+	})
+	return
+}
+
+func (decorator *RetryingBlobstoreDecorator) Get(path string) (body io.ReadCloser, e error) {
+	e = decorator.retry("get", func() error {
+		body, e = decorator.delegate.Get(path)
+		return e
+	})
+	if e != nil {
+		return nil, e
+	}
+	return decorator.resumable(body, path), nil
+}
+
+func (decorator *RetryingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, e error) {
+	e = decorator.retry("get_or_redirect", func() error {
+		body, redirectLocation, e = decorator.delegate.GetOrRedirect(path)
+		return e
+	})
+	if e != nil || body == nil {
+		return body, redirectLocation, e
+	}
+	return decorator.resumable(body, path), redirectLocation, nil
+}
+
+// Put reads src again from where it was positioned for every attempt.
+func (decorator *RetryingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	start, e := src.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return errors.Wrapf(e, "Could not determine position in content for %v", path)
+	}
+	return decorator.retry("put", func() error {
+		_, e := src.Seek(start, io.SeekStart)
+		if e != nil {
+			return errors.Wrapf(e, "Could not rewind content for %v", path)
+		}
+		return decorator.delegate.Put(path, src)
+	})
+}
+
+func (decorator *RetryingBlobstoreDecorator) Copy(src, dest string) error {
+	return decorator.retry("copy", func() error { return decorator.delegate.Copy(src, dest) })
+}
+
+func (decorator *RetryingBlobstoreDecorator) Delete(path string) error {
+	return decorator.retry("delete", func() error { return decorator.delegate.Delete(path) })
+}
+
+func (decorator *RetryingBlobstoreDecorator) DeleteDir(prefix string) error {
+	return decorator.retry("delete_dir", func() error { return decorator.delegate.DeleteDir(prefix) })
+}
+
+type resumingReadCloser struct {
+	body      io.ReadCloser
+	path      string
+	bytesRead int64
+	decorator *RetryingBlobstoreDecorator
+}
+
+func (r *resumingReadCloser) Read(p []byte) (int, error) {
+	n, e := r.body.Read(p)
+	r.bytesRead += int64(n)
+	if e == nil || e == io.EOF || n > 0 {
+		// A failing body fails again on the next Read, which is when resuming makes sense.
+		return n, e
+	}
+	resumeError := r.decorator.retry("read", func() error {
+		logger.Log.Infow("Resuming read from blobstore", "path", r.path, "offset", r.bytesRead, "error", e)
+		r.body.Close()
+		body, e := r.decorator.delegate.Get(r.path)
+		if e != nil {
+			// The blob is gone or inaccessible now. Either way the original error is more telling.
+			r.body = ioutil.NopCloser(&failingReader{e})
+			return e
+		}
+		r.body = body
+		_, e = io.CopyN(ioutil.Discard, r.body, r.bytesRead)
+		return e
+	})
+	if resumeError != nil {
+		return 0, e
+	}
+	return r.body.Read(p)
+}
+
+func (r *resumingReadCloser) Close() error {
+	return r.body.Close()
+}
+
+type failingReader struct {
+	e error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.e
+}
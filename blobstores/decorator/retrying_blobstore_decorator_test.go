@@ -0,0 +1,163 @@
+package decorator_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/petergtz/pegomock"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("RetryingBlobstoreDecorator", func() {
+	var (
+		backend        *failingTimesBlobstore
+		metricsService *MockMetricsService
+		blobstore      *RetryingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		backend = &failingTimesBlobstore{Blobstore: inmemory.NewBlobstore()}
+		metricsService = NewMockMetricsService()
+		policy := bitsgo.DefaultRetryPolicy()
+		policy.InitialInterval = time.Millisecond
+		blobstore = ForBlobstoreWithRetries(backend, policy, metricsService, "packages")
+	})
+
+	It("retries failed calls and counts the retries", func() {
+		backend.failures = 2
+		Expect(blobstore.Put("some-path", strings.NewReader("content"))).To(Succeed())
+
+		Expect(backend.calls).To(Equal(3))
+		metricsService.VerifyWasCalled(pegomock.Times(2)).SendCounterMetricWithTags("packages-blobstore-retries", 1, map[string]string{
+			"operation":  "put",
+			"error_type": "other",
+		})
+
+		body, e := backend.Get("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("content")))
+	})
+
+	It("gives up after the maximum number of attempts", func() {
+		backend.failures = 10
+		Expect(blobstore.Delete("some-path")).To(MatchError("backend failure"))
+		Expect(backend.calls).To(Equal(4))
+	})
+
+	It("does not retry errors which are not retryable", func() {
+		_, e := blobstore.Get("missing")
+		Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+		Expect(backend.calls).To(Equal(1))
+
+		backend.err = bitsgo.NewUnavailableError("circuit is open", time.Second)
+		backend.failures = 10
+		Expect(bitsgo.IsUnavailableError(blobstore.Copy("a", "b"))).To(BeTrue())
+		Expect(backend.calls).To(Equal(2))
+	})
+
+	It("does not retry canceled calls, and stops retrying once the request's context is done", func() {
+		backend.err = errors.Wrap(context.Canceled, "request failed")
+		backend.failures = 10
+		Expect(blobstore.Delete("some-path")).To(HaveOccurred())
+		Expect(backend.calls).To(Equal(1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		backend.err = nil
+		Expect(blobstore.WithContext(ctx).Delete("some-path")).To(MatchError("backend failure"))
+		Expect(backend.calls).To(Equal(2))
+	})
+
+	It("resumes reading a body of a content-addressed blob where it failed", func() {
+		path := "ab/cd/abcdef0123456789abcdef0123456789abcdef01"
+		Expect(backend.Put(path, strings.NewReader("some content"))).To(Succeed())
+		backend.brokenBodies = 1
+
+		body, e := blobstore.Get(path)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("some content")))
+		Expect(body.Close()).To(Succeed())
+	})
+
+	It("fails reading a body of other blobs, since they might have been replaced meanwhile", func() {
+		Expect(backend.Put("some-guid", strings.NewReader("some content"))).To(Succeed())
+		backend.brokenBodies = 1
+
+		body, e := blobstore.Get("some-guid")
+		Expect(e).NotTo(HaveOccurred())
+		content, e := ioutil.ReadAll(body)
+		Expect(e).To(MatchError("connection reset"))
+		Expect(content).To(Equal([]byte("some")))
+	})
+})
+
+// failingTimesBlobstore fails its next failures calls with err, and breaks the next brokenBodies bodies it returns
+// after their first 4 bytes.
+type failingTimesBlobstore struct {
+	*inmemory.Blobstore
+	calls        int
+	failures     int
+	err          error
+	brokenBodies int
+}
+
+func (blobstore *failingTimesBlobstore) fail() error {
+	blobstore.calls++
+	if blobstore.failures == 0 {
+		return nil
+	}
+	blobstore.failures--
+	if blobstore.err != nil {
+		return blobstore.err
+	}
+	return errors.New("backend failure")
+}
+
+func (blobstore *failingTimesBlobstore) Get(path string) (io.ReadCloser, error) {
+	if e := blobstore.fail(); e != nil {
+		return nil, e
+	}
+	body, e := blobstore.Blobstore.Get(path)
+	if e != nil || blobstore.brokenBodies == 0 {
+		return body, e
+	}
+	blobstore.brokenBodies--
+	return ioutil.NopCloser(io.MultiReader(io.LimitReader(body, 4), &brokenReader{})), nil
+}
+
+func (blobstore *failingTimesBlobstore) Put(path string, src io.ReadSeeker) error {
+	if e := blobstore.fail(); e != nil {
+		// Consume some content, so that retries must rewind it
+		io.CopyN(ioutil.Discard, src, 3)
+		return e
+	}
+	return blobstore.Blobstore.Put(path, src)
+}
+
+func (blobstore *failingTimesBlobstore) Copy(src, dest string) error {
+	if e := blobstore.fail(); e != nil {
+		return e
+	}
+	return blobstore.Blobstore.Copy(src, dest)
+}
+
+func (blobstore *failingTimesBlobstore) Delete(path string) error {
+	if e := blobstore.fail(); e != nil {
+		return e
+	}
+	return blobstore.Blobstore.Delete(path)
+}
+
+type brokenReader struct{}
+
+func (*brokenReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
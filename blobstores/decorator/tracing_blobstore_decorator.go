@@ -0,0 +1,121 @@
+package decorator
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingBlobstoreDecorator records every blobstore operation as a span. Spans become children
+// of the request's span when the decorator is bound to a request context via WithContext.
+type TracingBlobstoreDecorator struct {
+	delegate     bitsgo.Blobstore
+	resourceType string
+	ctx          context.Context
+}
+
+func ForBlobstoreWithTracing(delegate bitsgo.Blobstore, resourceType string) *TracingBlobstoreDecorator {
+	return &TracingBlobstoreDecorator{delegate, resourceType, context.Background()}
+}
+
+func (decorator *TracingBlobstoreDecorator) WithContext(ctx context.Context) bitsgo.Blobstore {
+	return &TracingBlobstoreDecorator{bitsgo.BlobstoreWithContext(ctx, decorator.delegate), decorator.resourceType, ctx}
+}
+
+func (decorator *TracingBlobstoreDecorator) Exists(path string) (bool, error) {
+	span := decorator.startSpan("Exists", path)
+	exists, e := decorator.delegate.Exists(path)
+	span.SetAttributes(attribute.Bool("bits.exists", exists))
+	endSpan(span, e)
+	return exists, e
+}
+
+func (decorator *TracingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+	span := decorator.startSpan("HeadOrRedirectAsGet", path)
+	redirectLocation, e := decorator.delegate.HeadOrRedirectAsGet(path)
+	endSpan(span, e)
+	return redirectLocation, e
+}
+
+func (decorator *TracingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
+	span := decorator.startSpan("Get", path)
+	body, e := decorator.delegate.Get(path)
+	if e != nil {
+		endSpan(span, e)
+		return nil, e
+	}
+	return &spanEndingReadCloser{body, span}, nil
+}
+
+func (decorator *TracingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+	span := decorator.startSpan("GetOrRedirect", path)
+	body, redirectLocation, e := decorator.delegate.GetOrRedirect(path)
+	if e != nil || body == nil {
+		endSpan(span, e)
+		return body, redirectLocation, e
+	}
+	return &spanEndingReadCloser{body, span}, redirectLocation, nil
+}
+
+func (decorator *TracingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+	span := decorator.startSpan("Put", path)
+	e := decorator.delegate.Put(path, src)
+	endSpan(span, e)
+	return e
+}
+
+func (decorator *TracingBlobstoreDecorator) Copy(src, dest string) error {
+	span := decorator.startSpan("Copy", src)
+	span.SetAttributes(attribute.String("bits.destination", dest))
+	e := decorator.delegate.Copy(src, dest)
+	endSpan(span, e)
+	return e
+}
+
+func (decorator *TracingBlobstoreDecorator) Delete(path string) error {
+	span := decorator.startSpan("Delete", path)
+	e := decorator.delegate.Delete(path)
+	endSpan(span, e)
+	return e
+}
+
+func (decorator *TracingBlobstoreDecorator) DeleteDir(prefix string) error {
+	span := decorator.startSpan("DeleteDir", prefix)
+	e := decorator.delegate.DeleteDir(prefix)
+	endSpan(span, e)
+	return e
+}
+
+func (decorator *TracingBlobstoreDecorator) startSpan(operation string, path string) trace.Span {
+	_, span := tracing.Tracer().Start(decorator.ctx, "Blobstore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("bits.resource_type", decorator.resourceType),
+			attribute.String("bits.path", path)))
+	return span
+}
+
+// NotFoundErrors are regular results of blobstore operations and therefore not recorded as errors.
+func endSpan(span trace.Span, e error) {
+	if !bitsgo.IsNotFoundError(e) {
+		tracing.RecordError(span, e)
+	}
+	span.End()
+}
+
+// spanEndingReadCloser keeps the span open until the body has been read and closed,
+// so that the span covers the actual download.
+type spanEndingReadCloser struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (r *spanEndingReadCloser) Close() error {
+	e := r.ReadCloser.Close()
+	r.span.End()
+	return e
+}
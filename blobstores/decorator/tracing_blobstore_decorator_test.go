@@ -0,0 +1,71 @@
+package decorator_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("TracingBlobstoreDecorator", func() {
+	var (
+		recorder  *tracetest.SpanRecorder
+		blobstore *TracingBlobstoreDecorator
+	)
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		blobstore = ForBlobstoreWithTracing(inmemory.NewBlobstoreWithEntries(map[string][]byte{"some-path": []byte("some content")}), "droplets")
+	})
+
+	It("records operations as children of the span of the request context", func() {
+		ctx, requestSpan := tracing.Tracer().Start(context.Background(), "request")
+
+		Expect(blobstore.WithContext(ctx).Put("other-path", strings.NewReader("content"))).To(Succeed())
+		requestSpan.End()
+
+		Expect(recorder.Ended()).To(HaveLen(2))
+		span := recorder.Ended()[0]
+		Expect(span.Name()).To(Equal("Blobstore.Put"))
+		Expect(span.Parent().SpanID()).To(Equal(requestSpan.SpanContext().SpanID()))
+		Expect(span.Attributes()).To(ContainElement(attribute.String("bits.resource_type", "droplets")))
+		Expect(span.Attributes()).To(ContainElement(attribute.String("bits.path", "other-path")))
+	})
+
+	It("keeps the span of a download open until its body is closed", func() {
+		body, e := blobstore.Get("some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(recorder.Ended()).To(BeEmpty())
+
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("some content")))
+		Expect(body.Close()).To(Succeed())
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		Expect(recorder.Ended()[0].Name()).To(Equal("Blobstore.Get"))
+	})
+
+	It("records errors, but not NotFoundErrors", func() {
+		_, e := blobstore.Get("non-existing-path")
+		Expect(bitsgo.IsNotFoundError(e)).To(BeTrue())
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		Expect(recorder.Ended()[0].Status().Code).NotTo(Equal(codes.Error))
+
+		Expect(ForBlobstoreWithTracing(&failingTimesBlobstore{Blobstore: inmemory.NewBlobstore(), failures: 1}, "droplets").Delete("some-path")).NotTo(Succeed())
+
+		Expect(recorder.Ended()).To(HaveLen(2))
+		Expect(recorder.Ended()[1].Status().Code).To(Equal(codes.Error))
+	})
+})
@@ -229,3 +229,20 @@ func (blobstore *Blobstore) bucketExists() error {
 	}
 	return nil
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	it := blobstore.client.Bucket(blobstore.bucket).Objects(context.TODO(), &storage.Query{Prefix: prefix})
+	for {
+		attrs, e := it.Next()
+		if e == iterator.Done {
+			return nil
+		}
+		if e != nil {
+			return errors.Wrapf(e, "Prefix %v", prefix)
+		}
+		e = visit(attrs.Name)
+		if e != nil {
+			return e
+		}
+	}
+}
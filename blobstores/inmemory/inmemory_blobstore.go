@@ -3,6 +3,7 @@ package inmemory_blobstore
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/cloudfoundry-incubator/bits-service"
@@ -82,3 +83,20 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	}
 	return nil
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	var paths []string
+	for key := range blobstore.Entries {
+		if strings.HasPrefix(key, prefix) {
+			paths = append(paths, key)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		e := visit(path)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
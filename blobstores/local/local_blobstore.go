@@ -3,8 +3,10 @@ package local
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/cloudfoundry-incubator/bits-service/config"
 
@@ -163,3 +165,39 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	}
 	return nil
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	_, e := os.Stat(filepath.Join(blobstore.pathPrefix, prefix))
+	if os.IsNotExist(e) {
+		return nil
+	}
+	return blobstore.listDir(prefix, visit)
+}
+
+// listDir visits files in lexical order of their paths, which is not the order filepath.Walk visits them in,
+// e.g. for "a-b" and "a/b".
+func (blobstore *Blobstore) listDir(dir string, visit func(path string) error) error {
+	fileInfos, e := ioutil.ReadDir(filepath.Join(blobstore.pathPrefix, dir))
+	if e != nil {
+		return errors.Wrapf(e, "Could not list %v", filepath.Join(blobstore.pathPrefix, dir))
+	}
+	names := make([]string, len(fileInfos))
+	for i, fileInfo := range fileInfos {
+		names[i] = fileInfo.Name()
+		if fileInfo.IsDir() {
+			names[i] += "/"
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name[len(name)-1] == '/' {
+			e = blobstore.listDir(dir+name, visit)
+		} else {
+			e = visit(dir + name)
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
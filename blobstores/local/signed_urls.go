@@ -2,9 +2,11 @@ package local
 
 import (
 	"fmt"
+	"strings"
 
 	"time"
 
+	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 )
 
@@ -15,5 +17,23 @@ type LocalResourceSigner struct {
 }
 
 func (signer *LocalResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
-	return fmt.Sprintf("%s%s", signer.DelegateEndpoint, signer.Signer.Sign(signer.ResourcePathPrefix+resource, expirationTime))
+	return signer.SignWithConstraints(resource, method, expirationTime, 0, "", "")
+}
+
+// CanSign reports whether Signer can sign URLs. It cannot, when it only validates them.
+func (signer *LocalResourceSigner) CanSign() bool {
+	availability, ok := signer.Signer.(bitsgo.SigningAvailability)
+	return !ok || availability.CanSign()
+}
+
+func (signer *LocalResourceSigner) SignWithConstraints(resource string, method string, expirationTime time.Time, maxContentLength int64, contentType string, tenant string) (signedURL string) {
+	return fmt.Sprintf("%s%s", signer.DelegateEndpoint, signer.Signer.SignWithConstraints(
+		signer.ResourcePathPrefix+resource,
+		expirationTime,
+		pathsigner.Constraints{
+			Method:           strings.ToUpper(method),
+			MaxContentLength: maxContentLength,
+			ContentType:      contentType,
+			Tenant:           tenant,
+		}))
 }
@@ -0,0 +1,226 @@
+package migration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// progressInterval is the number of blobs after which progress is saved and logged.
+const progressInterval = 100
+
+// Migration copies all blobs below SourcePrefix in Source to the same paths below TargetPrefix in Target.
+type Migration struct {
+	// Identifies the migration, e.g. the resource type. Names the file the progress is kept in.
+	Name         string
+	Source       bitsgo.ListingBlobstore
+	SourcePrefix string
+	Target       bitsgo.Blobstore
+	TargetPrefix string
+}
+
+// Progress is saved regularly, so that an interrupted migration resumes after the last path it saved.
+type Progress struct {
+	// Blobs are migrated in lexical order of their paths. All paths up to LastPath are done.
+	LastPath string `json:"last_path"`
+	Copied   int    `json:"copied"`
+	// Blobs which existed in the target already, e.g. because they had been read or replaced since the migration
+	// started, and blobs which were deleted while they were copied
+	Skipped int   `json:"skipped"`
+	Bytes   int64 `json:"bytes"`
+	// Paths which could not be migrated. They are retried when the migration is resumed.
+	Failed   []string `json:"failed"`
+	Complete bool     `json:"complete"`
+}
+
+// Run migrates blobs and keeps its progress in stateDir. When a previous run was interrupted, it resumes it and
+// retries the blobs that failed before. Blobs are verified by their SHA-256 digests after copying.
+func (migration *Migration) Run(stateDir string) (Progress, error) {
+	progressFile := filepath.Join(stateDir, migration.Name+"-migration.json")
+	progress, e := loadProgress(progressFile)
+	if e != nil {
+		return progress, e
+	}
+	if progress.Complete {
+		logger.Log.Infow("Migration is complete already. Remove the progress file to run it again.", "migration", migration.Name, "progress-file", progressFile)
+		return progress, nil
+	}
+	logger.Log.Infow("Starting migration", "migration", migration.Name, "resume-after", progress.LastPath, "retrying", len(progress.Failed))
+
+	previouslyFailed := progress.Failed
+	progress.Failed = nil
+	for _, path := range previouslyFailed {
+		migration.migrateAndCount(path, &progress)
+	}
+
+	e = migration.Source.List(migration.SourcePrefix, func(path string) error {
+		if path <= progress.LastPath {
+			return nil
+		}
+		migration.migrateAndCount(path, &progress)
+		progress.LastPath = path
+		if (progress.Copied+progress.Skipped+len(progress.Failed))%progressInterval == 0 {
+			migration.logProgress("Migrating", progress)
+			return saveProgress(progressFile, progress)
+		}
+		return nil
+	})
+	if e != nil {
+		saveProgress(progressFile, progress)
+		return progress, errors.Wrapf(e, "Could not list blobs of %v", migration.Name)
+	}
+
+	progress.Complete = len(progress.Failed) == 0
+	migration.logProgress("Finished migration", progress)
+	return progress, saveProgress(progressFile, progress)
+}
+
+func (migration *Migration) migrateAndCount(path string, progress *Progress) {
+	copied, size, e := migration.migrate(path)
+	switch {
+	case e != nil:
+		logger.Log.Errorw("Could not migrate blob", "migration", migration.Name, "path", path, "error", e)
+		progress.Failed = append(progress.Failed, path)
+	case copied:
+		progress.Copied++
+		progress.Bytes += size
+	default:
+		progress.Skipped++
+	}
+}
+
+func (migration *Migration) logProgress(message string, progress Progress) {
+	logger.Log.Infow(message,
+		"migration", migration.Name,
+		"copied", progress.Copied,
+		"skipped", progress.Skipped,
+		"failed", len(progress.Failed),
+		"bytes", progress.Bytes,
+		"last-path", progress.LastPath)
+}
+
+// migrate copies the blob unless the target has it already. Blobs in the target are never overwritten, since they
+// might have been written by the bits-service after the migration started. Blobs which have been deleted from the
+// source in the meantime count as skipped, and are removed from the target again if they were deleted during copying.
+func (migration *Migration) migrate(sourcePath string) (copied bool, size int64, e error) {
+	targetPath := migration.TargetPrefix + strings.TrimPrefix(sourcePath, migration.SourcePrefix)
+
+	exists, e := migration.Target.Exists(targetPath)
+	if e != nil {
+		return false, 0, errors.Wrap(e, "Checking target failed")
+	}
+	if exists {
+		return false, 0, nil
+	}
+
+	tempFile, e := ioutil.TempFile("", "bits-migration")
+	if e != nil {
+		return false, 0, e
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	sourceDigest, size, e := copyWithDigest(tempFile, migration.Source, sourcePath)
+	if bitsgo.IsNotFoundError(e) {
+		return false, 0, nil
+	}
+	if e != nil {
+		return false, 0, errors.Wrap(e, "Reading from source failed")
+	}
+
+	// the bits-service might have written the blob while it was read
+	exists, e = migration.Target.Exists(targetPath)
+	if e != nil {
+		return false, 0, errors.Wrap(e, "Checking target failed")
+	}
+	if exists {
+		return false, 0, nil
+	}
+
+	_, e = tempFile.Seek(0, io.SeekStart)
+	if e != nil {
+		return false, 0, e
+	}
+	e = migration.Target.Put(targetPath, tempFile)
+	if e != nil {
+		return false, 0, errors.Wrap(e, "Writing to target failed")
+	}
+	targetDigest, _, e := copyWithDigest(ioutil.Discard, migration.Target, targetPath)
+	if e != nil {
+		return false, 0, errors.Wrap(e, "Reading back from target failed")
+	}
+	if !bytes.Equal(sourceDigest, targetDigest) {
+		// otherwise, the next run would skip the corrupted copy
+		e = migration.Target.Delete(targetPath)
+		if e != nil && !bitsgo.IsNotFoundError(e) {
+			return false, 0, errors.Wrapf(e, "Checksum mismatch after copying to %v, removing the copy failed", targetPath)
+		}
+		return false, 0, errors.Errorf("Checksum mismatch after copying to %v", targetPath)
+	}
+
+	// the bits-service deletes from both blobstores, so a blob deleted while it was copied must not come back
+	existsInSource, e := migration.Source.Exists(sourcePath)
+	if e != nil {
+		return false, 0, errors.Wrap(e, "Checking source failed")
+	}
+	if !existsInSource {
+		e = migration.Target.Delete(targetPath)
+		if e != nil && !bitsgo.IsNotFoundError(e) {
+			return false, 0, errors.Wrap(e, "Removing blob deleted during copying from target failed")
+		}
+		return false, 0, nil
+	}
+	return true, size, nil
+}
+
+func copyWithDigest(dst io.Writer, blobstore bitsgo.Blobstore, path string) (digest []byte, size int64, e error) {
+	body, e := blobstore.Get(path)
+	if e != nil {
+		return nil, 0, e
+	}
+	defer body.Close()
+	hash := sha256.New()
+	size, e = io.Copy(io.MultiWriter(dst, hash), body)
+	if e != nil {
+		return nil, 0, e
+	}
+	return hash.Sum(nil), size, nil
+}
+
+func loadProgress(progressFile string) (Progress, error) {
+	var progress Progress
+	content, e := ioutil.ReadFile(progressFile)
+	if os.IsNotExist(e) {
+		return progress, nil
+	}
+	if e != nil {
+		return progress, errors.Wrapf(e, "Could not read progress file %v", progressFile)
+	}
+	e = json.Unmarshal(content, &progress)
+	if e != nil {
+		return progress, errors.Wrapf(e, "Could not parse progress file %v", progressFile)
+	}
+	return progress, nil
+}
+
+// saveProgress replaces the progress file atomically, so that it is never left half-written.
+func saveProgress(progressFile string, progress Progress) error {
+	content, e := json.MarshalIndent(progress, "", "  ")
+	if e != nil {
+		return e
+	}
+	e = ioutil.WriteFile(progressFile+".tmp", content, 0644)
+	if e != nil {
+		return errors.Wrapf(e, "Could not write progress file %v", progressFile)
+	}
+	return os.Rename(progressFile+".tmp", progressFile)
+}
@@ -0,0 +1,144 @@
+package migration_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
+	. "github.com/cloudfoundry-incubator/bits-service/blobstores/migration"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migration", func() {
+	var (
+		stateDir  string
+		source    *inmemory.Blobstore
+		target    *inmemory.Blobstore
+		migration *Migration
+	)
+
+	BeforeEach(func() {
+		var e error
+		stateDir, e = ioutil.TempDir("", "migration")
+		Expect(e).NotTo(HaveOccurred())
+
+		source = inmemory.NewBlobstoreWithEntries(map[string][]byte{
+			"cc-packages/ab/cd/abcd": []byte("abcd"),
+			"cc-packages/ef/gh/efgh": []byte("efgh"),
+			"cc-packages/ij/kl/ijkl": []byte("ijkl"),
+			"cc-droplets/mn/op/mnop": []byte("other resource type"),
+		})
+		target = inmemory.NewBlobstore()
+		migration = &Migration{
+			Name:         "packages",
+			Source:       source,
+			SourcePrefix: "cc-packages/",
+			Target:       target,
+			TargetPrefix: "",
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(stateDir)
+	})
+
+	It("copies all blobs below the prefix and skips the ones the target has already", func() {
+		target.Entries["ef/gh/efgh"] = []byte("efgh")
+		// e.g. replaced via the bits-service since the migration started
+		target.Entries["ij/kl/ijkl"] = []byte("newer")
+
+		progress, e := migration.Run(stateDir)
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(target.Entries).To(Equal(map[string][]byte{
+			"ab/cd/abcd": []byte("abcd"),
+			"ef/gh/efgh": []byte("efgh"),
+			"ij/kl/ijkl": []byte("newer"),
+		}))
+		Expect(progress).To(Equal(Progress{
+			LastPath: "cc-packages/ij/kl/ijkl",
+			Copied:   1,
+			Skipped:  2,
+			Bytes:    4,
+			Complete: true,
+		}))
+
+		source.Entries["cc-packages/zz/zz/zzzz"] = []byte("zzzz")
+		progress, e = migration.Run(stateDir)
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(progress.Copied).To(Equal(1))
+		Expect(target.Entries).NotTo(HaveKey("zz/zz/zzzz"))
+	})
+
+	It("resumes after the last saved path and retries failed blobs", func() {
+		Expect(ioutil.WriteFile(filepath.Join(stateDir, "packages-migration.json"),
+			[]byte(`{"last_path": "cc-packages/ef/gh/efgh", "copied": 1, "failed": ["cc-packages/ab/cd/abcd"]}`), 0644)).To(Succeed())
+
+		progress, e := migration.Run(stateDir)
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(target.Entries).To(Equal(map[string][]byte{
+			"ab/cd/abcd": []byte("abcd"),
+			"ij/kl/ijkl": []byte("ijkl"),
+		}))
+		Expect(progress.Copied).To(Equal(3))
+		Expect(progress.Failed).To(BeEmpty())
+		Expect(progress.Complete).To(BeTrue())
+	})
+
+	It("does not bring back blobs deleted while they were copied", func() {
+		migration.Target = &deletingBlobstore{target, source, "cc-packages/"}
+
+		progress, e := migration.Run(stateDir)
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(target.Entries).To(BeEmpty())
+		Expect(progress.Copied).To(Equal(0))
+		Expect(progress.Skipped).To(Equal(3))
+		Expect(progress.Complete).To(BeTrue())
+	})
+
+	It("records blobs which do not match their checksum after copying as failed", func() {
+		migration.Target = &corruptingBlobstore{target}
+
+		progress, e := migration.Run(stateDir)
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(progress.Failed).To(ConsistOf("cc-packages/ab/cd/abcd", "cc-packages/ef/gh/efgh", "cc-packages/ij/kl/ijkl"))
+		Expect(progress.Complete).To(BeFalse())
+
+		migration.Target = target
+		progress, e = migration.Run(stateDir)
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(progress.Failed).To(BeEmpty())
+		Expect(progress.Copied).To(Equal(3))
+		Expect(target.Entries["ab/cd/abcd"]).To(Equal([]byte("abcd")))
+	})
+})
+
+type corruptingBlobstore struct {
+	*inmemory.Blobstore
+}
+
+func (blobstore *corruptingBlobstore) Put(path string, src io.ReadSeeker) error {
+	return blobstore.Blobstore.Put(path, strings.NewReader("corrupted"))
+}
+
+// deletingBlobstore deletes every blob from source once it is put, like a delete via the bits-service would.
+type deletingBlobstore struct {
+	*inmemory.Blobstore
+	source       *inmemory.Blobstore
+	sourcePrefix string
+}
+
+func (blobstore *deletingBlobstore) Put(path string, src io.ReadSeeker) error {
+	e := blobstore.Blobstore.Put(path, src)
+	delete(blobstore.source.Entries, blobstore.sourcePrefix+path)
+	return e
+}
@@ -186,3 +186,30 @@ func (blobstore *Blobstore) Sign(resource string, method string, expirationTime
 	logger.Log.Debugw("Signed URL", "verb", method, "signed-url", signedURL)
 	return
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	if !blobstore.containerExists() {
+		return errors.Errorf("Container not found: '%v'", blobstore.containerName)
+	}
+	var visitErr error
+	e := blobstore.swiftConn.ObjectsWalk(blobstore.containerName, &swift.ObjectsOpts{Prefix: prefix}, func(opts *swift.ObjectsOpts) (interface{}, error) {
+		names, e := blobstore.swiftConn.ObjectNames(blobstore.containerName, opts)
+		if e != nil {
+			return nil, e
+		}
+		for _, name := range names {
+			visitErr = visit(name)
+			if visitErr != nil {
+				return nil, visitErr
+			}
+		}
+		return names, nil
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', prefix: '%v'", blobstore.containerName, prefix)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -17,6 +18,7 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
 	log "github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
@@ -26,6 +28,8 @@ type Blobstore struct {
 	signer               S3Signer
 	serverSideEncryption *string
 	sseKMSKeyID          *string
+	requestOptions       []request.Option
+	redirectExpiry       time.Duration
 }
 
 type S3Signer interface {
@@ -87,8 +91,12 @@ func NewBlobstoreWithLogger(config config.S3BlobstoreConfig, logger *zap.Sugared
 			config.Bucket,
 			config.SignatureVersion,
 		),
-		bucket: config.Bucket,
-		signer: s3Signer,
+		bucket:         config.Bucket,
+		signer:         s3Signer,
+		redirectExpiry: config.RedirectExpiry,
+	}
+	if blobstore.redirectExpiry == 0 {
+		blobstore.redirectExpiry = time.Hour
 	}
 
 	if config.ServerSideEncryption != "" {
@@ -106,11 +114,27 @@ func NewBlobstoreWithLogger(config config.S3BlobstoreConfig, logger *zap.Sugared
 	return blobstore
 }
 
+// WithContext returns a Blobstore which sends the request ID of ctx along with every S3 request,
+// as header and as part of the user agent, so that it shows up in S3 access logs.
+// Note: ctx is deliberately not used to cancel S3 requests, because asynchronous uploads outlive the request.
+func (blobstore *Blobstore) WithContext(ctx context.Context) bitsgo.Blobstore {
+	requestID := util.RequestIDFrom(ctx)
+	if requestID == "" {
+		return blobstore
+	}
+	blobstoreWithRequestID := *blobstore
+	blobstoreWithRequestID.requestOptions = []request.Option{
+		request.WithAppendUserAgent("vcap-request-id/" + requestID),
+		func(r *request.Request) { r.HTTPRequest.Header.Set(util.RequestIDHeader, requestID) },
+	}
+	return &blobstoreWithRequestID
+}
+
 func (blobstore *Blobstore) Exists(path string) (bool, error) {
-	_, e := blobstore.s3Client.HeadObject(&s3.HeadObjectInput{
+	_, e := blobstore.s3Client.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
-	})
+	}, blobstore.requestOptions...)
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return false, nil
@@ -125,15 +149,15 @@ func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation s
 		Bucket: &blobstore.bucket,
 		Key:    &path,
 	})
-	return blobstore.signer.Sign(request, blobstore.bucket, path, time.Now().Add(time.Hour))
+	return blobstore.signer.Sign(request, blobstore.bucket, path, time.Now().Add(blobstore.redirectExpiry))
 }
 
 func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 	logger.Log.Debugw("Get from S3", "bucket", blobstore.bucket, "path", path)
-	output, e := blobstore.s3Client.GetObject(&s3.GetObjectInput{
+	output, e := blobstore.s3Client.GetObjectWithContext(aws.BackgroundContext(), &s3.GetObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
-	})
+	}, blobstore.requestOptions...)
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return nil, bitsgo.NewNotFoundErrorWithKey(path)
@@ -148,19 +172,19 @@ func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redi
 		Bucket: &blobstore.bucket,
 		Key:    &path,
 	})
-	signedUrl, e := blobstore.signer.Sign(request, blobstore.bucket, path, time.Now().Add(time.Hour))
+	signedUrl, e := blobstore.signer.Sign(request, blobstore.bucket, path, time.Now().Add(blobstore.redirectExpiry))
 	return nil, signedUrl, e
 }
 
 func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 	logger.Log.Debugw("Put to S3", "bucket", blobstore.bucket, "path", path)
-	_, e := blobstore.s3Client.PutObject(&s3.PutObjectInput{
+	_, e := blobstore.s3Client.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
 		Bucket:               &blobstore.bucket,
 		Key:                  &path,
 		Body:                 src,
 		ServerSideEncryption: blobstore.serverSideEncryption,
 		SSEKMSKeyId:          blobstore.sseKMSKeyID,
-	})
+	}, blobstore.requestOptions...)
 	if e != nil {
 		return errors.Wrapf(e, "Path %v", path)
 	}
@@ -172,13 +196,13 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 	src = strings.Replace(src, "+", "%2B", -1)
 
 	logger.Log.Debugw("Copy in S3", "bucket", blobstore.bucket, "src", src, "dest", dest)
-	_, e := blobstore.s3Client.CopyObject(&s3.CopyObjectInput{
+	_, e := blobstore.s3Client.CopyObjectWithContext(aws.BackgroundContext(), &s3.CopyObjectInput{
 		Key:                  &dest,
 		CopySource:           aws.String(blobstore.bucket + "/" + src),
 		Bucket:               &blobstore.bucket,
 		ServerSideEncryption: blobstore.serverSideEncryption,
 		SSEKMSKeyId:          blobstore.sseKMSKeyID,
-	})
+	}, blobstore.requestOptions...)
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return bitsgo.NewNotFoundErrorWithKey(src)
@@ -189,10 +213,10 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 }
 
 func (blobstore *Blobstore) Delete(path string) error {
-	_, e := blobstore.s3Client.DeleteObject(&s3.DeleteObjectInput{
+	_, e := blobstore.s3Client.DeleteObjectWithContext(aws.BackgroundContext(), &s3.DeleteObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
-	})
+	}, blobstore.requestOptions...)
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return bitsgo.NewNotFoundErrorWithKey(path)
@@ -204,7 +228,8 @@ func (blobstore *Blobstore) Delete(path string) error {
 
 func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	deletionErrs := []error{}
-	e := blobstore.s3Client.ListObjectsPages(
+	e := blobstore.s3Client.ListObjectsPagesWithContext(
+		aws.BackgroundContext(),
 		&s3.ListObjectsInput{
 			Bucket: &blobstore.bucket,
 			Prefix: &prefix,
@@ -219,7 +244,8 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 				}
 			}
 			return true
-		})
+		},
+		blobstore.requestOptions...)
 	if e != nil {
 		return errors.Wrapf(e, "Prefix %v, errors from deleting: %v", prefix, deletionErrs)
 	}
@@ -255,3 +281,30 @@ func (signer *Blobstore) Sign(resource string, method string, expirationTime tim
 	logger.Log.Debugw("Signed URL", "verb", method, "signed-url", signedURL)
 	return
 }
+
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	var visitErr error
+	e := blobstore.s3Client.ListObjectsPagesWithContext(
+		aws.BackgroundContext(),
+		&s3.ListObjectsInput{
+			Bucket: &blobstore.bucket,
+			Prefix: &prefix,
+		},
+		func(p *s3.ListObjectsOutput, lastPage bool) (shouldContinue bool) {
+			for _, object := range p.Contents {
+				visitErr = visit(*object.Key)
+				if visitErr != nil {
+					return false
+				}
+			}
+			return true
+		},
+		blobstore.requestOptions...)
+	if visitErr != nil {
+		return visitErr
+	}
+	if e != nil {
+		return errors.Wrapf(e, "Prefix %v", prefix)
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package webdav
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 
 	"bytes"
@@ -15,6 +19,7 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/httputil"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
@@ -24,6 +29,7 @@ type Blobstore struct {
 	webdavPublicEndpoint  string
 	webdavUsername        string
 	webdavPassword        string
+	requestID             string
 }
 
 func NewBlobstore(c config.WebdavBlobstoreConfig) *Blobstore {
@@ -36,6 +42,17 @@ func NewBlobstore(c config.WebdavBlobstoreConfig) *Blobstore {
 	}
 }
 
+// WithContext returns a Blobstore which sends the request ID of ctx along with every request to the WebDAV server.
+func (blobstore *Blobstore) WithContext(ctx context.Context) bitsgo.Blobstore {
+	requestID := util.RequestIDFrom(ctx)
+	if requestID == "" {
+		return blobstore
+	}
+	blobstoreWithRequestID := *blobstore
+	blobstoreWithRequestID.requestID = requestID
+	return &blobstoreWithRequestID
+}
+
 func (blobstore *Blobstore) Exists(path string) (bool, error) {
 	url := blobstore.webdavPrivateEndpoint + "/" + path
 	logger.Log.Debugw("Exists", "path", path, "url", url)
@@ -65,7 +82,7 @@ func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 		return nil, bitsgo.NewNotFoundError()
 	}
 
-	response, e := blobstore.httpClient.Get(blobstore.webdavPrivateEndpoint + "/" + path)
+	response, e := blobstore.httpClient.Do(blobstore.newRequest("GET", blobstore.webdavPrivateEndpoint+"/"+path, nil).Build())
 
 	if e != nil {
 		return nil, errors.Wrapf(e, "path=%v")
@@ -160,6 +177,73 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return nil
 }
 
+func (blobstore *Blobstore) List(prefix string, visit func(path string) error) error {
+	return blobstore.listDir(prefix, visit)
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href       string    `xml:"href"`
+		Collection *struct{} `xml:"propstat>prop>resourcetype>collection"`
+	} `xml:"response"`
+}
+
+// listDir visits the files below dir using PROPFIND requests of depth 1, one per directory, because WebDAV servers
+// usually refuse PROPFIND requests of infinite depth.
+func (blobstore *Blobstore) listDir(dir string, visit func(path string) error) error {
+	dirURL := blobstore.webdavPrivateEndpoint + "/admin/" + dir
+	request := blobstore.newRequestWithBasicAuth("PROPFIND", dirURL, strings.NewReader(
+		`<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`))
+	request.Header.Set("Depth", "1")
+	request.Header.Set("Content-Type", "application/xml")
+	response, e := blobstore.httpClient.Do(request)
+	if e != nil {
+		return errors.Wrapf(e, "Request failed. dir=%v", dir)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if response.StatusCode != http.StatusMultiStatus {
+		return errors.Errorf("Expected HTTP status code 207, but got status code: %v", response.Status)
+	}
+	var result multistatus
+	e = xml.NewDecoder(response.Body).Decode(&result)
+	if e != nil {
+		return errors.Wrapf(e, "Could not parse PROPFIND response. dir=%v", dir)
+	}
+
+	dirPath := httputil.MustParse(dirURL).Path
+	var names []string
+	for _, entry := range result.Responses {
+		entryURL, e := url.Parse(entry.Href)
+		if e != nil {
+			return errors.Wrapf(e, "Invalid href in PROPFIND response. dir=%v", dir)
+		}
+		name := strings.TrimPrefix(entryURL.Path, dirPath)
+		if name == "" || name == "/" || name == entryURL.Path {
+			// the directory itself
+			continue
+		}
+		if entry.Collection != nil && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			e = blobstore.listDir(dir+name, visit)
+		} else {
+			e = visit(dir + name)
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
 func (signer *Blobstore) Sign(resource string, method string, expirationTime time.Time) string {
 	var url string
 	switch strings.ToLower(method) {
@@ -202,7 +286,15 @@ func (signer *Blobstore) Sign(resource string, method string, expirationTime tim
 
 func (blobstore *Blobstore) newRequestWithBasicAuth(method string, urlStr string, body io.Reader) *http.Request {
 	logger.Log.Debugw("Building HTTP request", "method", method, "url", urlStr, "has-body", body != nil, "user", blobstore.webdavUsername)
-	return httputil.NewRequest(method, urlStr, body).
+	return blobstore.newRequest(method, urlStr, body).
 		WithBasicAuth(blobstore.webdavUsername, blobstore.webdavPassword).
 		Build()
 }
+
+func (blobstore *Blobstore) newRequest(method string, urlStr string, body io.Reader) *httputil.Request {
+	request := httputil.NewRequest(method, urlStr, body)
+	if blobstore.requestID != "" {
+		request.WithHeader(util.RequestIDHeader, blobstore.requestID)
+	}
+	return request
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sync"
 
 	"github.com/cloudfoundry-incubator/bits-service/logger"
 )
@@ -31,6 +32,40 @@ func HandleBodySizeLimits(responseWriter http.ResponseWriter, request *http.Requ
 	return
 }
 
+// sizeLimits holds the body size limit and the app stash size thresholds of a handler, which can be replaced at runtime.
+// Requests already in progress keep using the limits they started with.
+type sizeLimits struct {
+	mutex            sync.RWMutex
+	maxBodySizeLimit uint64
+	minimumSize      uint64
+	maximumSize      uint64
+}
+
+func (limits *sizeLimits) SetMaxBodySizeLimit(maxBodySizeLimit uint64) {
+	limits.mutex.Lock()
+	defer limits.mutex.Unlock()
+	limits.maxBodySizeLimit = maxBodySizeLimit
+}
+
+func (limits *sizeLimits) SetSizeThresholds(minimumSize, maximumSize uint64) {
+	limits.mutex.Lock()
+	defer limits.mutex.Unlock()
+	limits.minimumSize = minimumSize
+	limits.maximumSize = maximumSize
+}
+
+func (limits *sizeLimits) maxBodySize() uint64 {
+	limits.mutex.RLock()
+	defer limits.mutex.RUnlock()
+	return limits.maxBodySizeLimit
+}
+
+func (limits *sizeLimits) sizeThresholds() (minimumSize, maximumSize uint64) {
+	limits.mutex.RLock()
+	defer limits.mutex.RUnlock()
+	return limits.minimumSize, limits.maximumSize
+}
+
 // Copied more or less from io.LimitedReader
 type limitedReader struct {
 	delegate          io.Reader
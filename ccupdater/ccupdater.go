@@ -2,6 +2,7 @@ package ccupdater
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -11,6 +12,10 @@ import (
 	"strings"
 
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/cloudfoundry-incubator/bits-service"
 
@@ -18,9 +23,11 @@ import (
 )
 
 type CCUpdater struct {
-	httpClient HttpClient
-	endpoint   string
-	method     string
+	httpClient     HttpClient
+	endpoint       string
+	method         string
+	retryPolicy    *bitsgo.RetryPolicy
+	metricsService bitsgo.MetricsService
 }
 
 type processingUploadPayload struct {
@@ -69,6 +76,14 @@ func NewCCUpdaterWithHttpClient(endpoint string, method string, httpClient HttpC
 	}
 }
 
+// WithRetryPolicy makes the CCUpdater retry network errors and responses which indicate that CC is temporarily
+// unavailable (502, 503, 504).
+func (updater *CCUpdater) WithRetryPolicy(policy bitsgo.RetryPolicy, metricsService bitsgo.MetricsService) *CCUpdater {
+	updater.retryPolicy = &policy
+	updater.metricsService = metricsService
+	return updater
+}
+
 func loadTLSConfig(clientCertFile string, clientKeyFile string, caCertFile string) *tls.Config {
 	cert, e := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
 	if e != nil {
@@ -90,12 +105,12 @@ func loadTLSConfig(clientCertFile string, clientKeyFile string, caCertFile strin
 	return tlsConfig
 }
 
-func (updater *CCUpdater) NotifyProcessingUpload(guid string) error {
-	return updater.update(guid, processingUploadPayload{"PROCESSING_UPLOAD"})
+func (updater *CCUpdater) NotifyProcessingUpload(ctx context.Context, guid string) error {
+	return updater.update(ctx, guid, processingUploadPayload{"PROCESSING_UPLOAD"})
 }
 
-func (updater *CCUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha256 string) error {
-	return updater.update(guid, successPayload{
+func (updater *CCUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha256 string) error {
+	return updater.update(ctx, guid, successPayload{
 		"READY",
 		[]checksum{
 			checksum{Type: "sha1", Value: sha1},
@@ -104,31 +119,56 @@ func (updater *CCUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha256
 	})
 }
 
-func (updater *CCUpdater) NotifyUploadFailed(guid string, e error) error {
-	return updater.update(guid, failurePayload{"FAILED", e.Error()})
+func (updater *CCUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) error {
+	return updater.update(ctx, guid, failurePayload{"FAILED", e.Error()})
 }
 
-func (updater *CCUpdater) update(guid string, p interface{}) error {
+// update deliberately does not bind ctx to the outgoing request: asynchronous uploads notify CC
+// after the incoming request has completed. ctx is only used to continue the trace.
+func (updater *CCUpdater) update(ctx context.Context, guid string, p interface{}) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "CCUpdater.update", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("bits.guid", guid), attribute.String("http.method", updater.method)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	payload, e := json.Marshal(p)
 	if e != nil {
 		logger.Log.Fatalw("Unexpected error in CC Updater update when marshalling payload",
 			"error", e, "guid", guid, "payload", p)
 	}
 
+	if updater.retryPolicy == nil {
+		return updater.send(ctx, span, guid, payload)
+	}
+	return updater.retryPolicy.Retry(updater.metricsService, "cc_updater", "update", func() error {
+		return updater.send(ctx, span, guid, payload)
+	})
+}
+
+func (updater *CCUpdater) send(ctx context.Context, span trace.Span, guid string, payload []byte) error {
 	r, e := http.NewRequest(updater.method, strings.TrimRight(updater.endpoint, "/")+"/"+guid, bytes.NewReader(payload))
 	if e != nil {
 		logger.Log.Fatalw("Unexpected error in CC Updater update when creating new request",
-			"error", e, "guid", guid, "payload", p)
+			"error", e, "guid", guid, "payload", string(payload))
 	}
+	if requestID := util.RequestIDFrom(ctx); requestID != "" {
+		r.Header.Set(util.RequestIDHeader, requestID)
+	}
+	tracing.Inject(ctx, r.Header)
 	resp, e := updater.httpClient.Do(r)
 	if e != nil {
 		return errors.Wrapf(e, "Could not make request against CC (GUID: \"%v\")", guid)
 	}
-	if resp.StatusCode == http.StatusNotFound {
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
 		return bitsgo.NewNotFoundError()
-	}
-	if resp.StatusCode == http.StatusUnprocessableEntity {
+	case http.StatusUnprocessableEntity:
 		return bitsgo.NewStateForbiddenError()
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return errors.Errorf("CC is unavailable (GUID: \"%v\", status code: %v)", guid, resp.StatusCode)
 	}
 	return nil
 }
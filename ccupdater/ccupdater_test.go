@@ -1,9 +1,11 @@
 package ccupdater_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/cloudfoundry-incubator/bits-service"
 
@@ -27,7 +29,7 @@ var _ = Describe("CCUpdater", func() {
 		It("works", func() {
 			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
 
-			e := updater.NotifyProcessingUpload("abc")
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
 
 			Expect(e).NotTo(HaveOccurred())
 
@@ -37,11 +39,22 @@ var _ = Describe("CCUpdater", func() {
 			Expect(ioutil.ReadAll(request.Body)).To(MatchJSON(`{"state":"PROCESSING_UPLOAD"}`))
 		})
 
+		It("forwards the request ID", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
+
+			e := updater.NotifyProcessingUpload(context.WithValue(context.Background(), "request-id", "some-request-id"), "abc")
+
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest()).GetCapturedArguments()
+			Expect(request.Header.Get("X-Vcap-Request-Id")).To(Equal("some-request-id"))
+		})
+
 		Context("http client returns some generic error", func() {
 			It("fails with a generic error", func() {
 				When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(nil, fmt.Errorf("Some network error"))
 
-				e := updater.NotifyProcessingUpload("abc")
+				e := updater.NotifyProcessingUpload(context.Background(), "abc")
 
 				Expect(e).To(MatchError(SatisfyAll(
 					ContainSubstring("Could not make request against CC"),
@@ -55,7 +68,7 @@ var _ = Describe("CCUpdater", func() {
 			It("fails with a generic error", func() {
 				When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusNotFound}, nil)
 
-				e := updater.NotifyProcessingUpload("abc")
+				e := updater.NotifyProcessingUpload(context.Background(), "abc")
 
 				Expect(e).To(Equal(bitsgo.NewNotFoundError()))
 			})
@@ -66,7 +79,7 @@ var _ = Describe("CCUpdater", func() {
 		It("works", func() {
 			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
 
-			e := updater.NotifyUploadSucceeded("abc", "sha1", "sha256")
+			e := updater.NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")
 
 			Expect(e).NotTo(HaveOccurred())
 
@@ -93,7 +106,7 @@ var _ = Describe("CCUpdater", func() {
 		It("works", func() {
 			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
 
-			e := updater.NotifyUploadFailed("abc", fmt.Errorf("some error"))
+			e := updater.NotifyUploadFailed(context.Background(), "abc", fmt.Errorf("some error"))
 
 			Expect(e).NotTo(HaveOccurred())
 
@@ -106,4 +119,43 @@ var _ = Describe("CCUpdater", func() {
 			  }`))
 		})
 	})
+
+	Context("with a retry policy", func() {
+		BeforeEach(func() {
+			policy := bitsgo.DefaultRetryPolicy()
+			policy.InitialInterval = time.Millisecond
+			updater.WithRetryPolicy(policy, NewMockMetricsService())
+		})
+
+		It("retries while CC is unavailable and sends the same payload again", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).
+				ThenReturn(nil, fmt.Errorf("Some network error")).
+				ThenReturn(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil).
+				ThenReturn(&http.Response{}, nil)
+
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
+
+			Expect(e).NotTo(HaveOccurred())
+			requests := httpClient.VerifyWasCalled(Times(3)).Do(AnyPtrToHttpRequest()).GetAllCapturedArguments()
+			Expect(ioutil.ReadAll(requests[2].Body)).To(MatchJSON(`{"state":"PROCESSING_UPLOAD"}`))
+		})
+
+		It("does not retry when CC does not know the resource", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusNotFound}, nil)
+
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
+
+			Expect(e).To(Equal(bitsgo.NewNotFoundError()))
+			httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest())
+		})
+
+		It("gives up after the maximum number of attempts", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusBadGateway}, nil)
+
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
+
+			Expect(e).To(MatchError(ContainSubstring("CC is unavailable")))
+			httpClient.VerifyWasCalled(Times(4)).Do(AnyPtrToHttpRequest())
+		})
+	})
 })
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/config"
+	log "github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	"go.uber.org/zap"
+)
+
+// configReloader applies changes of the config file at runtime, as far as they don't require a restart:
+// logging level, signing and admin users, signing keys, body size limits, app stash size thresholds, maintenance mode
+// and read-only resource types.
+type configReloader struct {
+	// guards current and serializes reloads triggered via SIGHUP and the admin endpoint
+	mutex   sync.Mutex
+	current config.Config
+
+	logLevel                 zap.AtomicLevel
+	urlSigner                urlSignerValidator
+	maintenanceMode          *bitsgo.MaintenanceMode
+	basicAuthMiddleware      *middlewares.BasicAuthMiddleware
+	adminBasicAuthMiddleware *middlewares.BasicAuthMiddleware
+	appStashHandler          *bitsgo.AppStashHandler
+	packageHandler           *bitsgo.ResourceHandler
+	buildpackHandler         *bitsgo.ResourceHandler
+	dropletHandler           *bitsgo.ResourceHandler
+	buildpackCacheHandler    *bitsgo.ResourceHandler
+}
+
+// reload leaves the running configuration untouched when the config file is invalid or changes properties which require a restart.
+func (reloader *configReloader) reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	c, e := config.LoadConfig(*configPath)
+	if e != nil {
+		return e
+	}
+	if changes := config.NonReloadableChanges(reloader.current, c); len(changes) > 0 {
+		return fmt.Errorf("changing %v requires a restart. Please revert these changes or restart the bits-service", strings.Join(changes, ", "))
+	}
+	// the only step which can fail, so it must come first
+	e = setSigningKeys(reloader.urlSigner, c)
+	if e != nil {
+		return e
+	}
+
+	reloader.logLevel.SetLevel(zapLogLevelFrom(c.Logging.Level).Level())
+	reloader.basicAuthMiddleware.SetCredentials(basicAuthCredentialsFrom(c.SigningUsers)...)
+	reloader.adminBasicAuthMiddleware.SetCredentials(basicAuthCredentialsFrom(c.AdminUsers)...)
+	reloader.appStashHandler.SetMaxBodySizeLimit(c.AppStash.MaxBodySizeBytes())
+	reloader.appStashHandler.SetSizeThresholds(c.AppStashConfig.MinimumSizeBytes(), c.AppStashConfig.MaximumSizeBytes())
+	reloader.packageHandler.SetMaxBodySizeLimit(c.Packages.MaxBodySizeBytes())
+	reloader.packageHandler.SetSizeThresholds(c.AppStashConfig.MinimumSizeBytes(), c.AppStashConfig.MaximumSizeBytes())
+	reloader.buildpackHandler.SetMaxBodySizeLimit(c.Buildpacks.MaxBodySizeBytes())
+	reloader.dropletHandler.SetMaxBodySizeLimit(c.Droplets.MaxBodySizeBytes())
+	reloader.buildpackCacheHandler.SetMaxBodySizeLimit(c.BuildpackCache.MaxBodySizeBytes())
+	// only when changed, so that reloading does not revert maintenance mode toggled via the admin API
+	if c.MaintenanceMode != reloader.current.MaintenanceMode {
+		applyMaintenanceModeConfig(reloader.maintenanceMode, c.MaintenanceMode)
+	}
+	currentReadOnlyResourceTypes := reloader.current.ReadOnlyResourceTypesMap()
+	for resourceType, readOnly := range c.ReadOnlyResourceTypesMap() {
+		if readOnly != currentReadOnlyResourceTypes[resourceType] {
+			applyReadOnlyConfig(reloader.maintenanceMode, resourceType, readOnly)
+		}
+	}
+
+	reloader.current = c
+	return nil
+}
+
+func reloadOnSIGHUP(reloader *configReloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		e := reloader.reload()
+		if e != nil {
+			log.Log.Errorw("Could not reload config. Keeping the current config.", "error", e)
+			continue
+		}
+		log.Log.Infow("Reloaded config", "log-level", reloader.logLevel.Level().String())
+	}
+}
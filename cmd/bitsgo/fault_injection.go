@@ -0,0 +1,8 @@
+//go:build fault_injection
+// +build fault_injection
+
+package main
+
+func init() {
+	faultInjectionBuildTag = true
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/cloudfoundry-incubator/bits-service/audit"
 	"github.com/cloudfoundry-incubator/bits-service/ccupdater"
 	"github.com/cloudfoundry-incubator/bits-service/oci_registry"
 
@@ -24,11 +30,14 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/s3"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/webdav"
 	"github.com/cloudfoundry-incubator/bits-service/config"
+	"github.com/cloudfoundry-incubator/bits-service/jwtauth"
 	log "github.com/cloudfoundry-incubator/bits-service/logger"
 	"github.com/cloudfoundry-incubator/bits-service/middlewares"
 	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 	"github.com/cloudfoundry-incubator/bits-service/routes"
 	"github.com/cloudfoundry-incubator/bits-service/statsd"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	"github.com/pkg/errors"
 	"github.com/urfave/negroni"
 	"go.uber.org/zap"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -36,54 +45,198 @@ import (
 
 var (
 	configPath = kingpin.Flag("config", "specify config to use").Required().Short('c').String()
+	dumpConfig = kingpin.Flag("dump-config", "print the effective config, including environment overrides, with secrets redacted and exit").Bool()
+
+	_                     = kingpin.Command("serve", "run the bits-service").Default()
+	validateConfigCommand = kingpin.Command("validate-config", "validate the config strictly, report all errors and exit")
+	probeCredentials      = validateConfigCommand.Flag("probe-credentials", "also check that every configured blobstore can be accessed").Bool()
+	migrateCommand        = kingpin.Command("migrate", "copy all blobs of migrating blobstores from their old to their new blobstore and exit")
+	migrationStateDir     = migrateCommand.Flag("state-dir", "directory to keep the progress in, so that an interrupted migration can be resumed").Default(".").String()
 )
 
+// faultInjectionBuildTag is set in binaries built with the fault_injection tag, e.g. for acceptance tests. They
+// accept fault rules via the admin API even without a fault_injection config.
+var faultInjectionBuildTag bool
+
 func main() {
-	kingpin.Parse()
+	switch kingpin.Parse() {
+	case validateConfigCommand.FullCommand():
+		validateConfig(*configPath, *probeCredentials)
+		return
+	case migrateCommand.FullCommand():
+		migrate(*configPath, *migrationStateDir)
+		return
+	}
 
 	config, e := config.LoadConfig(*configPath)
 
 	if e != nil {
 		log.Log.Fatalw("Could not load config.", "error", e)
 	}
+	if *dumpConfig {
+		redactedConfig, e := config.RedactedYAML()
+		if e != nil {
+			log.Log.Fatalw("Could not dump config.", "error", e)
+		}
+		fmt.Print(string(redactedConfig))
+		return
+	}
 	log.Log.Infow("Logging level", "log-level", config.Logging.Level)
-	logger := createLoggerWith(config.Logging.Level)
+	logLevel := zapLogLevelFrom(config.Logging.Level)
+	logger := createLoggerWith(logLevel)
 	log.SetLogger(logger)
 
 	if config.Secret != "" {
 		log.Log.Infow("Config file uses deprecated \"secret\" property. Please consider using \"signing_keys\" instead.")
 	}
 
-	metricsService := statsd.NewMetricsService()
+	for _, signingUser := range config.SigningUsers {
+		if signingUser.Password != "" {
+			log.Log.Infow("Config file uses plaintext password for signing user. Please consider using \"password_hash\" instead.", "username", signingUser.Username)
+		}
+	}
+
+	metricsService := statsd.NewMetricsService(config.Metrics.Address, *config.Metrics.Prefix, config.Metrics.TagsMap(), config.Metrics.TimingSuffix)
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if config.Tracing.Enabled {
+		shutdownTracing, e = tracing.SetUpTracerProvider(config.Tracing)
+		if e != nil {
+			log.Log.Fatalw("Could not set up tracing", "error", e)
+		}
+	}
+
+	// Signers and the signature verification share one instance, so that single-use URLs can be tracked.
+	urlSigner := createURLSigner(config, metricsService)
+	maxSignedURLExpiry := config.SignedURLs.MaxExpiryDuration()
+
+	appStashBlobstore, signAppStashURLHandler, appStashCircuitBreakers := createAppStashBlobstore(config.AppStash, config.PublicEndpointUrl(), config.Port, urlSigner, config.AppStash.SignedURLExpiryDuration(), maxSignedURLExpiry, log.Log, metricsService)
+	packageBlobstore, signPackageURLHandler, packageCircuitBreakers := createBlobstoreAndSignURLHandler(config.Packages, config.PublicEndpointUrl(), config.Port, urlSigner, config.Packages.SignedURLExpiryDuration(), maxSignedURLExpiry, "packages", log.Log, metricsService)
+	dropletBlobstore, signDropletURLHandler, dropletCircuitBreakers := createBlobstoreAndSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.Port, urlSigner, config.Droplets.SignedURLExpiryDuration(), maxSignedURLExpiry, "droplets", log.Log, metricsService)
+	buildpackBlobstore, signBuildpackURLHandler, buildpackCircuitBreakers := createBlobstoreAndSignURLHandler(config.Buildpacks, config.PublicEndpointUrl(), config.Port, urlSigner, config.Buildpacks.SignedURLExpiryDuration(), maxSignedURLExpiry, "buildpacks", log.Log, metricsService)
+	buildpackCacheBlobstore, signBuildpackCacheURLHandler, buildpackCacheCircuitBreakers := createBuildpackCacheSignURLHandler(config.BuildpackCacheBlobstoreConfig(), config.PublicEndpointUrl(), config.Port, urlSigner, config.BuildpackCache.SignedURLExpiryDuration(), maxSignedURLExpiry, log.Log, metricsService)
 
-	appStashBlobstore, signAppStashURLHandler := createAppStashBlobstore(config.AppStash, config.PublicEndpointUrl(), config.Port, config.Secret, config.SigningKeysMap(), config.ActiveKeyID, log.Log, metricsService)
-	packageBlobstore, signPackageURLHandler := createBlobstoreAndSignURLHandler(config.Packages, config.PublicEndpointUrl(), config.Port, config.Secret, config.SigningKeysMap(), config.ActiveKeyID, "packages", log.Log, metricsService)
-	dropletBlobstore, signDropletURLHandler := createBlobstoreAndSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.Port, config.Secret, config.SigningKeysMap(), config.ActiveKeyID, "droplets", log.Log, metricsService)
-	buildpackBlobstore, signBuildpackURLHandler := createBlobstoreAndSignURLHandler(config.Buildpacks, config.PublicEndpointUrl(), config.Port, config.Secret, config.SigningKeysMap(), config.ActiveKeyID, "buildpacks", log.Log, metricsService)
-	buildpackCacheBlobstore, signBuildpackCacheURLHandler := createBuildpackCacheSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.Port, config.Secret, config.SigningKeysMap(), config.ActiveKeyID, log.Log, metricsService)
+	// Faults are injected closest to the blobstores, so that circuit breakers and retries see them like real ones.
+	var faultInjectionHandler *bitsgo.FaultInjectionHandler
+	if config.FaultInjection != nil || faultInjectionBuildTag {
+		log.Log.Warnw("Fault injection is enabled. This must never happen in production.")
+		faultInjector := decorator.NewFaultInjector(clock.New())
+		if config.FaultInjection != nil {
+			e := faultInjector.SetFaultRules(faultRulesFrom(config.FaultInjection.Faults))
+			if e != nil {
+				log.Log.Fatalw("Invalid fault_injection config", "error", e)
+			}
+		}
+		appStashBlobstore = decorator.ForBlobstoreWithFaultInjection(appStashBlobstore, faultInjector, "app_stash")
+		packageBlobstore = decorator.ForBlobstoreWithFaultInjection(packageBlobstore, faultInjector, "packages")
+		dropletBlobstore = decorator.ForBlobstoreWithFaultInjection(dropletBlobstore, faultInjector, "droplets")
+		buildpackBlobstore = decorator.ForBlobstoreWithFaultInjection(buildpackBlobstore, faultInjector, "buildpacks")
+		buildpackCacheBlobstore = decorator.ForBlobstoreWithFaultInjection(buildpackCacheBlobstore, faultInjector, "buildpack_cache")
+		faultInjectionHandler = bitsgo.NewFaultInjectionHandler(faultInjector)
+	}
+
+	appStashCircuitBreaker := createCircuitBreaker(config.AppStash, "app_stash", metricsService)
+	appStashBlobstore = withCircuitBreaker(appStashBlobstore, appStashCircuitBreaker)
+	packageCircuitBreaker := createCircuitBreaker(config.Packages, "packages", metricsService)
+	packageBlobstore = withCircuitBreaker(packageBlobstore, packageCircuitBreaker)
+	buildpackCircuitBreaker := createCircuitBreaker(config.Buildpacks, "buildpacks", metricsService)
+	buildpackBlobstore = withCircuitBreaker(buildpackBlobstore, buildpackCircuitBreaker)
+	// The buildpack cache lives in the droplet blobstore, so both share the limit of concurrent calls.
+	dropletCircuitBreaker := createCircuitBreaker(config.Droplets, "droplets", metricsService)
+	dropletBlobstore = withCircuitBreaker(dropletBlobstore, dropletCircuitBreaker)
+	buildpackCacheBlobstore = withCircuitBreaker(buildpackCacheBlobstore, dropletCircuitBreaker)
+
+	var circuitBreakers []bitsgo.CircuitBreakerStatusReporter
+	for _, memberCircuitBreakers := range [][]bitsgo.CircuitBreakerStatusReporter{appStashCircuitBreakers, packageCircuitBreakers, dropletCircuitBreakers, buildpackCircuitBreakers, buildpackCacheCircuitBreakers} {
+		circuitBreakers = append(circuitBreakers, memberCircuitBreakers...)
+	}
+	circuitBreakers = appendCircuitBreakers(circuitBreakers, appStashCircuitBreaker, packageCircuitBreaker, buildpackCircuitBreaker, dropletCircuitBreaker)
+
+	// Retries wrap the circuit breakers, so that calls rejected by them fail fast instead of being retried.
+	retryPolicy := retryPolicyFrom(config.RetryPolicy)
+	appStashBlobstore = decorator.ForBlobstoreWithRetries(appStashBlobstore, retryPolicy, metricsService, "app_stash")
+	packageBlobstore = decorator.ForBlobstoreWithRetries(packageBlobstore, retryPolicy, metricsService, "packages")
+	buildpackBlobstore = decorator.ForBlobstoreWithRetries(buildpackBlobstore, retryPolicy, metricsService, "buildpacks")
+	dropletBlobstore = decorator.ForBlobstoreWithRetries(dropletBlobstore, retryPolicy, metricsService, "droplets")
+	buildpackCacheBlobstore = decorator.ForBlobstoreWithRetries(buildpackCacheBlobstore, retryPolicy, metricsService, "buildpack_cache")
+
+	maintenanceMode := bitsgo.NewMaintenanceMode(clock.New())
+	applyMaintenanceModeConfig(maintenanceMode, config.MaintenanceMode)
+	for resourceType, readOnly := range config.ReadOnlyResourceTypesMap() {
+		applyReadOnlyConfig(maintenanceMode, resourceType, readOnly)
+	}
+
+	if config.Encryption != nil {
+		keyring := decorator.NewEncryptionKeyring(config.Encryption.KeysMap(), config.Encryption.ActiveKeyID)
+		appStashBlobstore = withEncryption(appStashBlobstore, keyring, config.Encryption, maintenanceMode, "app_stash")
+		packageBlobstore = withEncryption(packageBlobstore, keyring, config.Encryption, maintenanceMode, "packages")
+		dropletBlobstore = withEncryption(dropletBlobstore, keyring, config.Encryption, maintenanceMode, "droplets")
+		buildpackBlobstore = withEncryption(buildpackBlobstore, keyring, config.Encryption, maintenanceMode, "buildpacks")
+		buildpackCacheBlobstore = withEncryption(buildpackCacheBlobstore, keyring, config.Encryption, maintenanceMode, "buildpack_cache")
+	}
+
+	// compressing must happen before encrypting, since encrypted content does not compress
+	if config.Compression != nil {
+		appStashBlobstore = withCompression(appStashBlobstore, config.Compression, "app_stash")
+		packageBlobstore = withCompression(packageBlobstore, config.Compression, "packages")
+		dropletBlobstore = withCompression(dropletBlobstore, config.Compression, "droplets")
+		buildpackBlobstore = withCompression(buildpackBlobstore, config.Compression, "buildpacks")
+		buildpackCacheBlobstore = withCompression(buildpackCacheBlobstore, config.Compression, "buildpack_cache")
+	}
+
+	signPackageURLHandler = withLocalSignedURLs(signPackageURLHandler, config, urlSigner, config.Packages, "packages", "packages")
+	signDropletURLHandler = withLocalSignedURLs(signDropletURLHandler, config, urlSigner, config.Droplets, "droplets", "droplets")
+	signBuildpackURLHandler = withLocalSignedURLs(signBuildpackURLHandler, config, urlSigner, config.Buildpacks, "buildpacks", "buildpacks")
+	signBuildpackCacheURLHandler = withLocalSignedURLs(signBuildpackCacheURLHandler, config, urlSigner, config.BuildpackCache, "buildpack_cache", "buildpack_cache/entries")
+
+	if config.DiskCache != nil {
+		diskCache := decorator.NewDiskCache(config.DiskCache.Directory, config.DiskCache.MaxSizeBytes(), config.DiskCache.NegativeTTLDuration(), clock.New())
+		appStashBlobstore = withDiskCache(appStashBlobstore, config.AppStash, diskCache, metricsService, "app_stash")
+		dropletBlobstore = withDiskCache(dropletBlobstore, config.Droplets, diskCache, metricsService, "droplets")
+	}
+
+	var quotaHandler *bitsgo.QuotaHandler
+	if config.Quotas != nil {
+		quotaTracker, e := decorator.NewQuotaTracker(config.Quotas.DefaultLimitBytes(), config.Quotas.LimitsBytes(), config.Quotas.StateFile, clock.New(), metricsService)
+		if e != nil {
+			log.Log.Fatalw("Could not create quota tracker", "error", e)
+		}
+		packageBlobstore = withQuotas(packageBlobstore, quotaTracker, config.Quotas, config.Packages, "packages")
+		dropletBlobstore = withQuotas(dropletBlobstore, quotaTracker, config.Quotas, config.Droplets, "droplets")
+		buildpackCacheBlobstore = withQuotas(buildpackCacheBlobstore, quotaTracker, config.Quotas, config.Droplets, "buildpack_cache")
+		go quotaTracker.Run(config.Quotas.ReconcileIntervalDuration())
+		quotaHandler = bitsgo.NewQuotaHandler(quotaTracker)
+	}
+
+	appStashBlobstore = decorator.ForBlobstoreWithReadOnlyMode(appStashBlobstore, maintenanceMode, "app_stash")
+	packageBlobstore = decorator.ForBlobstoreWithReadOnlyMode(packageBlobstore, maintenanceMode, "packages")
+	dropletBlobstore = decorator.ForBlobstoreWithReadOnlyMode(dropletBlobstore, maintenanceMode, "droplets")
+	buildpackBlobstore = decorator.ForBlobstoreWithReadOnlyMode(buildpackBlobstore, maintenanceMode, "buildpacks")
+	buildpackCacheBlobstore = decorator.ForBlobstoreWithReadOnlyMode(buildpackCacheBlobstore, maintenanceMode, "buildpack_cache")
+
+	// Without tracing enabled, the global tracer is a no-op. So decorating unconditionally is cheap.
+	appStashBlobstore = decorator.ForBlobstoreWithTracing(appStashBlobstore, "app_stash")
+	packageBlobstore = decorator.ForBlobstoreWithTracing(packageBlobstore, "packages")
+	dropletBlobstore = decorator.ForBlobstoreWithTracing(dropletBlobstore, "droplets")
+	buildpackBlobstore = decorator.ForBlobstoreWithTracing(buildpackBlobstore, "buildpacks")
+	buildpackCacheBlobstore = decorator.ForBlobstoreWithTracing(buildpackCacheBlobstore, "buildpack_cache")
 
 	go regularlyEmitGoRoutines(metricsService)
 
-	handler := routes.SetUpAllRoutes(
-		config.PrivateEndpointUrl().Host,
-		config.PublicEndpointUrl().Host,
-		middlewares.NewBasicAuthMiddleWare(basicAuthCredentialsFrom(config.SigningUsers)...),
-		&middlewares.SignatureVerificationMiddleware{pathsigner.Validate(&pathsigner.PathSignerValidator{
-			config.Secret,
-			clock.New(),
-			config.SigningKeysMap(),
-			config.ActiveKeyID,
-		})},
-		signPackageURLHandler,
-		signDropletURLHandler,
-		signBuildpackURLHandler,
-		signBuildpackCacheURLHandler,
-		signAppStashURLHandler,
-		bitsgo.NewAppStashHandlerWithSizeThresholds(appStashBlobstore, config.AppStash.MaxBodySizeBytes(), config.AppStashConfig.MinimumSizeBytes(), config.AppStashConfig.MaximumSizeBytes(), metricsService),
-		bitsgo.NewResourceHandlerWithUpdaterAndSizeThresholds(
+	reloader := &configReloader{
+		current:         config,
+		logLevel:        logLevel,
+		urlSigner:       urlSigner,
+		maintenanceMode: maintenanceMode,
+		basicAuthMiddleware: middlewares.NewBasicAuthMiddleWare(basicAuthCredentialsFrom(config.SigningUsers)...).
+			WithFailureLimit(config.BasicAuthFailureLimit.MaxFailures, config.BasicAuthFailureLimit.WindowDuration(), clock.New()),
+		adminBasicAuthMiddleware: middlewares.NewBasicAuthMiddleWare(basicAuthCredentialsFrom(config.AdminUsers)...).
+			WithFailureLimit(config.BasicAuthFailureLimit.MaxFailures, config.BasicAuthFailureLimit.WindowDuration(), clock.New()),
+		appStashHandler: bitsgo.NewAppStashHandlerWithSizeThresholds(appStashBlobstore, config.AppStash.MaxBodySizeBytes(), config.AppStashConfig.MinimumSizeBytes(), config.AppStashConfig.MaximumSizeBytes(), metricsService),
+		packageHandler: bitsgo.NewResourceHandlerWithUpdaterAndSizeThresholds(
 			packageBlobstore,
 			appStashBlobstore,
-			createUpdater(config.CCUpdater),
+			createUpdater(config.CCUpdater, retryPolicy, metricsService),
 			"package",
 			metricsService,
 			config.Packages.MaxBodySizeBytes(),
@@ -91,9 +244,37 @@ func main() {
 			config.AppStashConfig.MaximumSizeBytes(),
 			config.ShouldProxyGetRequests,
 		),
-		bitsgo.NewResourceHandler(buildpackBlobstore, appStashBlobstore, "buildpack", metricsService, config.Buildpacks.MaxBodySizeBytes(), config.ShouldProxyGetRequests),
-		bitsgo.NewResourceHandler(dropletBlobstore, appStashBlobstore, "droplet", metricsService, config.Droplets.MaxBodySizeBytes(), config.ShouldProxyGetRequests),
-		bitsgo.NewResourceHandler(buildpackCacheBlobstore, appStashBlobstore, "buildpack_cache", metricsService, config.BuildpackCache.MaxBodySizeBytes(), config.ShouldProxyGetRequests))
+		buildpackHandler:      bitsgo.NewResourceHandler(buildpackBlobstore, appStashBlobstore, "buildpack", metricsService, config.Buildpacks.MaxBodySizeBytes(), config.ShouldProxyGetRequests),
+		dropletHandler:        bitsgo.NewResourceHandler(dropletBlobstore, appStashBlobstore, "droplet", metricsService, config.Droplets.MaxBodySizeBytes(), config.ShouldProxyGetRequests),
+		buildpackCacheHandler: bitsgo.NewResourceHandler(buildpackCacheBlobstore, appStashBlobstore, "buildpack_cache", metricsService, config.BuildpackCache.MaxBodySizeBytes(), config.ShouldProxyGetRequests),
+	}
+	go reloadOnSIGHUP(reloader)
+
+	handler := routes.SetUpAllRoutes(
+		config.PrivateEndpointUrl().Host,
+		config.PublicEndpointUrl().Host,
+		reloader.basicAuthMiddleware,
+		reloader.adminBasicAuthMiddleware,
+		createJWTAuthMiddleware(config.JWT),
+		createClientCertAuthMiddleware(config.ClientCertAuth),
+		&middlewares.SignatureVerificationMiddleware{urlSigner},
+		signPackageURLHandler,
+		signDropletURLHandler,
+		signBuildpackURLHandler,
+		signBuildpackCacheURLHandler,
+		signAppStashURLHandler,
+		reloader.appStashHandler,
+		reloader.packageHandler,
+		reloader.buildpackHandler,
+		reloader.dropletHandler,
+		reloader.buildpackCacheHandler,
+		bitsgo.NewSigningKeysHandler(urlSigner, reloader.reload),
+		bitsgo.NewConfigReloadHandler(reloader.reload),
+		quotaHandler,
+		bitsgo.NewMaintenanceModeHandler(maintenanceMode),
+		&middlewares.MaintenanceModeMiddleware{Mode: maintenanceMode},
+		faultInjectionHandler,
+		bitsgo.NewHealthHandler(circuitBreakers...))
 
 	if config.EnableRegistry {
 		routes.AddImageHandler(handler, &oci_registry.ImageHandler{
@@ -114,35 +295,119 @@ func main() {
 		address = "0.0.0.0"
 	}
 
+	negroniHandlers := []negroni.Handler{
+		middlewares.NewTracingMiddleware(),
+		middlewares.NewMetricsMiddleware(metricsService),
+		middlewares.NewZapLoggerMiddleware(log.Log),
+	}
+	if config.Audit.Enabled {
+		negroniHandlers = append(negroniHandlers, middlewares.NewAuditMiddleware(createAuditLogger(config.Audit)))
+	}
+	negroniHandlers = append(negroniHandlers,
+		&middlewares.MultipartMiddleware{},
+		&middlewares.PanicMiddleware{},
+		negroni.Wrap(handler))
+
 	httpServer := &http.Server{
-		Handler: negroni.New(
-			middlewares.NewMetricsMiddleware(metricsService),
-			middlewares.NewZapLoggerMiddleware(log.Log),
-			&middlewares.MultipartMiddleware{},
-			&middlewares.PanicMiddleware{},
-			negroni.Wrap(handler)),
+		Handler:      negroni.New(negroniHandlers...),
 		WriteTimeout: 60 * time.Minute,
 		ReadTimeout:  60 * time.Minute,
 		ErrorLog:     log.NewStdLog(logger),
 	}
+	serverErrors := make(chan error, 2)
 	if config.HttpEnabled {
-		go listenAndServe(httpServer, address, config)
+		go func() { serverErrors <- listenAndServe(httpServer, address, config) }()
+	}
+	go func() { serverErrors <- listenAndServeTLS(httpServer, address, config) }()
+
+	terminationSignals := make(chan os.Signal, 1)
+	signal.Notify(terminationSignals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case e := <-serverErrors:
+		flushSpans(shutdownTracing)
+		log.Log.Fatalw("Server crashed", "error", e)
+	case terminationSignal := <-terminationSignals:
+		log.Log.Infow("Shutting down", "signal", terminationSignal)
+		flushSpans(shutdownTracing)
 	}
-	listenAndServeTLS(httpServer, address, config)
 }
 
-func listenAndServe(httpServer *http.Server, address string, c config.Config) {
+// flushSpans exports spans which have not been exported yet. It must be called before exiting, since ending
+// main does not run deferred calls when the servers never return.
+func flushSpans(shutdownTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e := shutdownTracing(ctx)
+	if e != nil {
+		log.Log.Errorw("Could not flush spans", "error", e)
+	}
+}
+
+type urlSignerValidator interface {
+	pathsigner.PathSigner
+	pathsigner.PathSignatureValidator
+	bitsgo.SigningKeysStatusReporter
+}
+
+func createURLSigner(c config.Config, metricsService bitsgo.MetricsService) urlSignerValidator {
+	var nonceStore pathsigner.NonceStore
+	if c.SignedURLs.SingleUse {
+		nonceStore = pathsigner.NewInMemoryNonceStore(clock.New(), c.SignedURLs.NonceStoreSize)
+	}
+	if len(c.AsymmetricSigningKeys) > 0 {
+		if c.ActiveKeyID == "" {
+			log.Log.Infow("No active_key_id configured for asymmetric_signing_keys. Signed URLs can be validated, but not created.")
+		}
+		return pathsigner.ValidateAsymmetric(&pathsigner.AsymmetricPathSignerValidator{
+			Clock:        clock.New(),
+			PrivateKeys:  c.AsymmetricPrivateKeysMap(),
+			PublicKeys:   c.AsymmetricPublicKeysMap(),
+			ActiveKeyID:  c.ActiveKeyID,
+			KeysNotAfter: c.SigningKeysNotAfterMap(),
+			NonceStore:   nonceStore,
+			Metrics:      metricsService,
+		})
+	}
+	return pathsigner.Validate(&pathsigner.PathSignerValidator{
+		Secret:                 c.Secret,
+		Clock:                  clock.New(),
+		SigningKeys:            c.SigningKeysMap(),
+		ActiveKeyID:            c.ActiveKeyID,
+		KeysNotAfter:           c.SigningKeysNotAfterMap(),
+		AcceptLegacySignatures: c.AcceptLegacySignatures,
+		NonceStore:             nonceStore,
+		Metrics:                metricsService,
+	})
+}
+
+func setSigningKeys(urlSigner urlSignerValidator, c config.Config) error {
+	switch urlSigner := urlSigner.(type) {
+	case *pathsigner.AsymmetricPathSignerValidator:
+		if len(c.AsymmetricSigningKeys) == 0 {
+			return errors.New("switching from asymmetric_signing_keys to signing_keys requires a restart")
+		}
+		return urlSigner.SetKeys(c.AsymmetricPrivateKeysMap(), c.AsymmetricPublicKeysMap(), c.SigningKeysNotAfterMap(), c.ActiveKeyID)
+	case *pathsigner.PathSignerValidator:
+		if len(c.AsymmetricSigningKeys) > 0 {
+			return errors.New("switching from signing_keys to asymmetric_signing_keys requires a restart")
+		}
+		return urlSigner.SetSigningKeys(c.SigningKeysMap(), c.SigningKeysNotAfterMap(), c.ActiveKeyID)
+	default:
+		panic("unexpected URL signer type")
+	}
+}
+
+func listenAndServe(httpServer *http.Server, address string, c config.Config) error {
 	httpServer.Addr = fmt.Sprintf("%v:%v", address, c.HttpPort)
 	log.Log.Infow("Starting HTTP server",
 		"ip-address", address,
 		"port", c.HttpPort,
 		"public-endpoint", c.PublicEndpointUrl().Host,
 		"private-endpoint", c.PrivateEndpointUrl().Host)
-	e := httpServer.ListenAndServe()
-	log.Log.Fatalw("HTTP server crashed", "error", e)
+	return errors.Wrap(httpServer.ListenAndServe(), "HTTP server crashed")
 }
 
-func listenAndServeTLS(httpServer *http.Server, address string, c config.Config) {
+func listenAndServeTLS(httpServer *http.Server, address string, c config.Config) error {
 	httpServer.Addr = fmt.Sprintf("%v:%v", address, c.Port)
 	// TLSConfig taken from https://blog.cloudflare.com/exposing-go-on-the-internet/
 	httpServer.TLSConfig = &tls.Config{
@@ -173,18 +438,55 @@ func listenAndServeTLS(httpServer *http.Server, address string, c config.Config)
 		},
 	}
 
+	if c.ClientCertAuth != nil {
+		requestClientCertsOnPrivateEndpoint(httpServer.TLSConfig, c)
+	}
+
 	log.Log.Infow("Starting HTTPS server",
 		"ip-address", address,
 		"port", c.Port,
 		"public-endpoint", c.PublicEndpointUrl().Host,
 		"private-endpoint", c.PrivateEndpointUrl().Host)
-	e := httpServer.ListenAndServeTLS(c.CertFile, c.KeyFile)
-	log.Log.Fatalw("HTTPS server crashed", "error", e)
+	return errors.Wrap(httpServer.ListenAndServeTLS(c.CertFile, c.KeyFile), "HTTPS server crashed")
 }
 
-func createLoggerWith(logLevel string) *zap.Logger {
+// requestClientCertsOnPrivateEndpoint selects the TLS config by SNI, so that clients of the public endpoint are not asked
+// for certificates. As clients can send any SNI, the routing layer checks for a verified certificate as well.
+func requestClientCertsOnPrivateEndpoint(tlsConfig *tls.Config, c config.Config) {
+	// Loading the certificate here, since the TLS config of the private endpoint is derived before the server loads it
+	certificate, e := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if e != nil {
+		log.Log.Fatalw("Could not load certificate", "error", e, "cert-file", c.CertFile, "key-file", c.KeyFile)
+	}
+	tlsConfig.Certificates = []tls.Certificate{certificate}
+
+	privateTLSConfig := tlsConfig.Clone()
+	privateTLSConfig.ClientCAs = loadCertPool(c.ClientCertAuth.CACertFile)
+	privateTLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.ClientCertAuth.Mode == config.RequiredClientCertMode {
+		privateTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	privateHost := c.PrivateEndpointUrl().Hostname()
+	tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if strings.EqualFold(hello.ServerName, privateHost) {
+			return privateTLSConfig, nil
+		}
+		return nil, nil
+	}
+}
+
+func createAuditLogger(auditConfig config.AuditConfig) *audit.Logger {
+	sink, e := audit.NewSinkFrom(auditConfig.Sink, auditConfig.File, auditConfig.SyslogTag, auditConfig.WebhookURL)
+	if e != nil {
+		log.Log.Fatalw("Could not create audit sink", "error", e, "sink", auditConfig.Sink)
+	}
+	log.Log.Infow("Audit log enabled", "sink", auditConfig.Sink)
+	return audit.NewLogger(sink)
+}
+
+func createLoggerWith(logLevel zap.AtomicLevel) *zap.Logger {
 	loggerConfig := zap.NewProductionConfig()
-	loggerConfig.Level = zapLogLevelFrom(logLevel)
+	loggerConfig.Level = logLevel
 	loggerConfig.DisableStacktrace = true
 	loggerConfig.Sampling = nil
 	logger, e := loggerConfig.Build()
@@ -220,8 +522,8 @@ func basicAuthCredentialsFrom(configCredententials []config.Credential) (basicAu
 	return
 }
 
-func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, secret string, signingKeys map[string]string, activeKeyID string, resourceType string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler) {
-	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, secret, signingKeys, activeKeyID, resourceType)
+func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, urlSigner pathsigner.PathSigner, signedURLExpiry, maxSignedURLExpiry time.Duration, resourceType string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, urlSigner, resourceType)
 	switch blobstoreConfig.BlobstoreType {
 	case config.Local:
 		log.Log.Infow("Creating local blobstore", "path-prefix", blobstoreConfig.LocalConfig.PathPrefix)
@@ -230,7 +532,7 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					local.NewBlobstore(*blobstoreConfig.LocalConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(localResourceSigner, localResourceSigner)
+			bitsgo.NewSignResourceHandlerWithExpiry(localResourceSigner, localResourceSigner, signedURLExpiry, maxSignedURLExpiry), nil
 	case config.AWS:
 		log.Log.Infow("Creating S3 blobstore", "bucket", blobstoreConfig.S3Config.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -238,10 +540,12 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, logger),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, logger)),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.Google:
 		log.Log.Infow("Creating GCP blobstore", "bucket", blobstoreConfig.GCPConfig.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -249,10 +553,12 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					gcp.NewBlobstore(*blobstoreConfig.GCPConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					gcp.NewBlobstore(*blobstoreConfig.GCPConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.Azure:
 		log.Log.Infow("Creating Azure blobstore", "container", blobstoreConfig.AzureConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -260,10 +566,12 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					azure.NewBlobstore(*blobstoreConfig.AzureConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					azure.NewBlobstore(*blobstoreConfig.AzureConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.OpenStack:
 		log.Log.Infow("Creating Openstack blobstore", "container", blobstoreConfig.OpenstackConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -271,10 +579,12 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.WebDAV:
 		log.Log.Infow("Creating Webdav blobstore",
 			"public-endpoint", blobstoreConfig.WebdavConfig.PublicEndpoint,
@@ -286,12 +596,14 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 						metricsService,
 						resourceType),
 					blobstoreConfig.WebdavConfig.DirectoryKey+"/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						webdav.NewBlobstore(*blobstoreConfig.WebdavConfig),
 						blobstoreConfig.WebdavConfig.DirectoryKey+"/")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.Alibaba:
 		log.Log.Infow("Creating Alibaba blobstore", "bucket", blobstoreConfig.AlibabaConfig.BucketName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -299,18 +611,29 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
+	case config.Replicated:
+		return createReplicatedBlobstore(*blobstoreConfig.ReplicatedConfig, resourceType, metricsService, func(memberConfig config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+			return createBlobstoreAndSignURLHandler(memberConfig, publicEndpoint, port, urlSigner, signedURLExpiry, maxSignedURLExpiry, resourceType, logger, metricsService)
+		})
+	case config.Migrating:
+		blobstore, circuitBreakers := createMigratingBlobstore(*blobstoreConfig.MigratingConfig, resourceType, metricsService, func(memberConfig config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+			return createBlobstoreAndSignURLHandler(memberConfig, publicEndpoint, port, urlSigner, signedURLExpiry, maxSignedURLExpiry, resourceType, logger, metricsService)
+		})
+		return blobstore, bitsgo.NewSignResourceHandlerWithExpiry(localResourceSigner, localResourceSigner, signedURLExpiry, maxSignedURLExpiry), circuitBreakers
 	default:
 		log.Log.Fatalw("blobstoreConfig is invalid.", "blobstore-type", blobstoreConfig.BlobstoreType)
-		return nil, nil // satisfy compiler
+		return nil, nil, nil // satisfy compiler
 	}
 }
 
-func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, secret string, signingKeys map[string]string, activeKeyID string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler) {
-	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, secret, signingKeys, activeKeyID, "buildpack_cache/entries")
+func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, urlSigner pathsigner.PathSigner, signedURLExpiry, maxSignedURLExpiry time.Duration, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, urlSigner, "buildpack_cache/entries")
 	switch blobstoreConfig.BlobstoreType {
 	case config.Local:
 		log.Log.Infow("Creating local blobstore", "path-prefix", blobstoreConfig.LocalConfig.PathPrefix)
@@ -321,7 +644,7 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(localResourceSigner, localResourceSigner)
+			bitsgo.NewSignResourceHandlerWithExpiry(localResourceSigner, localResourceSigner, signedURLExpiry, maxSignedURLExpiry), nil
 	case config.AWS:
 		log.Log.Infow("Creating S3 blobstore", "bucket", blobstoreConfig.S3Config.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -331,12 +654,14 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, logger),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.Google:
 		log.Log.Infow("Creating GCP blobstore", "bucket", blobstoreConfig.GCPConfig.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -346,12 +671,14 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						gcp.NewBlobstore(*blobstoreConfig.GCPConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.Azure:
 		log.Log.Infow("Creating Azure blobstore", "container", blobstoreConfig.AzureConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -361,12 +688,14 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						azure.NewBlobstore(*blobstoreConfig.AzureConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.OpenStack:
 		log.Log.Infow("Creating Openstack blobstore", "container", blobstoreConfig.OpenstackConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -376,12 +705,14 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.WebDAV:
 		log.Log.Infow("Creating Webdav blobstore",
 			"public-endpoint", blobstoreConfig.WebdavConfig.PublicEndpoint,
@@ -393,12 +724,14 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					blobstoreConfig.WebdavConfig.DirectoryKey+"/buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						webdav.NewBlobstore(*blobstoreConfig.WebdavConfig),
 						blobstoreConfig.WebdavConfig.DirectoryKey+"/buildpack_cache/")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
 	case config.Alibaba:
 		log.Log.Infow("Creating Alibaba blobstore", "bucket", blobstoreConfig.AlibabaConfig.BucketName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -408,44 +741,47 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithExpiry(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				signedURLExpiry,
+				maxSignedURLExpiry), nil
+	case config.Replicated:
+		return createReplicatedBlobstore(*blobstoreConfig.ReplicatedConfig, "buildpack_cache", metricsService, func(memberConfig config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+			return createBuildpackCacheSignURLHandler(memberConfig, publicEndpoint, port, urlSigner, signedURLExpiry, maxSignedURLExpiry, logger, metricsService)
+		})
+	case config.Migrating:
+		blobstore, circuitBreakers := createMigratingBlobstore(*blobstoreConfig.MigratingConfig, "buildpack_cache", metricsService, func(memberConfig config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+			return createBuildpackCacheSignURLHandler(memberConfig, publicEndpoint, port, urlSigner, signedURLExpiry, maxSignedURLExpiry, logger, metricsService)
+		})
+		return blobstore, bitsgo.NewSignResourceHandlerWithExpiry(localResourceSigner, localResourceSigner, signedURLExpiry, maxSignedURLExpiry), circuitBreakers
 	default:
 		log.Log.Fatalw("blobstoreConfig is invalid.", "blobstore-type", blobstoreConfig.BlobstoreType)
-		return nil, nil // satisfy compiler
+		return nil, nil, nil // satisfy compiler
 	}
 }
 
-func createLocalResourceSigner(publicEndpoint *url.URL, port int, secret string, signingKeys map[string]string, activeKeyID string, resourceType string) bitsgo.ResourceSigner {
+func createLocalResourceSigner(publicEndpoint *url.URL, port int, urlSigner pathsigner.PathSigner, resourceType string) bitsgo.ResourceSigner {
 	return &local.LocalResourceSigner{
-		DelegateEndpoint: fmt.Sprintf("%v://%v:%v", publicEndpoint.Scheme, publicEndpoint.Host, port),
-		Signer: pathsigner.Validate(&pathsigner.PathSignerValidator{
-			Secret:      secret,
-			Clock:       clock.New(),
-			SigningKeys: signingKeys,
-			ActiveKeyID: activeKeyID,
-		}),
+		DelegateEndpoint:   fmt.Sprintf("%v://%v:%v", publicEndpoint.Scheme, publicEndpoint.Host, port),
+		Signer:             urlSigner,
 		ResourcePathPrefix: "/" + resourceType + "/",
 	}
 }
 
-func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, secret string, signingKeys map[string]string, activeKeyID string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler) {
-	signAppStashMatchesHandler := bitsgo.NewSignResourceHandler(
+func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, urlSigner pathsigner.PathSigner, signedURLExpiry, maxSignedURLExpiry time.Duration, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+	signAppStashMatchesHandler := bitsgo.NewSignResourceHandlerWithExpiry(
 		nil, // signing for get is not necessary for app_stash
 		&local.LocalResourceSigner{
-			DelegateEndpoint: fmt.Sprintf("%v://%v:%v", publicEndpoint.Scheme, publicEndpoint.Host, port),
-			Signer: pathsigner.Validate(&pathsigner.PathSignerValidator{
-				Secret:      secret,
-				Clock:       clock.New(),
-				SigningKeys: signingKeys,
-				ActiveKeyID: activeKeyID,
-			}),
+			DelegateEndpoint:   fmt.Sprintf("%v://%v:%v", publicEndpoint.Scheme, publicEndpoint.Host, port),
+			Signer:             urlSigner,
 			ResourcePathPrefix: "/app_stash/matches",
-		})
+		},
+		signedURLExpiry,
+		maxSignedURLExpiry)
 
 	switch blobstoreConfig.BlobstoreType {
 	case config.Local:
@@ -457,7 +793,7 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					"app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
 	case config.AWS:
 		log.Log.Infow("Creating S3 blobstore", "bucket", blobstoreConfig.S3Config.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -467,7 +803,7 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					"app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
 	case config.Google:
 		log.Log.Infow("Creating GCP blobstore", "bucket", blobstoreConfig.GCPConfig.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -477,7 +813,7 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					"app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
 	case config.Azure:
 		log.Log.Infow("Creating Azure blobstore", "container", blobstoreConfig.AzureConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -487,7 +823,7 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					"app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
 	case config.OpenStack:
 		log.Log.Infow("Creating Openstack blobstore", "container", blobstoreConfig.OpenstackConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -497,7 +833,7 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					"app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
 	case config.WebDAV:
 		log.Log.Infow("Creating Webdav blobstore",
 			"public-endpoint", blobstoreConfig.WebdavConfig.PublicEndpoint,
@@ -509,7 +845,7 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					blobstoreConfig.WebdavConfig.DirectoryKey+"/app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
 	case config.Alibaba:
 		log.Log.Infow("Creating Alibaba blobstore", "bucket-name", blobstoreConfig.AlibabaConfig.BucketName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -519,13 +855,93 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 						metricsService,
 						"app_stash"),
 					"app_bits_cache/")),
-			signAppStashMatchesHandler
+			signAppStashMatchesHandler, nil
+	case config.Replicated:
+		return createReplicatedBlobstore(*blobstoreConfig.ReplicatedConfig, "app_stash", metricsService, func(memberConfig config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+			return createAppStashBlobstore(memberConfig, publicEndpoint, port, urlSigner, signedURLExpiry, maxSignedURLExpiry, logger, metricsService)
+		})
+	case config.Migrating:
+		blobstore, circuitBreakers := createMigratingBlobstore(*blobstoreConfig.MigratingConfig, "app_stash", metricsService, func(memberConfig config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+			return createAppStashBlobstore(memberConfig, publicEndpoint, port, urlSigner, signedURLExpiry, maxSignedURLExpiry, logger, metricsService)
+		})
+		return blobstore, signAppStashMatchesHandler, circuitBreakers
 	default:
 		log.Log.Fatalw("blobstoreConfig is invalid.", "blobstore-type", blobstoreConfig.BlobstoreType)
-		return nil, nil // satisfy compiler
+		return nil, nil, nil // satisfy compiler
 	}
 }
 
+// createReplicatedBlobstore creates the members of a replicated blobstore using create. Signed URLs point to the primary.
+func createReplicatedBlobstore(replicatedConfig config.ReplicatedBlobstoreConfig, resourceType string, metricsService bitsgo.MetricsService, create func(config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter)) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter) {
+	log.Log.Infow("Creating replicated blobstore", "mode", replicatedConfig.Mode, "secondaries", len(replicatedConfig.Secondaries))
+	primary, signURLHandler, circuitBreakers := create(replicatedConfig.Primary)
+	primaryCircuitBreaker := createCircuitBreaker(replicatedConfig.Primary, resourceType+"-primary", metricsService)
+	primary = withCircuitBreaker(primary, primaryCircuitBreaker)
+	circuitBreakers = appendCircuitBreakers(circuitBreakers, primaryCircuitBreaker)
+	var secondaries []bitsgo.Blobstore
+	for i, secondaryConfig := range replicatedConfig.Secondaries {
+		secondary, _, secondaryCircuitBreakers := create(secondaryConfig)
+		secondaryCircuitBreaker := createCircuitBreaker(secondaryConfig, fmt.Sprintf("%v-secondary-%v", resourceType, i), metricsService)
+		secondary = withCircuitBreaker(secondary, secondaryCircuitBreaker)
+		circuitBreakers = appendCircuitBreakers(append(circuitBreakers, secondaryCircuitBreakers...), secondaryCircuitBreaker)
+		secondaries = append(secondaries, secondary)
+	}
+	queue := decorator.NewReplicationQueue(
+		replicatedConfig.QueueSize,
+		replicatedConfig.RetryIntervalDuration(),
+		replicatedConfig.MaxAttempts,
+		clock.New(),
+		metricsService,
+		resourceType)
+	return decorator.ForBlobstoreWithReplication(primary, secondaries, queue, replicatedConfig.Mode == config.AsyncReplication), signURLHandler, circuitBreakers
+}
+
+// createMigratingBlobstore creates the old and the new blobstore using create. Signed URLs must point to the
+// bits-service, because blobs might be in either blobstore.
+func createMigratingBlobstore(migratingConfig config.MigratingBlobstoreConfig, resourceType string, metricsService bitsgo.MetricsService, create func(config.BlobstoreConfig) (bitsgo.Blobstore, *bitsgo.SignResourceHandler, []bitsgo.CircuitBreakerStatusReporter)) (bitsgo.Blobstore, []bitsgo.CircuitBreakerStatusReporter) {
+	log.Log.Infow("Creating migrating blobstore", "from", migratingConfig.From.BlobstoreType, "to", migratingConfig.To.BlobstoreType)
+	from, _, fromCircuitBreakers := create(migratingConfig.From)
+	fromCircuitBreaker := createCircuitBreaker(migratingConfig.From, resourceType+"-from", metricsService)
+	from = withCircuitBreaker(from, fromCircuitBreaker)
+	to, _, toCircuitBreakers := create(migratingConfig.To)
+	toCircuitBreaker := createCircuitBreaker(migratingConfig.To, resourceType+"-to", metricsService)
+	to = withCircuitBreaker(to, toCircuitBreaker)
+	return decorator.ForBlobstoreWithMigration(from, to, metricsService, resourceType),
+		appendCircuitBreakers(append(fromCircuitBreakers, toCircuitBreakers...), fromCircuitBreaker, toCircuitBreaker)
+}
+
+// createCircuitBreaker returns nil, unless blobstoreConfig has a circuit breaker configured.
+func createCircuitBreaker(blobstoreConfig config.BlobstoreConfig, name string, metricsService bitsgo.MetricsService) *decorator.CircuitBreaker {
+	if blobstoreConfig.CircuitBreaker == nil {
+		return nil
+	}
+	return decorator.NewCircuitBreaker(
+		blobstoreConfig.CircuitBreaker.FailureThreshold,
+		blobstoreConfig.CircuitBreaker.OpenPeriodDuration(),
+		blobstoreConfig.CircuitBreaker.MaxConcurrentCalls,
+		clock.New(),
+		metricsService,
+		name)
+}
+
+// appendCircuitBreakers appends the configured ones of circuitBreakers to reporters, so that the health route can
+// report them.
+func appendCircuitBreakers(reporters []bitsgo.CircuitBreakerStatusReporter, circuitBreakers ...*decorator.CircuitBreaker) []bitsgo.CircuitBreakerStatusReporter {
+	for _, circuitBreaker := range circuitBreakers {
+		if circuitBreaker != nil {
+			reporters = append(reporters, circuitBreaker)
+		}
+	}
+	return reporters
+}
+
+func withCircuitBreaker(blobstore bitsgo.Blobstore, circuitBreaker *decorator.CircuitBreaker) bitsgo.Blobstore {
+	if circuitBreaker == nil {
+		return blobstore
+	}
+	return decorator.ForBlobstoreWithCircuitBreaker(blobstore, circuitBreaker)
+}
+
 func createRootFSBlobstore(blobstoreConfig config.BlobstoreConfig) bitsgo.Blobstore {
 	if blobstoreConfig.BlobstoreType != config.Local {
 		log.Log.Fatalw("RootFS blobstore currently only allows local blobstores", "blobstore-type", blobstoreConfig.BlobstoreType)
@@ -534,7 +950,7 @@ func createRootFSBlobstore(blobstoreConfig config.BlobstoreConfig) bitsgo.Blobst
 	return local.NewBlobstore(*blobstoreConfig.LocalConfig)
 }
 
-func createUpdater(ccUpdaterConfig *config.CCUpdaterConfig) bitsgo.Updater {
+func createUpdater(ccUpdaterConfig *config.CCUpdaterConfig, retryPolicy bitsgo.RetryPolicy, metricsService bitsgo.MetricsService) bitsgo.Updater {
 	if ccUpdaterConfig == nil {
 		return &bitsgo.NullUpdater{}
 	}
@@ -543,7 +959,153 @@ func createUpdater(ccUpdaterConfig *config.CCUpdaterConfig) bitsgo.Updater {
 		ccUpdaterConfig.Method,
 		ccUpdaterConfig.ClientCertFile,
 		ccUpdaterConfig.ClientKeyFile,
-		ccUpdaterConfig.CACertFile)
+		ccUpdaterConfig.CACertFile).
+		WithRetryPolicy(retryPolicy, metricsService)
+}
+
+func retryPolicyFrom(retryPolicyConfig config.RetryPolicyConfig) bitsgo.RetryPolicy {
+	return bitsgo.RetryPolicy{
+		MaxAttempts:     retryPolicyConfig.MaxAttempts,
+		InitialInterval: retryPolicyConfig.InitialIntervalDuration(),
+		MaxInterval:     retryPolicyConfig.MaxIntervalDuration(),
+		MaxElapsedTime:  retryPolicyConfig.MaxElapsedTimeDuration(),
+		Jitter:          *retryPolicyConfig.Jitter,
+		RetryableErrors: retryPolicyConfig.RetryableErrors,
+	}
+}
+
+func createJWTAuthMiddleware(jwtConfig *config.JWTConfig) *middlewares.JWTAuthMiddleware {
+	if jwtConfig == nil {
+		return nil
+	}
+	var keys jwtauth.KeyProvider = jwtauth.StaticKeys(jwtConfig.KeysMap())
+	if jwtConfig.JWKSURL != "" {
+		keys = jwtauth.NewJWKSKeyProvider(jwtConfig.JWKSURL, createJWKSHTTPClient(jwtConfig.JWKSCACertFile), jwtConfig.JWKSRefreshIntervalDuration(), clock.New())
+	}
+	return middlewares.NewJWTAuthMiddleware(&jwtauth.TokenValidator{
+		Keys:     keys,
+		Audience: jwtConfig.Audience,
+		Issuer:   jwtConfig.Issuer,
+		Clock:    clock.New(),
+	})
+}
+
+func createJWKSHTTPClient(caCertFile string) *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if caCertFile == "" {
+		return client
+	}
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: loadCertPool(caCertFile)}}
+	return client
+}
+
+func loadCertPool(caCertFile string) *x509.CertPool {
+	caCert, e := ioutil.ReadFile(caCertFile)
+	if e != nil {
+		log.Log.Fatalw("Could not read CA Cert file", "error", e, "ca-cert-file", caCertFile)
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		log.Log.Fatalw("CA Cert file does not contain any PEM encoded certificates", "ca-cert-file", caCertFile)
+	}
+	return caCertPool
+}
+
+func createClientCertAuthMiddleware(clientCertAuthConfig *config.ClientCertAuthConfig) *middlewares.ClientCertAuthMiddleware {
+	if clientCertAuthConfig == nil {
+		return nil
+	}
+	rules := make([]middlewares.ClientCertRule, len(clientCertAuthConfig.Clients))
+	for i, client := range clientCertAuthConfig.Clients {
+		rules[i] = middlewares.ClientCertRule{Subject: client.Subject, SAN: client.SAN, Permissions: client.Permissions}
+	}
+	return middlewares.NewClientCertAuthMiddleware(clientCertAuthConfig.Mode == config.RequiredClientCertMode, rules...)
+}
+
+func withEncryption(blobstore bitsgo.Blobstore, keyring *decorator.EncryptionKeyring, encryptionConfig *config.EncryptionConfig, maintenanceMode *bitsgo.MaintenanceMode, resourceType string) bitsgo.Blobstore {
+	if !encryptionConfig.Encrypts(resourceType) {
+		return blobstore
+	}
+	return decorator.ForBlobstoreWithEncryption(blobstore, keyring, encryptionConfig.AllowUnencryptedBlobs).WithMaintenanceMode(maintenanceMode, resourceType)
+}
+
+func withCompression(blobstore bitsgo.Blobstore, compressionConfig *config.CompressionConfig, resourceType string) bitsgo.Blobstore {
+	if !compressionConfig.Compresses(resourceType) {
+		return blobstore
+	}
+	return decorator.ForBlobstoreWithCompression(blobstore, compressionConfig.Level)
+}
+
+// withLocalSignedURLs makes signed URLs of encrypted or compressed resource types point to the bits-service rather
+// than the blobstore, because clients cannot decrypt or decompress blobs themselves.
+func withLocalSignedURLs(signURLHandler *bitsgo.SignResourceHandler, c config.Config, urlSigner pathsigner.PathSigner, blobstoreConfig config.BlobstoreConfig, resourceType string, resourcePath string) *bitsgo.SignResourceHandler {
+	if (c.Encryption == nil || !c.Encryption.Encrypts(resourceType)) &&
+		(c.Compression == nil || !c.Compression.Compresses(resourceType)) {
+		return signURLHandler
+	}
+	localResourceSigner := createLocalResourceSigner(c.PublicEndpointUrl(), c.Port, urlSigner, resourcePath)
+	return bitsgo.NewSignResourceHandlerWithExpiry(localResourceSigner, localResourceSigner, blobstoreConfig.SignedURLExpiryDuration(), c.SignedURLs.MaxExpiryDuration())
+}
+
+func withDiskCache(blobstore bitsgo.Blobstore, blobstoreConfig config.BlobstoreConfig, diskCache *decorator.DiskCache, metricsService bitsgo.MetricsService, resourceType string) bitsgo.Blobstore {
+	// caching blobs of a local blobstore on local disk would not gain anything
+	if blobstoreConfig.BlobstoreType == config.Local {
+		return blobstore
+	}
+	return decorator.ForBlobstoreWithDiskCache(blobstore, diskCache, metricsService, resourceType)
+}
+
+// withQuotas also makes the tracker reconcile resourceType with the blobstore uploads end up in.
+func withQuotas(blobstore bitsgo.Blobstore, tracker *decorator.QuotaTracker, quotasConfig *config.QuotasConfig, blobstoreConfig config.BlobstoreConfig, resourceType string) bitsgo.Blobstore {
+	if !quotasConfig.Enforces(resourceType) {
+		return blobstore
+	}
+	switch blobstoreConfig.BlobstoreType {
+	case config.Replicated:
+		blobstoreConfig = blobstoreConfig.ReplicatedConfig.Primary
+	case config.Migrating:
+		blobstoreConfig = blobstoreConfig.MigratingConfig.To
+	}
+	prefix := pathPrefixOf(blobstoreConfig, resourceType)
+	if resourceType == "buildpack_cache" {
+		prefix += "buildpack_cache/"
+	}
+	tracker.AddReconciliationSource(resourceType, createListingBlobstore(blobstoreConfig), prefix)
+	return decorator.ForBlobstoreWithQuotas(blobstore, tracker, resourceType)
+}
+
+func applyMaintenanceModeConfig(maintenanceMode *bitsgo.MaintenanceMode, maintenanceModeConfig config.MaintenanceModeConfig) {
+	if maintenanceModeConfig.Enabled {
+		maintenanceMode.Enable(maintenanceModeConfig.Reason)
+	} else {
+		maintenanceMode.Disable()
+	}
+}
+
+func applyReadOnlyConfig(maintenanceMode *bitsgo.MaintenanceMode, resourceType string, readOnly bool) {
+	if readOnly {
+		maintenanceMode.EnableFor(resourceType, "")
+	} else {
+		maintenanceMode.DisableFor(resourceType)
+	}
+}
+
+func faultRulesFrom(faultRuleConfigs []config.FaultRuleConfig) []bitsgo.FaultRule {
+	rules := make([]bitsgo.FaultRule, len(faultRuleConfigs))
+	for i, faultRuleConfig := range faultRuleConfigs {
+		rules[i] = bitsgo.FaultRule{
+			ResourceType:       faultRuleConfig.ResourceType,
+			Operation:          faultRuleConfig.Operation,
+			LatencyMillis:      int64(faultRuleConfig.LatencyDuration() / time.Millisecond),
+			ErrorRate:          faultRuleConfig.ErrorRate,
+			NotFoundRate:       faultRuleConfig.NotFoundRate,
+			NoSpaceLeftRate:    faultRuleConfig.NoSpaceLeftRate,
+			TruncateRate:       faultRuleConfig.TruncateRate,
+			TruncateAfterBytes: faultRuleConfig.TruncateAfterBytes(),
+			HangRate:           faultRuleConfig.HangRate,
+		}
+	}
+	return rules
 }
 
 func regularlyEmitGoRoutines(metricsService bitsgo.MetricsService) {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/migration"
+	"github.com/cloudfoundry-incubator/bits-service/config"
+	log "github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// migrate backfills the new blobstores of all resource types with a migrating blobstore. Blobs are copied as they
+// are stored, i.e. without decrypting or decompressing them. The buildpack cache is part of the droplets.
+func migrate(configPath string, stateDir string) {
+	c, e := config.LoadConfig(configPath)
+	if e != nil {
+		log.Log.Fatalw("Could not load config.", "error", e)
+	}
+
+	failed := false
+	for _, blobstore := range []struct {
+		resourceType string
+		config       config.BlobstoreConfig
+	}{
+		{"packages", c.Packages},
+		{"droplets", c.Droplets},
+		{"buildpacks", c.Buildpacks},
+		{"app_stash", c.AppStash},
+	} {
+		if blobstore.config.BlobstoreType != config.Migrating {
+			continue
+		}
+		from := blobstore.config.MigratingConfig.From
+		to := blobstore.config.MigratingConfig.To
+		m := &migration.Migration{
+			Name:         blobstore.resourceType,
+			Source:       createListingBlobstore(from),
+			SourcePrefix: pathPrefixOf(from, blobstore.resourceType),
+			Target:       createListingBlobstore(to),
+			TargetPrefix: pathPrefixOf(to, blobstore.resourceType),
+		}
+		progress, e := m.Run(stateDir)
+		if e != nil {
+			log.Log.Errorw("Migration failed", "migration", blobstore.resourceType, "error", e)
+			failed = true
+			continue
+		}
+		if len(progress.Failed) > 0 {
+			failed = true
+		}
+		fmt.Printf("%v: copied %v blobs (%v bytes), skipped %v, failed %v\n",
+			blobstore.resourceType, progress.Copied, progress.Bytes, progress.Skipped, len(progress.Failed))
+	}
+	if failed {
+		fmt.Fprintln(os.Stderr, "Not all blobs could be migrated. Run the migration again to retry them.")
+		os.Exit(1)
+	}
+}
+
+// pathPrefixOf returns the prefix the bits-service stores blobs of resourceType under in a blobstore.
+func pathPrefixOf(blobstoreConfig config.BlobstoreConfig, resourceType string) string {
+	prefix := ""
+	if blobstoreConfig.BlobstoreType == config.WebDAV {
+		prefix = blobstoreConfig.WebdavConfig.DirectoryKey + "/"
+	}
+	if resourceType == "app_stash" {
+		prefix += "app_bits_cache/"
+	}
+	return prefix
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/alibaba"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/azure"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/gcp"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/local"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/openstack"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/s3"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/webdav"
+	"github.com/cloudfoundry-incubator/bits-service/config"
+	log "github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// probeKey is looked up in every blobstore when probing credentials. It does not need to exist.
+const probeKey = "bits-service-validate-config-probe"
+
+func validateConfig(configPath string, probeCredentials bool) {
+	c, errs := config.ValidateFile(configPath)
+	if len(errs) == 0 && probeCredentials {
+		errs = probeBlobstores(c)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%v is invalid:\n", configPath)
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "  - %v\n", e)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("%v is valid\n", configPath)
+}
+
+func probeBlobstores(c config.Config) (errs []string) {
+	for _, blobstore := range []struct {
+		property string
+		config   config.BlobstoreConfig
+	}{
+		{"packages", c.Packages},
+		{"droplets", c.Droplets},
+		{"buildpacks", c.Buildpacks},
+		{"app_stash", c.AppStash},
+	} {
+		errs = append(errs, probeBlobstoreWithMembers(blobstore.property, blobstore.config)...)
+	}
+	return
+}
+
+func probeBlobstoreWithMembers(property string, blobstoreConfig config.BlobstoreConfig) (errs []string) {
+	members, properties := blobstoreConfig.Members(property)
+	if len(members) > 0 {
+		for i, member := range members {
+			errs = append(errs, probeBlobstoreWithMembers(properties[i], *member)...)
+		}
+		return
+	}
+	if e := probeBlobstore(blobstoreConfig); e != nil {
+		errs = append(errs, fmt.Sprintf("%v: cannot access %v blobstore. Caused by: %v", property, blobstoreConfig.BlobstoreType, e))
+	}
+	return
+}
+
+func probeBlobstore(blobstoreConfig config.BlobstoreConfig) (e error) {
+	// blobstores panic on unexpected errors, e.g. when they cannot create a client from their config
+	defer func() {
+		if r := recover(); r != nil {
+			e = fmt.Errorf("%v", r)
+		}
+	}()
+	_, e = createProbedBlobstore(blobstoreConfig).Exists(probeKey)
+	return
+}
+
+func createProbedBlobstore(blobstoreConfig config.BlobstoreConfig) bitsgo.Blobstore {
+	if blobstoreConfig.BlobstoreType == config.WebDAV {
+		return decorator.ForBlobstoreWithPathPrefixing(createListingBlobstore(blobstoreConfig), blobstoreConfig.WebdavConfig.DirectoryKey+"/")
+	}
+	return createListingBlobstore(blobstoreConfig)
+}
+
+// createListingBlobstore creates a blobstore without any of the decorators the bits-service uses.
+func createListingBlobstore(blobstoreConfig config.BlobstoreConfig) bitsgo.ListingBlobstore {
+	switch blobstoreConfig.BlobstoreType {
+	case config.Local:
+		return local.NewBlobstore(*blobstoreConfig.LocalConfig)
+	case config.AWS:
+		return s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, log.Log)
+	case config.Google:
+		return gcp.NewBlobstore(*blobstoreConfig.GCPConfig)
+	case config.Azure:
+		return azure.NewBlobstore(*blobstoreConfig.AzureConfig)
+	case config.OpenStack:
+		return openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig)
+	case config.WebDAV:
+		return webdav.NewBlobstore(*blobstoreConfig.WebdavConfig)
+	case config.Alibaba:
+		return alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig)
+	default:
+		panic("unexpected blobstore type " + string(blobstoreConfig.BlobstoreType))
+	}
+}
@@ -11,10 +11,9 @@ import (
 )
 
 type LogEntry struct {
-	Timestamp     float64 `json:"ts"`
-	Message       string  `json:"msg"`
-	VcapRequestID string  `json:"vcap-request-id"`
-	RequestID     int64   `json:"request-id"`
+	Timestamp float64 `json:"ts"`
+	Message   string  `json:"msg"`
+	RequestID string  `json:"request-id"`
 }
 
 type TimestampAndEntry struct {
@@ -33,7 +32,7 @@ func main() {
 	scanner := bufio.NewScanner(file)
 	buf := make([]byte, 100*1024*1024)
 	scanner.Buffer(buf, 100*1024*1024)
-	logEntries := make(map[int64]LogEntry)
+	logEntries := make(map[string]LogEntry)
 	for scanner.Scan() {
 		var entry LogEntry
 		e := json.Unmarshal(scanner.Bytes(), &entry)
@@ -58,10 +57,9 @@ func main() {
 	sort.Slice(sortedEntries, func(i int, j int) bool { return sortedEntries[i].timestamp < sortedEntries[j].timestamp })
 
 	for _, entry := range sortedEntries {
-		fmt.Printf("%v: (id: %v, vcap-request-id: %v): %v\n",
+		fmt.Printf("%v: (id: %v): %v\n",
 			time.Unix(int64(entry.value.Timestamp), 0),
 			entry.value.RequestID,
-			entry.value.VcapRequestID,
 			entry.value.Message)
 	}
 }
@@ -1,15 +1,25 @@
 package config
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"math"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"code.cloudfoundry.org/bytefmt"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -33,23 +43,70 @@ type Config struct {
 	SigningKeys     []struct {
 		KeyID  string `yaml:"key_id"`
 		Secret string
+		// Date after which URLs signed with this key are rejected, e.g. "2020-12-31" or "2020-12-31T12:00:00Z"
+		NotAfter string `yaml:"not_after"`
 	} `yaml:"signing_keys"`
-	ActiveKeyID  string `yaml:"active_key_id"`
-	Port         int
-	HttpEnabled  bool         `yaml:"enable_http"`
-	HttpPort     int          `yaml:"http_port"`
-	SigningUsers []Credential `yaml:"signing_users"`
-	MaxBodySize  string       `yaml:"max_body_size"`
-	CertFile     string       `yaml:"cert_file"`
-	KeyFile      string       `yaml:"key_file"`
+	// Alternative to signing_keys. Components which only validate signed URLs need the public keys only.
+	AsymmetricSigningKeys []AsymmetricSigningKey `yaml:"asymmetric_signing_keys"`
+	ActiveKeyID           string                 `yaml:"active_key_id"`
+	// AcceptLegacySignatures allows signed URLs that are not bound to a method. Only meant for migrating existing deployments.
+	AcceptLegacySignatures bool `yaml:"accept_legacy_signatures"`
+	Port                   int
+	HttpEnabled            bool         `yaml:"enable_http"`
+	HttpPort               int          `yaml:"http_port"`
+	SigningUsers           []Credential `yaml:"signing_users"`
+	MaxBodySize            string       `yaml:"max_body_size"`
+	CertFile               string       `yaml:"cert_file"`
+	KeyFile                string       `yaml:"key_file"`
+
+	// Credentials accepted by admin routes via basic auth. Signing users cannot use admin routes.
+	AdminUsers []Credential `yaml:"admin_users"`
+
+	// Limits failed basic auth attempts with signing_users and admin_users
+	BasicAuthFailureLimit BasicAuthFailureLimitConfig `yaml:"basic_auth_failure_limit"`
 
 	CCUpdater *CCUpdaterConfig `yaml:"cc_updater"`
 
+	// Applies to all calls to blobstores and the Cloud Controller
+	RetryPolicy RetryPolicyConfig `yaml:"retry_policy"`
+
+	// Optional bearer token authentication for the private endpoint
+	JWT *JWTConfig `yaml:"jwt"`
+
+	// Optional client certificate authentication for the private endpoint
+	ClientCertAuth *ClientCertAuthConfig `yaml:"client_cert_auth"`
+
 	AppStashConfig AppStashConfig `yaml:"app_stash_config"`
 
 	EnableRegistry bool `yaml:"enable_registry"`
 
 	ShouldProxyGetRequests bool `yaml:"proxy_get_requests"`
+
+	// Optional client-side encryption of blobs
+	Encryption *EncryptionConfig `yaml:"encryption"`
+
+	// Optional gzip compression of blobs
+	Compression *CompressionConfig `yaml:"compression"`
+
+	// Optional local cache for app stash entries and droplets stored in a remote blobstore
+	DiskCache *DiskCacheConfig `yaml:"disk_cache"`
+
+	// Optional storage quotas for organizations or spaces
+	Quotas *QuotasConfig `yaml:"quotas"`
+
+	// Makes the bits-service read-only. Can also be toggled via the admin API
+	MaintenanceMode MaintenanceModeConfig `yaml:"maintenance_mode"`
+
+	// Injects faults into blobstore calls. Only meant for testing, never enable it in production
+	FaultInjection *FaultInjectionConfig `yaml:"fault_injection"`
+
+	Metrics MetricsConfig
+
+	Tracing TracingConfig
+
+	Audit AuditConfig
+
+	SignedURLs SignedURLsConfig `yaml:"signed_urls"`
 }
 
 func (config *Config) PublicEndpointUrl() *url.URL {
@@ -68,6 +125,17 @@ func (config *Config) PrivateEndpointUrl() *url.URL {
 	return u
 }
 
+// ReadOnlyResourceTypesMap tells for each resource type whether it is configured as read-only.
+func (config *Config) ReadOnlyResourceTypesMap() map[string]bool {
+	return map[string]bool{
+		"app_stash":       config.AppStash.ReadOnly,
+		"packages":        config.Packages.ReadOnly,
+		"droplets":        config.Droplets.ReadOnly,
+		"buildpacks":      config.Buildpacks.ReadOnly,
+		"buildpack_cache": config.BuildpackCache.ReadOnly,
+	}
+}
+
 func (config *Config) SigningKeysMap() map[string]string {
 	result := make(map[string]string, 3)
 	for _, signingKey := range config.SigningKeys {
@@ -76,17 +144,140 @@ func (config *Config) SigningKeysMap() map[string]string {
 	return result
 }
 
+func (config *Config) SigningKeysNotAfterMap() map[string]time.Time {
+	result := make(map[string]time.Time)
+	for _, signingKey := range config.SigningKeys {
+		addNotAfter(result, signingKey.KeyID, signingKey.NotAfter)
+	}
+	for _, signingKey := range config.AsymmetricSigningKeys {
+		addNotAfter(result, signingKey.KeyID, signingKey.NotAfter)
+	}
+	return result
+}
+
+func addNotAfter(notAfterMap map[string]time.Time, keyID string, s string) {
+	if s == "" {
+		return
+	}
+	notAfter, e := parseNotAfter(s)
+	if e != nil {
+		panic("Unexpected error: " + e.Error())
+	}
+	notAfterMap[keyID] = notAfter
+}
+
+type AsymmetricSigningKey struct {
+	KeyID string `yaml:"key_id"`
+	// PEM encoded PKCS #8 Ed25519 or ECDSA P-256 private key. Only needed for signing URLs
+	PrivateKey string `yaml:"private_key"`
+	// PEM encoded PKIX public key. Can be omitted when private_key is given
+	PublicKey string `yaml:"public_key"`
+	// Date after which URLs signed with this key are rejected, e.g. "2020-12-31" or "2020-12-31T12:00:00Z"
+	NotAfter string `yaml:"not_after"`
+}
+
+func (config *Config) AsymmetricPrivateKeysMap() map[string]crypto.Signer {
+	result := make(map[string]crypto.Signer)
+	for _, signingKey := range config.AsymmetricSigningKeys {
+		if signingKey.PrivateKey == "" {
+			continue
+		}
+		privateKey, e := parsePrivateKey(signingKey.PrivateKey)
+		if e != nil {
+			panic("Unexpected error: " + e.Error())
+		}
+		result[signingKey.KeyID] = privateKey
+	}
+	return result
+}
+
+func (config *Config) AsymmetricPublicKeysMap() map[string]crypto.PublicKey {
+	result := make(map[string]crypto.PublicKey)
+	for _, signingKey := range config.AsymmetricSigningKeys {
+		if signingKey.PublicKey == "" {
+			continue
+		}
+		publicKey, e := parsePublicKey(signingKey.PublicKey)
+		if e != nil {
+			panic("Unexpected error: " + e.Error())
+		}
+		result[signingKey.KeyID] = publicKey
+	}
+	return result
+}
+
+func parsePrivateKey(pemEncoded string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, e := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if e != nil {
+		return nil, e
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %T. Only Ed25519 and ECDSA keys are supported", key)
+	}
+}
+
+func parsePublicKey(pemEncoded string) (crypto.PublicKey, error) {
+	key, e := parsePKIXPublicKey(pemEncoded)
+	if e != nil {
+		return nil, e
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %T. Only Ed25519 and ECDSA keys are supported", key)
+	}
+}
+
+func parsePKIXPublicKey(pemEncoded string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// parseNotAfter accepts RFC 3339 timestamps and plain dates. A plain date means the end of that day (UTC).
+func parseNotAfter(s string) (time.Time, error) {
+	notAfter, e := time.Parse(time.RFC3339, s)
+	if e == nil {
+		return notAfter, nil
+	}
+	notAfter, e = time.Parse("2006-01-02", s)
+	if e != nil {
+		return time.Time{}, e
+	}
+	return notAfter.Add(24*time.Hour - time.Second), nil
+}
+
 type BlobstoreConfig struct {
-	BlobstoreType     BlobstoreType             `yaml:"blobstore_type"`
-	LocalConfig       *LocalBlobstoreConfig     `yaml:"local_config"`
-	S3Config          *S3BlobstoreConfig        `yaml:"s3_config"`
-	GCPConfig         *GCPBlobstoreConfig       `yaml:"gcp_config"`
-	AzureConfig       *AzureBlobstoreConfig     `yaml:"azure_config"`
-	OpenstackConfig   *OpenstackBlobstoreConfig `yaml:"openstack_config"`
-	WebdavConfig      *WebdavBlobstoreConfig    `yaml:"webdav_config"`
-	AlibabaConfig     *AlibabaBlobstoreConfig   `yaml:"alibaba_config"`
-	MaxBodySize       string                    `yaml:"max_body_size"`
-	GlobalMaxBodySize string                    // Not to be set by yaml
+	BlobstoreType     BlobstoreType              `yaml:"blobstore_type"`
+	LocalConfig       *LocalBlobstoreConfig      `yaml:"local_config"`
+	S3Config          *S3BlobstoreConfig         `yaml:"s3_config"`
+	GCPConfig         *GCPBlobstoreConfig        `yaml:"gcp_config"`
+	AzureConfig       *AzureBlobstoreConfig      `yaml:"azure_config"`
+	OpenstackConfig   *OpenstackBlobstoreConfig  `yaml:"openstack_config"`
+	WebdavConfig      *WebdavBlobstoreConfig     `yaml:"webdav_config"`
+	AlibabaConfig     *AlibabaBlobstoreConfig    `yaml:"alibaba_config"`
+	ReplicatedConfig  *ReplicatedBlobstoreConfig `yaml:"replicated_config"`
+	MigratingConfig   *MigratingBlobstoreConfig  `yaml:"migrating_config"`
+	CircuitBreaker    *CircuitBreakerConfig      `yaml:"circuit_breaker"`
+	MaxBodySize       string                     `yaml:"max_body_size"`
+	GlobalMaxBodySize string                     // Not to be set by yaml
+	// Overrides signed_urls.expiry for this resource type
+	SignedURLExpiry       string `yaml:"signed_url_expiry"`
+	GlobalSignedURLExpiry string // Not to be set by yaml
+	// Rejects changes to this resource type like maintenance_mode does for all of them
+	ReadOnly bool `yaml:"read_only"`
 }
 
 type BlobstoreType string
@@ -99,16 +290,22 @@ const (
 	OpenStack BlobstoreType = "openstack"
 	WebDAV    BlobstoreType = "webdav"
 	Alibaba   BlobstoreType = "alibaba"
+	// Replicated writes to a primary and secondary blobstores
+	Replicated BlobstoreType = "replicated"
+	// Migrating writes to a new blobstore and reads from the new and then the old one
+	Migrating BlobstoreType = "migrating"
 )
 
 var BlobstoreTypes = map[BlobstoreType]bool{
-	Local:     true,
-	AWS:       true,
-	Google:    true,
-	Azure:     true,
-	OpenStack: true,
-	WebDAV:    true,
-	Alibaba:   true,
+	Local:      true,
+	AWS:        true,
+	Google:     true,
+	Azure:      true,
+	OpenStack:  true,
+	WebDAV:     true,
+	Alibaba:    true,
+	Replicated: true,
+	Migrating:  true,
 }
 
 func (config *BlobstoreConfig) MaxBodySizeBytes() uint64 {
@@ -129,6 +326,72 @@ func (config *BlobstoreConfig) MaxBodySizeBytes() uint64 {
 	return bytes
 }
 
+const (
+	SyncReplication  = "sync"
+	AsyncReplication = "async"
+)
+
+type ReplicatedBlobstoreConfig struct {
+	Primary     BlobstoreConfig
+	Secondaries []BlobstoreConfig
+	// "sync" (default) writes to secondaries before responding, "async" writes to them in the background.
+	// In both modes, failed writes to secondaries are retried in the background.
+	Mode string
+	// Defaults to "1m"
+	RetryInterval string `yaml:"retry_interval"`
+	// Defaults to 10
+	MaxAttempts int `yaml:"max_attempts"`
+	// Maximum number of pending writes to secondaries. Defaults to 10000
+	QueueSize int `yaml:"queue_size"`
+}
+
+func (config *ReplicatedBlobstoreConfig) RetryIntervalDuration() time.Duration {
+	return mustParseDuration(config.RetryInterval)
+}
+
+type MigratingBlobstoreConfig struct {
+	From BlobstoreConfig
+	To   BlobstoreConfig
+}
+
+// CircuitBreakerConfig makes calls to a blobstore fail fast while it is failing or too slow to keep up.
+type CircuitBreakerConfig struct {
+	// Number of consecutive failures of an operation after which calls of that operation fail fast. Defaults to 5
+	FailureThreshold int `yaml:"failure_threshold"`
+	// How long calls fail fast before the blobstore is tried again. Defaults to "30s"
+	OpenPeriod string `yaml:"open_period"`
+	// Calls beyond this number fail fast. Defaults to 0, which means no limit
+	MaxConcurrentCalls int `yaml:"max_concurrent_calls"`
+}
+
+func (config *CircuitBreakerConfig) OpenPeriodDuration() time.Duration {
+	return mustParseDuration(config.OpenPeriod)
+}
+
+// Members returns the blobstore configs a replicated or migrating blobstore consists of, together with their
+// property paths. For other blobstore types, it returns none.
+func (config *BlobstoreConfig) Members(property string) (members []*BlobstoreConfig, properties []string) {
+	switch BlobstoreType(strings.ToLower(string(config.BlobstoreType))) {
+	case Replicated:
+		if config.ReplicatedConfig == nil {
+			return
+		}
+		members = append(members, &config.ReplicatedConfig.Primary)
+		properties = append(properties, property+".replicated_config.primary")
+		for i := range config.ReplicatedConfig.Secondaries {
+			members = append(members, &config.ReplicatedConfig.Secondaries[i])
+			properties = append(properties, fmt.Sprintf("%v.replicated_config.secondaries[%v]", property, i))
+		}
+	case Migrating:
+		if config.MigratingConfig == nil {
+			return
+		}
+		members = append(members, &config.MigratingConfig.From, &config.MigratingConfig.To)
+		properties = append(properties, property+".migrating_config.from", property+".migrating_config.to")
+	}
+	return
+}
+
 type LocalBlobstoreConfig struct {
 	PathPrefix string `yaml:"path_prefix"`
 }
@@ -144,6 +407,8 @@ type S3BlobstoreConfig struct {
 	SSEKMSKeyID          string `yaml:"server_side_encryption_aws_kms_key_id"`
 	UseIAMProfile        bool   `yaml:"use_iam_profile"`
 	SignatureVersion     int    `yaml:"signature_version"`
+	// Validity period of redirect URLs. Set from the signed URL expiry of the resource type
+	RedirectExpiry time.Duration `yaml:"-"`
 }
 
 type GCPBlobstoreConfig struct {
@@ -217,12 +482,145 @@ func (config WebdavBlobstoreConfig) CACert() string {
 type Credential struct {
 	Username string
 	Password string
+	// bcrypt or argon2id hash (PHC string format). Alternative to password
+	PasswordHash string `yaml:"password_hash"`
+}
+
+type BasicAuthFailureLimitConfig struct {
+	// Number of failed attempts per username and per client IP after which further attempts are rejected. Defaults to 10
+	MaxFailures int `yaml:"max_failures"`
+	// Period failed attempts are counted in, and for which attempts are rejected. Defaults to "1m"
+	Window string
+}
+
+func (config *BasicAuthFailureLimitConfig) WindowDuration() time.Duration {
+	return mustParseDuration(config.Window)
+}
+
+type RetryPolicyConfig struct {
+	// Including the first attempt. 1 disables retries. Defaults to 4
+	MaxAttempts int `yaml:"max_attempts"`
+	// Delay before the first retry, which doubles with every further retry. Defaults to "500ms"
+	InitialInterval string `yaml:"initial_interval"`
+	// Defaults to "5s"
+	MaxInterval string `yaml:"max_interval"`
+	// No further attempt is started after this time. Defaults to "30s"
+	MaxElapsedTime string `yaml:"max_elapsed_time"`
+	// Delays are randomized by +/- this factor. Between 0 and 1, defaults to 0.5
+	Jitter *float64
+	// Error types which are retried: "timeout" and/or "other". Defaults to both
+	RetryableErrors []string `yaml:"retryable_errors"`
+}
+
+func (config *RetryPolicyConfig) InitialIntervalDuration() time.Duration {
+	return mustParseDuration(config.InitialInterval)
+}
+
+func (config *RetryPolicyConfig) MaxIntervalDuration() time.Duration {
+	return mustParseDuration(config.MaxInterval)
+}
+
+func (config *RetryPolicyConfig) MaxElapsedTimeDuration() time.Duration {
+	return mustParseDuration(config.MaxElapsedTime)
 }
 
 type LoggingConfig struct {
 	Level string
 }
 
+type MetricsConfig struct {
+	Address string // statsd address, e.g. "127.0.0.1:8125". Defaults to ":8125"
+	// Prefix of all metric names. Defaults to "bits". An empty prefix disables prefixing
+	Prefix *string
+	Tags   MetricsTagsConfig
+	// Additional suffix for timing metrics, e.g. ".sparse-avg". If set, every timing metric is sent a second time with this suffix.
+	TimingSuffix string `yaml:"timing_suffix"`
+}
+
+type MetricsTagsConfig struct {
+	Deployment string
+	AZ         string `yaml:"az"`
+	Instance   string
+}
+
+func (config *MetricsConfig) TagsMap() map[string]string {
+	result := make(map[string]string, 3)
+	if config.Tags.Deployment != "" {
+		result["deployment"] = config.Tags.Deployment
+	}
+	if config.Tags.AZ != "" {
+		result["az"] = config.Tags.AZ
+	}
+	if config.Tags.Instance != "" {
+		result["instance"] = config.Tags.Instance
+	}
+	return result
+}
+
+const (
+	OTLPExporter   = "otlp"
+	StdoutExporter = "stdout"
+)
+
+type TracingConfig struct {
+	Enabled bool
+	// "otlp" (default) or "stdout"
+	Exporter string
+	// host:port of the OTLP/HTTP collector. Defaults to "localhost:4318"
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	OTLPInsecure bool   `yaml:"otlp_insecure"`
+	ServiceName  string `yaml:"service_name"`
+}
+
+const (
+	FileAuditSink    = "file"
+	SyslogAuditSink  = "syslog"
+	WebhookAuditSink = "webhook"
+)
+
+type AuditConfig struct {
+	Enabled bool
+	// "file", "syslog" or "webhook"
+	Sink string
+	// Path of the audit log file. Required for sink "file"
+	File string
+	// Defaults to "bits-service-audit"
+	SyslogTag string `yaml:"syslog_tag"`
+	// URL which every audit event gets POSTed to. Required for sink "webhook"
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+type SignedURLsConfig struct {
+	// Validity period of signed URLs, e.g. "30m". Defaults to "1h"
+	Expiry string
+	// Upper bound for the expires_in parameter when signing URLs. Defaults to "24h"
+	MaxExpiry string `yaml:"max_expiry"`
+	// When enabled, every signed URL can only be used once. Used URLs are remembered in memory by each
+	// bits-service instance, so with several instances behind a load balancer a URL can still be used once per instance.
+	SingleUse bool `yaml:"single_use"`
+	// Maximum number of used single-use URLs to remember. Defaults to 100000
+	NonceStoreSize int `yaml:"nonce_store_size"`
+}
+
+func (config *SignedURLsConfig) MaxExpiryDuration() time.Duration {
+	return mustParseDuration(config.MaxExpiry)
+}
+
+func (config *BlobstoreConfig) SignedURLExpiryDuration() time.Duration {
+	if config.SignedURLExpiry == "" {
+		return mustParseDuration(config.GlobalSignedURLExpiry)
+	}
+	return mustParseDuration(config.SignedURLExpiry)
+}
+
+func mustParseDuration(s string) time.Duration {
+	duration, e := time.ParseDuration(s)
+	if e != nil {
+		panic("Unexpected error: " + e.Error())
+	}
+	return duration
+}
+
 type CCUpdaterConfig struct {
 	Endpoint       string
 	Method         string
@@ -231,6 +629,64 @@ type CCUpdaterConfig struct {
 	CACertFile     string `yaml:"ca_cert_file"`
 }
 
+type JWTConfig struct {
+	// URL of a JSON Web Key Set, e.g. "https://uaa.service.cf.internal:8443/token_keys"
+	JWKSURL string `yaml:"jwks_url"`
+	// How long keys fetched from jwks_url are used before fetching them again. Defaults to "5m"
+	JWKSRefreshInterval string `yaml:"jwks_refresh_interval"`
+	// Optional CA certificate to verify jwks_url with
+	JWKSCACertFile string `yaml:"jwks_ca_cert_file"`
+	// Alternative to jwks_url
+	Keys []struct {
+		KeyID string `yaml:"key_id"`
+		// PEM encoded PKIX RSA, ECDSA or Ed25519 public key
+		PublicKey string `yaml:"public_key"`
+	}
+	// Must be contained in the "aud" claim of tokens
+	Audience string
+	// When set, must match the "iss" claim of tokens
+	Issuer string
+}
+
+func (config *JWTConfig) JWKSRefreshIntervalDuration() time.Duration {
+	return mustParseDuration(config.JWKSRefreshInterval)
+}
+
+func (config *JWTConfig) KeysMap() map[string]crypto.PublicKey {
+	result := make(map[string]crypto.PublicKey, len(config.Keys))
+	for _, key := range config.Keys {
+		publicKey, e := parsePKIXPublicKey(key.PublicKey)
+		if e != nil {
+			panic("Unexpected error: " + e.Error())
+		}
+		result[key.KeyID] = publicKey
+	}
+	return result
+}
+
+const (
+	RequiredClientCertMode = "required"
+	OptionalClientCertMode = "optional"
+)
+
+type ClientCertAuthConfig struct {
+	// CA certificates client certificates must be issued by
+	CACertFile string `yaml:"ca_cert_file"`
+	// "required" or "optional" (default). With "optional", requests without client certificate fall back to bearer
+	// tokens, and on sign and admin routes to basic auth. Requests which have nothing to fall back to are rejected.
+	Mode    string
+	Clients []ClientCertClientConfig
+}
+
+type ClientCertClientConfig struct {
+	// Distinguished name like "CN=cloud_controller,O=Cloud Foundry"
+	Subject string
+	// DNS name, email address, IP address or URI
+	SAN string `yaml:"san"`
+	// Any of "bits.read", "bits.write" and "bits.admin"
+	Permissions []string
+}
+
 type AppStashConfig struct {
 	MinimumSize string `yaml:"minimum_size"`
 	MaximumSize string `yaml:"maximum_size"`
@@ -243,6 +699,148 @@ func (config *AppStashConfig) MaximumSizeBytes() uint64 {
 	return parseSizeProperty(config.MaximumSize, math.MaxUint64)
 }
 
+type EncryptionConfig struct {
+	// Any of "packages", "droplets", "buildpacks", "app_stash" and "buildpack_cache"
+	ResourceTypes []string `yaml:"resource_types"`
+	Keys          []EncryptionKey
+	// Key new blobs are encrypted with. Blobs encrypted with other keys are re-encrypted when read
+	ActiveKeyID string `yaml:"active_key_id"`
+	// Allows to read blobs stored before encryption was enabled
+	AllowUnencryptedBlobs bool `yaml:"allow_unencrypted_blobs"`
+}
+
+type EncryptionKey struct {
+	KeyID string `yaml:"key_id"`
+	// Base64 encoded 256 bit key
+	Key string
+}
+
+func (config *EncryptionConfig) KeysMap() map[string][]byte {
+	result := make(map[string][]byte, len(config.Keys))
+	for _, key := range config.Keys {
+		decodedKey, e := base64.StdEncoding.DecodeString(key.Key)
+		if e != nil {
+			panic("Unexpected error: " + e.Error())
+		}
+		result[key.KeyID] = decodedKey
+	}
+	return result
+}
+
+func (config *EncryptionConfig) Encrypts(resourceType string) bool {
+	return contains(config.ResourceTypes, resourceType)
+}
+
+type CompressionConfig struct {
+	// Any of "packages", "droplets", "buildpacks", "app_stash" and "buildpack_cache". Droplets are gzipped already
+	ResourceTypes []string `yaml:"resource_types"`
+	// From 1 (fastest) to 9 (smallest). Defaults to 6
+	Level int
+}
+
+func (config *CompressionConfig) Compresses(resourceType string) bool {
+	return contains(config.ResourceTypes, resourceType)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type DiskCacheConfig struct {
+	Directory string
+	// Total size of cached blobs, e.g. "10G". Least recently used blobs are evicted first
+	MaxSize string `yaml:"max_size"`
+	// How long blobs that do not exist are remembered as missing. Defaults to "30s". "0s" disables it
+	NegativeTTL string `yaml:"negative_ttl"`
+}
+
+func (config *DiskCacheConfig) MaxSizeBytes() int64 {
+	return int64(parseSizeProperty(config.MaxSize, 0))
+}
+
+func (config *DiskCacheConfig) NegativeTTLDuration() time.Duration {
+	return mustParseDuration(config.NegativeTTL)
+}
+
+type MaintenanceModeConfig struct {
+	Enabled bool
+	// Shown to clients whose changes are rejected
+	Reason string
+}
+
+type FaultInjectionConfig struct {
+	// Initial rules. They can be changed at runtime via the admin API
+	Faults []FaultRuleConfig
+}
+
+type FaultRuleConfig struct {
+	// Any of "app_stash", "packages", "droplets", "buildpacks" and "buildpack_cache". Empty means all
+	ResourceType string `yaml:"resource_type"`
+	// Any blobstore operation, e.g. "get" or "put". Empty means all
+	Operation string
+	// Added to every call, e.g. "2s"
+	Latency         string
+	ErrorRate       float64 `yaml:"error_rate"`
+	NotFoundRate    float64 `yaml:"not_found_rate"`
+	NoSpaceLeftRate float64 `yaml:"no_space_left_rate"`
+	TruncateRate    float64 `yaml:"truncate_rate"`
+	// Size after which truncated reads fail, e.g. "1K"
+	TruncateAfter string  `yaml:"truncate_after"`
+	HangRate      float64 `yaml:"hang_rate"`
+}
+
+func (config *FaultRuleConfig) LatencyDuration() time.Duration {
+	if config.Latency == "" {
+		return 0
+	}
+	return mustParseDuration(config.Latency)
+}
+
+func (config *FaultRuleConfig) TruncateAfterBytes() int64 {
+	return int64(parseSizeProperty(config.TruncateAfter, 0))
+}
+
+type QuotasConfig struct {
+	// Any of "packages", "droplets" and "buildpack_cache"
+	ResourceTypes []string `yaml:"resource_types"`
+	// Quota of tenants without a limit of their own, e.g. "10G". Empty means unlimited
+	DefaultLimit string `yaml:"default_limit"`
+	// Quotas by tenant, e.g. "some-space-guid: 20G"
+	Limits map[string]string
+	// File usage is persisted in
+	StateFile string `yaml:"state_file"`
+	// How often usage is reconciled with the blobstores. Defaults to "1h"
+	ReconcileInterval string `yaml:"reconcile_interval"`
+	// Must be true to confirm that a single bits-service instance is deployed. Every instance keeps its own usage,
+	// so with several instances each of them would allow a tenant its full quota.
+	SingleInstance bool `yaml:"single_instance"`
+}
+
+func (config *QuotasConfig) DefaultLimitBytes() int64 {
+	return int64(parseSizeProperty(config.DefaultLimit, 0))
+}
+
+func (config *QuotasConfig) LimitsBytes() map[string]int64 {
+	result := make(map[string]int64, len(config.Limits))
+	for tenant, limit := range config.Limits {
+		result[tenant] = int64(parseSizeProperty(limit, 0))
+	}
+	return result
+}
+
+func (config *QuotasConfig) ReconcileIntervalDuration() time.Duration {
+	return mustParseDuration(config.ReconcileInterval)
+}
+
+func (config *QuotasConfig) Enforces(resourceType string) bool {
+	return contains(config.ResourceTypes, resourceType)
+}
+
 func parseSizeProperty(size string, defaultValue uint64) uint64 {
 	if size == "" {
 		return defaultValue
@@ -268,16 +866,65 @@ func LoadConfig(filename string) (config Config, err error) {
 	if e != nil {
 		return Config{}, errors.New("error parsing config. Caused by: " + e.Error())
 	}
+	e = applyEnvironmentOverrides(&config)
+	if e != nil {
+		return Config{}, errors.New("error applying config overrides from environment. Caused by: " + e.Error())
+	}
+	if errs := setDefaultsAndVerify(&config); len(errs) > 0 {
+		return Config{}, errors.New("error in config values: " + strings.Join(errs, "; "))
+	}
+	return
+}
+
+func setDefaultsAndVerify(config *Config) (errs []string) {
 	config.Droplets.GlobalMaxBodySize = config.MaxBodySize
 	config.Packages.GlobalMaxBodySize = config.MaxBodySize
 	config.AppStash.GlobalMaxBodySize = config.MaxBodySize
 	config.Buildpacks.GlobalMaxBodySize = config.MaxBodySize
 	config.BuildpackCache.GlobalMaxBodySize = config.MaxBodySize
 
+	if config.SignedURLs.Expiry == "" {
+		config.SignedURLs.Expiry = "1h"
+	}
+	if config.SignedURLs.MaxExpiry == "" {
+		config.SignedURLs.MaxExpiry = "24h"
+	}
+	if config.SignedURLs.NonceStoreSize == 0 {
+		config.SignedURLs.NonceStoreSize = 100000
+	}
+	config.Droplets.GlobalSignedURLExpiry = config.SignedURLs.Expiry
+	config.Packages.GlobalSignedURLExpiry = config.SignedURLs.Expiry
+	config.AppStash.GlobalSignedURLExpiry = config.SignedURLs.Expiry
+	config.Buildpacks.GlobalSignedURLExpiry = config.SignedURLs.Expiry
+	config.BuildpackCache.GlobalSignedURLExpiry = config.SignedURLs.Expiry
+
 	config.Droplets.BlobstoreType = BlobstoreType(strings.ToLower(string(config.Droplets.BlobstoreType)))
 	config.Packages.BlobstoreType = BlobstoreType(strings.ToLower(string(config.Packages.BlobstoreType)))
 	config.AppStash.BlobstoreType = BlobstoreType(strings.ToLower(string(config.AppStash.BlobstoreType)))
 	config.Buildpacks.BlobstoreType = BlobstoreType(strings.ToLower(string(config.Buildpacks.BlobstoreType)))
+	config.BuildpackCache.BlobstoreType = BlobstoreType(strings.ToLower(string(config.BuildpackCache.BlobstoreType)))
+	config.RootFS.BlobstoreType = BlobstoreType(strings.ToLower(string(config.RootFS.BlobstoreType)))
+
+	if config.Metrics.Prefix == nil {
+		defaultPrefix := "bits"
+		config.Metrics.Prefix = &defaultPrefix
+	}
+	if config.Tracing.Exporter == "" {
+		config.Tracing.Exporter = OTLPExporter
+	}
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = "bits-service"
+	}
+	if config.Audit.SyslogTag == "" {
+		config.Audit.SyslogTag = "bits-service-audit"
+	}
+	if config.BasicAuthFailureLimit.MaxFailures == 0 {
+		config.BasicAuthFailureLimit.MaxFailures = 10
+	}
+	setRetryPolicyDefaults(&config.RetryPolicy)
+	if config.BasicAuthFailureLimit.Window == "" {
+		config.BasicAuthFailureLimit.Window = "1m"
+	}
 
 	setSignatureVersionDefault(&config.AppStash)
 	setSignatureVersionDefault(&config.Buildpacks)
@@ -294,8 +941,6 @@ func LoadConfig(filename string) (config Config, err error) {
 		}
 	}
 
-	var errs []string
-
 	if config.Port == 0 {
 		errs = append(errs, "port must be an integer > 0")
 	}
@@ -336,12 +981,41 @@ func LoadConfig(filename string) (config Config, err error) {
 		errs = append(errs, "key_file must not be empty")
 	}
 	if config.MaxBodySize != "" {
-		_, e = bytefmt.ToBytes(config.MaxBodySize)
+		_, e := bytefmt.ToBytes(config.MaxBodySize)
 		if e != nil {
 			errs = append(errs, "max_body_size is invalid. Caused by: "+e.Error())
 		}
 	}
 
+	switch strings.ToLower(config.Logging.Level) {
+	case "", "debug", "info", "warn", "error", "fatal":
+	default:
+		errs = append(errs, "logging.level must be one of: debug, info, warn, error, fatal")
+	}
+
+	if config.Tracing.Exporter != OTLPExporter && config.Tracing.Exporter != StdoutExporter {
+		errs = append(errs, "tracing.exporter must be one of: "+OTLPExporter+", "+StdoutExporter)
+	}
+
+	if config.Audit.Enabled {
+		switch config.Audit.Sink {
+		case FileAuditSink:
+			if config.Audit.File == "" {
+				errs = append(errs, "audit.file must not be empty when using audit sink \"file\"")
+			}
+		case SyslogAuditSink:
+		case WebhookAuditSink:
+			u, e := url.Parse(config.Audit.WebhookURL)
+			if e != nil {
+				errs = append(errs, "audit.webhook_url is invalid. Caused by:"+e.Error())
+			} else if u.Host == "" {
+				errs = append(errs, "audit.webhook_url host must not be empty")
+			}
+		default:
+			errs = append(errs, "audit.sink must be one of: "+FileAuditSink+", "+SyslogAuditSink+", "+WebhookAuditSink)
+		}
+	}
+
 	if config.CCUpdater != nil {
 		config.CCUpdater.Method = "PATCH"
 		u, e := url.Parse(config.CCUpdater.Endpoint)
@@ -352,10 +1026,50 @@ func LoadConfig(filename string) (config Config, err error) {
 		}
 	}
 
+	verifySigningUsers(config, &errs)
+	verifyRetryPolicyConfig(&config.RetryPolicy, &errs)
+
+	if config.JWT != nil {
+		verifyJWTConfig(config.JWT, &errs)
+	}
+
+	if config.ClientCertAuth != nil {
+		verifyClientCertAuthConfig(config.ClientCertAuth, &errs)
+	}
+
+	if config.Encryption != nil {
+		verifyEncryptionConfig(config.Encryption, &errs)
+	}
+
+	if config.Compression != nil {
+		verifyCompressionConfig(config.Compression, &errs)
+	}
+
+	if config.DiskCache != nil {
+		verifyDiskCacheConfig(config.DiskCache, &errs)
+		if config.Encryption != nil && (config.Encryption.Encrypts("app_stash") || config.Encryption.Encrypts("droplets")) {
+			errs = append(errs, "disk_cache cannot be combined with encryption of app_stash or droplets, since it would store their content unencrypted")
+		}
+	}
+
+	if config.Quotas != nil {
+		verifyQuotasConfig(config.Quotas, &errs)
+	}
+
+	if config.FaultInjection != nil {
+		verifyFaultInjectionConfig(config.FaultInjection, &errs)
+	}
+
 	verifyBlobstoreType(config.Droplets.BlobstoreType, "droplets", &errs)
 	verifyBlobstoreType(config.Packages.BlobstoreType, "packages", &errs)
 	verifyBlobstoreType(config.AppStash.BlobstoreType, "app_stash", &errs)
 	verifyBlobstoreType(config.Buildpacks.BlobstoreType, "buildpacks", &errs)
+	if config.BuildpackCache.BlobstoreType != "" && config.BuildpackCache.BlobstoreType != config.Droplets.BlobstoreType {
+		errs = append(errs, "buildpack_cache.blobstore_type must be empty or match droplets.blobstore_type, as the droplet blobstore is used.")
+	}
+	if config.EnableRegistry && config.RootFS.BlobstoreType != Local {
+		errs = append(errs, "rootfs.blobstore_type must be local. Other blobstore types are not supported for rootfs yet.")
+	}
 
 	verifyBlobstoreConfig(config.Droplets, "droplets", &errs)
 	verifyBlobstoreConfig(config.Packages, "packages", &errs)
@@ -364,7 +1078,7 @@ func LoadConfig(filename string) (config Config, err error) {
 
 	if len(errs) > 0 {
 		// returning here already, because follow-up checks are difficult if not even basic checks succeed
-		return Config{}, errors.New("error in config values: " + strings.Join(errs, "; "))
+		return errs
 	}
 
 	if config.BuildpackCache.AzureConfig != nil ||
@@ -395,19 +1109,461 @@ func LoadConfig(filename string) (config Config, err error) {
 		errs = append(errs, "app_stash_config.maximum_size must be greater than app_stash_config.minimum_size")
 	}
 
-	if config.Secret == "" && len(config.SigningKeys) == 0 {
-		errs = append(errs, "Must provide either \"secret\" or \"signing_keys\" with at least one element.")
+	if config.Secret == "" && len(config.SigningKeys) == 0 && len(config.AsymmetricSigningKeys) == 0 {
+		errs = append(errs, "Must provide either \"secret\", \"signing_keys\" or \"asymmetric_signing_keys\" with at least one element.")
 	}
 
 	if len(config.SigningKeys) > 0 && config.ActiveKeyID == "" {
 		errs = append(errs, "When providing signing_keys, you must also provide active_key_id.")
 	}
+	verifySigningKeys(config, &errs)
+	verifyAsymmetricSigningKeys(config, &errs)
+
+	verifySignedURLExpiries(config, &errs)
+
+	verifyCACertFiles(config, &errs)
 
-	// TODO validate CACertsPaths
 	if len(errs) > 0 {
-		return Config{}, errors.New("error in config values: " + strings.Join(errs, "; "))
+		return errs
+	}
+
+	for _, blobstoreConfig := range []*BlobstoreConfig{&config.Droplets, &config.Packages, &config.AppStash, &config.Buildpacks} {
+		setRedirectExpiry(blobstoreConfig, blobstoreConfig.SignedURLExpiryDuration())
+	}
+	return nil
+}
+
+// BuildpackCacheBlobstoreConfig returns the Droplets blobstore config the buildpack cache is stored in,
+// with redirects expiring after the buildpack cache's signed URL expiry instead of the droplets' one.
+func (config *Config) BuildpackCacheBlobstoreConfig() BlobstoreConfig {
+	return withRedirectExpiry(config.Droplets, config.BuildpackCache.SignedURLExpiryDuration())
+}
+
+func withRedirectExpiry(blobstoreConfig BlobstoreConfig, redirectExpiry time.Duration) BlobstoreConfig {
+	if blobstoreConfig.S3Config != nil {
+		s3Config := *blobstoreConfig.S3Config
+		s3Config.RedirectExpiry = redirectExpiry
+		blobstoreConfig.S3Config = &s3Config
+	}
+	if blobstoreConfig.ReplicatedConfig != nil {
+		replicatedConfig := *blobstoreConfig.ReplicatedConfig
+		replicatedConfig.Primary = withRedirectExpiry(replicatedConfig.Primary, redirectExpiry)
+		replicatedConfig.Secondaries = make([]BlobstoreConfig, len(blobstoreConfig.ReplicatedConfig.Secondaries))
+		for i, secondary := range blobstoreConfig.ReplicatedConfig.Secondaries {
+			replicatedConfig.Secondaries[i] = withRedirectExpiry(secondary, redirectExpiry)
+		}
+		blobstoreConfig.ReplicatedConfig = &replicatedConfig
+	}
+	if blobstoreConfig.MigratingConfig != nil {
+		blobstoreConfig.MigratingConfig = &MigratingBlobstoreConfig{
+			From: withRedirectExpiry(blobstoreConfig.MigratingConfig.From, redirectExpiry),
+			To:   withRedirectExpiry(blobstoreConfig.MigratingConfig.To, redirectExpiry),
+		}
+	}
+	return blobstoreConfig
+}
+
+func setRedirectExpiry(blobstoreConfig *BlobstoreConfig, redirectExpiry time.Duration) {
+	if blobstoreConfig.S3Config != nil {
+		blobstoreConfig.S3Config.RedirectExpiry = redirectExpiry
+	}
+	members, _ := blobstoreConfig.Members("")
+	for _, member := range members {
+		setRedirectExpiry(member, redirectExpiry)
+	}
+}
+
+// addWebdavCACertFiles also adds the CA certificate files of the members of replicated and migrating blobstores.
+func addWebdavCACertFiles(caCertFiles map[string]string, property string, blobstoreConfig *BlobstoreConfig) {
+	if blobstoreConfig.WebdavConfig != nil {
+		caCertFiles[property+".webdav_config.ca_cert_path"] = blobstoreConfig.WebdavConfig.CACertPath
+	}
+	members, properties := blobstoreConfig.Members(property)
+	for i, member := range members {
+		addWebdavCACertFiles(caCertFiles, properties[i], member)
+	}
+}
+
+// verifyCACertFiles makes sure all configured CA certificate files can be read and contain at least one PEM certificate.
+func verifyCACertFiles(config *Config, errs *[]string) {
+	caCertFiles := map[string]string{}
+	for property, blobstoreConfig := range map[string]*BlobstoreConfig{
+		"packages":        &config.Packages,
+		"droplets":        &config.Droplets,
+		"buildpacks":      &config.Buildpacks,
+		"app_stash":       &config.AppStash,
+		"buildpack_cache": &config.BuildpackCache,
+	} {
+		addWebdavCACertFiles(caCertFiles, property, blobstoreConfig)
+	}
+	if config.CCUpdater != nil {
+		caCertFiles["cc_updater.ca_cert_file"] = config.CCUpdater.CACertFile
+	}
+	if config.JWT != nil {
+		caCertFiles["jwt.jwks_ca_cert_file"] = config.JWT.JWKSCACertFile
+	}
+	if config.ClientCertAuth != nil {
+		caCertFiles["client_cert_auth.ca_cert_file"] = config.ClientCertAuth.CACertFile
+	}
+
+	for _, property := range sortedKeys(caCertFiles) {
+		if caCertFiles[property] == "" {
+			continue
+		}
+		content, e := ioutil.ReadFile(caCertFiles[property])
+		if e != nil {
+			*errs = append(*errs, property+" cannot be read. Caused by: "+e.Error())
+			continue
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(content) {
+			*errs = append(*errs, property+" does not contain any PEM encoded certificate")
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func verifySigningUsers(config *Config, errs *[]string) {
+	verifyCredentials("signing_users", config.SigningUsers, errs)
+	verifyCredentials("admin_users", config.AdminUsers, errs)
+	if config.BasicAuthFailureLimit.MaxFailures < 0 {
+		*errs = append(*errs, "basic_auth_failure_limit.max_failures must not be negative")
+	}
+	if window, e := time.ParseDuration(config.BasicAuthFailureLimit.Window); e != nil || window <= 0 {
+		*errs = append(*errs, "basic_auth_failure_limit.window must be a positive duration like \"1m\"")
+	}
+}
+
+func verifyCredentials(property string, credentials []Credential, errs *[]string) {
+	for _, credential := range credentials {
+		if (credential.Password == "") == (credential.PasswordHash == "") {
+			*errs = append(*errs, property+": user \""+credential.Username+"\" must have either password or password_hash")
+		}
+		if credential.PasswordHash != "" {
+			if e := util.ValidatePasswordHash(credential.PasswordHash); e != nil {
+				*errs = append(*errs, property+": password_hash of user \""+credential.Username+"\" is invalid. Caused by: "+e.Error())
+			}
+		}
+	}
+}
+
+func setRetryPolicyDefaults(config *RetryPolicyConfig) {
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 4
+	}
+	if config.InitialInterval == "" {
+		config.InitialInterval = "500ms"
+	}
+	if config.MaxInterval == "" {
+		config.MaxInterval = "5s"
+	}
+	if config.MaxElapsedTime == "" {
+		config.MaxElapsedTime = "30s"
+	}
+	if config.Jitter == nil {
+		jitter := 0.5
+		config.Jitter = &jitter
+	}
+	if config.RetryableErrors == nil {
+		config.RetryableErrors = []string{"timeout", "other"}
+	}
+}
+
+func verifyRetryPolicyConfig(config *RetryPolicyConfig, errs *[]string) {
+	if config.MaxAttempts < 1 {
+		*errs = append(*errs, "retry_policy.max_attempts must be at least 1")
+	}
+	for _, property := range []struct{ name, value string }{
+		{"initial_interval", config.InitialInterval},
+		{"max_interval", config.MaxInterval},
+		{"max_elapsed_time", config.MaxElapsedTime},
+	} {
+		if duration, e := time.ParseDuration(property.value); e != nil || duration <= 0 {
+			*errs = append(*errs, "retry_policy."+property.name+" must be a positive duration like \"5s\"")
+		}
+	}
+	if *config.Jitter < 0 || *config.Jitter > 1 {
+		*errs = append(*errs, "retry_policy.jitter must be between 0 and 1")
+	}
+	for _, errorType := range config.RetryableErrors {
+		if errorType != "timeout" && errorType != "other" {
+			*errs = append(*errs, "retry_policy.retryable_errors: unknown error type \""+errorType+"\". Must be one of: timeout, other")
+		}
+	}
+}
+
+func verifyJWTConfig(config *JWTConfig, errs *[]string) {
+	if config.JWKSRefreshInterval == "" {
+		config.JWKSRefreshInterval = "5m"
+	}
+	if (config.JWKSURL == "") == (len(config.Keys) == 0) {
+		*errs = append(*errs, "jwt: must provide either jwks_url or keys")
+	}
+	if config.JWKSURL != "" {
+		u, e := url.Parse(config.JWKSURL)
+		if e != nil {
+			*errs = append(*errs, "jwt.jwks_url is invalid. Caused by:"+e.Error())
+		} else if u.Host == "" {
+			*errs = append(*errs, "jwt.jwks_url host must not be empty")
+		}
+	}
+	if refreshInterval, e := time.ParseDuration(config.JWKSRefreshInterval); e != nil || refreshInterval <= 0 {
+		*errs = append(*errs, "jwt.jwks_refresh_interval must be a positive duration like \"5m\"")
+	}
+	for _, key := range config.Keys {
+		if _, e := parsePKIXPublicKey(key.PublicKey); e != nil {
+			*errs = append(*errs, "jwt.keys: public_key of key \""+key.KeyID+"\" is invalid. Caused by: "+e.Error())
+		}
+	}
+	if config.Audience == "" {
+		*errs = append(*errs, "jwt.audience must not be empty")
+	}
+}
+
+func verifyClientCertAuthConfig(config *ClientCertAuthConfig, errs *[]string) {
+	if config.Mode == "" {
+		config.Mode = OptionalClientCertMode
+	}
+	if config.Mode != RequiredClientCertMode && config.Mode != OptionalClientCertMode {
+		*errs = append(*errs, "client_cert_auth.mode must be one of: "+RequiredClientCertMode+", "+OptionalClientCertMode)
+	}
+	if config.CACertFile == "" {
+		*errs = append(*errs, "client_cert_auth.ca_cert_file must not be empty")
+	}
+	for i, client := range config.Clients {
+		if (client.Subject == "") == (client.SAN == "") {
+			*errs = append(*errs, fmt.Sprintf("client_cert_auth.clients[%v] must have either subject or san", i))
+		}
+		for _, permission := range client.Permissions {
+			if permission != "bits.read" && permission != "bits.write" && permission != "bits.admin" {
+				*errs = append(*errs, fmt.Sprintf("client_cert_auth.clients[%v] has unknown permission \"%v\"", i, permission))
+			}
+		}
+	}
+}
+
+func verifyEncryptionConfig(config *EncryptionConfig, errs *[]string) {
+	verifyResourceTypes("encryption.resource_types", config.ResourceTypes, errs)
+	if len(config.Keys) == 0 {
+		*errs = append(*errs, "encryption.keys must not be empty")
+	}
+	keyIDs := map[string]bool{}
+	for i, key := range config.Keys {
+		if key.KeyID == "" || len(key.KeyID) > 255 {
+			*errs = append(*errs, fmt.Sprintf("encryption.keys[%v].key_id must have between 1 and 255 characters", i))
+		}
+		if keyIDs[key.KeyID] {
+			*errs = append(*errs, "encryption.keys: duplicate key_id \""+key.KeyID+"\"")
+		}
+		keyIDs[key.KeyID] = true
+		if decodedKey, e := base64.StdEncoding.DecodeString(key.Key); e != nil || len(decodedKey) != 32 {
+			*errs = append(*errs, fmt.Sprintf("encryption.keys[%v].key must be a base64 encoded 256 bit key", i))
+		}
+	}
+	if !keyIDs[config.ActiveKeyID] {
+		*errs = append(*errs, "encryption.active_key_id must refer to one of the encryption.keys")
+	}
+}
+
+func verifyCompressionConfig(config *CompressionConfig, errs *[]string) {
+	if config.Level == 0 {
+		config.Level = 6
+	}
+	verifyResourceTypes("compression.resource_types", config.ResourceTypes, errs)
+	if config.Level < 1 || config.Level > 9 {
+		*errs = append(*errs, "compression.level must be between 1 and 9")
+	}
+}
+
+func verifyResourceTypes(property string, resourceTypes []string, errs *[]string) {
+	for _, resourceType := range resourceTypes {
+		switch resourceType {
+		case "packages", "droplets", "buildpacks", "app_stash", "buildpack_cache":
+		default:
+			*errs = append(*errs, property+": unknown resource type \""+resourceType+"\"")
+		}
+	}
+}
+
+func verifyDiskCacheConfig(config *DiskCacheConfig, errs *[]string) {
+	if config.NegativeTTL == "" {
+		config.NegativeTTL = "30s"
+	}
+	if config.Directory == "" {
+		*errs = append(*errs, "disk_cache.directory must not be empty")
+	}
+	if maxSize, e := bytefmt.ToBytes(config.MaxSize); e != nil || maxSize > math.MaxInt64 {
+		*errs = append(*errs, "disk_cache.max_size must be a size like \"10G\"")
+	}
+	if negativeTTL, e := time.ParseDuration(config.NegativeTTL); e != nil || negativeTTL < 0 {
+		*errs = append(*errs, "disk_cache.negative_ttl must be a duration like \"30s\"")
+	}
+}
+
+func verifyQuotasConfig(config *QuotasConfig, errs *[]string) {
+	if config.ReconcileInterval == "" {
+		config.ReconcileInterval = "1h"
+	}
+	for _, resourceType := range config.ResourceTypes {
+		switch resourceType {
+		case "packages", "droplets", "buildpack_cache":
+		default:
+			*errs = append(*errs, "quotas.resource_types: unsupported resource type \""+resourceType+"\"")
+		}
+	}
+	if !isSize(config.DefaultLimit) {
+		*errs = append(*errs, "quotas.default_limit must be empty or a size like \"10G\"")
+	}
+	for tenant, limit := range config.Limits {
+		if !isSize(limit) {
+			*errs = append(*errs, "quotas.limits: limit of \""+tenant+"\" must be empty or a size like \"10G\"")
+		}
+	}
+	if config.StateFile == "" {
+		*errs = append(*errs, "quotas.state_file must not be empty")
+	}
+	if reconcileInterval, e := time.ParseDuration(config.ReconcileInterval); e != nil || reconcileInterval <= 0 {
+		*errs = append(*errs, "quotas.reconcile_interval must be a positive duration like \"1h\"")
+	}
+	if !config.SingleInstance {
+		*errs = append(*errs, "quotas.single_instance must be true, since quotas can only be enforced by a single bits-service instance")
+	}
+}
+
+func verifyFaultInjectionConfig(config *FaultInjectionConfig, errs *[]string) {
+	for i, fault := range config.Faults {
+		prefix := fmt.Sprintf("fault_injection.faults[%v]", i)
+		switch fault.ResourceType {
+		case "", "app_stash", "packages", "droplets", "buildpacks", "buildpack_cache":
+		default:
+			*errs = append(*errs, prefix+".resource_type: unsupported resource type \""+fault.ResourceType+"\"")
+		}
+		switch fault.Operation {
+		case "", "exists", "head_or_redirect", "get", "get_or_redirect", "put", "copy", "delete", "delete_dir":
+		default:
+			*errs = append(*errs, prefix+".operation: unsupported operation \""+fault.Operation+"\"")
+		}
+		if fault.Latency != "" {
+			if latency, e := time.ParseDuration(fault.Latency); e != nil || latency < 0 {
+				*errs = append(*errs, prefix+".latency must be a duration like \"2s\"")
+			}
+		}
+		if !isSize(fault.TruncateAfter) {
+			*errs = append(*errs, prefix+".truncate_after must be empty or a size like \"1K\"")
+		}
+		for _, rate := range []float64{fault.ErrorRate, fault.NotFoundRate, fault.NoSpaceLeftRate, fault.TruncateRate, fault.HangRate} {
+			if rate < 0 || rate > 1 {
+				*errs = append(*errs, prefix+": rates must be between 0 and 1")
+				break
+			}
+		}
+	}
+}
+
+func isSize(size string) bool {
+	if size == "" {
+		return true
+	}
+	bytes, e := bytefmt.ToBytes(size)
+	return e == nil && bytes <= math.MaxInt64
+}
+
+func verifySigningKeys(config *Config, errs *[]string) {
+	activeKeyFound := false
+	for _, signingKey := range config.SigningKeys {
+		if signingKey.KeyID == config.ActiveKeyID {
+			activeKeyFound = true
+		}
+		if signingKey.NotAfter == "" {
+			continue
+		}
+		notAfter, e := parseNotAfter(signingKey.NotAfter)
+		if e != nil {
+			*errs = append(*errs, "signing_keys: not_after of key \""+signingKey.KeyID+"\" must be a date like \"2020-12-31\" or an RFC 3339 timestamp")
+		} else if signingKey.KeyID == config.ActiveKeyID && time.Now().After(notAfter) {
+			*errs = append(*errs, "active_key_id refers to key \""+signingKey.KeyID+"\", which has expired")
+		}
+	}
+	if len(config.SigningKeys) > 0 && config.ActiveKeyID != "" && !activeKeyFound {
+		*errs = append(*errs, "active_key_id must refer to one of the signing_keys")
+	}
+}
+
+func verifyAsymmetricSigningKeys(config *Config, errs *[]string) {
+	if len(config.AsymmetricSigningKeys) == 0 {
+		return
+	}
+	if config.Secret != "" || len(config.SigningKeys) > 0 {
+		*errs = append(*errs, "asymmetric_signing_keys cannot be combined with secret or signing_keys")
+	}
+	activeKeyFound := false
+	for _, signingKey := range config.AsymmetricSigningKeys {
+		if signingKey.PrivateKey == "" && signingKey.PublicKey == "" {
+			*errs = append(*errs, "asymmetric_signing_keys: key \""+signingKey.KeyID+"\" must have a private_key or a public_key")
+		}
+		if signingKey.PrivateKey != "" {
+			if _, e := parsePrivateKey(signingKey.PrivateKey); e != nil {
+				*errs = append(*errs, "asymmetric_signing_keys: private_key of key \""+signingKey.KeyID+"\" is invalid. Caused by: "+e.Error())
+			}
+			if signingKey.KeyID == config.ActiveKeyID {
+				activeKeyFound = true
+			}
+		}
+		if signingKey.PublicKey != "" {
+			if _, e := parsePublicKey(signingKey.PublicKey); e != nil {
+				*errs = append(*errs, "asymmetric_signing_keys: public_key of key \""+signingKey.KeyID+"\" is invalid. Caused by: "+e.Error())
+			}
+		}
+		if signingKey.NotAfter == "" {
+			continue
+		}
+		notAfter, e := parseNotAfter(signingKey.NotAfter)
+		if e != nil {
+			*errs = append(*errs, "asymmetric_signing_keys: not_after of key \""+signingKey.KeyID+"\" must be a date like \"2020-12-31\" or an RFC 3339 timestamp")
+		} else if signingKey.KeyID == config.ActiveKeyID && time.Now().After(notAfter) {
+			*errs = append(*errs, "active_key_id refers to key \""+signingKey.KeyID+"\", which has expired")
+		}
+	}
+	// Without active_key_id, this is a validation-only deployment
+	if config.ActiveKeyID != "" && !activeKeyFound {
+		*errs = append(*errs, "active_key_id must refer to one of the asymmetric_signing_keys with a private_key")
+	}
+}
+
+func verifySignedURLExpiries(config *Config, errs *[]string) {
+	maxExpiry, e := time.ParseDuration(config.SignedURLs.MaxExpiry)
+	if e != nil || maxExpiry <= 0 {
+		*errs = append(*errs, "signed_urls.max_expiry must be a positive duration, e.g. \"24h\"")
+		return
+	}
+	for _, setting := range []struct{ name, expiry string }{
+		{"signed_urls.expiry", config.SignedURLs.Expiry},
+		{"packages.signed_url_expiry", config.Packages.SignedURLExpiry},
+		{"droplets.signed_url_expiry", config.Droplets.SignedURLExpiry},
+		{"buildpacks.signed_url_expiry", config.Buildpacks.SignedURLExpiry},
+		{"buildpack_cache.signed_url_expiry", config.BuildpackCache.SignedURLExpiry},
+		{"app_stash.signed_url_expiry", config.AppStash.SignedURLExpiry},
+	} {
+		if setting.expiry == "" {
+			continue
+		}
+		duration, e := time.ParseDuration(setting.expiry)
+		if e != nil || duration <= 0 {
+			*errs = append(*errs, setting.name+" must be a positive duration, e.g. \"1h\"")
+		} else if duration > maxExpiry {
+			*errs = append(*errs, setting.name+" must not be greater than signed_urls.max_expiry")
+		}
+	}
+	if config.SignedURLs.NonceStoreSize < 0 {
+		*errs = append(*errs, "signed_urls.nonce_store_size must not be negative")
 	}
-	return
 }
 
 func verifyBlobstoreType(blobstoreType BlobstoreType, resourceType string, errs *[]string) {
@@ -426,6 +1582,80 @@ func verifyBlobstoreConfig(blobstoreConfig BlobstoreConfig, resourceType string,
 	}
 	if blobstoreConfigIsNil(blobstoreConfig) {
 		*errs = append(*errs, resourceType+" blobstore config is missing "+string(blobstoreConfig.BlobstoreType)+" config")
+		return
+	}
+	if blobstoreConfig.CircuitBreaker != nil {
+		verifyCircuitBreakerConfig(blobstoreConfig.CircuitBreaker, resourceType, errs)
+	}
+	switch blobstoreConfig.BlobstoreType {
+	case Replicated:
+		verifyReplicatedBlobstoreConfig(blobstoreConfig.ReplicatedConfig, resourceType, errs)
+	case Migrating:
+		// nothing to verify besides its members
+	default:
+		return
+	}
+	members, properties := blobstoreConfig.Members(resourceType)
+	for i, member := range members {
+		member.BlobstoreType = BlobstoreType(strings.ToLower(string(member.BlobstoreType)))
+		if member.BlobstoreType == Replicated || member.BlobstoreType == Migrating {
+			*errs = append(*errs, properties[i]+".blobstore_type must not be "+string(member.BlobstoreType)+" within a "+string(blobstoreConfig.BlobstoreType)+" blobstore")
+			continue
+		}
+		verifyBlobstoreType(member.BlobstoreType, properties[i], errs)
+		verifyBlobstoreConfig(*member, properties[i], errs)
+		setSignatureVersionDefault(member)
+		if member.BlobstoreType == WebDAV && member.WebdavConfig != nil && member.WebdavConfig.DirectoryKey == "" {
+			*errs = append(*errs, properties[i]+".webdav_config.directory_key must not be empty")
+		}
+	}
+}
+
+func verifyReplicatedBlobstoreConfig(config *ReplicatedBlobstoreConfig, resourceType string, errs *[]string) {
+	if config.Mode == "" {
+		config.Mode = SyncReplication
+	}
+	if config.RetryInterval == "" {
+		config.RetryInterval = "1m"
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 10
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 10000
+	}
+	if config.Mode != SyncReplication && config.Mode != AsyncReplication {
+		*errs = append(*errs, resourceType+".replicated_config.mode must be one of: "+SyncReplication+", "+AsyncReplication)
+	}
+	if retryInterval, e := time.ParseDuration(config.RetryInterval); e != nil || retryInterval <= 0 {
+		*errs = append(*errs, resourceType+".replicated_config.retry_interval must be a positive duration like \"1m\"")
+	}
+	if config.MaxAttempts < 0 {
+		*errs = append(*errs, resourceType+".replicated_config.max_attempts must not be negative")
+	}
+	if config.QueueSize < 0 {
+		*errs = append(*errs, resourceType+".replicated_config.queue_size must not be negative")
+	}
+	if len(config.Secondaries) == 0 {
+		*errs = append(*errs, resourceType+".replicated_config.secondaries must not be empty")
+	}
+}
+
+func verifyCircuitBreakerConfig(config *CircuitBreakerConfig, resourceType string, errs *[]string) {
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenPeriod == "" {
+		config.OpenPeriod = "30s"
+	}
+	if config.FailureThreshold < 0 {
+		*errs = append(*errs, resourceType+".circuit_breaker.failure_threshold must not be negative")
+	}
+	if openDuration, e := time.ParseDuration(config.OpenPeriod); e != nil || openDuration <= 0 {
+		*errs = append(*errs, resourceType+".circuit_breaker.open_period must be a positive duration like \"30s\"")
+	}
+	if config.MaxConcurrentCalls < 0 {
+		*errs = append(*errs, resourceType+".circuit_breaker.max_concurrent_calls must not be negative")
 	}
 }
 
@@ -445,13 +1675,18 @@ func blobstoreConfigIsNil(blobstoreConfig BlobstoreConfig) bool {
 		return blobstoreConfig.WebdavConfig == nil || *blobstoreConfig.WebdavConfig == (WebdavBlobstoreConfig{})
 	case Alibaba:
 		return blobstoreConfig.AlibabaConfig == nil || *blobstoreConfig.AlibabaConfig == (AlibabaBlobstoreConfig{})
+	case Replicated:
+		return blobstoreConfig.ReplicatedConfig == nil
+	case Migrating:
+		return blobstoreConfig.MigratingConfig == nil
 	default:
 		return true
 	}
 }
 
 func setSignatureVersionDefault(c *BlobstoreConfig) {
-	if c.BlobstoreType == AWS && c.S3Config.SignatureVersion == 0 {
+	// A missing s3_config is reported by verifyBlobstoreConfig
+	if c.BlobstoreType == AWS && c.S3Config != nil && c.S3Config.SignatureVersion == 0 {
 		c.S3Config.SignatureVersion = 4
 	}
 }
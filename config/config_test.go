@@ -1,10 +1,16 @@
 package config_test
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/onsi/ginkgo"
@@ -37,6 +43,25 @@ app_stash:
     directory_key: dummy
 `
 
+const localBlobstoreConfigs = `
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/packages
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/droplets
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`
+
 var _ = Describe("config", func() {
 
 	var configFile *os.File
@@ -160,73 +185,1218 @@ cert_file: /some/path
 		Expect(config.Packages.MaxBodySizeBytes()).To(Equal(uint64(20971520)))
 	})
 
-	Context("can read limits for resources match ", func() {
-		It("value: MinimumSize", func() {
-			fmt.Fprintf(configFile, "%s", `
+	It("reads the metrics config and defaults the prefix to bits", func() {
+		fmt.Fprintf(configFile, "%s", `
 public_endpoint: https://public.127.0.0.1.nip.io
 private_endpoint: https://internal.127.0.0.1.nip.io
 port: 8000
 secret: geheim
 key_file: /some/path
 cert_file: /some/path
-app_stash_config:
-  minimum_size: 64K
-  maximum_size: 13M
+metrics:
+  address: 127.0.0.1:9125
+  tags:
+    deployment: cf
+    az: z1
+  timing_suffix: .sparse-avg
 `+
-				dummyBlobstoreConfigs)
-			config, e := LoadConfig(configFile.Name())
-			Expect(e).NotTo(HaveOccurred())
-			Expect(config.AppStashConfig.MinimumSizeBytes()).To(Equal(uint64(65536)))
-			Expect(config.AppStashConfig.MaximumSizeBytes()).To(Equal(uint64(13631488)))
-		})
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
 
-		Context("maximum_size is smaller than minimum_size", func() {
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.Metrics.Address).To(Equal("127.0.0.1:9125"))
+		Expect(*config.Metrics.Prefix).To(Equal("bits"))
+		Expect(config.Metrics.TimingSuffix).To(Equal(".sparse-avg"))
+		Expect(config.Metrics.TagsMap()).To(Equal(map[string]string{"deployment": "cf", "az": "z1"}))
+	})
 
-			It("returns an error", func() {
-				fmt.Fprintf(configFile, "%s", `
+	It("allows disabling the metrics prefix", func() {
+		fmt.Fprintf(configFile, "%s", `
 public_endpoint: https://public.127.0.0.1.nip.io
 private_endpoint: https://internal.127.0.0.1.nip.io
 port: 8000
+secret: geheim
 key_file: /some/path
 cert_file: /some/path
-app_stash_config:
-  minimum_size: 64K
-  maximum_size: 60K
+metrics:
+  prefix: ""
 `+
-					dummyBlobstoreConfigs)
-				_, e := LoadConfig(configFile.Name())
-				Expect(e).To(MatchError(ContainSubstring("app_stash_config.maximum_size must be greater than app_stash_config.minimum_size")))
-			})
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
 
-		})
+		Expect(e).NotTo(HaveOccurred())
+		Expect(*config.Metrics.Prefix).To(BeEmpty())
 	})
 
-	It("returns an error when blobstores are not configured", func() {
+	It("rejects an unknown tracing exporter", func() {
 		fmt.Fprintf(configFile, "%s", `
-privatebuildpacks:
-droplets:
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+key_file: /some/path
+cert_file: /some/path
+tracing:
+  enabled: true
+  exporter: zipkin
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(ContainSubstring("tracing.exporter must be one of: otlp, stdout")))
+	})
+
+	It("requires a file for the audit file sink", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+key_file: /some/path
+cert_file: /some/path
+audit:
+  enabled: true
+  sink: file
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(ContainSubstring("audit.file must not be empty")))
+	})
+
+	It("defaults signed URL expiries and lets resource types override them", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+key_file: /some/path
+cert_file: /some/path
+signed_urls:
+  expiry: 30m
+`+
+			dummyBlobstoreConfigs+`
+  signed_url_expiry: 2h
+`)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.Packages.SignedURLExpiryDuration()).To(Equal(30 * time.Minute))
+		Expect(config.AppStash.SignedURLExpiryDuration()).To(Equal(2 * time.Hour))
+		Expect(config.SignedURLs.MaxExpiryDuration()).To(Equal(24 * time.Hour))
+		Expect(config.Buildpacks.S3Config.RedirectExpiry).To(Equal(30 * time.Minute))
+	})
+
+	It("lets buildpack cache redirects expire after the buildpack cache's signed URL expiry", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+key_file: /some/path
+cert_file: /some/path
+signed_urls:
+  expiry: 30m
 packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: aws
+  s3_config:
+    bucket: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
 app_stash:
-logging:
-  file: /tmp/bits-service.log
-  syslog: vcap.bits-service
-  level: debug
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpack_cache:
+  signed_url_expiry: 2h
+`)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.Droplets.S3Config.RedirectExpiry).To(Equal(30 * time.Minute))
+		Expect(config.BuildpackCacheBlobstoreConfig().S3Config.RedirectExpiry).To(Equal(2 * time.Hour))
+	})
+
+	It("rejects a signed URL expiry greater than max_expiry", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+key_file: /some/path
+cert_file: /some/path
+signed_urls:
+  expiry: 2h
+  max_expiry: 1h
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(ContainSubstring("signed_urls.expiry must not be greater than signed_urls.max_expiry")))
+	})
+
+	It("reads not_after of signing keys", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+signing_keys:
+  - key_id: old
+    secret: old-secret
+    not_after: 2020-01-31
+  - key_id: new
+    secret: new-secret
+    not_after: 2999-01-01T10:00:00Z
+active_key_id: new
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.SigningKeysNotAfterMap()).To(Equal(map[string]time.Time{
+			"old": time.Date(2020, 1, 31, 23, 59, 59, 0, time.UTC),
+			"new": time.Date(2999, 1, 1, 10, 0, 0, 0, time.UTC),
+		}))
+	})
+
+	It("rejects an expired active signing key", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+signing_keys:
+  - key_id: old
+    secret: old-secret
+    not_after: 2020-01-31
+active_key_id: old
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(ContainSubstring("active_key_id refers to key \"old\", which has expired")))
+	})
+
+	It("reads asymmetric signing keys", func() {
+		publicKey, privateKey, e := ed25519.GenerateKey(rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+		privateKeyDER, e := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(e).NotTo(HaveOccurred())
+		publicKeyDER, e := x509.MarshalPKIXPublicKey(publicKey)
+		Expect(e).NotTo(HaveOccurred())
+
+		fmt.Fprintf(configFile, `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+asymmetric_signing_keys:
+  - key_id: signing
+    private_key: |
+      %s
+  - key_id: verification-only
+    public_key: |
+      %s
+active_key_id: signing
+%s`,
+			indented(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyDER})),
+			indented(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})),
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.AsymmetricPrivateKeysMap()).To(HaveKeyWithValue("signing", privateKey))
+		Expect(config.AsymmetricPublicKeysMap()).To(HaveKeyWithValue("verification-only", publicKey))
+	})
+
+	It("rejects an active key ID which refers to a public key only", func() {
+		publicKey, _, e := ed25519.GenerateKey(rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+		publicKeyDER, e := x509.MarshalPKIXPublicKey(publicKey)
+		Expect(e).NotTo(HaveOccurred())
+
+		fmt.Fprintf(configFile, `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+asymmetric_signing_keys:
+  - key_id: verification-only
+    public_key: |
+      %s
+active_key_id: verification-only
+%s`,
+			indented(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})),
+			dummyBlobstoreConfigs)
+		_, e = LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(ContainSubstring("active_key_id must refer to one of the asymmetric_signing_keys with a private_key")))
+	})
+
+	It("reads the jwt config and defaults the JWKS refresh interval", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+jwt:
+  jwks_url: https://uaa.127.0.0.1.nip.io/token_keys
+  audience: bits_service
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.JWT.JWKSURL).To(Equal("https://uaa.127.0.0.1.nip.io/token_keys"))
+		Expect(config.JWT.JWKSRefreshIntervalDuration()).To(Equal(5 * time.Minute))
+	})
+
+	It("rejects a jwt config without audience and keys", func() {
+		fmt.Fprintf(configFile, "%s", `
 public_endpoint: https://public.127.0.0.1.nip.io
 private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
 secret: geheim
+jwt:
+  issuer: https://uaa.127.0.0.1.nip.io/oauth/token
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring("jwt: must provide either jwks_url or keys"),
+			ContainSubstring("jwt.audience must not be empty"))))
+	})
+
+	It("validates the client_cert_auth config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
 port: 8000
 key_file: /some/path
 cert_file: /some/path
-`)
+secret: geheim
+client_cert_auth:
+  mode: mandatory
+  clients:
+  - subject: CN=cloud_controller
+    san: cloud-controller-ng.service.cf.internal
+    permissions: [bits.read, bits.delete]
+`+
+			dummyBlobstoreConfigs)
 		_, e := LoadConfig(configFile.Name())
 
-		Expect(e).To(MatchError(SatisfyAll(
-			ContainSubstring("Blobstore type '' for droplets is invalid."),
-			ContainSubstring("Blobstore type '' for packages is invalid."),
-			ContainSubstring("Blobstore type '' for buildpacks is invalid."),
-			ContainSubstring("Blobstore type '' for app_stash is invalid."),
-		)))
+		Expect(e).To(MatchError(And(
+			ContainSubstring("client_cert_auth.mode must be one of: required, optional"),
+			ContainSubstring("client_cert_auth.ca_cert_file must not be empty"),
+			ContainSubstring("client_cert_auth.clients[0] must have either subject or san"),
+			ContainSubstring(`client_cert_auth.clients[0] has unknown permission "bits.delete"`))))
+	})
+
+	It("reads the encryption config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+encryption:
+  resource_types: [packages, droplets]
+  active_key_id: key-2
+  keys:
+  - key_id: key-1
+    key: AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=
+  - key_id: key-2
+    key: ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8=
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
 
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.Encryption.Encrypts("packages")).To(BeTrue())
+		Expect(config.Encryption.Encrypts("app_stash")).To(BeFalse())
+		Expect(config.Encryption.KeysMap()).To(HaveLen(2))
+		Expect(config.Encryption.KeysMap()["key-1"]).To(HaveLen(32))
 	})
 
-})
+	It("rejects an invalid encryption config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+encryption:
+  resource_types: [rootfs]
+  active_key_id: key-3
+  keys:
+  - key_id: key-1
+    key: dG9vIHNob3J0
+  - key_id: key-1
+    key: ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8=
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring(`encryption.resource_types: unknown resource type "rootfs"`),
+			ContainSubstring("encryption.keys[0].key must be a base64 encoded 256 bit key"),
+			ContainSubstring(`encryption.keys: duplicate key_id "key-1"`),
+			ContainSubstring("encryption.active_key_id must refer to one of the encryption.keys"))))
+	})
+
+	It("reads the compression config and defaults the level", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+compression:
+  resource_types: [app_stash, buildpack_cache]
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.Compression.Level).To(Equal(6))
+		Expect(config.Compression.Compresses("app_stash")).To(BeTrue())
+		Expect(config.Compression.Compresses("droplets")).To(BeFalse())
+	})
+
+	It("rejects an invalid compression config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+compression:
+  resource_types: [app_stashes]
+  level: 10
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring(`compression.resource_types: unknown resource type "app_stashes"`),
+			ContainSubstring("compression.level must be between 1 and 9"))))
+	})
+
+	It("reads the disk cache config and defaults the negative TTL", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+disk_cache:
+  directory: /var/vcap/data/bits-service
+  max_size: 10G
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.DiskCache.Directory).To(Equal("/var/vcap/data/bits-service"))
+		Expect(config.DiskCache.MaxSizeBytes()).To(Equal(int64(10 * 1024 * 1024 * 1024)))
+		Expect(config.DiskCache.NegativeTTLDuration()).To(Equal(30 * time.Second))
+	})
+
+	It("rejects an invalid disk cache config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+disk_cache:
+  negative_ttl: -1s
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring("disk_cache.directory must not be empty"),
+			ContainSubstring("disk_cache.max_size must be a size"),
+			ContainSubstring("disk_cache.negative_ttl must be a duration"))))
+	})
+
+	It("rejects a disk cache for encrypted resource types", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+disk_cache:
+  directory: /var/vcap/data/bits-service
+  max_size: 10G
+encryption:
+  resource_types: [packages, droplets]
+  active_key_id: key-1
+  keys:
+  - key_id: key-1
+    key: AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(ContainSubstring("disk_cache cannot be combined with encryption of app_stash or droplets")))
+	})
+
+	It("reads the quotas config and defaults the reconcile interval", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+quotas:
+  resource_types: [packages, droplets]
+  default_limit: 1G
+  limits:
+    some-space: 10G
+  state_file: /var/vcap/data/bits-service/quotas.json
+  single_instance: true
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.Quotas.Enforces("packages")).To(BeTrue())
+		Expect(config.Quotas.Enforces("buildpack_cache")).To(BeFalse())
+		Expect(config.Quotas.DefaultLimitBytes()).To(Equal(int64(1024 * 1024 * 1024)))
+		Expect(config.Quotas.LimitsBytes()).To(Equal(map[string]int64{"some-space": 10 * 1024 * 1024 * 1024}))
+		Expect(config.Quotas.ReconcileIntervalDuration()).To(Equal(time.Hour))
+	})
+
+	It("rejects an invalid quotas config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+quotas:
+  resource_types: [app_stash]
+  default_limit: lots
+  reconcile_interval: 0s
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring(`quotas.resource_types: unsupported resource type "app_stash"`),
+			ContainSubstring("quotas.default_limit must be empty or a size"),
+			ContainSubstring("quotas.state_file must not be empty"),
+			ContainSubstring("quotas.reconcile_interval must be a positive duration"),
+			ContainSubstring("quotas.single_instance must be true"))))
+	})
+
+	It("reads the fault injection config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+fault_injection:
+  faults:
+  - resource_type: packages
+    operation: get
+    latency: 2s
+    truncate_rate: 0.5
+    truncate_after: 1K
+  - error_rate: 0.1
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.FaultInjection.Faults).To(HaveLen(2))
+		Expect(config.FaultInjection.Faults[0].LatencyDuration()).To(Equal(2 * time.Second))
+		Expect(config.FaultInjection.Faults[0].TruncateAfterBytes()).To(Equal(int64(1024)))
+		Expect(config.FaultInjection.Faults[1].ErrorRate).To(Equal(0.1))
+		Expect(config.FaultInjection.Faults[1].LatencyDuration()).To(BeZero())
+	})
+
+	It("rejects an invalid fault injection config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+fault_injection:
+  faults:
+  - resource_type: rootfs
+    operation: list
+    latency: soon
+    truncate_after: lots
+    hang_rate: 2
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring(`fault_injection.faults[0].resource_type: unsupported resource type "rootfs"`),
+			ContainSubstring(`fault_injection.faults[0].operation: unsupported operation "list"`),
+			ContainSubstring("fault_injection.faults[0].latency must be a duration"),
+			ContainSubstring("fault_injection.faults[0].truncate_after must be empty or a size"),
+			ContainSubstring("fault_injection.faults[0]: rates must be between 0 and 1"))))
+	})
+
+	It("reads the replicated blobstore config and defaults its properties", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+packages:
+  blobstore_type: replicated
+  signed_url_expiry: 2h
+  replicated_config:
+    primary:
+      blobstore_type: Local
+      local_config:
+        path_prefix: /tmp/packages
+    secondaries:
+    - blobstore_type: aws
+      s3_config:
+        bucket: packages-replica
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/droplets
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		replicatedConfig := config.Packages.ReplicatedConfig
+		Expect(replicatedConfig.Primary.BlobstoreType).To(Equal(Local))
+		Expect(replicatedConfig.Secondaries[0].S3Config.Bucket).To(Equal("packages-replica"))
+		Expect(replicatedConfig.Secondaries[0].S3Config.RedirectExpiry).To(Equal(2 * time.Hour))
+		Expect(replicatedConfig.Mode).To(Equal(SyncReplication))
+		Expect(replicatedConfig.RetryIntervalDuration()).To(Equal(time.Minute))
+		Expect(replicatedConfig.MaxAttempts).To(Equal(10))
+		Expect(replicatedConfig.QueueSize).To(Equal(10000))
+	})
+
+	It("rejects an invalid replicated blobstore config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+packages:
+  blobstore_type: replicated
+  replicated_config:
+    mode: eventually
+    retry_interval: 0s
+    primary:
+      blobstore_type: replicated
+      replicated_config: {}
+droplets:
+  blobstore_type: replicated
+  replicated_config:
+    primary:
+      blobstore_type: local
+    secondaries:
+    - blobstore_type: ftp
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring("packages.replicated_config.mode must be one of: sync, async"),
+			ContainSubstring("packages.replicated_config.retry_interval must be a positive duration"),
+			ContainSubstring("packages.replicated_config.secondaries must not be empty"),
+			ContainSubstring("packages.replicated_config.primary.blobstore_type must not be replicated within a replicated blobstore"),
+			ContainSubstring("droplets.replicated_config.primary blobstore config is missing local config"),
+			ContainSubstring("droplets.replicated_config.secondaries[0]"))))
+	})
+
+	It("reads and validates the migrating blobstore config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+packages:
+  blobstore_type: Migrating
+  migrating_config:
+    from:
+      blobstore_type: webdav
+      webdav_config:
+        private_endpoint: https://blobstore.internal
+    to:
+      blobstore_type: aws
+      s3_config:
+        bucket: packages
+droplets:
+  blobstore_type: migrating
+  migrating_config:
+    from:
+      blobstore_type: local
+      local_config:
+        path_prefix: /tmp/droplets
+    to:
+      blobstore_type: migrating
+      migrating_config: {}
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring("packages.migrating_config.from.webdav_config.directory_key must not be empty"),
+			ContainSubstring("droplets.migrating_config.to.blobstore_type must not be migrating within a migrating blobstore"))))
+		Expect(e.Error()).NotTo(ContainSubstring("packages.migrating_config.to"))
+	})
+
+	It("reads the circuit breaker config of blobstores and defaults its properties", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/packages
+  circuit_breaker:
+    max_concurrent_calls: 100
+droplets:
+  blobstore_type: replicated
+  replicated_config:
+    primary:
+      blobstore_type: local
+      local_config:
+        path_prefix: /tmp/droplets
+      circuit_breaker:
+        failure_threshold: 3
+        open_period: 1m
+    secondaries:
+    - blobstore_type: local
+      local_config:
+        path_prefix: /tmp/droplets-replica
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(*config.Packages.CircuitBreaker).To(Equal(CircuitBreakerConfig{FailureThreshold: 5, OpenPeriod: "30s", MaxConcurrentCalls: 100}))
+		primaryCircuitBreaker := config.Droplets.ReplicatedConfig.Primary.CircuitBreaker
+		Expect(primaryCircuitBreaker.FailureThreshold).To(Equal(3))
+		Expect(primaryCircuitBreaker.OpenPeriodDuration()).To(Equal(time.Minute))
+		Expect(config.Droplets.CircuitBreaker).To(BeNil())
+		Expect(config.Buildpacks.CircuitBreaker).To(BeNil())
+	})
+
+	It("rejects an invalid circuit breaker config", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/packages
+  circuit_breaker:
+    failure_threshold: -1
+    open_period: never
+    max_concurrent_calls: -1
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/droplets
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`)
+		_, errs := ValidateFile(configFile.Name())
+
+		Expect(errs).To(ConsistOf(
+			"packages.circuit_breaker.failure_threshold must not be negative",
+			`packages.circuit_breaker.open_period must be a positive duration like "30s"`,
+			"packages.circuit_breaker.max_concurrent_calls must not be negative",
+		))
+	})
+
+	It("defaults the retry policy", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+retry_policy:
+  max_attempts: 2
+  retryable_errors: [timeout]
+`+
+			dummyBlobstoreConfigs)
+		config, e := LoadConfig(configFile.Name())
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(config.RetryPolicy.MaxAttempts).To(Equal(2))
+		Expect(config.RetryPolicy.InitialIntervalDuration()).To(Equal(500 * time.Millisecond))
+		Expect(config.RetryPolicy.MaxIntervalDuration()).To(Equal(5 * time.Second))
+		Expect(config.RetryPolicy.MaxElapsedTimeDuration()).To(Equal(30 * time.Second))
+		Expect(*config.RetryPolicy.Jitter).To(Equal(0.5))
+		Expect(config.RetryPolicy.RetryableErrors).To(Equal([]string{"timeout"}))
+	})
+
+	It("rejects an invalid retry policy", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+retry_policy:
+  max_attempts: -1
+  max_interval: soon
+  jitter: 2
+  retryable_errors: [timeout, not_found]
+`+
+			dummyBlobstoreConfigs)
+		_, errs := ValidateFile(configFile.Name())
+
+		Expect(errs).To(ContainElement("retry_policy.max_attempts must be at least 1"))
+		Expect(errs).To(ContainElement(`retry_policy.max_interval must be a positive duration like "5s"`))
+		Expect(errs).To(ContainElement("retry_policy.jitter must be between 0 and 1"))
+		Expect(errs).To(ContainElement(`retry_policy.retryable_errors: unknown error type "not_found". Must be one of: timeout, other`))
+		Expect(errs).NotTo(ContainElement(ContainSubstring("retry_policy.initial_interval")))
+	})
+
+	It("validates signing users, admin users and the basic auth failure limit", func() {
+		fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+signing_users:
+- username: both
+  password: secret
+  password_hash: $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy
+- username: neither
+- username: broken
+  password_hash: not-a-hash
+admin_users:
+- username: admin-without-password
+basic_auth_failure_limit:
+  max_failures: -1
+  window: 0s
+`+
+			dummyBlobstoreConfigs)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(And(
+			ContainSubstring(`signing_users: user "both" must have either password or password_hash`),
+			ContainSubstring(`signing_users: user "neither" must have either password or password_hash`),
+			ContainSubstring(`signing_users: password_hash of user "broken" is invalid`),
+			ContainSubstring(`admin_users: user "admin-without-password" must have either password or password_hash`),
+			ContainSubstring("basic_auth_failure_limit.max_failures must not be negative"),
+			ContainSubstring("basic_auth_failure_limit.window must be a positive duration"))))
+	})
+
+	Context("can read limits for resources match ", func() {
+		It("value: MinimumSize", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+secret: geheim
+key_file: /some/path
+cert_file: /some/path
+app_stash_config:
+  minimum_size: 64K
+  maximum_size: 13M
+`+
+				dummyBlobstoreConfigs)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.AppStashConfig.MinimumSizeBytes()).To(Equal(uint64(65536)))
+			Expect(config.AppStashConfig.MaximumSizeBytes()).To(Equal(uint64(13631488)))
+		})
+
+		Context("maximum_size is smaller than minimum_size", func() {
+
+			It("returns an error", func() {
+				fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+app_stash_config:
+  minimum_size: 64K
+  maximum_size: 60K
+`+
+					dummyBlobstoreConfigs)
+				_, e := LoadConfig(configFile.Name())
+				Expect(e).To(MatchError(ContainSubstring("app_stash_config.maximum_size must be greater than app_stash_config.minimum_size")))
+			})
+
+		})
+	})
+
+	It("returns an error when blobstores are not configured", func() {
+		fmt.Fprintf(configFile, "%s", `
+privatebuildpacks:
+droplets:
+packages:
+app_stash:
+logging:
+  file: /tmp/bits-service.log
+  syslog: vcap.bits-service
+  level: debug
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+secret: geheim
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+`)
+		_, e := LoadConfig(configFile.Name())
+
+		Expect(e).To(MatchError(SatisfyAll(
+			ContainSubstring("Blobstore type '' for droplets is invalid."),
+			ContainSubstring("Blobstore type '' for packages is invalid."),
+			ContainSubstring("Blobstore type '' for buildpacks is invalid."),
+			ContainSubstring("Blobstore type '' for app_stash is invalid."),
+		)))
+
+	})
+
+	Context("environment overrides", func() {
+		var secretFile *os.File
+
+		BeforeEach(func() {
+			var e error
+			secretFile, e = ioutil.TempFile("", "bitsgo_secret")
+			Expect(e).NotTo(HaveOccurred())
+			fmt.Fprint(secretFile, "secret-from-file\n")
+
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+signing_users:
+- username: the-user
+  password: the-password
+`+
+				dummyBlobstoreConfigs)
+		})
+
+		AfterEach(func() {
+			secretFile.Close()
+			os.Remove(secretFile.Name())
+			for _, name := range []string{"BITS_PORT", "BITS_SECRET", "BITS_SECRET_FILE", "BITS_ENABLE_HTTP", "BITS_SIGNING_USERS_0_PASSWORD_FILE",
+				"BITS_BUILDPACKS_S3_CONFIG_SECRET_ACCESS_KEY", "BITS_PACKAGES_S3_CONFIG_BUCKET", "BITS_RETRY_POLICY_JITTER"} {
+				os.Unsetenv(name)
+			}
+		})
+
+		It("overrides properties with BITS_ environment variables and files", func() {
+			os.Setenv("BITS_PORT", "9000")
+			os.Setenv("BITS_ENABLE_HTTP", "true")
+			os.Setenv("BITS_BUILDPACKS_S3_CONFIG_SECRET_ACCESS_KEY", "the-secret-access-key")
+			os.Setenv("BITS_PACKAGES_S3_CONFIG_BUCKET", "the-bucket")
+			os.Setenv("BITS_SECRET_FILE", secretFile.Name())
+			os.Setenv("BITS_SIGNING_USERS_0_PASSWORD_FILE", secretFile.Name())
+			os.Setenv("BITS_RETRY_POLICY_JITTER", "0.25")
+
+			config, e := LoadConfig(configFile.Name())
+
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.Port).To(Equal(9000))
+			Expect(config.HttpEnabled).To(BeTrue())
+			Expect(config.Buildpacks.S3Config.SecretAccessKey).To(Equal("the-secret-access-key"))
+			Expect(config.Buildpacks.S3Config.Bucket).To(Equal("dummy"))
+			Expect(config.Packages.S3Config.Bucket).To(Equal("the-bucket"))
+			Expect(config.Droplets.S3Config).To(BeNil())
+			Expect(config.Secret).To(Equal("secret-from-file"))
+			Expect(config.SigningUsers[0].Password).To(Equal("secret-from-file"))
+			Expect(*config.RetryPolicy.Jitter).To(Equal(0.25))
+		})
+
+		It("rejects invalid values and ambiguous overrides", func() {
+			os.Setenv("BITS_PORT", "not-a-number")
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("BITS_PORT must be an integer")))
+
+			os.Unsetenv("BITS_PORT")
+			os.Setenv("BITS_RETRY_POLICY_JITTER", "half")
+			_, e = LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("BITS_RETRY_POLICY_JITTER must be a number")))
+
+			os.Unsetenv("BITS_RETRY_POLICY_JITTER")
+			os.Setenv("BITS_SECRET", "geheim")
+			os.Setenv("BITS_SECRET_FILE", secretFile.Name())
+			_, e = LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("only one of BITS_SECRET and BITS_SECRET_FILE must be set")))
+		})
+
+		It("dumps the config with secrets redacted", func() {
+			os.Setenv("BITS_BUILDPACKS_S3_CONFIG_SECRET_ACCESS_KEY", "the-secret-access-key")
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+
+			redacted, e := config.RedactedYAML()
+
+			Expect(e).NotTo(HaveOccurred())
+			Expect(string(redacted)).To(SatisfyAll(
+				ContainSubstring("port: 8000"),
+				ContainSubstring("username: the-user"),
+				ContainSubstring("secret_access_key: REDACTED"),
+				Not(ContainSubstring("geheim")),
+				Not(ContainSubstring("the-password")),
+				Not(ContainSubstring("the-secret-access-key"))))
+		})
+	})
+
+	Describe("ValidateFile", func() {
+		It("reports unknown properties, incomplete blobstores and other errors with their paths", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+signing_users:
+- username: the-user
+  pasword: typo
+packages:
+  blobstore_type: AWS
+  s3_config:
+    bucket: the-bucket
+  local_config:
+    path_prefix: /tmp
+droplets:
+  blobstore_type: azure
+  azure_config:
+    container_name: droplets
+    acount_name: typo
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp
+app_stash:
+  blobstore_type: webdav
+  webdav_config:
+    directory_key: app_stash
+    ca_cert_path: /does/not/exist
+buildpack_cache:
+  blobstore_type: local
+`)
+			_, errs := ValidateFile(configFile.Name())
+
+			Expect(errs).To(ConsistOf(
+				"signing_users[0].pasword is not a known property",
+				"droplets.azure_config.acount_name is not a known property",
+				"packages.local_config is ignored, because blobstore_type is aws",
+				"packages.s3_config must have access_key_id and secret_access_key, unless use_iam_profile is true",
+				"droplets.azure_config.account_name must not be empty",
+				"droplets.azure_config.account_key must not be empty",
+				"app_stash.webdav_config.private_endpoint must not be empty",
+				"app_stash.webdav_config.public_endpoint must not be empty",
+				`signing_users: user "the-user" must have either password or password_hash`,
+				"buildpack_cache.blobstore_type must be empty or match droplets.blobstore_type, as the droplet blobstore is used.",
+			))
+		})
+
+		It("reports unreadable CA cert files", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+cc_updater:
+  endpoint: https://api.example.com
+  ca_cert_file: /does/not/exist
+`+
+				localBlobstoreConfigs)
+			_, errs := ValidateFile(configFile.Name())
+
+			Expect(errs).To(ConsistOf(HavePrefix("cc_updater.ca_cert_file cannot be read")))
+		})
+
+		It("reports unreadable CA cert files of replicated and migrating blobstore members", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+packages:
+  blobstore_type: replicated
+  replicated_config:
+    primary:
+      blobstore_type: local
+      local_config:
+        path_prefix: /tmp/packages
+    secondaries:
+    - blobstore_type: webdav
+      webdav_config:
+        private_endpoint: https://webdav.example.com
+        public_endpoint: https://webdav.example.com
+        directory_key: packages
+        ca_cert_path: /does/not/exist
+droplets:
+  blobstore_type: migrating
+  migrating_config:
+    from:
+      blobstore_type: local
+      local_config:
+        path_prefix: /tmp/droplets
+    to:
+      blobstore_type: webdav
+      webdav_config:
+        private_endpoint: https://webdav.example.com
+        public_endpoint: https://webdav.example.com
+        directory_key: droplets
+        ca_cert_path: /does/not/exist
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/buildpacks
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: /tmp/app_stash
+`)
+			_, errs := ValidateFile(configFile.Name())
+
+			Expect(errs).To(ConsistOf(
+				HavePrefix("packages.replicated_config.secondaries[0].webdav_config.ca_cert_path cannot be read"),
+				HavePrefix("droplets.migrating_config.to.webdav_config.ca_cert_path cannot be read")))
+		})
+
+		It("accepts a valid config", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+`+
+				localBlobstoreConfigs)
+			_, errs := ValidateFile(configFile.Name())
+
+			Expect(errs).To(BeEmpty())
+		})
+	})
+
+	Describe("NonReloadableChanges", func() {
+		It("ignores the properties which can be reloaded", func() {
+			current := Config{Port: 8000, Logging: LoggingConfig{Level: "info"}, MaxBodySize: "1M"}
+			current.Packages.BlobstoreType = Local
+			current.Packages.MaxBodySize = "2M"
+			reloaded := Config{Port: 8000, Logging: LoggingConfig{Level: "debug"}, MaxBodySize: "10M", ActiveKeyID: "key2",
+				SigningUsers:    []Credential{{Username: "user", Password: "password"}},
+				AppStashConfig:  AppStashConfig{MinimumSize: "1K"},
+				MaintenanceMode: MaintenanceModeConfig{Enabled: true, Reason: "migrating"}}
+			reloaded.Packages.BlobstoreType = Local
+			reloaded.Packages.MaxBodySize = "20M"
+			reloaded.Droplets.ReadOnly = true
+
+			Expect(NonReloadableChanges(current, reloaded)).To(BeEmpty())
+		})
+
+		It("lists the other changed properties by their yaml names", func() {
+			current := Config{Port: 8000, PublicEndpoint: "https://public.example.com"}
+			current.Packages.BlobstoreType = Local
+			reloaded := Config{Port: 8001, PublicEndpoint: "https://public.example.com"}
+			reloaded.Packages.BlobstoreType = AWS
+
+			Expect(NonReloadableChanges(current, reloaded)).To(ConsistOf("port", "packages"))
+		})
+	})
+
+})
+
+func indented(pemEncoded []byte) string {
+	return strings.Replace(strings.TrimSpace(string(pemEncoded)), "\n", "\n      ", -1)
+}
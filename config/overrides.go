@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const environmentPrefix = "BITS"
+
+// applyEnvironmentOverrides overrides properties with environment variables named after their yaml path, e.g.
+// BITS_PACKAGES_S3_CONFIG_SECRET_ACCESS_KEY for packages.s3_config.secret_access_key, or BITS_SIGNING_USERS_0_PASSWORD
+// for the password of the first signing user. For string properties, a variable with suffix _FILE names a file
+// to read the value from instead, e.g. a mounted Kubernetes secret.
+func applyEnvironmentOverrides(config *Config) error {
+	_, e := applyOverridesTo(reflect.ValueOf(config).Elem(), environmentPrefix, map[reflect.Type]bool{})
+	return e
+}
+
+// allocating holds the types of nil pointers which are being allocated tentatively, to stop at recursive types
+// like replicated blobstore configs.
+func applyOverridesTo(value reflect.Value, name string, allocating map[reflect.Type]bool) (overridden bool, e error) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" || field.Tag.Get("yaml") == "-" {
+				continue
+			}
+			fieldOverridden, e := applyOverridesTo(value.Field(i), name+"_"+strings.ToUpper(yamlNameOf(field)), allocating)
+			if e != nil {
+				return false, e
+			}
+			overridden = overridden || fieldOverridden
+		}
+		return overridden, nil
+
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return applyOverridesTo(value.Elem(), name, allocating)
+		}
+		if allocating[value.Type()] {
+			return false, nil
+		}
+		// only allocate the struct when any of its properties is set via the environment
+		allocating[value.Type()] = true
+		defer delete(allocating, value.Type())
+		newValue := reflect.New(value.Type().Elem())
+		overridden, e = applyOverridesTo(newValue.Elem(), name, allocating)
+		if overridden {
+			value.Set(newValue)
+		}
+		return overridden, e
+
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.String {
+			s, exist, e := lookupEnvironmentValue(name)
+			if !exist || e != nil {
+				return false, e
+			}
+			value.Set(reflect.ValueOf(strings.Split(s, ",")))
+			return true, nil
+		}
+		for i := 0; i < value.Len(); i++ {
+			elementOverridden, e := applyOverridesTo(value.Index(i), fmt.Sprintf("%v_%v", name, i), allocating)
+			if e != nil {
+				return false, e
+			}
+			overridden = overridden || elementOverridden
+		}
+		return overridden, nil
+
+	default:
+		s, exist, e := lookupEnvironmentValue(name)
+		if !exist || e != nil {
+			return false, e
+		}
+		return true, setFromString(value, s, name)
+	}
+}
+
+func lookupEnvironmentValue(name string) (value string, exist bool, e error) {
+	value, exist = os.LookupEnv(name)
+	filename, fileExists := os.LookupEnv(name + "_FILE")
+	if !fileExists {
+		return value, exist, nil
+	}
+	if exist {
+		return "", false, errors.Errorf("only one of %v and %v_FILE must be set", name, name)
+	}
+	content, e := ioutil.ReadFile(filename)
+	if e != nil {
+		return "", false, errors.Wrapf(e, "could not read %v_FILE", name)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+func setFromString(value reflect.Value, s string, name string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		b, e := strconv.ParseBool(s)
+		if e != nil {
+			return errors.Wrapf(e, "%v must be a boolean", name)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, e := strconv.ParseInt(s, 10, 64)
+		if e != nil {
+			return errors.Wrapf(e, "%v must be an integer", name)
+		}
+		value.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		f, e := strconv.ParseFloat(s, value.Type().Bits())
+		if e != nil {
+			return errors.Wrapf(e, "%v must be a number", name)
+		}
+		value.SetFloat(f)
+	default:
+		return errors.Errorf("%v cannot be set via the environment", name)
+	}
+	return nil
+}
+
+var secretProperties = map[string]bool{
+	"secret":                    true,
+	"password":                  true,
+	"password_hash":             true,
+	"private_key":               true,
+	"secret_access_key":         true,
+	"account_key":               true,
+	"api_key":                   true,
+	"access_key_secret":         true,
+	"account_meta_temp_url_key": true,
+	"key":                       true,
+}
+
+// RedactedYAML returns the config as YAML, with the values of all secret properties replaced.
+func (config Config) RedactedYAML() ([]byte, error) {
+	content, e := yaml.Marshal(config)
+	if e != nil {
+		return nil, e
+	}
+	var properties yaml.MapSlice
+	e = yaml.Unmarshal(content, &properties)
+	if e != nil {
+		return nil, e
+	}
+	return yaml.Marshal(redacted(properties))
+}
+
+func redacted(value interface{}) interface{} {
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		for i := range value {
+			if secretProperties[fmt.Sprint(value[i].Key)] && value[i].Value != "" {
+				value[i].Value = "REDACTED"
+			} else {
+				value[i].Value = redacted(value[i].Value)
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redacted(value[i])
+		}
+	}
+	return value
+}
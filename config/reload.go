@@ -0,0 +1,48 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// NonReloadableChanges returns the names of the top-level properties which differ between current and reloaded,
+// ignoring the properties which can be changed at runtime: the logging level, signing users, signing keys,
+// body size limits, app stash size thresholds, maintenance mode and read-only resource types.
+func NonReloadableChanges(current, reloaded Config) []string {
+	currentValue := reflect.ValueOf(withoutReloadableProperties(current))
+	reloadedValue := reflect.ValueOf(withoutReloadableProperties(reloaded))
+
+	var changes []string
+	for i := 0; i < currentValue.NumField(); i++ {
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), reloadedValue.Field(i).Interface()) {
+			changes = append(changes, yamlNameOf(currentValue.Type().Field(i)))
+		}
+	}
+	return changes
+}
+
+func withoutReloadableProperties(config Config) Config {
+	config.Logging.Level = ""
+	config.SigningUsers = nil
+	config.AdminUsers = nil
+	config.SigningKeys = nil
+	config.AsymmetricSigningKeys = nil
+	config.ActiveKeyID = ""
+	config.MaxBodySize = ""
+	config.AppStashConfig = AppStashConfig{}
+	config.MaintenanceMode = MaintenanceModeConfig{}
+	for _, blobstoreConfig := range []*BlobstoreConfig{&config.Buildpacks, &config.Droplets, &config.Packages, &config.AppStash, &config.RootFS, &config.BuildpackCache} {
+		blobstoreConfig.MaxBodySize = ""
+		blobstoreConfig.GlobalMaxBodySize = ""
+		blobstoreConfig.ReadOnly = false
+	}
+	return config
+}
+
+func yamlNameOf(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("yaml"), ",")[0]; name != "" {
+		return name
+	}
+	// the default yaml.v2 uses for untagged fields
+	return strings.ToLower(field.Name)
+}
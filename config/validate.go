@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ValidateFile checks a config file more strictly than LoadConfig: it rejects unknown properties, checks every blobstore
+// for the properties its type requires and reports all errors it finds, rather than the first ones. Where possible,
+// errors start with the YAML path of the offending property.
+func ValidateFile(filename string) (Config, []string) {
+	content, e := ioutil.ReadFile(filename)
+	if e != nil {
+		return Config{}, []string{"error reading config. Caused by: " + e.Error()}
+	}
+	var properties yaml.MapSlice
+	e = yaml.Unmarshal(content, &properties)
+	if e != nil {
+		return Config{}, []string{"error parsing config. Caused by: " + e.Error()}
+	}
+
+	errs := unknownProperties(properties, reflect.TypeOf(Config{}), "")
+
+	var config Config
+	e = yaml.Unmarshal(content, &config)
+	if typeError, isTypeError := e.(*yaml.TypeError); isTypeError {
+		errs = append(errs, typeError.Errors...)
+	} else if e != nil {
+		errs = append(errs, e.Error())
+	}
+	e = applyEnvironmentOverrides(&config)
+	if e != nil {
+		errs = append(errs, "error applying config overrides from environment. Caused by: "+e.Error())
+	}
+
+	for _, blobstore := range []struct {
+		property string
+		config   BlobstoreConfig
+	}{
+		{"packages", config.Packages},
+		{"droplets", config.Droplets},
+		{"buildpacks", config.Buildpacks},
+		{"app_stash", config.AppStash},
+	} {
+		errs = append(errs, blobstorePropertyErrors(blobstore.property, blobstore.config)...)
+	}
+
+	errs = append(errs, setDefaultsAndVerify(&config)...)
+	return config, errs
+}
+
+func unknownProperties(value interface{}, t reflect.Type, path string) (errs []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		properties, isMap := value.(yaml.MapSlice)
+		if !isMap {
+			// type mismatches are reported when unmarshalling into Config
+			return nil
+		}
+		fields := make(map[string]reflect.StructField, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" && t.Field(i).Tag.Get("yaml") != "-" {
+				fields[yamlNameOf(t.Field(i))] = t.Field(i)
+			}
+		}
+		for _, property := range properties {
+			propertyPath := propertyPathFor(path, fmt.Sprint(property.Key))
+			field, exists := fields[fmt.Sprint(property.Key)]
+			if !exists {
+				errs = append(errs, propertyPath+" is not a known property")
+				continue
+			}
+			errs = append(errs, unknownProperties(property.Value, field.Type, propertyPath)...)
+		}
+	case reflect.Slice:
+		elements, isSlice := value.([]interface{})
+		if !isSlice {
+			return nil
+		}
+		for i, element := range elements {
+			errs = append(errs, unknownProperties(element, t.Elem(), fmt.Sprintf("%v[%v]", path, i))...)
+		}
+	}
+	return
+}
+
+func propertyPathFor(path string, property string) string {
+	if path == "" {
+		return property
+	}
+	return path + "." + property
+}
+
+// requiredBlobstoreProperties lists, per blobstore type, the name of its config and the properties it cannot do without.
+var requiredBlobstoreProperties = map[BlobstoreType]struct {
+	configProperty string
+	properties     []string
+}{
+	Local:      {"local_config", []string{"path_prefix"}},
+	AWS:        {"s3_config", []string{"bucket"}},
+	Google:     {"gcp_config", []string{"bucket", "private_key_id", "private_key", "email"}},
+	Azure:      {"azure_config", []string{"container_name", "account_name", "account_key"}},
+	OpenStack:  {"openstack_config", []string{"container_name", "username", "api_key", "auth_url"}},
+	WebDAV:     {"webdav_config", []string{"private_endpoint", "public_endpoint", "directory_key"}},
+	Alibaba:    {"alibaba_config", []string{"bucket_name", "access_key_id", "access_key_secret", "endpoint"}},
+	Replicated: {"replicated_config", nil},
+	Migrating:  {"migrating_config", nil},
+}
+
+func blobstorePropertyErrors(property string, blobstoreConfig BlobstoreConfig) (errs []string) {
+	blobstoreType := BlobstoreType(strings.ToLower(string(blobstoreConfig.BlobstoreType)))
+	required, knownType := requiredBlobstoreProperties[blobstoreType]
+	if !knownType {
+		// reported by verifyBlobstoreType
+		return nil
+	}
+
+	blobstoreValue := reflect.ValueOf(blobstoreConfig)
+	for i := 0; i < blobstoreValue.NumField(); i++ {
+		field := blobstoreValue.Type().Field(i)
+		if field.Type.Kind() != reflect.Ptr || blobstoreValue.Field(i).IsNil() {
+			continue
+		}
+		configProperty := yamlNameOf(field)
+		if !strings.HasSuffix(configProperty, "_config") {
+			// not specific to a blobstore type, e.g. circuit_breaker
+			continue
+		}
+		if configProperty != required.configProperty {
+			errs = append(errs, fmt.Sprintf("%v.%v is ignored, because blobstore_type is %v", property, configProperty, blobstoreType))
+			continue
+		}
+		for _, requiredProperty := range required.properties {
+			if stringPropertyOf(blobstoreValue.Field(i).Elem(), requiredProperty) == "" {
+				errs = append(errs, fmt.Sprintf("%v.%v.%v must not be empty", property, configProperty, requiredProperty))
+			}
+		}
+		if blobstoreType == AWS && !blobstoreConfig.S3Config.UseIAMProfile &&
+			(blobstoreConfig.S3Config.AccessKeyID == "" || blobstoreConfig.S3Config.SecretAccessKey == "") {
+			errs = append(errs, property+".s3_config must have access_key_id and secret_access_key, unless use_iam_profile is true")
+		}
+	}
+	members, properties := blobstoreConfig.Members(property)
+	for i, member := range members {
+		errs = append(errs, blobstorePropertyErrors(properties[i], *member)...)
+	}
+	return
+}
+
+func stringPropertyOf(value reflect.Value, property string) string {
+	for i := 0; i < value.NumField(); i++ {
+		if yamlNameOf(value.Type().Field(i)) == property {
+			return value.Field(i).String()
+		}
+	}
+	panic("Unexpected property " + property)
+}
@@ -0,0 +1,33 @@
+package bitsgo
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// ConfigReloadHandler lets operators apply configuration changes without a restart, which would kill in-flight uploads.
+type ConfigReloadHandler struct {
+	reload func() error
+}
+
+// NewConfigReloadHandler creates a handler which calls reload. reload is expected to re-read the configuration
+// file and apply its reloadable parts, or to change nothing when returning an error.
+func NewConfigReloadHandler(reload func() error) *ConfigReloadHandler {
+	return &ConfigReloadHandler{reload: reload}
+}
+
+func (handler *ConfigReloadHandler) Reload(responseWriter http.ResponseWriter, request *http.Request) {
+	audit.From(request).Describe(audit.ReloadConfig, "")
+	e := handler.reload()
+	if e != nil {
+		logger.From(request).Errorw("Could not reload config", "error", e)
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "Could not reload config: %v", e.Error())
+		return
+	}
+	logger.From(request).Infow("Reloaded config")
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+package bitsgo
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// FaultRule describes faults injected into blobstore calls, for testing how the bits-service and its clients
+// behave with slow or failing storage. Rates are probabilities between 0 and 1.
+type FaultRule struct {
+	// Empty means all resource types
+	ResourceType string `json:"resource_type,omitempty"`
+	// One of "exists", "head_or_redirect", "get", "get_or_redirect", "put", "copy", "delete" and "delete_dir".
+	// Empty means all operations
+	Operation string `json:"operation,omitempty"`
+
+	LatencyMillis   int64   `json:"latency_ms,omitempty"`
+	ErrorRate       float64 `json:"error_rate,omitempty"`
+	NotFoundRate    float64 `json:"not_found_rate,omitempty"`
+	NoSpaceLeftRate float64 `json:"no_space_left_rate,omitempty"`
+	// Bodies returned by get and get_or_redirect fail after TruncateAfterBytes
+	TruncateRate       float64 `json:"truncate_rate,omitempty"`
+	TruncateAfterBytes int64   `json:"truncate_after_bytes,omitempty"`
+	// Hung calls only return when their request is cancelled or the rules are changed
+	HangRate float64 `json:"hang_rate,omitempty"`
+}
+
+type FaultInjectionController interface {
+	FaultRules() []FaultRule
+	// SetFaultRules replaces all rules. It returns an error and keeps the current rules when rules are invalid.
+	SetFaultRules(rules []FaultRule) error
+}
+
+// FaultInjectionHandler lets tests change injected faults at runtime.
+type FaultInjectionHandler struct {
+	controller FaultInjectionController
+}
+
+func NewFaultInjectionHandler(controller FaultInjectionController) *FaultInjectionHandler {
+	return &FaultInjectionHandler{controller: controller}
+}
+
+func (handler *FaultInjectionHandler) List(responseWriter http.ResponseWriter, request *http.Request) {
+	writeJSON(responseWriter, handler.controller.FaultRules())
+}
+
+// Set expects a JSON array of FaultRules. An empty array stops injecting faults.
+func (handler *FaultInjectionHandler) Set(responseWriter http.ResponseWriter, request *http.Request) {
+	var rules []FaultRule
+	e := json.NewDecoder(request.Body).Decode(&rules)
+	if e != nil {
+		badRequest(responseWriter, request, "Invalid body: %v", e.Error())
+		return
+	}
+	audit.From(request).Describe(audit.SetFaultRules, "")
+	e = handler.controller.SetFaultRules(rules)
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "Invalid fault rules: %v", e.Error())
+		return
+	}
+	logger.From(request).Infow("Changed injected faults", "rules", rules)
+	writeJSON(responseWriter, handler.controller.FaultRules())
+}
@@ -0,0 +1,58 @@
+package bitsgo
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+type CircuitBreakerStatus struct {
+	// Resource type, or resource type and member of a replicated or migrating blobstore, e.g. "droplets-secondary-0"
+	Blobstore           string `json:"blobstore"`
+	Operation           string `json:"operation"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+type CircuitBreakerStatusReporter interface {
+	CircuitBreakerStatus() []CircuitBreakerStatus
+}
+
+// HealthHandler reports the state of the circuit breakers in front of the blobstores. It always responds with
+// 200, since the bits-service itself is healthy even when a blobstore is not, and restarting it would not help.
+type HealthHandler struct {
+	circuitBreakers []CircuitBreakerStatusReporter
+}
+
+func NewHealthHandler(circuitBreakers ...CircuitBreakerStatusReporter) *HealthHandler {
+	return &HealthHandler{circuitBreakers: circuitBreakers}
+}
+
+type healthResponseBody struct {
+	// "ok" when all circuit breakers are closed, "degraded" otherwise
+	Status          string                 `json:"status"`
+	CircuitBreakers []CircuitBreakerStatus `json:"circuit_breakers"`
+}
+
+func (handler *HealthHandler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	body := healthResponseBody{Status: "ok", CircuitBreakers: []CircuitBreakerStatus{}}
+	for _, circuitBreaker := range handler.circuitBreakers {
+		for _, status := range circuitBreaker.CircuitBreakerStatus() {
+			if status.State != CircuitClosed {
+				body.Status = "degraded"
+			}
+			body.CircuitBreakers = append(body.CircuitBreakers, status)
+		}
+	}
+	response, e := json.Marshal(body)
+	util.PanicOnError(e)
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(response)
+}
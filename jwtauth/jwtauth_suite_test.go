@@ -0,0 +1,13 @@
+package jwtauth_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestJwtauth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Jwtauth Suite")
+}
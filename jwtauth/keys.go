@@ -0,0 +1,202 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/pkg/errors"
+)
+
+// KeyProvider returns the public key a token has been signed with. keyID is the "kid" header of the token
+// and can be empty.
+type KeyProvider interface {
+	Key(keyID string) (crypto.PublicKey, error)
+}
+
+// StaticKeys is a KeyProvider for keys which are configured up front.
+type StaticKeys map[string]crypto.PublicKey
+
+func (keys StaticKeys) Key(keyID string) (crypto.PublicKey, error) {
+	if key, exist := keys[keyID]; exist {
+		return key, nil
+	}
+	// Tokens without "kid" are accepted as long as there is no ambiguity about the key.
+	if keyID == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, errors.Errorf("unknown key ID \"%v\"", keyID)
+}
+
+// Unknown key IDs trigger a refresh, but not more often than this, so that tokens with made up key IDs
+// cannot be used to flood the JWKS endpoint.
+const minRefreshInterval = 30 * time.Second
+
+// JWKSKeyProvider fetches keys from a JSON Web Key Set URL, e.g. UAA's /token_keys.
+type JWKSKeyProvider struct {
+	url             string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	clock           clock.Clock
+
+	mutex       sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewJWKSKeyProvider creates a JWKSKeyProvider which re-fetches keys once they are older than refreshInterval,
+// or when a token refers to an unknown key.
+func NewJWKSKeyProvider(url string, httpClient *http.Client, refreshInterval time.Duration, clock clock.Clock) *JWKSKeyProvider {
+	return &JWKSKeyProvider{
+		url:             url,
+		httpClient:      httpClient,
+		refreshInterval: refreshInterval,
+		clock:           clock,
+	}
+}
+
+func (provider *JWKSKeyProvider) Key(keyID string) (crypto.PublicKey, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	sinceLastRefresh := provider.clock.Now().Sub(provider.lastRefresh)
+	key, exist := provider.keys[keyID]
+	if provider.lastRefresh.IsZero() || sinceLastRefresh > provider.refreshInterval || (!exist && sinceLastRefresh > minRefreshInterval) {
+		keys, e := provider.fetchKeys()
+		provider.lastRefresh = provider.clock.Now()
+		if e != nil {
+			// Keeps using the previously fetched keys while the endpoint is unavailable
+			if !exist {
+				return nil, e
+			}
+			return key, nil
+		}
+		provider.keys = keys
+		key, exist = provider.keys[keyID]
+	}
+	if !exist {
+		return StaticKeys(provider.keys).Key(keyID)
+	}
+	return key, nil
+}
+
+func (provider *JWKSKeyProvider) fetchKeys() (map[string]crypto.PublicKey, error) {
+	response, e := provider.httpClient.Get(provider.url)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not fetch JWKS from %v", provider.url)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Could not fetch JWKS from %v. Status code: %v", provider.url, response.StatusCode)
+	}
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	e = json.NewDecoder(response.Body).Decode(&keySet)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not decode JWKS from %v", provider.url)
+	}
+	return parseJSONWebKeys(keySet.Keys)
+}
+
+type jsonWebKey struct {
+	KeyID   string `json:"kid"`
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// parseJSONWebKeys converts signature keys to public keys by key ID. Encryption keys and unsupported key types are skipped.
+func parseJSONWebKeys(jsonWebKeys []jsonWebKey) (map[string]crypto.PublicKey, error) {
+	result := make(map[string]crypto.PublicKey, len(jsonWebKeys))
+	for _, jsonWebKey := range jsonWebKeys {
+		if jsonWebKey.Use != "" && jsonWebKey.Use != "sig" {
+			continue
+		}
+		key, e := jsonWebKey.publicKey()
+		if e != nil {
+			return nil, errors.Wrapf(e, "Invalid key \"%v\"", jsonWebKey.KeyID)
+		}
+		if key != nil {
+			result[jsonWebKey.KeyID] = key
+		}
+	}
+	return result, nil
+}
+
+func (jsonWebKey jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jsonWebKey.KeyType {
+	case "RSA":
+		n, e := decodeBigInt(jsonWebKey.N)
+		if e != nil {
+			return nil, e
+		}
+		exponent, e := decodeBigInt(jsonWebKey.E)
+		if e != nil {
+			return nil, e
+		}
+		return &rsa.PublicKey{N: n, E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jsonWebKey.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v", jsonWebKey.Curve)
+		}
+		x, e := decodeBigInt(jsonWebKey.X)
+		if e != nil {
+			return nil, e
+		}
+		y, e := decodeBigInt(jsonWebKey.Y)
+		if e != nil {
+			return nil, e
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jsonWebKey.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %v", jsonWebKey.Curve)
+		}
+		x, e := base64.RawURLEncoding.DecodeString(jsonWebKey.X)
+		if e != nil {
+			return nil, e
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(encoded string) (*big.Int, error) {
+	decoded, e := base64.RawURLEncoding.DecodeString(encoded)
+	if e != nil {
+		return nil, e
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,114 @@
+package jwtauth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	. "github.com/cloudfoundry-incubator/bits-service/jwtauth"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWKSKeyProvider", func() {
+	var (
+		mockClock    *clock.Mock
+		rsaKey       *rsa.PrivateKey
+		ecdsaKey     *ecdsa.PrivateKey
+		keySet       string
+		requestCount int
+		server       *httptest.Server
+		statusCode   int
+		keyProvider  *JWKSKeyProvider
+	)
+
+	encoded := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		var e error
+		rsaKey, e = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(e).NotTo(HaveOccurred())
+		ecdsaKey, e = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+
+		keySet = fmt.Sprintf(`{"keys": [{"kid": "rsa-key", "kty": "RSA", "use": "sig", "alg": "RS256", "n": "%v", "e": "%v"}]}`,
+			encoded(rsaKey.N), encoded(big.NewInt(int64(rsaKey.E))))
+		requestCount = 0
+		statusCode = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			requestCount++
+			responseWriter.WriteHeader(statusCode)
+			fmt.Fprint(responseWriter, keySet)
+		}))
+		keyProvider = NewJWKSKeyProvider(server.URL, http.DefaultClient, 5*time.Minute, mockClock)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("fetches keys once and caches them", func() {
+		key, e := keyProvider.Key("rsa-key")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(key).To(Equal(rsaKey.Public()))
+
+		_, e = keyProvider.Key("rsa-key")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(requestCount).To(Equal(1))
+	})
+
+	It("re-fetches keys after the refresh interval", func() {
+		keyProvider.Key("rsa-key")
+		mockClock.Add(6 * time.Minute)
+		keyProvider.Key("rsa-key")
+
+		Expect(requestCount).To(Equal(2))
+	})
+
+	It("re-fetches keys for unknown key IDs, but not too often", func() {
+		keyProvider.Key("rsa-key")
+		keySet = fmt.Sprintf(`{"keys": [{"kid": "ec-key", "kty": "EC", "crv": "P-256", "x": "%v", "y": "%v"}]}`,
+			encoded(ecdsaKey.X), encoded(ecdsaKey.Y))
+
+		_, e := keyProvider.Key("ec-key")
+		Expect(e).To(HaveOccurred())
+		Expect(requestCount).To(Equal(1))
+
+		mockClock.Add(time.Minute)
+		key, e := keyProvider.Key("ec-key")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(key).To(Equal(ecdsaKey.Public()))
+		Expect(requestCount).To(Equal(2))
+	})
+
+	It("keeps using fetched keys while the JWKS endpoint fails", func() {
+		keyProvider.Key("rsa-key")
+		statusCode = http.StatusInternalServerError
+		mockClock.Add(6 * time.Minute)
+
+		key, e := keyProvider.Key("rsa-key")
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(key).To(Equal(rsaKey.Public()))
+		Expect(requestCount).To(Equal(2))
+	})
+
+	It("returns an error when the JWKS endpoint fails initially", func() {
+		statusCode = http.StatusInternalServerError
+
+		_, e := keyProvider.Key("rsa-key")
+
+		Expect(e).To(MatchError(ContainSubstring("500")))
+	})
+})
@@ -0,0 +1,98 @@
+package jwtauth
+
+import (
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	ReadScope  = "bits.read"
+	WriteScope = "bits.write"
+	AdminScope = "bits.admin"
+)
+
+// Token is what a validated token tells about its bearer.
+type Token struct {
+	Subject  string
+	ClientID string
+	Scopes   []string
+}
+
+func (token *Token) HasScope(scope string) bool {
+	for _, s := range token.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenValidator validates OAuth2 access tokens in JWT format, as issued by UAA.
+type TokenValidator struct {
+	Keys KeyProvider
+	// Must be contained in the "aud" claim of a token
+	Audience string
+	// Optional. When set, must match the "iss" claim of a token
+	Issuer string
+	Clock  clock.Clock
+}
+
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// scopesOf reads the "scope" claim, which is a list in UAA tokens, but a space separated string according to RFC 8693.
+func scopesOf(claim interface{}) ([]string, error) {
+	switch scope := claim.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.Fields(scope), nil
+	case []interface{}:
+		list := make([]string, 0, len(scope))
+		for _, s := range scope {
+			str, ok := s.(string)
+			if !ok {
+				return nil, errors.New("scope must be a list of strings")
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	}
+	return nil, errors.New("scope must be a list or a space separated string")
+}
+
+func (validator *TokenValidator) Validate(tokenString string) (*Token, error) {
+	claims := jwt.MapClaims{}
+	// Time based claims are verified below, to use validator.Clock
+	parser := jwt.Parser{ValidMethods: signingMethods, SkipClaimsValidation: true}
+	_, e := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		return validator.Keys.Key(keyID)
+	})
+	if e != nil {
+		return nil, e
+	}
+
+	now := validator.Clock.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, errors.New("token is expired or has no expiry")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if !claims.VerifyAudience(validator.Audience, true) {
+		return nil, errors.Errorf("token audience does not contain \"%v\"", validator.Audience)
+	}
+	if validator.Issuer != "" && !claims.VerifyIssuer(validator.Issuer, true) {
+		return nil, errors.Errorf("token issuer is not \"%v\"", validator.Issuer)
+	}
+	scopes, e := scopesOf(claims["scope"])
+	if e != nil {
+		return nil, e
+	}
+	subject, _ := claims["sub"].(string)
+	clientID, _ := claims["client_id"].(string)
+	return &Token{Subject: subject, ClientID: clientID, Scopes: scopes}, nil
+}
@@ -0,0 +1,148 @@
+package jwtauth_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	. "github.com/cloudfoundry-incubator/bits-service/jwtauth"
+	jwt "github.com/golang-jwt/jwt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TokenValidator", func() {
+	var (
+		mockClock  *clock.Mock
+		privateKey *rsa.PrivateKey
+		validator  *TokenValidator
+	)
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		mockClock.Set(time.Now())
+		var e error
+		privateKey, e = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(e).NotTo(HaveOccurred())
+
+		validator = &TokenValidator{
+			Keys:     StaticKeys{"key-1": privateKey.Public()},
+			Audience: "bits_service",
+			Issuer:   "https://uaa.example.com/oauth/token",
+			Clock:    mockClock,
+		}
+	})
+
+	signedToken := func(claims jwt.MapClaims, keyID string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = keyID
+		tokenString, e := token.SignedString(privateKey)
+		Expect(e).NotTo(HaveOccurred())
+		return tokenString
+	}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":       "some-client",
+			"client_id": "some-client",
+			"aud":       []string{"bits_service", "other"},
+			"iss":       "https://uaa.example.com/oauth/token",
+			"exp":       mockClock.Now().Add(time.Hour).Unix(),
+			"scope":     []string{"bits.read", "bits.write"},
+		}
+	}
+
+	It("returns subject and scopes of a valid token", func() {
+		token, e := validator.Validate(signedToken(validClaims(), "key-1"))
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(token).To(Equal(&Token{Subject: "some-client", ClientID: "some-client", Scopes: []string{"bits.read", "bits.write"}}))
+		Expect(token.HasScope("bits.write")).To(BeTrue())
+		Expect(token.HasScope("bits.admin")).To(BeFalse())
+	})
+
+	It("accepts scopes as space separated string", func() {
+		claims := validClaims()
+		claims["scope"] = "bits.read bits.admin"
+
+		token, e := validator.Validate(signedToken(claims, "key-1"))
+
+		Expect(e).NotTo(HaveOccurred())
+		Expect(token.Scopes).To(Equal([]string{"bits.read", "bits.admin"}))
+	})
+
+	It("rejects expired tokens", func() {
+		tokenString := signedToken(validClaims(), "key-1")
+		mockClock.Add(2 * time.Hour)
+
+		_, e := validator.Validate(tokenString)
+
+		Expect(e).To(MatchError(ContainSubstring("expired")))
+	})
+
+	It("rejects tokens without expiry", func() {
+		claims := validClaims()
+		delete(claims, "exp")
+
+		_, e := validator.Validate(signedToken(claims, "key-1"))
+
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("rejects tokens for other audiences", func() {
+		claims := validClaims()
+		claims["aud"] = "cloud_controller"
+
+		_, e := validator.Validate(signedToken(claims, "key-1"))
+
+		Expect(e).To(MatchError(ContainSubstring("audience")))
+	})
+
+	It("rejects tokens from other issuers", func() {
+		claims := validClaims()
+		claims["iss"] = "https://evil.example.com"
+
+		_, e := validator.Validate(signedToken(claims, "key-1"))
+
+		Expect(e).To(MatchError(ContainSubstring("issuer")))
+	})
+
+	It("rejects tokens signed with unknown keys", func() {
+		_, e := validator.Validate(signedToken(validClaims(), "key-2"))
+
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("rejects tokens signed with a different key", func() {
+		otherKey, e := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(e).NotTo(HaveOccurred())
+		validator.Keys = StaticKeys{"key-1": otherKey.Public()}
+
+		_, e = validator.Validate(signedToken(validClaims(), "key-1"))
+
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("rejects unsigned tokens", func() {
+		tokenString, e := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		Expect(e).NotTo(HaveOccurred())
+
+		_, e = validator.Validate(tokenString)
+
+		Expect(e).To(HaveOccurred())
+	})
+
+	It("rejects HMAC tokens using the public key as secret", func() {
+		validator.Keys = StaticKeys{"key-1": crypto.PublicKey([]byte("public-key-bytes"))}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+		token.Header["kid"] = "key-1"
+		tokenString, e := token.SignedString([]byte("public-key-bytes"))
+		Expect(e).NotTo(HaveOccurred())
+
+		_, e = validator.Validate(tokenString)
+
+		Expect(e).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,206 @@
+package bitsgo
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// MaintenanceRetryAfter is what clients are told when their writes are rejected in maintenance mode. Maintenance
+// usually takes longer, but clients should not back off for too long either.
+const MaintenanceRetryAfter = time.Minute
+
+// MaintenanceMode makes the bits-service read-only, e.g. during blobstore migrations or incidents. Downloads and
+// signing keep working. Single resource types can be made read-only on their own, e.g. while only their blobstore
+// is migrated.
+type MaintenanceMode struct {
+	clock clock.Clock
+
+	mutex   sync.RWMutex
+	enabled bool
+	reason  string
+	since   time.Time
+
+	readOnlyResourceTypes map[string]readOnlyResourceType
+}
+
+type readOnlyResourceType struct {
+	reason string
+	since  time.Time
+}
+
+type MaintenanceStatus struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	// Only lists the resource types which are read-only on their own
+	ResourceTypes map[string]MaintenanceStatus `json:"resource_types,omitempty"`
+}
+
+func NewMaintenanceMode(clock clock.Clock) *MaintenanceMode {
+	return &MaintenanceMode{clock: clock, readOnlyResourceTypes: make(map[string]readOnlyResourceType)}
+}
+
+func (mode *MaintenanceMode) Enable(reason string) {
+	mode.mutex.Lock()
+	defer mode.mutex.Unlock()
+
+	if !mode.enabled {
+		mode.since = mode.clock.Now()
+	}
+	mode.enabled = true
+	mode.reason = reason
+}
+
+func (mode *MaintenanceMode) Disable() {
+	mode.mutex.Lock()
+	defer mode.mutex.Unlock()
+
+	mode.enabled = false
+	mode.reason = ""
+}
+
+// EnableFor makes only resourceType read-only, independent of whether maintenance mode is enabled.
+func (mode *MaintenanceMode) EnableFor(resourceType string, reason string) {
+	mode.mutex.Lock()
+	defer mode.mutex.Unlock()
+
+	since := mode.clock.Now()
+	if readOnly, exists := mode.readOnlyResourceTypes[resourceType]; exists {
+		since = readOnly.since
+	}
+	mode.readOnlyResourceTypes[resourceType] = readOnlyResourceType{reason: reason, since: since}
+}
+
+func (mode *MaintenanceMode) DisableFor(resourceType string) {
+	mode.mutex.Lock()
+	defer mode.mutex.Unlock()
+
+	delete(mode.readOnlyResourceTypes, resourceType)
+}
+
+func (mode *MaintenanceMode) Status() MaintenanceStatus {
+	mode.mutex.RLock()
+	defer mode.mutex.RUnlock()
+
+	status := MaintenanceStatus{}
+	if mode.enabled {
+		since := mode.since
+		status = MaintenanceStatus{Enabled: true, Reason: mode.reason, Since: &since}
+	}
+	if len(mode.readOnlyResourceTypes) > 0 {
+		status.ResourceTypes = make(map[string]MaintenanceStatus)
+		for resourceType, readOnly := range mode.readOnlyResourceTypes {
+			since := readOnly.since
+			status.ResourceTypes[resourceType] = MaintenanceStatus{Enabled: true, Reason: readOnly.reason, Since: &since}
+		}
+	}
+	return status
+}
+
+// CheckWritable returns an *UnavailableError while maintenance mode is enabled.
+func (mode *MaintenanceMode) CheckWritable() *UnavailableError {
+	mode.mutex.RLock()
+	defer mode.mutex.RUnlock()
+
+	return mode.checkWritable()
+}
+
+// CheckWritableFor returns an *UnavailableError while maintenance mode is enabled or resourceType is read-only.
+func (mode *MaintenanceMode) CheckWritableFor(resourceType string) *UnavailableError {
+	mode.mutex.RLock()
+	defer mode.mutex.RUnlock()
+
+	if e := mode.checkWritable(); e != nil {
+		return e
+	}
+	readOnly, exists := mode.readOnlyResourceTypes[resourceType]
+	if !exists {
+		return nil
+	}
+	return NewUnavailableError(withReason(resourceType+" blobstore is read-only and does not accept changes", readOnly.reason), MaintenanceRetryAfter)
+}
+
+func (mode *MaintenanceMode) checkWritable() *UnavailableError {
+	if !mode.enabled {
+		return nil
+	}
+	return NewUnavailableError(withReason("bits-service is in maintenance mode and does not accept changes", mode.reason), MaintenanceRetryAfter)
+}
+
+func withReason(message string, reason string) string {
+	if reason != "" {
+		return message + ": " + reason
+	}
+	return message
+}
+
+// MaintenanceModeHandler lets operators toggle maintenance mode, or read-only mode of single resource types, without
+// changing the config file.
+type MaintenanceModeHandler struct {
+	mode *MaintenanceMode
+}
+
+func NewMaintenanceModeHandler(mode *MaintenanceMode) *MaintenanceModeHandler {
+	return &MaintenanceModeHandler{mode: mode}
+}
+
+func (handler *MaintenanceModeHandler) Get(responseWriter http.ResponseWriter, request *http.Request) {
+	writeJSON(responseWriter, handler.mode.Status())
+}
+
+// Enable accepts an optional JSON body like {"reason": "migrating droplets"}.
+func (handler *MaintenanceModeHandler) Enable(responseWriter http.ResponseWriter, request *http.Request) {
+	reason, ok := reasonFrom(responseWriter, request)
+	if !ok {
+		return
+	}
+	audit.From(request).Describe(audit.EnableMaintenanceMode, "")
+	handler.mode.Enable(reason)
+	logger.From(request).Infow("Enabled maintenance mode", "reason", reason)
+	writeJSON(responseWriter, handler.mode.Status())
+}
+
+func (handler *MaintenanceModeHandler) Disable(responseWriter http.ResponseWriter, request *http.Request) {
+	audit.From(request).Describe(audit.DisableMaintenanceMode, "")
+	handler.mode.Disable()
+	logger.From(request).Infow("Disabled maintenance mode")
+	writeJSON(responseWriter, handler.mode.Status())
+}
+
+// EnableFor accepts the same body as Enable.
+func (handler *MaintenanceModeHandler) EnableFor(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	reason, ok := reasonFrom(responseWriter, request)
+	if !ok {
+		return
+	}
+	audit.From(request).Describe(audit.EnableMaintenanceMode, "").WithResourceType(params["resource_type"])
+	handler.mode.EnableFor(params["resource_type"], reason)
+	logger.From(request).Infow("Made resource type read-only", "resource-type", params["resource_type"], "reason", reason)
+	writeJSON(responseWriter, handler.mode.Status())
+}
+
+func (handler *MaintenanceModeHandler) DisableFor(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	audit.From(request).Describe(audit.DisableMaintenanceMode, "").WithResourceType(params["resource_type"])
+	handler.mode.DisableFor(params["resource_type"])
+	logger.From(request).Infow("Made resource type writable", "resource-type", params["resource_type"])
+	writeJSON(responseWriter, handler.mode.Status())
+}
+
+func reasonFrom(responseWriter http.ResponseWriter, request *http.Request) (reason string, ok bool) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	e := json.NewDecoder(request.Body).Decode(&body)
+	if e != nil && e != io.EOF {
+		badRequest(responseWriter, request, "Invalid body: %v", e.Error())
+		return "", false
+	}
+	return body.Reason, true
+}
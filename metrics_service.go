@@ -6,4 +6,10 @@ type MetricsService interface {
 	SendTimingMetric(name string, duration time.Duration)
 	SendGaugeMetric(name string, value int64)
 	SendCounterMetric(name string, value int64)
+
+	// The *WithTags variants attach the given tags to the metric in addition to
+	// the globally configured ones, instead of encoding them into the metric name.
+	SendTimingMetricWithTags(name string, duration time.Duration, tags map[string]string)
+	SendGaugeMetricWithTags(name string, value int64, tags map[string]string)
+	SendCounterMetricWithTags(name string, value int64, tags map[string]string)
 }
@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// AuditMiddleware writes an audit event for every request which a handler described as auditable.
+// It must be placed after the ZapLoggerMiddleware to pick up the request ID and before the PanicMiddleware
+// to record failed requests with their final status code.
+type AuditMiddleware struct {
+	auditLogger *audit.Logger
+}
+
+func NewAuditMiddleware(auditLogger *audit.Logger) *AuditMiddleware {
+	return &AuditMiddleware{auditLogger: auditLogger}
+}
+
+func (middleware *AuditMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	event := &audit.Event{
+		Time:      time.Now(),
+		RequestID: util.RequestIDFrom(request.Context()),
+		// Authentication middlewares replace the actor once they verified the request.
+		Actor:        audit.Actor{Type: audit.AnonymousActor},
+		ResourceType: ResourceTypeFrom(strings.TrimPrefix(request.URL.Path, "/sign")),
+		ClientIP:     clientIPFrom(request),
+	}
+
+	negroniResponseWriter, ok := responseWriter.(negroni.ResponseWriter)
+	if !ok {
+		negroniResponseWriter = negroni.NewResponseWriter(responseWriter)
+	}
+
+	next(negroniResponseWriter, audit.WithEvent(request, event))
+
+	if event.Action == "" {
+		return
+	}
+	event.StatusCode = negroniResponseWriter.Status()
+	switch {
+	case event.StatusCode == http.StatusAccepted:
+		event.Outcome = audit.Accepted
+	case event.StatusCode < 400:
+		event.Outcome = audit.Success
+	default:
+		event.Outcome = audit.Failure
+	}
+	middleware.auditLogger.Log(event)
+}
+
+// clientIPFrom ignores X-Forwarded-For, since clients can send any value in it.
+func clientIPFrom(request *http.Request) string {
+	host, _, e := net.SplitHostPort(request.RemoteAddr)
+	if e != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
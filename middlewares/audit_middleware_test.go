@@ -0,0 +1,121 @@
+package middlewares_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+type recordingSink struct {
+	lines [][]byte
+}
+
+func (sink *recordingSink) Write(line []byte) error {
+	sink.lines = append(sink.lines, line)
+	return nil
+}
+
+var _ = Describe("AuditMiddleware", func() {
+	var (
+		sink           *recordingSink
+		responseWriter *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		sink = &recordingSink{}
+		responseWriter = httptest.NewRecorder()
+	})
+
+	It("writes a JSON line for requests described as auditable", func() {
+		request := httptest.NewRequest("PUT", "http://example.com/packages/some-guid", nil)
+		request.SetBasicAuth("the-user", "the-password")
+		request.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+
+		middlewares.NewAuditMiddleware(audit.NewLogger(sink)).ServeHTTP(
+			responseWriter,
+			util.RequestWithContextValues(request, "request-id", "some-request-id"),
+			func(rw http.ResponseWriter, r *http.Request) {
+				middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "the-user", Password: "the-password"}).ServeHTTP(rw, r,
+					func(rw http.ResponseWriter, r *http.Request) {
+						audit.From(r).Describe(audit.Upload, "some-guid").WithChecksums("the-sha1", "the-sha256")
+						rw.WriteHeader(http.StatusCreated)
+					})
+			})
+
+		Expect(sink.lines).To(HaveLen(1))
+		Expect(sink.lines[0]).To(HaveSuffix("\n"))
+		var event map[string]interface{}
+		Expect(json.Unmarshal(sink.lines[0], &event)).To(Succeed())
+		delete(event, "time")
+		Expect(event).To(Equal(map[string]interface{}{
+			"request_id":    "some-request-id",
+			"action":        "upload",
+			"actor":         map[string]interface{}{"type": "basic_auth", "id": "the-user"},
+			"resource_type": "packages",
+			"guid":          "some-guid",
+			"sha1":          "the-sha1",
+			"sha256":        "the-sha256",
+			"outcome":       "success",
+			"status_code":   float64(http.StatusCreated),
+			"client_ip":     "192.0.2.1",
+		}))
+	})
+
+	It("records actors whose credentials were not verified as anonymous and failures as outcome", func() {
+		request := httptest.NewRequest("DELETE", "http://example.com/droplets/some-guid?signature=abc&expires=123&AccessKeyId=key-1", nil)
+		request.SetBasicAuth("the-user", "wrong-password")
+		middlewares.NewAuditMiddleware(audit.NewLogger(sink)).ServeHTTP(
+			responseWriter,
+			request,
+			func(rw http.ResponseWriter, r *http.Request) {
+				audit.From(r).Describe(audit.Delete, "some-guid")
+				middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "the-user", Password: "the-password"}).ServeHTTP(rw, r,
+					func(rw http.ResponseWriter, r *http.Request) { rw.WriteHeader(http.StatusNoContent) })
+			})
+
+		Expect(sink.lines).To(HaveLen(1))
+		var event audit.Event
+		Expect(json.Unmarshal(sink.lines[0], &event)).To(Succeed())
+		Expect(event.Actor).To(Equal(audit.Actor{Type: audit.AnonymousActor}))
+		Expect(event.ResourceType).To(Equal("droplets"))
+		Expect(event.Outcome).To(Equal(audit.Failure))
+		Expect(event.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(event.ClientIP).To(Equal("192.0.2.1"))
+	})
+
+	It("records the signing key of verified signed URLs as actor", func() {
+		signer := pathsigner.Validate(&pathsigner.PathSignerValidator{Secret: "secret", Clock: clock.New(), SigningKeys: map[string]string{"key-1": "key-secret"}, ActiveKeyID: "key-1"})
+		middlewares.NewAuditMiddleware(audit.NewLogger(sink)).ServeHTTP(
+			responseWriter,
+			httptest.NewRequest("DELETE", "http://example.com"+signer.Sign("/droplets/some-guid", time.Now().Add(time.Hour)), nil),
+			func(rw http.ResponseWriter, r *http.Request) {
+				audit.From(r).Describe(audit.Delete, "some-guid")
+				(&middlewares.SignatureVerificationMiddleware{SignatureValidator: signer}).ServeHTTP(rw, r,
+					func(rw http.ResponseWriter, r *http.Request) { rw.WriteHeader(http.StatusNoContent) })
+			})
+
+		Expect(sink.lines).To(HaveLen(1))
+		var event audit.Event
+		Expect(json.Unmarshal(sink.lines[0], &event)).To(Succeed())
+		Expect(event.Actor).To(Equal(audit.Actor{Type: audit.SignedURLActor, ID: "key-1"}))
+		Expect(event.Outcome).To(Equal(audit.Success))
+	})
+
+	It("does not write anything for requests which are not auditable", func() {
+		middlewares.NewAuditMiddleware(audit.NewLogger(sink)).ServeHTTP(
+			responseWriter,
+			httptest.NewRequest("GET", "http://example.com/packages/some-guid", nil),
+			func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			})
+
+		Expect(sink.lines).To(BeEmpty())
+	})
+})
@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// Upper bound for the number of tracked pairs of username and client IP, so that attackers cannot exhaust memory.
+const maxTrackedAuthFailures = 100000
+
+type authFailures struct {
+	count       int
+	windowStart time.Time
+}
+
+// authFailureLimiter blocks a username from a client IP after maxFailures failed attempts within window. Keying on the pair,
+// rather than on either of them, keeps attackers from locking out legitimate users of the same username or IP.
+type authFailureLimiter struct {
+	maxFailures int
+	window      time.Duration
+	clock       clock.Clock
+
+	mutex    sync.Mutex
+	failures map[string]*authFailures
+}
+
+func newAuthFailureLimiter(maxFailures int, window time.Duration, clock clock.Clock) *authFailureLimiter {
+	return &authFailureLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		clock:       clock,
+		failures:    make(map[string]*authFailures),
+	}
+}
+
+// blockedFor returns how long attempts for username from clientIP are still blocked, or 0 if they are not.
+func (limiter *authFailureLimiter) blockedFor(username string, clientIP string) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	failures, exist := limiter.failures[limiter.key(username, clientIP)]
+	if !exist || failures.count < limiter.maxFailures {
+		return 0
+	}
+	if remaining := failures.windowStart.Add(limiter.window).Sub(limiter.clock.Now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (limiter *authFailureLimiter) recordFailure(username string, clientIP string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.clock.Now()
+	if len(limiter.failures) >= maxTrackedAuthFailures {
+		limiter.removeExpired(now)
+	}
+	key := limiter.key(username, clientIP)
+	failures, exist := limiter.failures[key]
+	if !exist || now.Sub(failures.windowStart) >= limiter.window {
+		if !exist && len(limiter.failures) >= maxTrackedAuthFailures {
+			return
+		}
+		failures = &authFailures{windowStart: now}
+		limiter.failures[key] = failures
+	}
+	failures.count++
+}
+
+func (limiter *authFailureLimiter) reset(username string, clientIP string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	delete(limiter.failures, limiter.key(username, clientIP))
+}
+
+func (limiter *authFailureLimiter) removeExpired(now time.Time) {
+	for key, failures := range limiter.failures {
+		if now.Sub(failures.windowStart) >= limiter.window {
+			delete(limiter.failures, key)
+		}
+	}
+}
+
+func (limiter *authFailureLimiter) key(username string, clientIP string) string {
+	// the IP cannot contain a space, so the key is unambiguous for any username
+	return clientIP + " " + username
+}
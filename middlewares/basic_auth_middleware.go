@@ -2,17 +2,32 @@ package middlewares
 
 import (
 	"crypto/subtle"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 )
 
 type Credential struct {
 	Username, Password string
+	// bcrypt or argon2id hash of the password. Takes precedence over Password.
+	PasswordHash string
 }
 
 type BasicAuthMiddleware struct {
 	credentials                   []Credential
 	basicAuthHeaderMissingHandler http.Handler
 	unauthorizedHandler           http.Handler
+	failureLimiter                *authFailureLimiter
+
+	// guards the credentials, which can be replaced at runtime via SetCredentials
+	mutex sync.RWMutex
 }
 
 func NewBasicAuthMiddleWare(credentials ...Credential) *BasicAuthMiddleware {
@@ -29,6 +44,21 @@ func (middleware *BasicAuthMiddleware) WithUnauthorizedHandler(handler http.Hand
 	return middleware
 }
 
+// WithFailureLimit rejects attempts for a username from a client IP with 429 Too Many Requests once
+// there have been maxFailures failed attempts for that pair within window. The client IP is the peer address
+// of the connection, X-Forwarded-For is not trusted.
+func (middleware *BasicAuthMiddleware) WithFailureLimit(maxFailures int, window time.Duration, clock clock.Clock) *BasicAuthMiddleware {
+	middleware.failureLimiter = newAuthFailureLimiter(maxFailures, window, clock)
+	return middleware
+}
+
+// SetCredentials replaces the credentials at runtime.
+func (middleware *BasicAuthMiddleware) SetCredentials(credentials ...Credential) {
+	middleware.mutex.Lock()
+	defer middleware.mutex.Unlock()
+	middleware.credentials = credentials
+}
+
 func (middleware *BasicAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
 	username, password, ok := request.BasicAuth()
 	if !ok {
@@ -40,22 +70,51 @@ func (middleware *BasicAuthMiddleware) ServeHTTP(responseWriter http.ResponseWri
 		return
 	}
 
+	clientIP := clientIPFrom(request)
+	if middleware.failureLimiter != nil {
+		if blockedFor := middleware.failureLimiter.blockedFor(username, clientIP); blockedFor > 0 {
+			logger.From(request).Infow("Basic auth blocked after too many failed attempts", "username", username, "client-ip", clientIP)
+			responseWriter.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blockedFor.Seconds()))))
+			responseWriter.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}
+
 	if !middleware.authorized(username, password) {
+		logger.From(request).Infow("Basic auth failed", "username", username, "client-ip", clientIP)
+		if middleware.failureLimiter != nil {
+			middleware.failureLimiter.recordFailure(username, clientIP)
+		}
 		if middleware.unauthorizedHandler == nil {
 			responseWriter.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 		middleware.unauthorizedHandler.ServeHTTP(responseWriter, request)
+		return
+	}
+
+	if middleware.failureLimiter != nil {
+		middleware.failureLimiter.reset(username, clientIP)
 	}
+	audit.From(request).Actor = audit.Actor{Type: audit.BasicAuthActor, ID: username}
 	next(responseWriter, request)
 }
 
 func (middleware *BasicAuthMiddleware) authorized(username, password string) bool {
+	middleware.mutex.RLock()
+	defer middleware.mutex.RUnlock()
+
 	for _, credential := range middleware.credentials {
-		if subtle.ConstantTimeCompare([]byte(username), []byte(credential.Username)) == 1 &&
-			subtle.ConstantTimeCompare([]byte(password), []byte(credential.Password)) == 1 {
+		if subtle.ConstantTimeCompare([]byte(username), []byte(credential.Username)) == 1 && passwordMatches(credential, password) {
 			return true
 		}
 	}
 	return false
 }
+
+func passwordMatches(credential Credential, password string) bool {
+	if credential.PasswordHash != "" {
+		return util.VerifyPassword(credential.PasswordHash, password)
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(credential.Password)) == 1
+}
@@ -1,16 +1,22 @@
 package middlewares_test
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service/middlewares"
 	. "github.com/cloudfoundry-incubator/bits-service/testutil"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	. "github.com/petergtz/pegomock"
 	"github.com/urfave/negroni"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var _ = Describe("BasicAuthMiddle", func() {
@@ -96,6 +102,126 @@ var _ = Describe("BasicAuthMiddle", func() {
 
 			mockHandler.VerifyWasCalledOnce().ServeHTTP(anyResponseWriter(), anyRequestPtr())
 		})
+
+		It("does not continue with the next handler", func() {
+			middleware.WithUnauthorizedHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusForbidden)
+			}))
+
+			request := newGetRequest(server.URL)
+			request.SetBasicAuth("the-username", "wrong-password")
+
+			response, e := http.DefaultClient.Do(request)
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(*response).To(HaveStatusCodeAndBody(
+				Equal(http.StatusForbidden),
+				BeEmpty()))
+		})
+	})
+
+	It("uses credentials replaced at runtime", func() {
+		middleware.SetCredentials(middlewares.Credential{Username: "new-username", Password: "new-password"})
+
+		request := newGetRequest(server.URL)
+		request.SetBasicAuth("the-username", "the-password")
+		response, e := http.DefaultClient.Do(request)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		request = newGetRequest(server.URL)
+		request.SetBasicAuth("new-username", "new-password")
+		response, e = http.DefaultClient.Do(request)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	Context("password hashes", func() {
+		BeforeEach(func() {
+			bcryptHash, e := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+			Expect(e).NotTo(HaveOccurred())
+			salt := []byte("0123456789abcdef")
+			argon2Hash := fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=1$%v$%v",
+				base64.RawStdEncoding.EncodeToString(salt),
+				base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("argon2-password"), salt, 1, 1024, 1, 32)))
+
+			middleware = middlewares.NewBasicAuthMiddleWare(
+				middlewares.Credential{Username: "bcrypt-user", PasswordHash: string(bcryptHash)},
+				middlewares.Credential{Username: "argon2-user", PasswordHash: argon2Hash},
+			)
+		})
+
+		It("accepts passwords matching bcrypt and argon2id hashes", func() {
+			for username, password := range map[string]string{"bcrypt-user": "bcrypt-password", "argon2-user": "argon2-password"} {
+				request := newGetRequest(server.URL)
+				request.SetBasicAuth(username, password)
+
+				response, e := http.DefaultClient.Do(request)
+				Expect(e).NotTo(HaveOccurred())
+
+				Expect(response.StatusCode).To(Equal(http.StatusOK), username)
+			}
+		})
+
+		It("rejects passwords not matching the hash", func() {
+			for _, username := range []string{"bcrypt-user", "argon2-user"} {
+				request := newGetRequest(server.URL)
+				request.SetBasicAuth(username, "wrong-password")
+
+				response, e := http.DefaultClient.Do(request)
+				Expect(e).NotTo(HaveOccurred())
+
+				Expect(response.StatusCode).To(Equal(http.StatusUnauthorized), username)
+			}
+		})
+	})
+
+	Context("failure limit is set", func() {
+		var mockClock *clock.Mock
+
+		BeforeEach(func() {
+			mockClock = clock.NewMock()
+			middleware.WithFailureLimit(2, time.Minute, mockClock)
+		})
+
+		statusCodeFor := func(username, password string) int {
+			request := newGetRequest(server.URL)
+			request.SetBasicAuth(username, password)
+			response, e := http.DefaultClient.Do(request)
+			Expect(e).NotTo(HaveOccurred())
+			return response.StatusCode
+		}
+
+		It("rejects attempts after too many failures until the window has passed", func() {
+			Expect(statusCodeFor("the-username", "wrong-password")).To(Equal(http.StatusUnauthorized))
+			Expect(statusCodeFor("the-username", "wrong-password")).To(Equal(http.StatusUnauthorized))
+
+			Expect(statusCodeFor("the-username", "the-password")).To(Equal(http.StatusTooManyRequests))
+			// other usernames from the same client IP are not blocked
+			Expect(statusCodeFor("another-username", "another-password")).To(Equal(http.StatusOK))
+
+			mockClock.Add(time.Minute)
+			Expect(statusCodeFor("the-username", "the-password")).To(Equal(http.StatusOK))
+		})
+
+		It("does not let clients escape the limit with X-Forwarded-For", func() {
+			for i := 0; i < 3; i++ {
+				request := newGetRequest(server.URL)
+				request.SetBasicAuth("the-username", "wrong-password")
+				request.Header.Set("X-Forwarded-For", fmt.Sprintf("192.0.2.%v", i))
+				_, e := http.DefaultClient.Do(request)
+				Expect(e).NotTo(HaveOccurred())
+			}
+
+			Expect(statusCodeFor("the-username", "the-password")).To(Equal(http.StatusTooManyRequests))
+		})
+
+		It("resets the failures after a successful attempt", func() {
+			Expect(statusCodeFor("the-username", "wrong-password")).To(Equal(http.StatusUnauthorized))
+			Expect(statusCodeFor("the-username", "the-password")).To(Equal(http.StatusOK))
+			Expect(statusCodeFor("the-username", "wrong-password")).To(Equal(http.StatusUnauthorized))
+			Expect(statusCodeFor("the-username", "the-password")).To(Equal(http.StatusOK))
+		})
 	})
 
 	It("returns status unauthorized when basic auth is not set", func() {
@@ -0,0 +1,126 @@
+package middlewares
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/urfave/negroni"
+)
+
+// ClientCertRule grants permissions to client certificates with the given subject or SAN.
+type ClientCertRule struct {
+	// Distinguished name as formatted by pkix.Name.String(), e.g. "CN=cloud_controller,O=Cloud Foundry"
+	Subject string
+	// DNS name, email address, IP address or URI
+	SAN         string
+	Permissions []string
+}
+
+// ClientCertAuthMiddleware authorizes requests by the client certificate verified during the TLS handshake.
+type ClientCertAuthMiddleware struct {
+	rules              []ClientCertRule
+	required           bool
+	requiredPermission string
+	fallback           negroni.Handler
+}
+
+// NewClientCertAuthMiddleware creates a middleware which rejects requests without verified client certificate
+// if required is true. Otherwise, such requests are handed to the fallback, or, without fallback, rejected as well.
+func NewClientCertAuthMiddleware(required bool, rules ...ClientCertRule) *ClientCertAuthMiddleware {
+	return &ClientCertAuthMiddleware{rules: rules, required: required}
+}
+
+// RequiringPermission returns a copy of middleware, so that one middleware can serve as template for several route groups.
+func (middleware *ClientCertAuthMiddleware) RequiringPermission(permission string) *ClientCertAuthMiddleware {
+	result := *middleware
+	result.requiredPermission = permission
+	return &result
+}
+
+// WithFallback returns a copy of middleware which hands requests without client certificate, or with a certificate
+// no rule applies to, to fallback. Only used when client certificates are optional.
+func (middleware *ClientCertAuthMiddleware) WithFallback(fallback negroni.Handler) *ClientCertAuthMiddleware {
+	result := *middleware
+	result.fallback = fallback
+	return &result
+}
+
+func (middleware *ClientCertAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	var (
+		clientCert  *x509.Certificate
+		permissions []string
+		matched     bool
+	)
+	// Only verified chains count. PeerCertificates alone could have been presented by anyone.
+	if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 && len(request.TLS.VerifiedChains[0]) > 0 {
+		clientCert = request.TLS.VerifiedChains[0][0]
+		permissions, matched = middleware.permissionsFor(clientCert)
+	}
+
+	if !matched {
+		if middleware.required || middleware.fallback == nil {
+			if clientCert == nil {
+				logger.From(request).Infow("Client certificate required")
+			} else {
+				logger.From(request).Infow("No permissions for client certificate", "subject", clientCert.Subject.String())
+			}
+			responseWriter.WriteHeader(http.StatusForbidden)
+			return
+		}
+		middleware.fallback.ServeHTTP(responseWriter, request, next)
+		return
+	}
+
+	audit.From(request).Actor = audit.Actor{Type: audit.ClientCertActor, ID: clientCert.Subject.String()}
+	if middleware.requiredPermission != "" && !contains(permissions, middleware.requiredPermission) {
+		logger.From(request).Infow("Client certificate lacks required permission", "subject", clientCert.Subject.String(), "required-permission", middleware.requiredPermission)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		return
+	}
+	next(responseWriter, request)
+}
+
+func (middleware *ClientCertAuthMiddleware) permissionsFor(clientCert *x509.Certificate) (permissions []string, matched bool) {
+	for _, rule := range middleware.rules {
+		if (rule.Subject != "" && rule.Subject == clientCert.Subject.String()) || (rule.SAN != "" && hasSAN(clientCert, rule.SAN)) {
+			permissions = append(permissions, rule.Permissions...)
+			matched = true
+		}
+	}
+	return
+}
+
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, dnsName := range cert.DNSNames {
+		if dnsName == san {
+			return true
+		}
+	}
+	for _, emailAddress := range cert.EmailAddresses {
+		if emailAddress == san {
+			return true
+		}
+	}
+	for _, ipAddress := range cert.IPAddresses {
+		if ipAddress.String() == san {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package middlewares_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+)
+
+var _ = Describe("ClientCertAuthMiddleware", func() {
+	var (
+		rules          []middlewares.ClientCertRule
+		responseWriter *httptest.ResponseRecorder
+		nextCalled     bool
+	)
+
+	next := func(http.ResponseWriter, *http.Request) { nextCalled = true }
+
+	BeforeEach(func() {
+		rules = []middlewares.ClientCertRule{
+			{Subject: "CN=cloud_controller,O=Cloud Foundry", Permissions: []string{"bits.read", "bits.write"}},
+			{SAN: "reader.service.cf.internal", Permissions: []string{"bits.read"}},
+		}
+		responseWriter = httptest.NewRecorder()
+		nextCalled = false
+	})
+
+	requestWithClientCert := func(cert *x509.Certificate) *http.Request {
+		request := httptest.NewRequest("PUT", "https://internal.example.com/packages/some-guid", nil)
+		if cert != nil {
+			request.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		}
+		return request
+	}
+
+	cloudControllerCert := &x509.Certificate{Subject: pkix.Name{CommonName: "cloud_controller", Organization: []string{"Cloud Foundry"}}}
+	readerCert := &x509.Certificate{Subject: pkix.Name{CommonName: "reader"}, DNSNames: []string{"reader.service.cf.internal"}}
+	unknownCert := &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}
+
+	It("lets requests pass whose client certificate subject has the required permission", func() {
+		event := &audit.Event{}
+
+		middlewares.NewClientCertAuthMiddleware(true, rules...).RequiringPermission("bits.write").
+			ServeHTTP(responseWriter, audit.WithEvent(requestWithClientCert(cloudControllerCert), event), next)
+
+		Expect(nextCalled).To(BeTrue())
+		Expect(event.Actor).To(Equal(audit.Actor{Type: audit.ClientCertActor, ID: "CN=cloud_controller,O=Cloud Foundry"}))
+	})
+
+	It("matches SANs", func() {
+		middlewares.NewClientCertAuthMiddleware(true, rules...).RequiringPermission("bits.read").
+			ServeHTTP(responseWriter, requestWithClientCert(readerCert), next)
+
+		Expect(nextCalled).To(BeTrue())
+	})
+
+	It("rejects client certificates lacking the required permission", func() {
+		middlewares.NewClientCertAuthMiddleware(false, rules...).RequiringPermission("bits.write").
+			ServeHTTP(responseWriter, requestWithClientCert(readerCert), next)
+
+		Expect(nextCalled).To(BeFalse())
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("ignores unverified client certificates", func() {
+		request := requestWithClientCert(nil)
+		request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cloudControllerCert}}
+
+		middlewares.NewClientCertAuthMiddleware(true, rules...).RequiringPermission("bits.read").ServeHTTP(responseWriter, request, next)
+
+		Expect(nextCalled).To(BeFalse())
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+	})
+
+	Context("required mode", func() {
+		It("rejects requests without client certificate", func() {
+			middlewares.NewClientCertAuthMiddleware(true, rules...).RequiringPermission("bits.read").
+				ServeHTTP(responseWriter, requestWithClientCert(nil), next)
+
+			Expect(nextCalled).To(BeFalse())
+			Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("rejects client certificates no rule applies to", func() {
+			middlewares.NewClientCertAuthMiddleware(true, rules...).RequiringPermission("bits.read").
+				ServeHTTP(responseWriter, requestWithClientCert(unknownCert), next)
+
+			Expect(nextCalled).To(BeFalse())
+			Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Context("optional mode", func() {
+		It("hands requests without client certificate to the fallback", func() {
+			request := requestWithClientCert(nil)
+			request.SetBasicAuth("user", "wrong")
+
+			middlewares.NewClientCertAuthMiddleware(false, rules...).RequiringPermission("bits.read").
+				WithFallback(middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "user", Password: "pass"})).
+				ServeHTTP(responseWriter, request, next)
+
+			Expect(nextCalled).To(BeFalse())
+			Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects requests without matching client certificate when there is no fallback", func() {
+			middlewares.NewClientCertAuthMiddleware(false, rules...).RequiringPermission("bits.read").
+				ServeHTTP(responseWriter, requestWithClientCert(unknownCert), next)
+
+			Expect(nextCalled).To(BeFalse())
+			Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("rejects requests without client certificate when there is no fallback", func() {
+			middlewares.NewClientCertAuthMiddleware(false, rules...).RequiringPermission("bits.read").
+				ServeHTTP(responseWriter, requestWithClientCert(nil), next)
+
+			Expect(nextCalled).To(BeFalse())
+			Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/jwtauth"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/urfave/negroni"
+)
+
+type TokenValidator interface {
+	Validate(token string) (*jwtauth.Token, error)
+}
+
+// JWTAuthMiddleware only lets requests pass which carry a valid bearer token granting the required scope.
+type JWTAuthMiddleware struct {
+	validator     TokenValidator
+	requiredScope string
+	fallback      negroni.Handler
+}
+
+func NewJWTAuthMiddleware(validator TokenValidator) *JWTAuthMiddleware {
+	return &JWTAuthMiddleware{validator: validator}
+}
+
+// RequiringScope returns a copy of middleware, so that one middleware can serve as template for several route groups.
+func (middleware *JWTAuthMiddleware) RequiringScope(scope string) *JWTAuthMiddleware {
+	result := *middleware
+	result.requiredScope = scope
+	return &result
+}
+
+// WithFallback returns a copy of middleware which hands requests without bearer token to fallback instead of rejecting them.
+func (middleware *JWTAuthMiddleware) WithFallback(fallback negroni.Handler) *JWTAuthMiddleware {
+	result := *middleware
+	result.fallback = fallback
+	return &result
+}
+
+func (middleware *JWTAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	tokenString, ok := bearerTokenFrom(request)
+	if !ok {
+		if middleware.fallback != nil {
+			middleware.fallback.ServeHTTP(responseWriter, request, next)
+			return
+		}
+		responseWriter.Header().Set("WWW-Authenticate", "Bearer")
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	token, e := middleware.validator.Validate(tokenString)
+	if e != nil {
+		logger.From(request).Infow("Invalid bearer token", "error", e)
+		responseWriter.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	audit.From(request).Actor = audit.Actor{Type: audit.BearerTokenActor, ID: token.Subject}
+
+	if middleware.requiredScope != "" && !token.HasScope(middleware.requiredScope) {
+		logger.From(request).Infow("Bearer token lacks required scope", "subject", token.Subject, "client-id", token.ClientID, "required-scope", middleware.requiredScope)
+		responseWriter.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+middleware.requiredScope+`"`)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		return
+	}
+	next(responseWriter, request)
+}
+
+func bearerTokenFrom(request *http.Request) (string, bool) {
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) < len("Bearer ") || !strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len("Bearer "):]), true
+}
@@ -0,0 +1,101 @@
+package middlewares_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/jwtauth"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+)
+
+type fakeTokenValidator map[string]*jwtauth.Token
+
+func (validator fakeTokenValidator) Validate(token string) (*jwtauth.Token, error) {
+	if result, exist := validator[token]; exist {
+		return result, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+var _ = Describe("JWTAuthMiddleware", func() {
+	var (
+		middleware     *middlewares.JWTAuthMiddleware
+		responseWriter *httptest.ResponseRecorder
+		nextCalled     bool
+	)
+
+	next := func(http.ResponseWriter, *http.Request) { nextCalled = true }
+
+	BeforeEach(func() {
+		middleware = middlewares.NewJWTAuthMiddleware(fakeTokenValidator{
+			"reader-token": {Subject: "reader", Scopes: []string{"bits.read"}},
+			"writer-token": {Subject: "writer", Scopes: []string{"bits.read", "bits.write"}},
+		}).RequiringScope("bits.write")
+		responseWriter = httptest.NewRecorder()
+		nextCalled = false
+	})
+
+	requestWithAuthorization := func(authorization string) *http.Request {
+		request := httptest.NewRequest("PUT", "http://example.com/packages/some-guid", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		return request
+	}
+
+	It("lets requests with a token granting the required scope pass", func() {
+		event := &audit.Event{}
+
+		middleware.ServeHTTP(responseWriter, audit.WithEvent(requestWithAuthorization("bearer writer-token"), event), next)
+
+		Expect(nextCalled).To(BeTrue())
+		Expect(event.Actor).To(Equal(audit.Actor{Type: audit.BearerTokenActor, ID: "writer"}))
+	})
+
+	It("rejects requests with a token lacking the required scope", func() {
+		middleware.ServeHTTP(responseWriter, requestWithAuthorization("Bearer reader-token"), next)
+
+		Expect(nextCalled).To(BeFalse())
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		Expect(responseWriter.Header().Get("WWW-Authenticate")).To(Equal(`Bearer error="insufficient_scope", scope="bits.write"`))
+	})
+
+	It("rejects requests with an invalid token", func() {
+		middleware.ServeHTTP(responseWriter, requestWithAuthorization("Bearer forged-token"), next)
+
+		Expect(nextCalled).To(BeFalse())
+		Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+		Expect(responseWriter.Header().Get("WWW-Authenticate")).To(Equal(`Bearer error="invalid_token"`))
+	})
+
+	It("rejects requests without token", func() {
+		middleware.ServeHTTP(responseWriter, requestWithAuthorization(""), next)
+
+		Expect(nextCalled).To(BeFalse())
+		Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	Context("with fallback", func() {
+		BeforeEach(func() {
+			middleware = middleware.WithFallback(middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "user", Password: "pass"}))
+		})
+
+		It("hands requests without bearer token to the fallback", func() {
+			request := requestWithAuthorization("")
+			request.SetBasicAuth("user", "pass")
+
+			middleware.ServeHTTP(responseWriter, request, next)
+
+			Expect(nextCalled).To(BeTrue())
+		})
+
+		It("does not fall back when a bearer token is invalid", func() {
+			middleware.ServeHTTP(responseWriter, requestWithAuthorization("Bearer forged-token"), next)
+
+			Expect(nextCalled).To(BeFalse())
+			Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
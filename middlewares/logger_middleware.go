@@ -3,7 +3,6 @@ package middlewares
 import (
 	"net/http"
 
-	"math/rand"
 	"time"
 
 	"github.com/cloudfoundry-incubator/bits-service/util"
@@ -16,17 +15,19 @@ type ZapLoggerMiddleware struct {
 }
 
 func NewZapLoggerMiddleware(logger *zap.SugaredLogger) *ZapLoggerMiddleware {
-	rand.Seed(time.Now().Unix())
 	return &ZapLoggerMiddleware{logger: logger}
 }
 
 func (middleware *ZapLoggerMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
 	startTime := time.Now()
 
-	requestId := rand.Int63()
-	requestLogger := middleware.logger.With(
-		"request-id", requestId,
-		"vcap-request-id", request.Header.Get("X-Vcap-Request-Id"))
+	// Adopting the router's request ID allows following a request through all CF components. Malformed IDs are
+	// replaced, since the ID ends up in logs and in requests to the blobstores and CC.
+	requestId := request.Header.Get(util.RequestIDHeader)
+	if !util.ValidRequestID(requestId) {
+		requestId = util.NewRequestID()
+	}
+	requestLogger := middleware.logger.With("request-id", requestId)
 
 	requestLogger.Infow(
 		"HTTP Request started",
@@ -40,10 +41,10 @@ func (middleware *ZapLoggerMiddleware) ServeHTTP(responseWriter http.ResponseWri
 	if !ok {
 		negroniResponseWriter = negroni.NewResponseWriter(responseWriter)
 	}
+	negroniResponseWriter.Header().Set(util.RequestIDHeader, requestId)
 
 	next(negroniResponseWriter, util.RequestWithContextValues(request,
 		"logger", requestLogger,
-		"vcap-request-id", request.Header.Get("X-Vcap-Request-Id"),
 		"request-id", requestId,
 	))
 
@@ -0,0 +1,83 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("ZapLoggerMiddleware", func() {
+	var (
+		responseWriter   *httptest.ResponseRecorder
+		request          *http.Request
+		handlerRequestID string
+	)
+
+	BeforeEach(func() {
+		responseWriter = httptest.NewRecorder()
+		request = httptest.NewRequest("GET", "http://example.com/some/request", nil)
+	})
+
+	JustBeforeEach(func() {
+		middlewares.NewZapLoggerMiddleware(zap.NewNop().Sugar()).ServeHTTP(
+			responseWriter,
+			request,
+			func(rw http.ResponseWriter, r *http.Request) {
+				handlerRequestID = util.RequestIDFrom(r.Context())
+				rw.WriteHeader(http.StatusOK)
+			})
+	})
+
+	Context("X-Vcap-Request-Id header is set", func() {
+		BeforeEach(func() {
+			request.Header.Set("X-Vcap-Request-Id", "some-vcap-request-id")
+		})
+
+		It("uses it as request ID and returns it in the response", func() {
+			Expect(handlerRequestID).To(Equal("some-vcap-request-id"))
+			Expect(responseWriter.Header().Get("X-Vcap-Request-Id")).To(Equal("some-vcap-request-id"))
+		})
+	})
+
+	Context("X-Vcap-Request-Id header is composed by the router", func() {
+		BeforeEach(func() {
+			request.Header.Set("X-Vcap-Request-Id", "9ec0a9cc-b2bb-4bd8-7b8c-4d2b1e7a2e3c::ab8d4b10-5d3d-4b4a-9a54-8d1f6c1f2d5e")
+		})
+
+		It("uses it as request ID", func() {
+			Expect(handlerRequestID).To(Equal("9ec0a9cc-b2bb-4bd8-7b8c-4d2b1e7a2e3c::ab8d4b10-5d3d-4b4a-9a54-8d1f6c1f2d5e"))
+		})
+	})
+
+	Context("X-Vcap-Request-Id header is malformed", func() {
+		BeforeEach(func() {
+			request.Header.Set("X-Vcap-Request-Id", "some-id\"; injected=\"value")
+		})
+
+		It("generates a new request ID", func() {
+			Expect(handlerRequestID).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+			Expect(responseWriter.Header().Get("X-Vcap-Request-Id")).To(Equal(handlerRequestID))
+		})
+	})
+
+	Context("X-Vcap-Request-Id header is too long", func() {
+		BeforeEach(func() {
+			request.Header.Set("X-Vcap-Request-Id", strings.Repeat("a", 129))
+		})
+
+		It("generates a new request ID", func() {
+			Expect(handlerRequestID).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		})
+	})
+
+	Context("X-Vcap-Request-Id header is not set", func() {
+		It("generates a UUID as request ID and returns it in the response", func() {
+			Expect(handlerRequestID).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+			Expect(responseWriter.Header().Get("X-Vcap-Request-Id")).To(Equal(handlerRequestID))
+		})
+	})
+})
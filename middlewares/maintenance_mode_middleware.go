@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+)
+
+// MaintenanceModeMiddleware rejects requests which would change blobs while maintenance mode is enabled or their
+// resource type is read-only, before their bodies are read. Downloads, signing and matching app stash entries are
+// still served.
+type MaintenanceModeMiddleware struct {
+	Mode *bitsgo.MaintenanceMode
+}
+
+func (middleware *MaintenanceModeMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	if changesBlobs(request) {
+		if e := middleware.Mode.CheckWritableFor(ResourceTypeFrom(request.URL.Path)); e != nil {
+			bitsgo.WriteServiceUnavailable(responseWriter, request, e)
+			return
+		}
+	}
+	next(responseWriter, request)
+}
+
+func changesBlobs(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(request.URL.Path, "/app_stash/entries")
+	}
+	return false
+}
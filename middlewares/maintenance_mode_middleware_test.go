@@ -0,0 +1,73 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+)
+
+var _ = Describe("MaintenanceModeMiddleware", func() {
+	var (
+		mode       *bitsgo.MaintenanceMode
+		middleware *middlewares.MaintenanceModeMiddleware
+	)
+
+	BeforeEach(func() {
+		mode = bitsgo.NewMaintenanceMode(clock.NewMock())
+		middleware = &middlewares.MaintenanceModeMiddleware{Mode: mode}
+	})
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		responseWriter := httptest.NewRecorder()
+		middleware.ServeHTTP(responseWriter, httptest.NewRequest(method, path, nil), func(responseWriter http.ResponseWriter, request *http.Request) {
+			responseWriter.WriteHeader(http.StatusOK)
+		})
+		return responseWriter
+	}
+
+	It("passes all requests while maintenance mode is disabled", func() {
+		Expect(serve("PUT", "/packages/abcd").Code).To(Equal(http.StatusOK))
+		Expect(serve("DELETE", "/droplets/abcd").Code).To(Equal(http.StatusOK))
+	})
+
+	It("rejects changes while maintenance mode is enabled", func() {
+		mode.Enable("migrating droplets")
+
+		for _, request := range [][]string{{"PUT", "/packages/abcd"}, {"DELETE", "/buildpack_cache/entries"}, {"POST", "/app_stash/entries"}} {
+			responseWriter := serve(request[0], request[1])
+			Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable), request[0]+" "+request[1])
+			Expect(responseWriter.Body.String()).To(MatchJSON(`{
+				"code": 10015,
+				"description": "Service Unavailable: bits-service is in maintenance mode and does not accept changes: migrating droplets"
+			}`))
+		}
+	})
+
+	It("serves downloads and app stash matches while maintenance mode is enabled", func() {
+		mode.Enable("")
+
+		Expect(serve("GET", "/packages/abcd").Code).To(Equal(http.StatusOK))
+		Expect(serve("HEAD", "/packages/abcd").Code).To(Equal(http.StatusOK))
+		Expect(serve("GET", "/sign/packages/abcd?verb=put").Code).To(Equal(http.StatusOK))
+		Expect(serve("POST", "/app_stash/matches").Code).To(Equal(http.StatusOK))
+	})
+
+	It("rejects changes only to resource types which are read-only", func() {
+		mode.EnableFor("droplets", "migrating droplets")
+
+		responseWriter := serve("DELETE", "/droplets/abcd")
+		Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(responseWriter.Body.String()).To(MatchJSON(`{
+			"code": 10015,
+			"description": "Service Unavailable: droplets blobstore is read-only and does not accept changes: migrating droplets"
+		}`))
+		Expect(serve("GET", "/droplets/abcd").Code).To(Equal(http.StatusOK))
+		Expect(serve("PUT", "/packages/abcd").Code).To(Equal(http.StatusOK))
+
+		mode.DisableFor("droplets")
+		Expect(serve("DELETE", "/droplets/abcd").Code).To(Equal(http.StatusOK))
+	})
+})
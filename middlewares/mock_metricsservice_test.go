@@ -32,6 +32,21 @@ func (mock *MockMetricsService) SendTimingMetric(_param0 string, _param1 time.Du
 	pegomock.GetGenericMockFrom(mock).Invoke("SendTimingMetric", params, []reflect.Type{})
 }
 
+func (mock *MockMetricsService) SendCounterMetricWithTags(_param0 string, _param1 int64, _param2 map[string]string) {
+	params := []pegomock.Param{_param0, _param1, _param2}
+	pegomock.GetGenericMockFrom(mock).Invoke("SendCounterMetricWithTags", params, []reflect.Type{})
+}
+
+func (mock *MockMetricsService) SendGaugeMetricWithTags(_param0 string, _param1 int64, _param2 map[string]string) {
+	params := []pegomock.Param{_param0, _param1, _param2}
+	pegomock.GetGenericMockFrom(mock).Invoke("SendGaugeMetricWithTags", params, []reflect.Type{})
+}
+
+func (mock *MockMetricsService) SendTimingMetricWithTags(_param0 string, _param1 time.Duration, _param2 map[string]string) {
+	params := []pegomock.Param{_param0, _param1, _param2}
+	pegomock.GetGenericMockFrom(mock).Invoke("SendTimingMetricWithTags", params, []reflect.Type{})
+}
+
 func (mock *MockMetricsService) VerifyWasCalledOnce() *VerifierMetricsService {
 	return &VerifierMetricsService{mock, pegomock.Times(1), nil}
 }
@@ -142,3 +157,108 @@ func (c *MetricsService_SendTimingMetric_OngoingVerification) GetAllCapturedArgu
 	}
 	return
 }
+
+func (verifier *VerifierMetricsService) SendCounterMetricWithTags(_param0 string, _param1 int64, _param2 map[string]string) *MetricsService_SendCounterMetricWithTags_OngoingVerification {
+	params := []pegomock.Param{_param0, _param1, _param2}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "SendCounterMetricWithTags", params)
+	return &MetricsService_SendCounterMetricWithTags_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type MetricsService_SendCounterMetricWithTags_OngoingVerification struct {
+	mock              *MockMetricsService
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *MetricsService_SendCounterMetricWithTags_OngoingVerification) GetCapturedArguments() (string, int64, map[string]string) {
+	_param0, _param1, _param2 := c.GetAllCapturedArguments()
+	return _param0[len(_param0)-1], _param1[len(_param1)-1], _param2[len(_param2)-1]
+}
+
+func (c *MetricsService_SendCounterMetricWithTags_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []int64, _param2 []map[string]string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]int64, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int64)
+		}
+		_param2 = make([]map[string]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(map[string]string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierMetricsService) SendGaugeMetricWithTags(_param0 string, _param1 int64, _param2 map[string]string) *MetricsService_SendGaugeMetricWithTags_OngoingVerification {
+	params := []pegomock.Param{_param0, _param1, _param2}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "SendGaugeMetricWithTags", params)
+	return &MetricsService_SendGaugeMetricWithTags_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type MetricsService_SendGaugeMetricWithTags_OngoingVerification struct {
+	mock              *MockMetricsService
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *MetricsService_SendGaugeMetricWithTags_OngoingVerification) GetCapturedArguments() (string, int64, map[string]string) {
+	_param0, _param1, _param2 := c.GetAllCapturedArguments()
+	return _param0[len(_param0)-1], _param1[len(_param1)-1], _param2[len(_param2)-1]
+}
+
+func (c *MetricsService_SendGaugeMetricWithTags_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []int64, _param2 []map[string]string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]int64, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int64)
+		}
+		_param2 = make([]map[string]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(map[string]string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierMetricsService) SendTimingMetricWithTags(_param0 string, _param1 time.Duration, _param2 map[string]string) *MetricsService_SendTimingMetricWithTags_OngoingVerification {
+	params := []pegomock.Param{_param0, _param1, _param2}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "SendTimingMetricWithTags", params)
+	return &MetricsService_SendTimingMetricWithTags_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type MetricsService_SendTimingMetricWithTags_OngoingVerification struct {
+	mock              *MockMetricsService
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *MetricsService_SendTimingMetricWithTags_OngoingVerification) GetCapturedArguments() (string, time.Duration, map[string]string) {
+	_param0, _param1, _param2 := c.GetAllCapturedArguments()
+	return _param0[len(_param0)-1], _param1[len(_param1)-1], _param2[len(_param2)-1]
+}
+
+func (c *MetricsService_SendTimingMetricWithTags_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []time.Duration, _param2 []map[string]string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]time.Duration, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(time.Duration)
+		}
+		_param2 = make([]map[string]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(map[string]string)
+		}
+	}
+	return
+}
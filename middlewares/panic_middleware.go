@@ -1,12 +1,14 @@
 package middlewares
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
+	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
 )
 
 type PanicMiddleware struct{}
@@ -15,19 +17,27 @@ type internalServerErrorResponseBody struct {
 	Service       string `json:"service"`
 	Error         string `json:"error"`
 	VcapRequestID string `json:"vcap-request-id"`
-	RequestID     int64  `json:"request-id"`
+	RequestID     string `json:"request-id"`
 }
 
 func (middleware *PanicMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
 	defer func() {
 		if e := recover(); e != nil {
+			// Blobstore errors usually surface as panics. A blobstore which rejects calls is not an internal error.
+			if err, isError := e.(error); isError {
+				if unavailable, isUnavailable := errors.Cause(err).(*bitsgo.UnavailableError); isUnavailable {
+					bitsgo.WriteServiceUnavailable(responseWriter, request, unavailable)
+					return
+				}
+			}
 			logger.From(request).Errorw("Internal Server Error.", "error", fmt.Sprintf("%+v", e))
 			responseWriter.WriteHeader(http.StatusInternalServerError)
+			// vcap-request-id is kept for clients which still rely on it. It's the same as the request-id now.
 			body, e := json.Marshal(internalServerErrorResponseBody{
 				Service:       "Bits-Service",
 				Error:         "Internal Server Error",
-				VcapRequestID: safeGetStringValueFrom(request.Context(), "vcap-request-id"),
-				RequestID:     safeGetInt64ValueFrom(request.Context(), "request-id"),
+				VcapRequestID: util.RequestIDFrom(request.Context()),
+				RequestID:     util.RequestIDFrom(request.Context()),
 			})
 			if e != nil {
 				// Nothing we can do at this point
@@ -39,23 +49,3 @@ func (middleware *PanicMiddleware) ServeHTTP(responseWriter http.ResponseWriter,
 
 	next(responseWriter, request)
 }
-
-func safeGetStringValueFrom(c context.Context, key string) string {
-	if c.Value(key) == nil {
-		return ""
-	}
-	if value, ok := c.Value(key).(string); ok {
-		return value
-	}
-	return ""
-}
-
-func safeGetInt64ValueFrom(c context.Context, key string) int64 {
-	if c.Value(key) == nil {
-		return 0
-	}
-	if value, ok := c.Value(key).(int64); ok {
-		return value
-	}
-	return 0
-}
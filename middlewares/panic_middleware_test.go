@@ -3,7 +3,9 @@ package middlewares_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"time"
 
+	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/middlewares"
 	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
@@ -18,8 +20,7 @@ var _ = Describe("PanicMiddleWare", func() {
 				responseWriter,
 				util.RequestWithContextValues(
 					httptest.NewRequest("GET", "http://example.com/some/request", nil),
-					"request-id", int64(123456),
-					"vcap-request-id", "123456-7890-1234"),
+					"request-id", "123456-7890-1234"),
 				func(http.ResponseWriter, *http.Request) {
 					panic(errors.New("Some unexpected error"))
 				})
@@ -28,10 +29,25 @@ var _ = Describe("PanicMiddleWare", func() {
 			Expect(responseWriter.Body.String()).To(MatchJSON(`{
 				"service": "Bits-Service",
 				"error": "Internal Server Error",
-				"request-id": 123456,
+				"request-id": "123456-7890-1234",
 				"vcap-request-id":"123456-7890-1234"
 			}`))
 		})
+
+		It("responds with Service Unavailable when a blobstore rejected a call", func() {
+			responseWriter := httptest.NewRecorder()
+
+			(&middlewares.PanicMiddleware{}).ServeHTTP(
+				responseWriter,
+				httptest.NewRequest("GET", "http://example.com/some/request", nil),
+				func(http.ResponseWriter, *http.Request) {
+					panic(errors.Wrap(bitsgo.NewUnavailableError("Circuit is open", 1500*time.Millisecond), "Could not get file"))
+				})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(responseWriter.Header().Get("Retry-After")).To(Equal("2"))
+			Expect(responseWriter.Body.String()).To(MatchJSON(`{"code": 10015, "description": "Service Unavailable: Circuit is open"}`))
+		})
 	})
 
 	Context("Handler succeeds", func() {
@@ -1,8 +1,12 @@
 package middlewares
 
 import (
+	"mime"
 	"net/http"
+	"strings"
 
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
 	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 )
 
@@ -15,9 +19,42 @@ func (middleware *SignatureVerificationMiddleware) ServeHTTP(responseWriter http
 		responseWriter.WriteHeader(403)
 		return
 	}
+
+	// Constraints are checked before the signature, so that a rejected request does not use up a single-use URL.
+	// Any tampering with them is still caught by the signature check.
+	constraints := pathsigner.ConstraintsFrom(request.URL)
+	if !constraints.AllowsMethod(request.Method) {
+		responseWriter.WriteHeader(403)
+		return
+	}
+	if constraints.ContentType != "" && !contentTypeMatches(request.Header.Get("Content-Type"), constraints.ContentType) {
+		responseWriter.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if constraints.MaxContentLength > 0 && request.ContentLength > constraints.MaxContentLength {
+		responseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
 	if !middleware.SignatureValidator.SignatureValid(request.URL) {
 		responseWriter.WriteHeader(403)
 		return
 	}
+
+	if constraints.MaxContentLength > 0 {
+		// Content-Length might be unknown (chunked encoding), so the body itself must be limited too
+		request.Body = http.MaxBytesReader(responseWriter, request.Body, constraints.MaxContentLength)
+	}
+	if constraints.Tenant != "" {
+		request = request.WithContext(bitsgo.ContextWithTenant(request.Context(), constraints.Tenant))
+	}
+	audit.From(request).Actor = audit.Actor{Type: audit.SignedURLActor, ID: request.URL.Query().Get("AccessKeyId")}
 	next(responseWriter, request)
 }
+
+func contentTypeMatches(contentType string, expected string) bool {
+	mediaType, _, e := mime.ParseMediaType(contentType)
+	if e != nil {
+		return false
+	}
+	return strings.EqualFold(mediaType, expected)
+}
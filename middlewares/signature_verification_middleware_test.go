@@ -2,9 +2,11 @@ package middlewares_test
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
@@ -38,7 +40,7 @@ var _ = Describe("Signing URLs", func() {
 
 	BeforeEach(func() {
 		mockClock = clock.NewMock()
-		pathSignerValidator = pathsigner.Validate(&pathsigner.PathSignerValidator{"geheim", mockClock, nil, ""})
+		pathSignerValidator = pathsigner.Validate(&pathsigner.PathSignerValidator{Secret: "geheim", Clock: mockClock})
 		handler = &LocalResourceSigner{
 			Signer:             pathSignerValidator,
 			DelegateEndpoint:   "http://example.com",
@@ -90,4 +92,110 @@ var _ = Describe("Signing URLs", func() {
 		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
 	})
 
+	Context("constraints", func() {
+		var (
+			responseWriter *httptest.ResponseRecorder
+			r              *mux.Router
+		)
+
+		BeforeEach(func() {
+			responseWriter = httptest.NewRecorder()
+			r = mux.NewRouter()
+			r.Path("/my/path").Handler(negroni.New(
+				&SignatureVerificationMiddleware{pathSignerValidator},
+				negroni.Wrap(NewMockHandler()),
+			))
+		})
+
+		It("rejects a URL signed for GET when used with PUT", func() {
+			signedURL := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
+
+			r.ServeHTTP(responseWriter, httptest.NewRequest("PUT", signedURL, strings.NewReader("content")))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("accepts a URL signed for GET when used with HEAD", func() {
+			signedURL := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
+
+			r.ServeHTTP(responseWriter, httptest.NewRequest("HEAD", signedURL, nil))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusOK))
+		})
+
+		It("rejects uploads exceeding the max content length", func() {
+			signedURL := handler.SignWithConstraints("path", "put", mockClock.Now().Add(1*time.Hour), 3, "", "")
+
+			r.ServeHTTP(responseWriter, httptest.NewRequest("PUT", signedURL, strings.NewReader("content")))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+
+		It("rejects uploads with a different content type", func() {
+			signedURL := handler.SignWithConstraints("path", "put", mockClock.Now().Add(1*time.Hour), 0, "application/zip", "")
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("content"))
+			request.Header.Set("Content-Type", "text/plain")
+			r.ServeHTTP(responseWriter, request)
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnsupportedMediaType))
+		})
+
+		It("accepts uploads within the constraints", func() {
+			signedURL := handler.SignWithConstraints("path", "put", mockClock.Now().Add(1*time.Hour), 1024, "multipart/form-data", "")
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("content"))
+			request.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+			r.ServeHTTP(responseWriter, request)
+
+			Expect(responseWriter.Code).To(Equal(http.StatusOK))
+		})
+
+		It("does not use up a single-use URL when rejecting a request", func() {
+			pathSignerValidator = pathsigner.Validate(&pathsigner.PathSignerValidator{Secret: "geheim", Clock: mockClock, NonceStore: pathsigner.NewInMemoryNonceStore(mockClock, 10)})
+			handler.Signer = pathSignerValidator
+			r = mux.NewRouter()
+			r.Path("/my/path").Handler(negroni.New(
+				&SignatureVerificationMiddleware{pathSignerValidator},
+				negroni.Wrap(NewMockHandler()),
+			))
+			signedURL := handler.SignWithConstraints("path", "put", mockClock.Now().Add(1*time.Hour), 0, "application/zip", "")
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("content"))
+			request.Header.Set("Content-Type", "text/plain")
+			r.ServeHTTP(responseWriter, request)
+			Expect(responseWriter.Code).To(Equal(http.StatusUnsupportedMediaType))
+
+			responseWriter = httptest.NewRecorder()
+			request = httptest.NewRequest("PUT", signedURL, strings.NewReader("content"))
+			request.Header.Set("Content-Type", "application/zip")
+			r.ServeHTTP(responseWriter, request)
+			Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+			responseWriter = httptest.NewRecorder()
+			request = httptest.NewRequest("PUT", signedURL, strings.NewReader("content"))
+			request.Header.Set("Content-Type", "application/zip")
+			r.ServeHTTP(responseWriter, request)
+			Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("accounts uploads to the tenant the URL was signed for", func() {
+			signedURL := handler.SignWithConstraints("path", "put", mockClock.Now().Add(1*time.Hour), 0, "", "some-space")
+
+			var tenant string
+			r = mux.NewRouter()
+			r.Path("/my/path").Handler(negroni.New(
+				&SignatureVerificationMiddleware{pathSignerValidator},
+				negroni.WrapFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+					tenant = bitsgo.TenantFrom(request.Context())
+				}),
+			))
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("content"))
+			request.Header.Set(bitsgo.TenantHeader, "other-space")
+			r.ServeHTTP(responseWriter, request)
+
+			Expect(responseWriter.Code).To(Equal(http.StatusOK))
+			Expect(tenant).To(Equal("some-space"))
+		})
+	})
 })
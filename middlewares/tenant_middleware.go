@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+)
+
+// TenantMiddleware accounts requests to the tenant in their bitsgo.TenantHeader. It must only be used for the
+// private endpoint, whose clients are trusted. On the public endpoint, the SignatureVerificationMiddleware takes the
+// tenant from the signed URL instead.
+type TenantMiddleware struct{}
+
+func (middleware *TenantMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	tenant := request.Header.Get(bitsgo.TenantHeader)
+	if tenant == "" {
+		next(responseWriter, request)
+		return
+	}
+	next(responseWriter, request.WithContext(bitsgo.ContextWithTenant(request.Context(), tenant)))
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/urfave/negroni"
+
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TracingMiddleware struct{}
+
+func NewTracingMiddleware() *TracingMiddleware {
+	return &TracingMiddleware{}
+}
+
+func (middleware *TracingMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	spanName := "HTTP " + request.Method
+	if resourceType := ResourceTypeFrom(request.URL.Path); resourceType != "" {
+		spanName += " " + resourceType
+	}
+	// Note: we only record the path, because the query may contain signatures.
+	ctx, span := tracing.Tracer().Start(tracing.Extract(request.Context(), request.Header), spanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", request.Method),
+			attribute.String("http.host", request.Host),
+			attribute.String("http.target", request.URL.Path)))
+	defer span.End()
+
+	negroniResponseWriter, ok := responseWriter.(negroni.ResponseWriter)
+	if !ok {
+		negroniResponseWriter = negroni.NewResponseWriter(responseWriter)
+	}
+
+	next(negroniResponseWriter, request.WithContext(ctx))
+
+	span.SetAttributes(attribute.Int("http.status_code", negroniResponseWriter.Status()))
+	if negroniResponseWriter.Status() >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(negroniResponseWriter.Status()))
+	}
+}
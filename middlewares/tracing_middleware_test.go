@@ -0,0 +1,65 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("TracingMiddleware", func() {
+	var recorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	serve := func(request *http.Request, status int) trace.SpanContext {
+		var handlerSpanContext trace.SpanContext
+		middlewares.NewTracingMiddleware().ServeHTTP(httptest.NewRecorder(), request, func(responseWriter http.ResponseWriter, request *http.Request) {
+			handlerSpanContext = trace.SpanContextFromContext(request.Context())
+			responseWriter.WriteHeader(status)
+		})
+		return handlerSpanContext
+	}
+
+	It("records a server span per request and passes it on to the handler", func() {
+		handlerSpanContext := serve(httptest.NewRequest("PUT", "http://internal.example.com/packages/abcd?signature=secret", nil), http.StatusCreated)
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		span := recorder.Ended()[0]
+		Expect(span.Name()).To(Equal("HTTP PUT packages"))
+		Expect(span.SpanKind()).To(Equal(trace.SpanKindServer))
+		Expect(span.SpanContext().SpanID()).To(Equal(handlerSpanContext.SpanID()))
+		Expect(span.Attributes()).To(ContainElement(attribute.String("http.target", "/packages/abcd")))
+		Expect(span.Attributes()).To(ContainElement(attribute.Int("http.status_code", http.StatusCreated)))
+		Expect(span.Status().Code).NotTo(Equal(codes.Error))
+	})
+
+	It("continues the trace of the caller", func() {
+		request := httptest.NewRequest("GET", "http://internal.example.com/droplets/abcd", nil)
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		serve(request, http.StatusOK)
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		Expect(recorder.Ended()[0].SpanContext().TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(recorder.Ended()[0].Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+	})
+
+	It("marks server errors as errors", func() {
+		serve(httptest.NewRequest("GET", "http://internal.example.com/droplets/abcd", nil), http.StatusInternalServerError)
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Error))
+	})
+})
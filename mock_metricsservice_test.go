@@ -41,6 +41,30 @@ func (mock *MockMetricsService) SendCounterMetric(name string, value int64) {
 	pegomock.GetGenericMockFrom(mock).Invoke("SendCounterMetric", params, []reflect.Type{})
 }
 
+func (mock *MockMetricsService) SendTimingMetricWithTags(name string, duration time.Duration, tags map[string]string) {
+	if mock == nil {
+		panic("mock must not be nil. Use myMock := NewMockMetricsService().")
+	}
+	params := []pegomock.Param{name, duration, tags}
+	pegomock.GetGenericMockFrom(mock).Invoke("SendTimingMetricWithTags", params, []reflect.Type{})
+}
+
+func (mock *MockMetricsService) SendGaugeMetricWithTags(name string, value int64, tags map[string]string) {
+	if mock == nil {
+		panic("mock must not be nil. Use myMock := NewMockMetricsService().")
+	}
+	params := []pegomock.Param{name, value, tags}
+	pegomock.GetGenericMockFrom(mock).Invoke("SendGaugeMetricWithTags", params, []reflect.Type{})
+}
+
+func (mock *MockMetricsService) SendCounterMetricWithTags(name string, value int64, tags map[string]string) {
+	if mock == nil {
+		panic("mock must not be nil. Use myMock := NewMockMetricsService().")
+	}
+	params := []pegomock.Param{name, value, tags}
+	pegomock.GetGenericMockFrom(mock).Invoke("SendCounterMetricWithTags", params, []reflect.Type{})
+}
+
 func (mock *MockMetricsService) VerifyWasCalledOnce() *VerifierMetricsService {
 	return &VerifierMetricsService{mock, pegomock.Times(1), nil}
 }
@@ -151,3 +175,108 @@ func (c *MetricsService_SendCounterMetric_OngoingVerification) GetAllCapturedArg
 	}
 	return
 }
+
+func (verifier *VerifierMetricsService) SendTimingMetricWithTags(name string, duration time.Duration, tags map[string]string) *MetricsService_SendTimingMetricWithTags_OngoingVerification {
+	params := []pegomock.Param{name, duration, tags}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "SendTimingMetricWithTags", params)
+	return &MetricsService_SendTimingMetricWithTags_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type MetricsService_SendTimingMetricWithTags_OngoingVerification struct {
+	mock              *MockMetricsService
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *MetricsService_SendTimingMetricWithTags_OngoingVerification) GetCapturedArguments() (string, time.Duration, map[string]string) {
+	name, duration, tags := c.GetAllCapturedArguments()
+	return name[len(name)-1], duration[len(duration)-1], tags[len(tags)-1]
+}
+
+func (c *MetricsService_SendTimingMetricWithTags_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []time.Duration, _param2 []map[string]string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]time.Duration, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(time.Duration)
+		}
+		_param2 = make([]map[string]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(map[string]string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierMetricsService) SendGaugeMetricWithTags(name string, value int64, tags map[string]string) *MetricsService_SendGaugeMetricWithTags_OngoingVerification {
+	params := []pegomock.Param{name, value, tags}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "SendGaugeMetricWithTags", params)
+	return &MetricsService_SendGaugeMetricWithTags_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type MetricsService_SendGaugeMetricWithTags_OngoingVerification struct {
+	mock              *MockMetricsService
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *MetricsService_SendGaugeMetricWithTags_OngoingVerification) GetCapturedArguments() (string, int64, map[string]string) {
+	name, value, tags := c.GetAllCapturedArguments()
+	return name[len(name)-1], value[len(value)-1], tags[len(tags)-1]
+}
+
+func (c *MetricsService_SendGaugeMetricWithTags_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []int64, _param2 []map[string]string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]int64, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int64)
+		}
+		_param2 = make([]map[string]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(map[string]string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierMetricsService) SendCounterMetricWithTags(name string, value int64, tags map[string]string) *MetricsService_SendCounterMetricWithTags_OngoingVerification {
+	params := []pegomock.Param{name, value, tags}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "SendCounterMetricWithTags", params)
+	return &MetricsService_SendCounterMetricWithTags_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type MetricsService_SendCounterMetricWithTags_OngoingVerification struct {
+	mock              *MockMetricsService
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *MetricsService_SendCounterMetricWithTags_OngoingVerification) GetCapturedArguments() (string, int64, map[string]string) {
+	name, value, tags := c.GetAllCapturedArguments()
+	return name[len(name)-1], value[len(value)-1], tags[len(tags)-1]
+}
+
+func (c *MetricsService_SendCounterMetricWithTags_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []int64, _param2 []map[string]string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]int64, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int64)
+		}
+		_param2 = make([]map[string]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(map[string]string)
+		}
+	}
+	return
+}
@@ -4,6 +4,7 @@
 package bitsgo_test
 
 import (
+	context "context"
 	pegomock "github.com/petergtz/pegomock"
 	"reflect"
 )
@@ -16,11 +17,11 @@ func NewMockUpdater() *MockUpdater {
 	return &MockUpdater{fail: pegomock.GlobalFailHandler}
 }
 
-func (mock *MockUpdater) NotifyProcessingUpload(guid string) error {
+func (mock *MockUpdater) NotifyProcessingUpload(ctx context.Context, guid string) error {
 	if mock == nil {
-		panic("mock must not be nil. Use myMock := NewMockMockUpdater().")
+		panic("mock must not be nil. Use myMock := NewMockUpdater().")
 	}
-	params := []pegomock.Param{guid}
+	params := []pegomock.Param{ctx, guid}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("NotifyProcessingUpload", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -31,11 +32,11 @@ func (mock *MockUpdater) NotifyProcessingUpload(guid string) error {
 	return ret0
 }
 
-func (mock *MockUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha2 string) error {
+func (mock *MockUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) error {
 	if mock == nil {
-		panic("mock must not be nil. Use myMock := NewMockMockUpdater().")
+		panic("mock must not be nil. Use myMock := NewMockUpdater().")
 	}
-	params := []pegomock.Param{guid, sha1, sha2}
+	params := []pegomock.Param{ctx, guid, sha1, sha2}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("NotifyUploadSucceeded", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -46,11 +47,11 @@ func (mock *MockUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha2 st
 	return ret0
 }
 
-func (mock *MockUpdater) NotifyUploadFailed(guid string, e error) error {
+func (mock *MockUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) error {
 	if mock == nil {
-		panic("mock must not be nil. Use myMock := NewMockMockUpdater().")
+		panic("mock must not be nil. Use myMock := NewMockUpdater().")
 	}
-	params := []pegomock.Param{guid, e}
+	params := []pegomock.Param{ctx, guid, e}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("NotifyUploadFailed", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -79,8 +80,8 @@ type VerifierUpdater struct {
 	inOrderContext         *pegomock.InOrderContext
 }
 
-func (verifier *VerifierUpdater) NotifyProcessingUpload(guid string) *Updater_NotifyProcessingUpload_OngoingVerification {
-	params := []pegomock.Param{guid}
+func (verifier *VerifierUpdater) NotifyProcessingUpload(ctx context.Context, guid string) *Updater_NotifyProcessingUpload_OngoingVerification {
+	params := []pegomock.Param{ctx, guid}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "NotifyProcessingUpload", params)
 	return &Updater_NotifyProcessingUpload_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -90,24 +91,28 @@ type Updater_NotifyProcessingUpload_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Updater_NotifyProcessingUpload_OngoingVerification) GetCapturedArguments() string {
-	guid := c.GetAllCapturedArguments()
-	return guid[len(guid)-1]
+func (c *Updater_NotifyProcessingUpload_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, guid := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], guid[len(guid)-1]
 }
 
-func (c *Updater_NotifyProcessingUpload_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Updater_NotifyProcessingUpload_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha2 string) *Updater_NotifyUploadSucceeded_OngoingVerification {
-	params := []pegomock.Param{guid, sha1, sha2}
+func (verifier *VerifierUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) *Updater_NotifyUploadSucceeded_OngoingVerification {
+	params := []pegomock.Param{ctx, guid, sha1, sha2}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "NotifyUploadSucceeded", params)
 	return &Updater_NotifyUploadSucceeded_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -117,17 +122,17 @@ type Updater_NotifyUploadSucceeded_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Updater_NotifyUploadSucceeded_OngoingVerification) GetCapturedArguments() (string, string, string) {
-	guid, sha1, sha2 := c.GetAllCapturedArguments()
-	return guid[len(guid)-1], sha1[len(sha1)-1], sha2[len(sha2)-1]
+func (c *Updater_NotifyUploadSucceeded_OngoingVerification) GetCapturedArguments() (context.Context, string, string, string) {
+	ctx, guid, sha1, sha2 := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], guid[len(guid)-1], sha1[len(sha1)-1], sha2[len(sha2)-1]
 }
 
-func (c *Updater_NotifyUploadSucceeded_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []string, _param2 []string) {
+func (c *Updater_NotifyUploadSucceeded_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string, _param2 []string, _param3 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
 		}
 		_param1 = make([]string, len(params[1]))
 		for u, param := range params[1] {
@@ -137,12 +142,16 @@ func (c *Updater_NotifyUploadSucceeded_OngoingVerification) GetAllCapturedArgume
 		for u, param := range params[2] {
 			_param2[u] = param.(string)
 		}
+		_param3 = make([]string, len(params[3]))
+		for u, param := range params[3] {
+			_param3[u] = param.(string)
+		}
 	}
 	return
 }
 
-func (verifier *VerifierUpdater) NotifyUploadFailed(guid string, e error) *Updater_NotifyUploadFailed_OngoingVerification {
-	params := []pegomock.Param{guid, e}
+func (verifier *VerifierUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) *Updater_NotifyUploadFailed_OngoingVerification {
+	params := []pegomock.Param{ctx, guid, e}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "NotifyUploadFailed", params)
 	return &Updater_NotifyUploadFailed_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -152,21 +161,25 @@ type Updater_NotifyUploadFailed_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Updater_NotifyUploadFailed_OngoingVerification) GetCapturedArguments() (string, error) {
-	guid, e := c.GetAllCapturedArguments()
-	return guid[len(guid)-1], e[len(e)-1]
+func (c *Updater_NotifyUploadFailed_OngoingVerification) GetCapturedArguments() (context.Context, string, error) {
+	ctx, guid, e := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], guid[len(guid)-1], e[len(e)-1]
 }
 
-func (c *Updater_NotifyUploadFailed_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []error) {
+func (c *Updater_NotifyUploadFailed_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string, _param2 []error) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
 		}
-		_param1 = make([]error, len(params[1]))
+		_param1 = make([]string, len(params[1]))
 		for u, param := range params[1] {
-			_param1[u] = param.(error)
+			_param1[u] = param.(string)
+		}
+		_param2 = make([]error, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(error)
 		}
 	}
 	return
@@ -2,6 +2,7 @@ package bitsgo
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"io"
@@ -14,16 +15,27 @@ import (
 
 	"github.com/pkg/errors"
 
-	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
+func CreateTempZipFileFrom(ctx context.Context,
+	bundlesPayload []Fingerprint,
 	zipReader *zip.Reader,
 	minimumSize, maximumSize uint64,
 	blobstore Blobstore,
 	metricsService MetricsService,
 	logger *zap.SugaredLogger,
 ) (tempFilename string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "CreateTempZipFileFrom",
+		trace.WithAttributes(attribute.Int("bits.bundle_entries", len(bundlesPayload))))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	blobstore = BlobstoreWithContext(ctx, blobstore)
+
 	tempZipFile, e := ioutil.TempFile("", "bundles")
 	if e != nil {
 		return "", errors.Wrap(e, "Could not create temp file")
@@ -71,28 +83,11 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 			if e != nil {
 				return "", errors.Wrap(e, "Could not close zip entry reader")
 			}
-			e = backoff.RetryNotify(func() error {
-				tempFile, e = os.Open(tempFile.Name())
+			if uint64(tempFileSize) >= minimumSize && uint64(tempFileSize) <= maximumSize {
+				e = putTempFile(blobstore, hex.EncodeToString(sha.Sum(nil)), tempFile.Name())
 				if e != nil {
-					return errors.Wrap(e, "Could not open temp file for reading")
+					return "", e
 				}
-				defer tempFile.Close()
-				if uint64(tempFileSize) >= minimumSize && uint64(tempFileSize) <= maximumSize {
-					sha := hex.EncodeToString(sha.Sum(nil))
-					e = blobstore.Put(sha, tempFile)
-					if e != nil {
-						if _, ok := e.(*NoSpaceLeftError); ok {
-							return backoff.Permanent(e)
-						}
-						return errors.Wrapf(e, "Could not upload file to blobstore. SHA: '%v'", sha)
-					}
-				}
-				return nil
-			}, backoff.NewExponentialBackOff(), func(e error, backOffDelay time.Duration) {
-				metricsService.SendCounterMetric("appStashPutRetries", 1)
-			})
-			if e != nil {
-				return "", e
 			}
 			os.Remove(tempFile.Name())
 		}
@@ -104,28 +99,7 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 			return "", errors.Wrap(e, "Could create header in zip file")
 		}
 
-		e = backoff.RetryNotify(func() error {
-			b, e := blobstore.Get(entry.Sha1)
-
-			if e != nil {
-				if _, ok := e.(*NotFoundError); ok {
-					return backoff.Permanent(NewNotFoundErrorWithKey(entry.Sha1))
-				}
-				return errors.Wrapf(e, "Could not get file from blobstore. SHA: '%v'", entry.Sha1)
-			}
-			defer b.Close()
-
-			_, e = io.Copy(zipEntry, b)
-			if e != nil {
-				return errors.Wrapf(e, "Could not copy file to zip entry. SHA: %v", entry.Sha1)
-			}
-			return nil
-		},
-			backoff.NewExponentialBackOff(),
-			func(e error, backOffDelay time.Duration) {
-				metricsService.SendCounterMetric("appStashGetRetries", 1)
-			},
-		)
+		e = copyBlob(blobstore, entry.Sha1, zipEntry)
 		if e != nil {
 			return "", e
 		}
@@ -134,6 +108,41 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 	return tempZipFile.Name(), nil
 }
 
+func putTempFile(blobstore Blobstore, sha string, tempFilename string) error {
+	tempFile, e := os.Open(tempFilename)
+	if e != nil {
+		return errors.Wrap(e, "Could not open temp file for reading")
+	}
+	defer tempFile.Close()
+	e = blobstore.Put(sha, tempFile)
+	switch e.(type) {
+	case nil, *NoSpaceLeftError, *UnavailableError:
+		return e
+	default:
+		return errors.Wrapf(e, "Could not upload file to blobstore. SHA: '%v'", sha)
+	}
+}
+
+func copyBlob(blobstore Blobstore, sha string, dest io.Writer) error {
+	b, e := blobstore.Get(sha)
+	switch e.(type) {
+	case nil:
+	case *NotFoundError:
+		return NewNotFoundErrorWithKey(sha)
+	case *UnavailableError:
+		return e
+	default:
+		return errors.Wrapf(e, "Could not get file from blobstore. SHA: '%v'", sha)
+	}
+	defer b.Close()
+
+	_, e = io.Copy(dest, b)
+	if e != nil {
+		return errors.Wrapf(e, "Could not copy file to zip entry. SHA: %v", sha)
+	}
+	return nil
+}
+
 func fileModeFrom(s string) os.FileMode {
 	mode, e := strconv.ParseInt(s, 8, 32)
 	if e != nil {
@@ -2,6 +2,7 @@ package bitsgo_test
 
 import (
 	"archive/zip"
+	"context"
 	"io/ioutil"
 	"math"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	bitsgo "github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
 	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
 	. "github.com/cloudfoundry-incubator/bits-service/matchers"
@@ -27,7 +29,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 	It("Creates a zip", func() {
 		Expect(blobstore.Put("abc", strings.NewReader("filename1 content"))).To(Succeed())
 
-		tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+		tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 			bitsgo.Fingerprint{
 				Sha1: "abc",
 				Fn:   "filename1",
@@ -49,7 +51,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 			Expect(blobstore.Put("abc", strings.NewReader("filename1 content"))).To(Succeed())
 
 			var e error
-			tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+			tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 				bitsgo.Fingerprint{
 					Sha1: "abc",
 					Fn:   "filename1",
@@ -83,7 +85,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 			response := blobstore.Put("abc", tmpfilereader)
 			Expect(response).To(Succeed())
 
-			tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+			tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 				bitsgo.Fingerprint{
 					Sha1: "abc",
 					Fn:   "filename1",
@@ -102,10 +104,16 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 	})
 
 	Context("One error from blobstore", func() {
-		var blobstore *MockBlobstore
+		var (
+			blobstore         *MockBlobstore
+			retryingBlobstore bitsgo.Blobstore
+		)
 
 		BeforeEach(func() {
 			blobstore = NewMockBlobstore()
+			policy := bitsgo.DefaultRetryPolicy()
+			policy.InitialInterval = time.Millisecond
+			retryingBlobstore = decorator.ForBlobstoreWithRetries(blobstore, policy, NewMockMetricsService(), "app_stash")
 		})
 
 		Context("Error in Blobstore.Get", func() {
@@ -114,13 +122,13 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 					ThenReturn(nil, errors.New("Some error")).
 					ThenReturn(ioutil.NopCloser(strings.NewReader("filename1 content")), nil)
 
-				tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+				tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 					bitsgo.Fingerprint{
 						Sha1: "abc",
 						Fn:   "filename1",
 						Mode: "644",
 					},
-				}, nil, 0, math.MaxUint64, blobstore, NewMockMetricsService(), logger.Log)
+				}, nil, 0, math.MaxUint64, retryingBlobstore, NewMockMetricsService(), logger.Log)
 				Expect(e).NotTo(HaveOccurred())
 
 				reader, e := zip.OpenReader(tempFileName)
@@ -131,9 +139,9 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 		})
 
 		Context("Error in read", func() {
-			It("Retries and creates the zip successfully", func() {
+			It("Resumes reading and creates the zip successfully", func() {
 				readClose := NewMockReadCloser()
-				When(readClose.Read(AnySliceOfByte())).ThenReturn(1, errors.New("some random read error"))
+				When(readClose.Read(AnySliceOfByte())).ThenReturn(0, errors.New("some random read error"))
 
 				When(blobstore.Get("abc")).
 					ThenReturn(readClose, nil).
@@ -143,7 +151,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 					ThenReturn(readClose, nil).
 					ThenReturn(ioutil.NopCloser(strings.NewReader("filename2 content")), nil)
 
-				tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+				tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 					bitsgo.Fingerprint{
 						Sha1: "abc",
 						Fn:   "filename1",
@@ -154,7 +162,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 						Fn:   "filename2",
 						Mode: "644",
 					},
-				}, nil, 0, math.MaxUint64, blobstore, NewMockMetricsService(), logger.Log)
+				}, nil, 0, math.MaxUint64, retryingBlobstore, NewMockMetricsService(), logger.Log)
 				Expect(e).NotTo(HaveOccurred())
 
 				reader, e := zip.OpenReader(tempFileName)
@@ -178,7 +186,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 			Expect(e).NotTo(HaveOccurred())
 			defer openZipFile.Close()
 
-			tempFilename, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService(), logger.Log)
+			tempFilename, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService(), logger.Log)
 			Expect(e).NotTo(HaveOccurred())
 			os.Remove(tempFilename)
 
@@ -195,7 +203,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 			Expect(e).NotTo(HaveOccurred())
 			defer openZipFile.Close()
 
-			tempFilename, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService(), logger.Log)
+			tempFilename, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService(), logger.Log)
 			Expect(e).NotTo(HaveOccurred(), "Error: %v", e)
 			os.Remove(tempFilename)
 		})
@@ -0,0 +1,204 @@
+package pathsigner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// AsymmetricPathSignerValidator signs URLs with Ed25519 or ECDSA (P-256, SHA-256) private keys and
+// validates them with the corresponding public keys. Deployments which only validate URLs need
+// PublicKeys only; they cannot sign URLs.
+type AsymmetricPathSignerValidator struct {
+	Clock clock.Clock
+	// Keys used for signing. The public key of each private key is used for validation as well.
+	PrivateKeys map[string]crypto.Signer
+	// Keys used for validation only
+	PublicKeys map[string]crypto.PublicKey
+	// Must refer to one of the PrivateKeys, unless this is a validation-only deployment.
+	ActiveKeyID string
+	// KeysNotAfter optionally limits how long a key is accepted. Keys without entry never expire.
+	KeysNotAfter map[string]time.Time
+	// NonceStore makes signed URLs single-use: every signed URL gets a nonce, which is consumed on validation.
+	NonceStore NonceStore
+	// Metrics optionally counts validations per key ID and result.
+	Metrics ValidationMetrics
+
+	// guards the keys, which can be replaced at runtime via SetKeys
+	mutex sync.RWMutex
+}
+
+func ValidateAsymmetric(signer *AsymmetricPathSignerValidator) *AsymmetricPathSignerValidator {
+	util.PanicOnError(signer.SetKeys(signer.PrivateKeys, signer.PublicKeys, signer.KeysNotAfter, signer.ActiveKeyID))
+	return signer
+}
+
+// SetKeys replaces the keys at runtime. URLs signed with keys which are no longer present are rejected from then on.
+func (signer *AsymmetricPathSignerValidator) SetKeys(privateKeys map[string]crypto.Signer, publicKeys map[string]crypto.PublicKey, keysNotAfter map[string]time.Time, activeKeyID string) error {
+	allPublicKeys := make(map[string]crypto.PublicKey, len(privateKeys)+len(publicKeys))
+	for keyID, publicKey := range publicKeys {
+		if e := verifyKeyType(publicKey); e != nil {
+			return fmt.Errorf("key \"%v\": %v", keyID, e)
+		}
+		allPublicKeys[keyID] = publicKey
+	}
+	for keyID, privateKey := range privateKeys {
+		if e := verifyKeyType(privateKey.Public()); e != nil {
+			return fmt.Errorf("key \"%v\": %v", keyID, e)
+		}
+		allPublicKeys[keyID] = privateKey.Public()
+	}
+	if len(allPublicKeys) == 0 {
+		return errors.New("must provide at least one private or public key")
+	}
+	if activeKeyID != "" {
+		if _, exist := privateKeys[activeKeyID]; !exist {
+			return errors.New("active key ID \"" + activeKeyID + "\" does not refer to a private key")
+		}
+		if keyExpired(keysNotAfter, activeKeyID, signer.Clock.Now()) {
+			return errors.New("active key \"" + activeKeyID + "\" has expired")
+		}
+	}
+
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	signer.PrivateKeys = privateKeys
+	signer.PublicKeys = allPublicKeys
+	signer.KeysNotAfter = keysNotAfter
+	signer.ActiveKeyID = activeKeyID
+	return nil
+}
+
+func verifyKeyType(publicKey crypto.PublicKey) error {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return nil
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().Name != "P-256" {
+			return errors.New("only ECDSA keys on curve P-256 are supported")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T. Only Ed25519 and ECDSA keys are supported", publicKey)
+	}
+}
+
+// CanSign reports whether there is an active private key. Validation-only deployments have none.
+func (signer *AsymmetricPathSignerValidator) CanSign() bool {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	_, exist := signer.PrivateKeys[signer.ActiveKeyID]
+	return exist
+}
+
+func (signer *AsymmetricPathSignerValidator) Sign(path string, expires time.Time) string {
+	return signer.SignWithConstraints(path, expires, Constraints{})
+}
+
+func (signer *AsymmetricPathSignerValidator) SignWithConstraints(path string, expires time.Time, constraints Constraints) string {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	privateKey, exist := signer.PrivateKeys[signer.ActiveKeyID]
+	if !exist {
+		panic(errors.New("cannot sign URLs without an active private key"))
+	}
+	nonce, nonceQuery := nonceFor(signer.NonceStore)
+	signature, e := signatureWithPrivateKey(privateKey, messageFor(path, expires, constraints, nonce))
+	util.PanicOnError(e)
+	return fmt.Sprintf("%s?signature=%x&expires=%v&AccessKeyId=%v%s%s", path, signature, expires.Unix(), signer.ActiveKeyID, constraints.queryString(), nonceQuery)
+}
+
+func (signer *AsymmetricPathSignerValidator) SignatureValid(u *url.URL) bool {
+	keyID, result := signer.validate(u)
+	sendValidationMetric(signer.Metrics, keyID, result)
+	return result == validSignature
+}
+
+func (signer *AsymmetricPathSignerValidator) validate(u *url.URL) (keyID string, result string) {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	keyID = u.Query().Get("AccessKeyId")
+	publicKey, exist := signer.PublicKeys[keyID]
+	if !exist {
+		// not using the ID from the URL as tag, to keep the number of distinct tag values bounded
+		return unknownKeyID, unknownKey
+	}
+
+	expires, e := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if e != nil {
+		return keyID, invalidSignature
+	}
+	if signer.Clock.Now().After(time.Unix(expires, 0)) {
+		return keyID, expiredURL
+	}
+	if keyExpired(signer.KeysNotAfter, keyID, signer.Clock.Now()) {
+		return keyID, retiredKey
+	}
+	// There are no legacy asymmetric signatures
+	if u.Query().Get("signature_version") != signatureVersion {
+		return keyID, invalidSignature
+	}
+
+	signature, e := hex.DecodeString(u.Query().Get("signature"))
+	if e != nil {
+		return keyID, invalidSignature
+	}
+	nonce := u.Query().Get("nonce")
+	if !unambiguous(u, nonce) {
+		return keyID, invalidSignature
+	}
+	if !signatureValidWithPublicKey(publicKey, messageFor(u.Path, time.Unix(expires, 0), ConstraintsFrom(u), nonce), signature) {
+		return keyID, invalidSignature
+	}
+	return keyID, consumeNonce(signer.NonceStore, nonce, time.Unix(expires, 0))
+}
+
+// SigningKeysStatus lists the IDs of all keys along with their status. It never includes key material.
+func (signer *AsymmetricPathSignerValidator) SigningKeysStatus() SigningKeysStatus {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	keyIDs := make([]string, 0, len(signer.PublicKeys))
+	for keyID := range signer.PublicKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	return SigningKeysStatus{
+		ActiveKeyID: signer.ActiveKeyID,
+		Keys:        keyStatuses(keyIDs, signer.ActiveKeyID, signer.KeysNotAfter, signer.Clock.Now()),
+	}
+}
+
+func signatureWithPrivateKey(privateKey crypto.Signer, message []byte) ([]byte, error) {
+	if _, isEd25519 := privateKey.Public().(ed25519.PublicKey); isEd25519 {
+		return privateKey.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(message)
+	return privateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func signatureValidWithPublicKey(publicKey crypto.PublicKey, message []byte, signature []byte) bool {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, signature)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	default:
+		return false
+	}
+}
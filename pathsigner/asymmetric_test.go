@@ -0,0 +1,136 @@
+package pathsigner_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	. "github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AsymmetricPathSignerValidator", func() {
+	var (
+		mockClock  *clock.Mock
+		ed25519Key ed25519.PrivateKey
+		ecdsaKey   *ecdsa.PrivateKey
+		signer     *AsymmetricPathSignerValidator
+	)
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		var e error
+		_, ed25519Key, e = ed25519.GenerateKey(rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+		ecdsaKey, e = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+
+		signer = ValidateAsymmetric(&AsymmetricPathSignerValidator{
+			Clock:       mockClock,
+			PrivateKeys: map[string]crypto.Signer{"ed": ed25519Key, "ec": ecdsaKey},
+			ActiveKeyID: "ed",
+		})
+	})
+
+	It("signs and validates URLs with Ed25519 keys", func() {
+		signedPath := signer.Sign("/some/path", mockClock.Now().Add(time.Hour))
+
+		Expect(signedPath).To(ContainSubstring("AccessKeyId=ed"))
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+	})
+
+	It("signs and validates URLs with ECDSA keys", func() {
+		Expect(signer.SetKeys(signer.PrivateKeys, nil, nil, "ec")).To(Succeed())
+
+		signedPath := signer.SignWithConstraints("/some/path", mockClock.Now().Add(time.Hour), Constraints{Method: "PUT", MaxContentLength: 10})
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+	})
+
+	It("validates URLs with public keys only", func() {
+		signedPath := signer.Sign("/some/path", mockClock.Now().Add(time.Hour))
+
+		verifier := ValidateAsymmetric(&AsymmetricPathSignerValidator{
+			Clock:      mockClock,
+			PublicKeys: map[string]crypto.PublicKey{"ed": ed25519Key.Public()},
+		})
+
+		Expect(verifier.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+		Expect(verifier.CanSign()).To(BeFalse())
+		Expect(func() { verifier.Sign("/some/path", mockClock.Now().Add(time.Hour)) }).To(Panic())
+		Expect(signer.CanSign()).To(BeTrue())
+	})
+
+	It("rejects tampered URLs", func() {
+		signedPath := signer.SignWithConstraints("/some/path", mockClock.Now().Add(time.Hour), Constraints{Method: "GET"})
+
+		Expect(signer.SignatureValid(httputil.MustParse(strings.Replace(signedPath, "/some/path", "/other/path", 1)))).To(BeFalse())
+		Expect(signer.SignatureValid(httputil.MustParse(strings.Replace(signedPath, "method=GET", "method=PUT", 1)))).To(BeFalse())
+	})
+
+	It("will not allow to move the tenant into another field", func() {
+		signedPath := signer.SignWithConstraints("/some/path", mockClock.Now().Add(time.Hour), Constraints{Tenant: "org-1"})
+
+		Expect(signer.SignatureValid(httputil.MustParse(strings.Replace(signedPath, "&tenant=org-1", "&nonce=%0Aorg-1", 1)))).To(BeFalse())
+	})
+
+	It("rejects URLs signed with unknown keys", func() {
+		otherSigner := ValidateAsymmetric(&AsymmetricPathSignerValidator{
+			Clock:       mockClock,
+			PrivateKeys: map[string]crypto.Signer{"other": ecdsaKey},
+			ActiveKeyID: "other",
+		})
+
+		Expect(signer.SignatureValid(httputil.MustParse(otherSigner.Sign("/some/path", mockClock.Now().Add(time.Hour))))).To(BeFalse())
+	})
+
+	It("rejects URLs signed with the right key ID, but a different key", func() {
+		Expect(signer.SetKeys(map[string]crypto.Signer{"ed": ecdsaKey}, nil, nil, "ed")).To(Succeed())
+		signedPath := signer.Sign("/some/path", mockClock.Now().Add(time.Hour))
+		Expect(signer.SetKeys(map[string]crypto.Signer{"ed": ed25519Key}, nil, nil, "ed")).To(Succeed())
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+	})
+
+	It("rejects expired URLs and URLs signed with retired keys", func() {
+		signedPath := signer.Sign("/some/path", mockClock.Now().Add(time.Hour))
+		Expect(signer.SetKeys(signer.PrivateKeys, nil, map[string]time.Time{"ed": mockClock.Now().Add(time.Minute)}, "ec")).To(Succeed())
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+
+		mockClock.Add(2 * time.Minute)
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+
+		signedPath = signer.Sign("/some/path", mockClock.Now().Add(time.Minute))
+		mockClock.Add(2 * time.Minute)
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+	})
+
+	It("rejects keys on curves other than P-256", func() {
+		p384Key, e := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+
+		Expect(signer.SetKeys(map[string]crypto.Signer{"p384": p384Key}, nil, nil, "p384")).To(MatchError(ContainSubstring("P-256")))
+	})
+
+	It("rejects an active key ID which does not refer to a private key", func() {
+		Expect(signer.SetKeys(nil, map[string]crypto.PublicKey{"ed": ed25519Key.Public()}, nil, "ed")).To(HaveOccurred())
+	})
+
+	It("lists key IDs only", func() {
+		Expect(signer.SigningKeysStatus()).To(Equal(SigningKeysStatus{
+			ActiveKeyID: "ed",
+			Keys: []KeyStatus{
+				{KeyID: "ec", Status: ValidKey},
+				{KeyID: "ed", Status: ActiveKey},
+			},
+		}))
+	})
+})
@@ -0,0 +1,94 @@
+package pathsigner
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// NonceStore remembers the nonces of single-use signed URLs which have already been used.
+type NonceStore interface {
+	// Consume records nonce as used until expires. It returns false if nonce has been used before.
+	Consume(nonce string, expires time.Time) bool
+}
+
+// InMemoryNonceStore keeps at most maxSize nonces. Expired nonces are dropped first. When the store
+// is still full, the nonce which expires first gets evicted, which means a replay of that URL would go unnoticed.
+type InMemoryNonceStore struct {
+	clock   clock.Clock
+	maxSize int
+
+	mutex  sync.Mutex
+	nonces map[string]bool
+	// ordered by expiry, so that expired nonces are dropped no matter in which order they were consumed
+	byExpiry nonceHeap
+	sequence uint64
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+	// breaks ties between nonces with the same expiry, so that the oldest of them gets evicted first
+	sequence uint64
+}
+
+func NewInMemoryNonceStore(clock clock.Clock, maxSize int) *InMemoryNonceStore {
+	return &InMemoryNonceStore{
+		clock:   clock,
+		maxSize: maxSize,
+		nonces:  make(map[string]bool),
+	}
+}
+
+func (store *InMemoryNonceStore) Consume(nonce string, expires time.Time) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.removeExpired()
+	if store.nonces[nonce] {
+		return false
+	}
+	for len(store.byExpiry) >= store.maxSize && len(store.byExpiry) > 0 {
+		store.removeFirst()
+	}
+	store.sequence++
+	heap.Push(&store.byExpiry, &nonceEntry{nonce, expires, store.sequence})
+	store.nonces[nonce] = true
+	return true
+}
+
+func (store *InMemoryNonceStore) removeExpired() {
+	now := store.clock.Now()
+	for len(store.byExpiry) > 0 && now.After(store.byExpiry[0].expires) {
+		store.removeFirst()
+	}
+}
+
+func (store *InMemoryNonceStore) removeFirst() {
+	delete(store.nonces, heap.Pop(&store.byExpiry).(*nonceEntry).nonce)
+}
+
+type nonceHeap []*nonceEntry
+
+func (h nonceHeap) Len() int { return len(h) }
+
+func (h nonceHeap) Less(i, j int) bool {
+	if h[i].expires.Equal(h[j].expires) {
+		return h[i].sequence < h[j].sequence
+	}
+	return h[i].expires.Before(h[j].expires)
+}
+
+func (h nonceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *nonceHeap) Push(x interface{}) { *h = append(*h, x.(*nonceEntry)) }
+
+func (h *nonceHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,62 @@
+package pathsigner_test
+
+import (
+	"time"
+
+	"github.com/benbjohnson/clock"
+	. "github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InMemoryNonceStore", func() {
+	var (
+		mockClock *clock.Mock
+		store     *InMemoryNonceStore
+	)
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		store = NewInMemoryNonceStore(mockClock, 2)
+	})
+
+	It("consumes a nonce only once", func() {
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeTrue())
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeFalse())
+	})
+
+	It("forgets nonces once they have expired", func() {
+		Expect(store.Consume("a", mockClock.Now().Add(time.Minute))).To(BeTrue())
+
+		mockClock.Add(2 * time.Minute)
+
+		Expect(store.Consume("a", mockClock.Now().Add(time.Minute))).To(BeTrue())
+	})
+
+	It("forgets expired nonces even when they were consumed after nonces which expire later", func() {
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeTrue())
+		Expect(store.Consume("b", mockClock.Now().Add(time.Minute))).To(BeTrue())
+
+		mockClock.Add(2 * time.Minute)
+
+		Expect(store.Consume("c", mockClock.Now().Add(time.Hour))).To(BeTrue())
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeFalse())
+	})
+
+	It("evicts the nonce which expires first when full", func() {
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeTrue())
+		Expect(store.Consume("b", mockClock.Now().Add(time.Minute))).To(BeTrue())
+		Expect(store.Consume("c", mockClock.Now().Add(time.Hour))).To(BeTrue())
+
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeFalse())
+	})
+
+	It("evicts the oldest nonce when full", func() {
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeTrue())
+		Expect(store.Consume("b", mockClock.Now().Add(time.Hour))).To(BeTrue())
+		Expect(store.Consume("c", mockClock.Now().Add(time.Hour))).To(BeTrue())
+
+		Expect(store.Consume("b", mockClock.Now().Add(time.Hour))).To(BeFalse())
+		Expect(store.Consume("a", mockClock.Now().Add(time.Hour))).To(BeTrue())
+	})
+})
@@ -2,31 +2,100 @@ package pathsigner
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 )
 
+// signatureVersion marks signatures which also cover the Constraints of a signed URL.
+// Signatures without it are legacy signatures, which only cover path and expiry.
+const signatureVersion = "3"
+
 type PathSigner interface {
 	Sign(path string, expires time.Time) string
+	SignWithConstraints(path string, expires time.Time, constraints Constraints) string
 }
 
 type PathSignatureValidator interface {
 	SignatureValid(u *url.URL) bool
 }
 
+// Constraints restrict how a signed URL can be used. Zero values mean no restriction.
+type Constraints struct {
+	Method           string
+	MaxContentLength int64
+	ContentType      string
+	// Organization or space uploads are accounted to for quotas
+	Tenant string
+}
+
+// ConstraintsFrom returns the Constraints encoded in u. They can only be trusted once the signature of u has been validated.
+func ConstraintsFrom(u *url.URL) Constraints {
+	maxContentLength, e := strconv.ParseInt(u.Query().Get("max_content_length"), 10, 64)
+	if e != nil {
+		maxContentLength = 0
+	}
+	return Constraints{
+		Method:           u.Query().Get("method"),
+		MaxContentLength: maxContentLength,
+		ContentType:      u.Query().Get("content_type"),
+		Tenant:           u.Query().Get("tenant"),
+	}
+}
+
+// AllowsMethod reports whether method may be used with the signed URL. A URL signed for GET may also be used for HEAD.
+func (constraints Constraints) AllowsMethod(method string) bool {
+	if constraints.Method == "" || strings.EqualFold(constraints.Method, method) {
+		return true
+	}
+	return strings.EqualFold(constraints.Method, http.MethodGet) && method == http.MethodHead
+}
+
+func (constraints Constraints) queryString() string {
+	result := "&signature_version=" + signatureVersion
+	if constraints.Method != "" {
+		result += "&method=" + url.QueryEscape(constraints.Method)
+	}
+	if constraints.MaxContentLength > 0 {
+		result += fmt.Sprintf("&max_content_length=%v", constraints.MaxContentLength)
+	}
+	if constraints.ContentType != "" {
+		result += "&content_type=" + url.QueryEscape(constraints.ContentType)
+	}
+	if constraints.Tenant != "" {
+		result += "&tenant=" + url.QueryEscape(constraints.Tenant)
+	}
+	return result
+}
+
 type PathSignerValidator struct {
 	Secret      string
 	Clock       clock.Clock
 	SigningKeys map[string]string
 	ActiveKeyID string
+	// KeysNotAfter optionally limits how long a signing key is accepted. Keys without entry never expire.
+	KeysNotAfter map[string]time.Time
+	// AcceptLegacySignatures allows signatures which do not cover any Constraints. Only meant for migrating existing deployments.
+	AcceptLegacySignatures bool
+	// NonceStore makes signed URLs single-use: every signed URL gets a nonce, which is consumed on validation.
+	NonceStore NonceStore
+	// Metrics optionally counts validations per key ID and result.
+	Metrics ValidationMetrics
+
+	// guards the signing keys, which can be replaced at runtime via SetSigningKeys
+	mutex sync.RWMutex
 }
 
 func Validate(signer *PathSignerValidator) *PathSignerValidator {
@@ -40,43 +109,153 @@ func Validate(signer *PathSignerValidator) *PathSignerValidator {
 }
 
 func (signer *PathSignerValidator) Sign(path string, expires time.Time) string {
+	return signer.SignWithConstraints(path, expires, Constraints{})
+}
+
+func (signer *PathSignerValidator) SignWithConstraints(path string, expires time.Time, constraints Constraints) string {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	nonce, nonceQuery := nonceFor(signer.NonceStore)
 	if len(signer.SigningKeys) > 0 {
-		return fmt.Sprintf("%s?signature=%x&expires=%v&AccessKeyId=%v", path, signatureWithHMACFor(path, signer.SigningKeys[signer.ActiveKeyID], expires), expires.Unix(), signer.ActiveKeyID)
+		return fmt.Sprintf("%s?signature=%x&expires=%v&AccessKeyId=%v%s%s", path, signatureWithHMACFor(path, signer.SigningKeys[signer.ActiveKeyID], expires, constraints, nonce), expires.Unix(), signer.ActiveKeyID, constraints.queryString(), nonceQuery)
 	}
-	return fmt.Sprintf("%s?signature=%x&expires=%v", path, signatureWithHMACFor(path, signer.Secret, expires), expires.Unix())
+	return fmt.Sprintf("%s?signature=%x&expires=%v%s%s", path, signatureWithHMACFor(path, signer.Secret, expires, constraints, nonce), expires.Unix(), constraints.queryString(), nonceQuery)
 }
 
 func (signer *PathSignerValidator) SignatureValid(u *url.URL) bool {
+	keyID, result := signer.validate(u)
+	sendValidationMetric(signer.Metrics, keyID, result)
+	return result == validSignature
+}
+
+func (signer *PathSignerValidator) validate(u *url.URL) (keyID string, result string) {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	keyID = u.Query().Get("AccessKeyId")
+	if keyID == "" {
+		keyID = secretKeyID
+	}
+
 	expires, e := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
 	if e != nil {
-		return false
+		return keyID, invalidSignature
 	}
 	if signer.Clock.Now().After(time.Unix(expires, 0)) {
-		return false
+		return keyID, expiredURL
 	}
 
 	querySignature, e := hex.DecodeString(u.Query().Get("signature"))
 	if e != nil {
-		return false
+		return keyID, invalidSignature
 	}
 
-	accessKeyID := u.Query().Get("AccessKeyId")
-	if accessKeyID != "" {
-		if _, exist := signer.SigningKeys[accessKeyID]; !exist {
-			return false
-		}
-		if subtle.ConstantTimeCompare(querySignature, signatureWithHMACFor(u.Path, signer.SigningKeys[accessKeyID], time.Unix(expires, 0))) == 0 {
-			return false
+	var secret string
+	if keyID == secretKeyID {
+		// Once signing keys are configured, the deprecated secret is no longer accepted
+		if len(signer.SigningKeys) > 0 {
+			return keyID, retiredKey
 		}
+		secret = signer.Secret
 	} else {
-		if subtle.ConstantTimeCompare(querySignature, signatureWithHMACFor(u.Path, signer.Secret, time.Unix(expires, 0))) == 0 {
+		var exist bool
+		secret, exist = signer.SigningKeys[keyID]
+		if !exist {
+			// not using the ID from the URL as tag, to keep the number of distinct tag values bounded
+			return unknownKeyID, unknownKey
+		}
+		if signer.keyExpired(keyID) {
+			return keyID, retiredKey
+		}
+	}
+
+	nonce := u.Query().Get("nonce")
+	var expectedSignature []byte
+	switch u.Query().Get("signature_version") {
+	case signatureVersion:
+		if !unambiguous(u, nonce) {
+			return keyID, invalidSignature
+		}
+		expectedSignature = signatureWithHMACFor(u.Path, secret, time.Unix(expires, 0), ConstraintsFrom(u), nonce)
+	case "":
+		if !signer.AcceptLegacySignatures {
+			return keyID, legacySignature
+		}
+		expectedSignature = legacySignatureWithHMACFor(u.Path, secret, time.Unix(expires, 0))
+	default:
+		return keyID, invalidSignature
+	}
+	if subtle.ConstantTimeCompare(querySignature, expectedSignature) == 0 {
+		return keyID, invalidSignature
+	}
+
+	return keyID, consumeNonce(signer.NonceStore, nonce, time.Unix(expires, 0))
+}
+
+func nonceFor(nonceStore NonceStore) (nonce string, nonceQuery string) {
+	if nonceStore == nil {
+		return "", ""
+	}
+	nonceBytes := make([]byte, 16)
+	_, e := rand.Read(nonceBytes)
+	util.PanicOnError(e)
+	nonce = hex.EncodeToString(nonceBytes)
+	return nonce, "&nonce=" + nonce
+}
+
+func consumeNonce(nonceStore NonceStore, nonce string, expires time.Time) (result string) {
+	if nonceStore == nil {
+		return validSignature
+	}
+	if nonce == "" {
+		return invalidSignature
+	}
+	if !nonceStore.Consume(nonce, expires) {
+		return replayedURL
+	}
+	return validSignature
+}
+
+func sendValidationMetric(metrics ValidationMetrics, keyID string, result string) {
+	if metrics != nil {
+		metrics.SendCounterMetricWithTags("signature-validations", 1, map[string]string{"key_id": keyID, "result": result})
+	}
+}
+
+func signatureWithHMACFor(path string, secret string, expires time.Time, constraints Constraints, nonce string) []byte {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write(messageFor(path, expires, constraints, nonce))
+	return hash.Sum(nil)
+}
+
+// messageFor is what gets signed: everything a signed URL is bound to. Every field is always present, and validation
+// rejects fields containing the separator, so that no part of one field can be moved into another.
+func messageFor(path string, expires time.Time, constraints Constraints, nonce string) []byte {
+	return []byte(strings.Join([]string{
+		"v" + signatureVersion,
+		strconv.FormatInt(expires.Unix(), 10),
+		path,
+		strings.ToUpper(constraints.Method),
+		strconv.FormatInt(constraints.MaxContentLength, 10),
+		constraints.ContentType,
+		nonce,
+		constraints.Tenant,
+	}, "\n"))
+}
+
+// unambiguous reports whether none of the fields messageFor signs for u contains its separator.
+func unambiguous(u *url.URL, nonce string) bool {
+	constraints := ConstraintsFrom(u)
+	for _, field := range []string{u.Path, constraints.Method, constraints.ContentType, nonce, constraints.Tenant} {
+		if strings.Contains(field, "\n") {
 			return false
 		}
 	}
 	return true
 }
 
-func signatureWithHMACFor(path string, secret string, expires time.Time) []byte {
+func legacySignatureWithHMACFor(path string, secret string, expires time.Time) []byte {
 	hash := hmac.New(sha256.New, []byte(secret))
 	hash.Write([]byte(fmt.Sprintf("%v%v %v", expires.Unix(), path, secret)))
 	return hash.Sum(nil)
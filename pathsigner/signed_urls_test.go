@@ -1,6 +1,9 @@
 package pathsigner_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"testing"
 	"time"
@@ -110,4 +113,135 @@ var _ = Describe("PathSigner", func() {
 
 	})
 
+	Context("Constraints", func() {
+		BeforeEach(func() {
+			signer = pathsigner.Validate(&PathSignerValidator{Secret: "thesecret", Clock: clock})
+		})
+
+		It("encodes the constraints into the signed URL", func() {
+			signedPath := signer.SignWithConstraints("/some/path", time.Unix(200, 0), Constraints{Method: "PUT", MaxContentLength: 1024, ContentType: "application/zip", Tenant: "some-space"})
+
+			u := httputil.MustParse(signedPath)
+			Expect(signer.SignatureValid(u)).To(BeTrue())
+			Expect(ConstraintsFrom(u)).To(Equal(Constraints{Method: "PUT", MaxContentLength: 1024, ContentType: "application/zip", Tenant: "some-space"}))
+		})
+
+		It("will not allow to tamper with the constraints", func() {
+			signedPath := signer.SignWithConstraints("/some/path", time.Unix(200, 0), Constraints{Method: "GET", MaxContentLength: 1024})
+
+			for param, value := range map[string]string{"method": "PUT", "max_content_length": "2048", "content_type": "text/plain", "tenant": "other-space"} {
+				u := httputil.MustParse(signedPath)
+				q := u.Query()
+				q.Set(param, value)
+				u.RawQuery = q.Encode()
+
+				Expect(signer.SignatureValid(u)).To(BeFalse(), param)
+			}
+		})
+
+		It("will not allow to move the tenant into another field", func() {
+			signedPath := signer.SignWithConstraints("/some/path", time.Unix(200, 0), Constraints{Method: "PUT", Tenant: "org-1"})
+
+			u := httputil.MustParse(signedPath)
+			q := u.Query()
+			q.Del("tenant")
+			q.Set("nonce", "\norg-1")
+			u.RawQuery = q.Encode()
+
+			Expect(signer.SignatureValid(u)).To(BeFalse())
+		})
+
+		It("will not allow to strip the signature version", func() {
+			signedPath := signer.SignWithConstraints("/some/path", time.Unix(200, 0), Constraints{Method: "GET"})
+
+			u := httputil.MustParse(signedPath)
+			q := u.Query()
+			q.Del("signature_version")
+			q.Del("method")
+			u.RawQuery = q.Encode()
+
+			Expect(signer.SignatureValid(u)).To(BeFalse())
+		})
+
+		It("allows HEAD requests for URLs signed for GET", func() {
+			Expect(Constraints{Method: "GET"}.AllowsMethod("HEAD")).To(BeTrue())
+			Expect(Constraints{Method: "GET"}.AllowsMethod("PUT")).To(BeFalse())
+			Expect(Constraints{}.AllowsMethod("DELETE")).To(BeTrue())
+		})
+	})
+
+	Context("Single use", func() {
+		BeforeEach(func() {
+			signer = pathsigner.Validate(&PathSignerValidator{Secret: "thesecret", Clock: clock, NonceStore: NewInMemoryNonceStore(clock, 10)})
+		})
+
+		It("validates a signed URL only once", func() {
+			signedPath := signer.Sign("/some/path", time.Unix(200, 0))
+
+			Expect(signedPath).To(ContainSubstring("nonce="))
+			Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+			Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+		})
+
+		It("signs the same path with different nonces", func() {
+			first := signer.Sign("/some/path", time.Unix(200, 0))
+			second := signer.Sign("/some/path", time.Unix(200, 0))
+
+			Expect(first).NotTo(Equal(second))
+			Expect(signer.SignatureValid(httputil.MustParse(first))).To(BeTrue())
+			Expect(signer.SignatureValid(httputil.MustParse(second))).To(BeTrue())
+		})
+
+		It("will not allow to tamper with the nonce", func() {
+			u := httputil.MustParse(signer.Sign("/some/path", time.Unix(200, 0)))
+			q := u.Query()
+			q.Set("nonce", "0123456789abcdef")
+			u.RawQuery = q.Encode()
+
+			Expect(signer.SignatureValid(u)).To(BeFalse())
+		})
+
+		It("will not allow to move the tenant into the nonce", func() {
+			u := httputil.MustParse(signer.SignWithConstraints("/some/path", time.Unix(200, 0), Constraints{Tenant: "org-1"}))
+			q := u.Query()
+			q.Set("nonce", q.Get("nonce")+"\n"+q.Get("tenant"))
+			q.Del("tenant")
+			u.RawQuery = q.Encode()
+
+			Expect(signer.SignatureValid(u)).To(BeFalse())
+		})
+
+		It("rejects URLs without nonce", func() {
+			withoutNonce := pathsigner.Validate(&PathSignerValidator{Secret: "thesecret", Clock: clock}).Sign("/some/path", time.Unix(200, 0))
+
+			Expect(signer.SignatureValid(httputil.MustParse(withoutNonce))).To(BeFalse())
+		})
+	})
+
+	Context("Legacy signatures", func() {
+		var legacySignedPath string
+
+		BeforeEach(func() {
+			// computed with the signature scheme that only covers path and expiry
+			legacySignedPath = "/some/path?signature=" + legacySignature("/some/path", "thesecret", 200) + "&expires=200"
+		})
+
+		It("rejects them by default", func() {
+			signer = pathsigner.Validate(&PathSignerValidator{Secret: "thesecret", Clock: clock})
+
+			Expect(signer.SignatureValid(httputil.MustParse(legacySignedPath))).To(BeFalse())
+		})
+
+		It("accepts them when AcceptLegacySignatures is set", func() {
+			signer = pathsigner.Validate(&PathSignerValidator{Secret: "thesecret", Clock: clock, AcceptLegacySignatures: true})
+
+			Expect(signer.SignatureValid(httputil.MustParse(legacySignedPath))).To(BeTrue())
+		})
+	})
 })
+
+func legacySignature(path string, secret string, expires int64) string {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(fmt.Sprintf("%v%v %v", expires, path, secret)))
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,118 @@
+package pathsigner
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Results of signature validations, as reported via ValidationMetrics
+const (
+	validSignature   = "valid"
+	invalidSignature = "invalid_signature"
+	expiredURL       = "expired_url"
+	unknownKey       = "unknown_key"
+	retiredKey       = "retired_key"
+	legacySignature  = "legacy_signature"
+	replayedURL      = "replayed"
+)
+
+const (
+	// secretKeyID is used in metrics for signatures created with the deprecated Secret
+	secretKeyID  = "secret"
+	unknownKeyID = "unknown"
+)
+
+// Key statuses as reported by SigningKeysStatus
+const (
+	ActiveKey  = "active"
+	ValidKey   = "valid"
+	ExpiredKey = "expired"
+)
+
+type ValidationMetrics interface {
+	SendCounterMetricWithTags(name string, value int64, tags map[string]string)
+}
+
+type KeyStatus struct {
+	KeyID    string     `json:"key_id"`
+	Status   string     `json:"status"`
+	NotAfter *time.Time `json:"not_after,omitempty"`
+}
+
+type SigningKeysStatus struct {
+	ActiveKeyID string      `json:"active_key_id,omitempty"`
+	Keys        []KeyStatus `json:"keys"`
+	// SecretAccepted tells whether signatures created with the deprecated single secret are still accepted
+	SecretAccepted bool `json:"secret_accepted"`
+}
+
+// SetSigningKeys replaces the signing keys at runtime. URLs signed with keys which are no longer
+// present are rejected from then on.
+func (signer *PathSignerValidator) SetSigningKeys(signingKeys map[string]string, keysNotAfter map[string]time.Time, activeKeyID string) error {
+	if len(signingKeys) == 0 && signer.Secret == "" {
+		return errors.New("must provide at least one signing key")
+	}
+	if len(signingKeys) > 0 {
+		if _, exist := signingKeys[activeKeyID]; !exist {
+			return errors.New("active key ID \"" + activeKeyID + "\" does not refer to a signing key")
+		}
+		if notAfter, exist := keysNotAfter[activeKeyID]; exist && signer.Clock.Now().After(notAfter) {
+			return errors.New("active key \"" + activeKeyID + "\" has expired")
+		}
+	}
+
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	signer.SigningKeys = signingKeys
+	signer.KeysNotAfter = keysNotAfter
+	signer.ActiveKeyID = activeKeyID
+	return nil
+}
+
+// SigningKeysStatus lists the IDs of all signing keys along with their status. It never includes the secrets.
+func (signer *PathSignerValidator) SigningKeysStatus() SigningKeysStatus {
+	signer.mutex.RLock()
+	defer signer.mutex.RUnlock()
+
+	keyIDs := make([]string, 0, len(signer.SigningKeys))
+	for keyID := range signer.SigningKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	status := SigningKeysStatus{
+		Keys:           keyStatuses(keyIDs, signer.ActiveKeyID, signer.KeysNotAfter, signer.Clock.Now()),
+		SecretAccepted: len(signer.SigningKeys) == 0,
+	}
+	if len(signer.SigningKeys) > 0 {
+		status.ActiveKeyID = signer.ActiveKeyID
+	}
+	return status
+}
+
+func keyStatuses(keyIDs []string, activeKeyID string, keysNotAfter map[string]time.Time, now time.Time) []KeyStatus {
+	result := []KeyStatus{}
+	for _, keyID := range keyIDs {
+		keyStatus := KeyStatus{KeyID: keyID, Status: ValidKey}
+		if notAfter, exist := keysNotAfter[keyID]; exist {
+			keyStatus.NotAfter = &notAfter
+		}
+		switch {
+		case keyExpired(keysNotAfter, keyID, now):
+			keyStatus.Status = ExpiredKey
+		case keyID == activeKeyID:
+			keyStatus.Status = ActiveKey
+		}
+		result = append(result, keyStatus)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].KeyID < result[j].KeyID })
+	return result
+}
+
+func (signer *PathSignerValidator) keyExpired(keyID string) bool {
+	return keyExpired(signer.KeysNotAfter, keyID, signer.Clock.Now())
+}
+
+func keyExpired(keysNotAfter map[string]time.Time, keyID string, now time.Time) bool {
+	notAfter, exist := keysNotAfter[keyID]
+	return exist && now.After(notAfter)
+}
@@ -0,0 +1,104 @@
+package pathsigner_test
+
+import (
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	. "github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingMetrics struct {
+	tags []map[string]string
+}
+
+func (metrics *recordingMetrics) SendCounterMetricWithTags(name string, value int64, tags map[string]string) {
+	metrics.tags = append(metrics.tags, tags)
+}
+
+var _ = Describe("Signing key lifecycle", func() {
+	var (
+		mockClock *clock.Mock
+		metrics   *recordingMetrics
+		signer    *PathSignerValidator
+	)
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		metrics = &recordingMetrics{}
+		signer = Validate(&PathSignerValidator{
+			Secret:       "thesecret",
+			Clock:        mockClock,
+			SigningKeys:  map[string]string{"old": "oldsecret", "new": "newsecret"},
+			ActiveKeyID:  "old",
+			KeysNotAfter: map[string]time.Time{"old": mockClock.Now().Add(time.Hour)},
+			Metrics:      metrics,
+		})
+	})
+
+	It("rejects URLs signed with a key after its not_after date", func() {
+		signedPath := signer.Sign("/some/path", mockClock.Now().Add(3*time.Hour))
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+
+		mockClock.Add(2 * time.Hour)
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+		Expect(metrics.tags).To(Equal([]map[string]string{
+			{"key_id": "old", "result": "valid"},
+			{"key_id": "old", "result": "retired_key"},
+		}))
+	})
+
+	It("rejects URLs signed with the deprecated secret once signing keys are configured", func() {
+		signedPath := Validate(&PathSignerValidator{Secret: "thesecret", Clock: mockClock}).Sign("/some/path", mockClock.Now().Add(time.Hour))
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+		Expect(metrics.tags).To(Equal([]map[string]string{{"key_id": "secret", "result": "retired_key"}}))
+	})
+
+	It("does not use unknown key IDs as metric tags", func() {
+		u := httputil.MustParse(signer.Sign("/some/path", mockClock.Now().Add(time.Hour)))
+		q := u.Query()
+		q.Set("AccessKeyId", "made-up")
+		u.RawQuery = q.Encode()
+
+		Expect(signer.SignatureValid(u)).To(BeFalse())
+		Expect(metrics.tags).To(Equal([]map[string]string{{"key_id": "unknown", "result": "unknown_key"}}))
+	})
+
+	It("picks up new keys without restart", func() {
+		signedWithOld := signer.Sign("/some/path", mockClock.Now().Add(time.Hour))
+
+		Expect(signer.SetSigningKeys(map[string]string{"new": "newsecret", "newer": "newersecret"}, nil, "newer")).To(Succeed())
+
+		Expect(signer.SignatureValid(httputil.MustParse(signedWithOld))).To(BeFalse())
+		signedWithNewer := signer.Sign("/some/path", mockClock.Now().Add(time.Hour))
+		Expect(signedWithNewer).To(ContainSubstring("AccessKeyId=newer"))
+		Expect(signer.SignatureValid(httputil.MustParse(signedWithNewer))).To(BeTrue())
+	})
+
+	It("refuses to activate a key which does not exist or has expired", func() {
+		Expect(signer.SetSigningKeys(map[string]string{"new": "newsecret"}, nil, "other")).To(MatchError(ContainSubstring("does not refer to a signing key")))
+		Expect(signer.SetSigningKeys(map[string]string{"new": "newsecret"}, map[string]time.Time{"new": mockClock.Now().Add(-time.Minute)}, "new")).To(MatchError(ContainSubstring("has expired")))
+		Expect(signer.SigningKeysStatus().ActiveKeyID).To(Equal("old"))
+	})
+
+	It("reports the status of all keys without their secrets", func() {
+		notAfter := mockClock.Now().Add(time.Hour)
+
+		Expect(signer.SigningKeysStatus()).To(Equal(SigningKeysStatus{
+			ActiveKeyID: "old",
+			Keys: []KeyStatus{
+				{KeyID: "new", Status: ValidKey},
+				{KeyID: "old", Status: ActiveKey, NotAfter: &notAfter},
+			},
+		}))
+
+		mockClock.Add(2 * time.Hour)
+
+		Expect(signer.SigningKeysStatus().Keys[1].Status).To(Equal(ExpiredKey))
+	})
+})
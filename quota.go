@@ -0,0 +1,105 @@
+package bitsgo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// TenantHeader identifies the organization or space which uploads to the private endpoint are accounted to.
+// Uploads via signed URLs are accounted to the tenant the URL was signed for.
+const TenantHeader = "X-Bits-Tenant"
+
+type tenantKey struct{}
+
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant of ctx, or "" for requests which are not accounted to any tenant.
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+type QuotaExceededError struct {
+	error
+	Tenant string
+	// In bytes
+	Quota int64
+	Usage int64
+}
+
+func NewQuotaExceededError(tenant string, quota int64, usage int64, size int64) *QuotaExceededError {
+	return &QuotaExceededError{
+		error:  errors.Errorf("Quota of tenant %v exceeded: using %v of %v bytes, cannot add %v bytes", tenant, usage, quota, size),
+		Tenant: tenant,
+		Quota:  quota,
+		Usage:  usage,
+	}
+}
+
+func IsQuotaExceededError(e error) bool {
+	_, ok := errors.Cause(e).(*QuotaExceededError)
+	return ok
+}
+
+func writeQuotaExceeded(responseWriter http.ResponseWriter, request *http.Request, e *QuotaExceededError) {
+	logger.From(request).Infow("Quota exceeded", "tenant", e.Tenant, "quota", e.Quota, "usage", e.Usage)
+	http.Error(responseWriter, util.DescriptionAndCodeAsJSON(10016, "Quota Exceeded: %v", e.Error()), http.StatusRequestEntityTooLarge)
+}
+
+type QuotaUsage struct {
+	Tenant    string `json:"tenant"`
+	UsedBytes int64  `json:"used_bytes"`
+	// 0 means unlimited
+	QuotaBytes int64 `json:"quota_bytes"`
+	Blobs      int   `json:"blobs"`
+}
+
+type QuotaUsageReporter interface {
+	QuotaUsage(tenant string) QuotaUsage
+	AllQuotaUsage() []QuotaUsage
+	Reconcile() error
+}
+
+// QuotaHandler exposes the storage used by tenants.
+type QuotaHandler struct {
+	reporter QuotaUsageReporter
+}
+
+func NewQuotaHandler(reporter QuotaUsageReporter) *QuotaHandler {
+	return &QuotaHandler{reporter: reporter}
+}
+
+func (handler *QuotaHandler) List(responseWriter http.ResponseWriter, request *http.Request) {
+	writeJSON(responseWriter, handler.reporter.AllQuotaUsage())
+}
+
+func (handler *QuotaHandler) Get(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	writeJSON(responseWriter, handler.reporter.QuotaUsage(params["tenant"]))
+}
+
+func (handler *QuotaHandler) Reconcile(responseWriter http.ResponseWriter, request *http.Request) {
+	audit.From(request).Describe(audit.ReconcileQuotas, "")
+	e := handler.reporter.Reconcile()
+	if e != nil {
+		logger.From(request).Errorw("Could not reconcile quota usage", "error", e)
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		util.FprintDescriptionAsJSON(responseWriter, "Could not reconcile quota usage: %v", e.Error())
+		return
+	}
+	writeJSON(responseWriter, handler.reporter.AllQuotaUsage())
+}
+
+func writeJSON(responseWriter http.ResponseWriter, body interface{}) {
+	response, e := json.Marshal(body)
+	util.PanicOnError(e)
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(response)
+}
@@ -3,6 +3,7 @@ package bitsgo
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
@@ -14,15 +15,19 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
-	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
 	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type StateForbiddenError struct {
@@ -34,27 +39,27 @@ func NewStateForbiddenError() *StateForbiddenError {
 }
 
 type Updater interface {
-	NotifyProcessingUpload(guid string) error
-	NotifyUploadSucceeded(guid string, sha1 string, sha2 string) error
-	NotifyUploadFailed(guid string, e error) error
+	NotifyProcessingUpload(ctx context.Context, guid string) error
+	NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) error
+	NotifyUploadFailed(ctx context.Context, guid string, e error) error
 }
 
 type NullUpdater struct{}
 
-func (u *NullUpdater) NotifyProcessingUpload(guid string) error                          { return nil }
-func (u *NullUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha2 string) error { return nil }
-func (u *NullUpdater) NotifyUploadFailed(guid string, e error) error                     { return nil }
+func (u *NullUpdater) NotifyProcessingUpload(ctx context.Context, guid string) error { return nil }
+func (u *NullUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) error {
+	return nil
+}
+func (u *NullUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) error { return nil }
 
 type ResourceHandler struct {
 	blobstore              Blobstore
 	appStashBlobstore      Blobstore
 	resourceType           string
 	metricsService         MetricsService
-	maxBodySizeLimit       uint64
 	updater                Updater
-	minimumSize            uint64
-	maximumSize            uint64
 	shouldProxyGetRequests bool
+	sizeLimits
 }
 
 type responseBody struct {
@@ -97,18 +102,34 @@ func NewResourceHandlerWithUpdaterAndSizeThresholds(blobstore Blobstore, appStas
 		appStashBlobstore:      appStashBlobstore,
 		resourceType:           resourceType,
 		metricsService:         metricsService,
-		maxBodySizeLimit:       maxBodySizeLimit,
 		updater:                updater,
-		maximumSize:            maximumSize,
-		minimumSize:            minimumSize,
 		shouldProxyGetRequests: shouldProxyGetRequests,
+		sizeLimits: sizeLimits{
+			maxBodySizeLimit: maxBodySizeLimit,
+			minimumSize:      minimumSize,
+			maximumSize:      maximumSize,
+		},
 	}
 }
 
+func (handler *ResourceHandler) startSpan(request *http.Request, name string, identifier string) (*http.Request, trace.Span) {
+	ctx, span := tracing.Tracer().Start(request.Context(), "ResourceHandler."+name, trace.WithAttributes(
+		attribute.String("bits.resource_type", handler.resourceType),
+		attribute.String("bits.identifier", identifier)))
+	return request.WithContext(ctx), span
+}
+
+// blobstoreFor returns the handler's blobstore bound to the request's context, so that
+// blobstore calls become part of the request's trace.
+func (handler *ResourceHandler) blobstoreFor(request *http.Request) Blobstore {
+	return BlobstoreWithContext(request.Context(), handler.blobstore)
+}
+
 // TODO: instead of params, we could use `identifier string` to make the interface more type-safe.
 //       Here and in the other methods.
 func (handler *ResourceHandler) AddOrReplaceWithDigestInHeader(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
+	audit.From(request).Describe(audit.Upload, params["identifier"])
+	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySize()) {
 		return
 	}
 	logger.From(request).Debugw("Octet-Stream")
@@ -132,24 +153,18 @@ func (handler *ResourceHandler) AddOrReplaceWithDigestInHeader(responseWriter ht
 		badRequest(responseWriter, request, "Digest must have format sha256=value. Value cannot be empty")
 		return
 	}
+	audit.From(request).WithChecksums("", value)
 
 	// TODO this can cause an out of memory panic. Should be smart about writing big files to disk instead.
 	content, e := ioutil.ReadAll(request.Body)
 	util.PanicOnError(e)
 
-	e = backoff.RetryNotify(func() error {
-		e := handler.blobstore.Put(params["identifier"]+"/"+value, bytes.NewReader(content))
-		if e != nil {
-			if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
-				return backoff.Permanent(e)
-			}
-			return errors.Wrap(e, "Could not upload bits to blobstore")
-		}
-		return nil
-
-	}, retryPolicy(), func(e error, delay time.Duration) {
-		handler.metricsService.SendCounterMetric("upload"+handler.resourceType, 1)
-	})
+	e = handler.blobstoreFor(request).Put(params["identifier"]+"/"+value, bytes.NewReader(content))
+	switch e.(type) {
+	case nil, *NoSpaceLeftError, *UnavailableError, *QuotaExceededError:
+	default:
+		e = errors.Wrap(e, "Could not upload bits to blobstore")
+	}
 
 	// TODO use Clock instead:
 	writeResponseBasedOn("", e, responseWriter, request, http.StatusCreated, nil, &responseBody{Guid: params["identifier"], State: "READY", Type: "bits", CreatedAt: time.Now()}, "")
@@ -158,7 +173,11 @@ func (handler *ResourceHandler) AddOrReplaceWithDigestInHeader(responseWriter ht
 // TODO: instead of params, we could use `identifier string` to make the interface more type-safe.
 //       Here and in the other methods.
 func (handler *ResourceHandler) AddOrReplace(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
+	request, span := handler.startSpan(request, "AddOrReplace", params["identifier"])
+	defer span.End()
+	audit.From(request).Describe(audit.Upload, params["identifier"])
+
+	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySize()) {
 		return
 	}
 	file, fileInfo, e := request.FormFile(handler.resourceType)
@@ -176,7 +195,7 @@ func (handler *ResourceHandler) AddOrReplace(responseWriter http.ResponseWriter,
 	// TODO: this if-block maybe not be necessary at all.
 	//       The reason it's necessary right now is that we need zip handling only for packages. We treat other resources opaque.
 	if handler.resourceType == "package" {
-		tempFilename, e = handler.completePackageWithResources(request.FormValue("resources"), file, fileInfo.Size, logger.From(request))
+		tempFilename, e = handler.completePackageWithResources(request.Context(), request.FormValue("resources"), file, fileInfo.Size, logger.From(request))
 		switch e.(type) {
 		case *inputError:
 			logger.From(request).Infow(e.Error())
@@ -196,8 +215,9 @@ func (handler *ResourceHandler) AddOrReplace(responseWriter http.ResponseWriter,
 
 	sha1, sha256, e := ShaSums(tempFilename)
 	util.PanicOnError(e)
+	audit.From(request).WithChecksums(hex.EncodeToString(sha1), hex.EncodeToString(sha256))
 
-	e = handler.updater.NotifyProcessingUpload(params["identifier"])
+	e = handler.updater.NotifyProcessingUpload(request.Context(), params["identifier"])
 	if handleNotificationError(e, responseWriter, request) {
 		return
 	}
@@ -234,7 +254,7 @@ type inputError struct {
 }
 
 // returns inputError or NoSpaceLeftError in case of error
-func (handler *ResourceHandler) completePackageWithResources(resources string, file multipart.File, fileSize int64, logger *zap.SugaredLogger) (tempfileName string, err error) {
+func (handler *ResourceHandler) completePackageWithResources(ctx context.Context, resources string, file multipart.File, fileSize int64, logger *zap.SugaredLogger) (tempfileName string, err error) {
 	var bundlesPayload []Fingerprint
 	if resources != "" {
 		e := json.Unmarshal([]byte(resources), &bundlesPayload)
@@ -251,7 +271,8 @@ func (handler *ResourceHandler) completePackageWithResources(resources string, f
 	}
 	util.PanicOnError(e)
 
-	tempFilename, e := CreateTempZipFileFrom(bundlesPayload, zipReader, handler.minimumSize, handler.maximumSize, handler.appStashBlobstore, handler.metricsService, logger)
+	minimumSize, maximumSize := handler.sizeThresholds()
+	tempFilename, e := CreateTempZipFileFrom(ctx, bundlesPayload, zipReader, minimumSize, maximumSize, handler.appStashBlobstore, handler.metricsService, logger)
 	if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
 		return "", e
 	}
@@ -279,34 +300,33 @@ func CreateTempFileWithContent(reader io.Reader) (string, error) {
 
 func (handler *ResourceHandler) uploadResource(tempFilename string, request *http.Request, identifier string, async bool, sha1Sum []byte, sha256Sum []byte) error {
 	defer os.Remove(tempFilename)
-	e := backoff.RetryNotify(func() error {
-		tempFile, e := os.Open(tempFilename)
-		if e != nil {
-			return backoff.Permanent(errors.Wrapf(e, "Could not open temporary file '%v'", tempFilename))
-		}
+	ctx, span := tracing.Tracer().Start(request.Context(), "ResourceHandler.uploadResource",
+		trace.WithAttributes(attribute.String("bits.identifier", identifier), attribute.Bool("bits.async", async)))
+	defer span.End()
+
+	tempFile, e := os.Open(tempFilename)
+	if e != nil {
+		e = errors.Wrapf(e, "Could not open temporary file '%v'", tempFilename)
+	} else {
 		defer tempFile.Close()
 
 		logger.From(request).Debugw("Starting upload to blobstore", "identifier", identifier)
-		e = handler.blobstore.Put(identifier, tempFile)
+		e = BlobstoreWithContext(ctx, handler.blobstore).Put(identifier, tempFile)
 		logger.From(request).Debugw("Completed upload to blobstore", "identifier", identifier)
 
-		if e != nil {
-			if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
-				return backoff.Permanent(e)
-			}
-
-			return errors.Wrapf(e, "Could not upload temporary file to blobstore %v", tempFilename)
+		switch e.(type) {
+		case nil, *NoSpaceLeftError, *UnavailableError, *QuotaExceededError:
+		default:
+			e = errors.Wrapf(e, "Could not upload temporary file to blobstore %v", tempFilename)
 		}
-		return nil
-	}, retryPolicy(), func(e error, delay time.Duration) {
-		handler.metricsService.SendCounterMetric("upload"+handler.resourceType, 1)
-	})
+	}
 
 	if e != nil {
-		handler.notifyUploadFailed(identifier, e, request)
+		tracing.RecordError(span, e)
+		handler.notifyUploadFailed(ctx, identifier, e, request)
 		return handle(e, async, request)
 	}
-	e = handler.updater.NotifyUploadSucceeded(identifier, hex.EncodeToString(sha1Sum), hex.EncodeToString(sha256Sum))
+	e = handler.updater.NotifyUploadSucceeded(ctx, identifier, hex.EncodeToString(sha1Sum), hex.EncodeToString(sha256Sum))
 	if IsNotFoundError(e) {
 		return e
 	}
@@ -324,14 +344,8 @@ func handle(e error, async bool, request *http.Request) error {
 	return e
 }
 
-func retryPolicy() *backoff.ExponentialBackOff {
-	retryPolicy := backoff.NewExponentialBackOff()
-	retryPolicy.MaxElapsedTime = time.Second
-	return retryPolicy
-}
-
-func (handler *ResourceHandler) notifyUploadFailed(identifier string, e error, request *http.Request) {
-	notifyErr := handler.updater.NotifyUploadFailed(identifier, e)
+func (handler *ResourceHandler) notifyUploadFailed(ctx context.Context, identifier string, e error, request *http.Request) {
+	notifyErr := handler.updater.NotifyUploadFailed(ctx, identifier, e)
 	if notifyErr != nil {
 		logger.From(request).Errorw("Failed to notifying CC about failed upload.", "error", notifyErr)
 	}
@@ -369,14 +383,16 @@ func handleNotificationError(e error, responseWriter http.ResponseWriter, reques
 }
 
 func (handler *ResourceHandler) CopySourceGuid(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
+	audit.From(request).Describe(audit.Copy, params["identifier"])
+	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySize()) {
 		return
 	}
 	sourceGuid := sourceGuidFrom(request, responseWriter)
 	if sourceGuid == "" {
 		return // response is already handled in sourceGuidFrom
 	}
-	e := handler.blobstore.Copy(sourceGuid, params["identifier"])
+	audit.From(request).WithSourceGUID(sourceGuid)
+	e := handler.blobstoreFor(request).Copy(sourceGuid, params["identifier"])
 	// TODO use Clock instead:
 	writeResponseBasedOn("", e, responseWriter, request, http.StatusCreated, nil, &responseBody{Guid: params["identifier"], State: "READY", Type: "bits", CreatedAt: time.Now()}, "")
 }
@@ -397,7 +413,7 @@ func sourceGuidFrom(request *http.Request, responseWriter http.ResponseWriter) s
 
 func (handler *ResourceHandler) HeadOrRedirectAsGet(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
 	if handler.shouldProxyGetRequests {
-		exists, e := handler.blobstore.Exists(params["identifier"])
+		exists, e := handler.blobstoreFor(request).Exists(params["identifier"])
 		util.PanicOnError(e)
 		if exists {
 			responseWriter.WriteHeader(http.StatusOK)
@@ -406,7 +422,7 @@ func (handler *ResourceHandler) HeadOrRedirectAsGet(responseWriter http.Response
 		}
 		return
 	}
-	redirectLocation, e := handler.blobstore.HeadOrRedirectAsGet(params["identifier"])
+	redirectLocation, e := handler.blobstoreFor(request).HeadOrRedirectAsGet(params["identifier"])
 	writeResponseBasedOn(redirectLocation, e, responseWriter, request, http.StatusOK, nil, nil, "")
 }
 
@@ -417,29 +433,31 @@ func (handler *ResourceHandler) Get(responseWriter http.ResponseWriter, request
 		body             io.ReadCloser
 	)
 	if handler.shouldProxyGetRequests {
-		body, e = handler.blobstore.Get(params["identifier"])
+		body, e = handler.blobstoreFor(request).Get(params["identifier"])
 	} else {
-		body, redirectLocation, e = handler.blobstore.GetOrRedirect(params["identifier"])
+		body, redirectLocation, e = handler.blobstoreFor(request).GetOrRedirect(params["identifier"])
 	}
 	writeResponseBasedOn(redirectLocation, e, responseWriter, request, http.StatusOK, body, nil, request.Header.Get("If-None-Modify"))
 }
 
 func (handler *ResourceHandler) Delete(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	audit.From(request).Describe(audit.Delete, params["identifier"])
 	// TODO nothing should be S3 specific here
 	// this check is needed, because S3 does not return a NotFound on a Delete request:
-	exists, e := handler.blobstore.Exists(params["identifier"])
+	exists, e := handler.blobstoreFor(request).Exists(params["identifier"])
 	util.PanicOnError(e)
 	if !exists {
 		responseWriter.WriteHeader(http.StatusNotFound)
 		return
 	}
-	e = handler.blobstore.Delete(params["identifier"])
+	e = handler.blobstoreFor(request).Delete(params["identifier"])
 
 	writeResponseBasedOn("", e, responseWriter, request, http.StatusNoContent, nil, nil, "")
 }
 
 func (handler *ResourceHandler) DeleteDir(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	e := handler.blobstore.DeleteDir(params["identifier"])
+	audit.From(request).Describe(audit.DeleteDir, params["identifier"])
+	e := handler.blobstoreFor(request).DeleteDir(params["identifier"])
 
 	switch e.(type) {
 	case *NotFoundError:
@@ -460,6 +478,12 @@ func writeResponseBasedOn(redirectLocation string, e error, responseWriter http.
 	case *NoSpaceLeftError:
 		http.Error(responseWriter, util.DescriptionAndCodeAsJSON(500000, "Request Entity Too Large"), http.StatusInsufficientStorage)
 		return
+	case *UnavailableError:
+		WriteServiceUnavailable(responseWriter, request, e.(*UnavailableError))
+		return
+	case *QuotaExceededError:
+		writeQuotaExceeded(responseWriter, request, e.(*QuotaExceededError))
+		return
 	case error:
 		panic(e)
 	}
@@ -494,6 +518,13 @@ func redirect(responseWriter http.ResponseWriter, redirectLocation string) {
 	responseWriter.WriteHeader(http.StatusFound)
 }
 
+// WriteServiceUnavailable tells clients when to retry, so that they back off while a blobstore is failing.
+func WriteServiceUnavailable(responseWriter http.ResponseWriter, request *http.Request, e *UnavailableError) {
+	logger.From(request).Infow("Service unavailable", "error", e, "retry-after", e.RetryAfter)
+	responseWriter.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	http.Error(responseWriter, util.DescriptionAndCodeAsJSON(10015, "Service Unavailable: %v", e.Error()), http.StatusServiceUnavailable)
+}
+
 func badRequest(responseWriter http.ResponseWriter, request *http.Request, message string, args ...interface{}) {
 	responseBody := fmt.Sprintf(message, args...)
 	logger.From(request).Infow("Bad request", "body", responseBody)
@@ -1,6 +1,7 @@
 package bitsgo_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"reflect"
@@ -99,17 +100,17 @@ var _ = Describe("ResourceHandler", func() {
 					req,
 					map[string]string{})
 
-				updater.VerifyWasCalledOnce().NotifyProcessingUpload(AnyString())
+				updater.VerifyWasCalledOnce().NotifyProcessingUpload(anyContext(), AnyString())
 
-				updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-				updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+				updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+				updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 				synchronization <- true
 
 				Eventually(func() []string {
 					// TODO can this be done better?
 					return interceptPegomockFailures(func() {
-						updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-						updater.VerifyWasCalledOnce().NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+						updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+						updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 					})
 				}, "2s").Should(BeEmpty())
 
@@ -185,9 +186,10 @@ var _ = Describe("ResourceHandler", func() {
 					map[string]string{"identifier": "someguid"})
 
 				inOrderContext := new(InOrderContext)
-				updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload("someguid")
+				updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload(anyContext(), EqString("someguid"))
 				blobstore.VerifyWasCalledInOrder(Once(), inOrderContext).Put(EqString("someguid"), anyReadSeeker())
-				_, sha1, sha256 := updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadSucceeded(
+				_, _, sha1, sha256 := updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadSucceeded(
+					anyContext(),
 					EqString("someguid"),
 					AnyString(),
 					AnyString()).GetCapturedArguments()
@@ -200,14 +202,14 @@ var _ = Describe("ResourceHandler", func() {
 		Context("Rejects an update", func() {
 			Context("NotifyProcessingUpload returns NewStateForbiddenError", func() {
 				It("does not upload the resource, returns BadRequest", func() {
-					When(updater.NotifyProcessingUpload(AnyString())).ThenReturn(NewStateForbiddenError())
+					When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(NewStateForbiddenError())
 
 					handler.AddOrReplace(responseWriter,
 						newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
 						map[string]string{"identifier": "someguid"})
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 					blobstore.VerifyWasCalled(Never()).Put(AnyString(), anyReadSeeker())
 
 					Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
@@ -217,7 +219,7 @@ var _ = Describe("ResourceHandler", func() {
 
 			Context("NotifyUploadSucceeded returns an error", func() {
 				It("has uploaded the resource, panics", func() {
-					When(updater.NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())).ThenReturn(fmt.Errorf("Some error"))
+					When(updater.NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())).ThenReturn(fmt.Errorf("Some error"))
 
 					Expect(func() {
 						handler.AddOrReplace(responseWriter,
@@ -225,20 +227,20 @@ var _ = Describe("ResourceHandler", func() {
 							map[string]string{"identifier": "someguid"})
 					}).To(Panic())
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
 					blobstore.VerifyWasCalledOnce().Put(EqString("someguid"), anyReadSeeker())
 				})
 
 				Context("error is NotFoundError", func() {
 					It("has uploaded the resource, returns StatusConflict", func() {
-						When(updater.NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())).ThenReturn(bitsgo.NewNotFoundError())
+						When(updater.NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())).ThenReturn(bitsgo.NewNotFoundError())
 
 						handler.AddOrReplace(responseWriter,
 							newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
 							map[string]string{"identifier": "someguid"})
 
 						Expect(responseWriter.Code).To(Equal(http.StatusConflict))
-						updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
+						updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
 						blobstore.VerifyWasCalledOnce().Put(EqString("someguid"), anyReadSeeker())
 					})
 				})
@@ -247,7 +249,7 @@ var _ = Describe("ResourceHandler", func() {
 			Context("NotifyUploadFailed returns an error", func() {
 				It("panics", func() {
 					When(blobstore.Put(AnyString(), anyReadSeeker())).ThenReturn(fmt.Errorf("Some blobstore error"))
-					When(updater.NotifyUploadFailed(AnyString(), anyError())).ThenReturn(fmt.Errorf("Some error"))
+					When(updater.NotifyUploadFailed(anyContext(), AnyString(), anyError())).ThenReturn(fmt.Errorf("Some error"))
 
 					Expect(func() {
 						handler.AddOrReplace(responseWriter,
@@ -256,9 +258,9 @@ var _ = Describe("ResourceHandler", func() {
 					}).To(Panic())
 
 					inOrderContext := new(InOrderContext)
-					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload("someguid")
-					blobstore.VerifyWasCalledInOrder(AtLeast(2), inOrderContext).Put(EqString("someguid"), anyReadSeeker())
-					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadFailed(EqString("someguid"), anyError())
+					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload(anyContext(), EqString("someguid"))
+					blobstore.VerifyWasCalledInOrder(Once(), inOrderContext).Put(EqString("someguid"), anyReadSeeker())
+					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
 				})
 			})
 
@@ -267,7 +269,7 @@ var _ = Describe("ResourceHandler", func() {
 		Context("replies with an unexpected error", func() {
 			Context("NotifyProcessingUpload returns unexpected error", func() {
 				It("does not upload the resource, panics", func() {
-					When(updater.NotifyProcessingUpload(AnyString())).ThenReturn(fmt.Errorf("Unexpected error"))
+					When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(fmt.Errorf("Unexpected error"))
 
 					Expect(func() {
 						handler.AddOrReplace(responseWriter,
@@ -275,8 +277,8 @@ var _ = Describe("ResourceHandler", func() {
 							map[string]string{"identifier": "someguid"})
 					}).To(Panic())
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 					blobstore.VerifyWasCalled(Never()).Put(AnyString(), anyReadSeeker())
 
 				})
@@ -286,14 +288,14 @@ var _ = Describe("ResourceHandler", func() {
 		Context("replies with guid not found", func() {
 			Context("NotifyProcessingUpload returns guid not found", func() {
 				It("does not upload the resource, returns ResourceNotFound", func() {
-					When(updater.NotifyProcessingUpload(AnyString())).ThenReturn(bitsgo.NewNotFoundError())
+					When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(bitsgo.NewNotFoundError())
 
 					handler.AddOrReplace(responseWriter,
 						newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
 						map[string]string{"identifier": "someguid"})
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 					blobstore.VerifyWasCalled(Never()).Put(AnyString(), anyReadSeeker())
 
 					Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
@@ -313,6 +315,11 @@ func anyError() error {
 	return nil
 }
 
+func anyContext() context.Context {
+	RegisterMatcher(NewAnyMatcher(reflect.TypeOf((*context.Context)(nil)).Elem()))
+	return nil
+}
+
 func newTestRequest(resource string, filename string, body string) *http.Request {
 	request, e := httputil.NewPutRequest("http://notrelevant",
 		map[string]map[string]io.Reader{
@@ -0,0 +1,115 @@
+package bitsgo
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+)
+
+// Error types, as used by RetryPolicy.RetryableErrors and in metrics
+const (
+	NotFoundErrorType       = "not_found"
+	NoSpaceLeftErrorType    = "no_space_left"
+	UnavailableErrorType    = "unavailable"
+	StateForbiddenErrorType = "state_forbidden"
+	TimeoutErrorType        = "timeout"
+	OtherErrorType          = "other"
+)
+
+// RetryPolicy is shared by everything that calls blobstores or the Cloud Controller, so that all of them retry alike.
+type RetryPolicy struct {
+	// Including the first attempt. 1 disables retries, 0 retries until MaxElapsedTime
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// No further attempt is started after this time
+	MaxElapsedTime time.Duration
+	// Intervals are randomized by +/- this factor, so that clients which failed together do not retry together
+	Jitter float64
+	// Error types which are retried: TimeoutErrorType and/or OtherErrorType. Errors which are part of normal
+	// operation, like missing blobs, and rejections by a circuit breaker are never worth retrying.
+	RetryableErrors []string
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     4,
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		MaxElapsedTime:  30 * time.Second,
+		Jitter:          0.5,
+		RetryableErrors: []string{TimeoutErrorType, OtherErrorType},
+	}
+}
+
+// ErrorTypeOf classifies e for retrying and metrics.
+func ErrorTypeOf(e error) string {
+	switch cause := errors.Cause(e).(type) {
+	case *NotFoundError:
+		return NotFoundErrorType
+	case *NoSpaceLeftError:
+		return NoSpaceLeftErrorType
+	case *UnavailableError:
+		return UnavailableErrorType
+	case *StateForbiddenError:
+		return StateForbiddenErrorType
+	case interface{ Timeout() bool }:
+		if cause.Timeout() {
+			return TimeoutErrorType
+		}
+	}
+	return OtherErrorType
+}
+
+// IsRetryable never retries calls which were canceled or ran out of time on the caller's side.
+func (policy RetryPolicy) IsRetryable(e error) bool {
+	if cause := errors.Cause(e); cause == context.Canceled || cause == context.DeadlineExceeded {
+		return false
+	}
+	errorType := ErrorTypeOf(e)
+	for _, retryable := range policy.RetryableErrors {
+		if retryable == errorType {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry calls f until it succeeds, fails with an error which is not retryable, or the policy is exhausted. It returns
+// the last error of f. Every retry is counted in the metric <component>-retries, tagged with operation and error_type.
+func (policy RetryPolicy) Retry(metricsService MetricsService, component string, operation string, f func() error) error {
+	return policy.RetryWithContext(context.Background(), metricsService, component, operation, f)
+}
+
+// RetryWithContext is like Retry, but stops retrying once ctx is done, e.g. because the client went away.
+func (policy RetryPolicy) RetryWithContext(ctx context.Context, metricsService MetricsService, component string, operation string, f func() error) error {
+	var lastError error
+	backoff.RetryNotify(func() error {
+		lastError = f()
+		if lastError != nil && !policy.IsRetryable(lastError) {
+			return backoff.Permanent(lastError)
+		}
+		return lastError
+	}, backoff.WithContext(policy.backOff(), ctx), func(e error, delay time.Duration) {
+		metricsService.SendCounterMetricWithTags(component+"-retries", 1, map[string]string{
+			"operation":  operation,
+			"error_type": ErrorTypeOf(e),
+		})
+	})
+	return lastError
+}
+
+func (policy RetryPolicy) backOff() backoff.BackOff {
+	exponentialBackOff := backoff.NewExponentialBackOff()
+	exponentialBackOff.InitialInterval = policy.InitialInterval
+	exponentialBackOff.MaxInterval = policy.MaxInterval
+	exponentialBackOff.MaxElapsedTime = policy.MaxElapsedTime
+	exponentialBackOff.RandomizationFactor = policy.Jitter
+	exponentialBackOff.Reset()
+	if policy.MaxAttempts <= 0 {
+		return exponentialBackOff
+	}
+	return backoff.WithMaxRetries(exponentialBackOff, uint64(policy.MaxAttempts-1))
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/jwtauth"
 	"github.com/cloudfoundry-incubator/bits-service/middlewares"
 	registry "github.com/cloudfoundry-incubator/bits-service/oci_registry"
 	"github.com/cloudfoundry-incubator/bits-service/util"
@@ -11,7 +12,18 @@ import (
 	"github.com/urfave/negroni"
 )
 
-func SetUpAllRoutes(privateHost, publicHost string, basicAuthMiddleware *middlewares.BasicAuthMiddleware,
+// SetUpAllRoutes sets up the routes of the private and the public endpoint. jwtAuthMiddleware and clientCertAuthMiddleware
+// are optional. When given, every route of the private endpoint requires a bearer token or client certificate with the scope
+// of its route group: bits.read or bits.write for resources, depending on the method, and for signing, depending on the
+// signed verb; bits.admin for admin routes. Sign routes still accept basic auth of signing users via basicAuthMiddleware
+// for requests without either, admin routes only basic auth of admin users via adminBasicAuthMiddleware.
+// The health route never requires authentication. quotaHandler is optional; without it, there are no quota admin routes.
+// Requests to the private endpoint are accounted to the tenant in their bitsgo.TenantHeader. maintenanceModeMiddleware
+// rejects changes to blobs on both endpoints while maintenance mode is enabled or their resource type is read-only.
+// faultInjectionHandler is only set when fault injection is enabled.
+func SetUpAllRoutes(privateHost, publicHost string, basicAuthMiddleware, adminBasicAuthMiddleware *middlewares.BasicAuthMiddleware,
+	jwtAuthMiddleware *middlewares.JWTAuthMiddleware,
+	clientCertAuthMiddleware *middlewares.ClientCertAuthMiddleware,
 	signatureVerificationMiddleware *middlewares.SignatureVerificationMiddleware,
 	signPackageURLHandler,
 	signDropletURLHandler,
@@ -19,25 +31,54 @@ func SetUpAllRoutes(privateHost, publicHost string, basicAuthMiddleware *middlew
 	signBuildpackCacheURLHandler,
 	signAppStashURLHandler *bitsgo.SignResourceHandler,
 	appstashHandler *bitsgo.AppStashHandler,
-	packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler *bitsgo.ResourceHandler) *mux.Router {
+	packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler *bitsgo.ResourceHandler,
+	signingKeysHandler *bitsgo.SigningKeysHandler,
+	configReloadHandler *bitsgo.ConfigReloadHandler,
+	quotaHandler *bitsgo.QuotaHandler,
+	maintenanceModeHandler *bitsgo.MaintenanceModeHandler,
+	maintenanceModeMiddleware *middlewares.MaintenanceModeMiddleware,
+	faultInjectionHandler *bitsgo.FaultInjectionHandler,
+	healthHandler *bitsgo.HealthHandler) *mux.Router {
 
 	rootRouter := mux.NewRouter()
 
 	internalRouter := mux.NewRouter()
-	rootRouter.Host(privateHost).Handler(internalRouter)
+	rootRouter.Host(privateHost).Handler(negroni.New(
+		&middlewares.TenantMiddleware{},
+		maintenanceModeMiddleware,
+		negroni.Wrap(internalRouter),
+	))
 
-	SetUpSignRoute(internalRouter, basicAuthMiddleware,
+	authMiddlewareWithBasicAuthFor := func(scope string) negroni.Handler {
+		return authMiddlewareFor(scope, basicAuthMiddleware, jwtAuthMiddleware, clientCertAuthMiddleware)
+	}
+	SetUpSignRoute(internalRouter, requiringScopeForReadOrWrite(signsRead, authMiddlewareWithBasicAuthFor),
 		signPackageURLHandler, signDropletURLHandler, signBuildpackURLHandler, signBuildpackCacheURLHandler, signAppStashURLHandler)
+	SetUpAdminRoutes(internalRouter, authMiddlewareFor(jwtauth.AdminScope, adminBasicAuthMiddleware, jwtAuthMiddleware, clientCertAuthMiddleware), signingKeysHandler, configReloadHandler, quotaHandler, maintenanceModeHandler, faultInjectionHandler)
+	internalRouter.Path("/health").Methods("GET").Handler(healthHandler)
+
+	internalResourceRouter := internalRouter
+	if jwtAuthMiddleware != nil || clientCertAuthMiddleware != nil {
+		// must come after all other internal routes, since it matches any path
+		internalResourceRouter = mux.NewRouter()
+		internalRouter.PathPrefix("/").Handler(negroni.New(
+			requiringScopeForReadOrWrite(reads, func(scope string) negroni.Handler {
+				return authMiddlewareFor(scope, nil, jwtAuthMiddleware, clientCertAuthMiddleware)
+			}),
+			negroni.Wrap(internalResourceRouter),
+		))
+	}
 
-	SetUpAppStashRoutes(internalRouter, appstashHandler)
-	SetUpPackageRoutes(internalRouter, packageHandler)
-	SetUpBuildpackRoutes(internalRouter, buildpackHandler)
-	SetUpDropletRoutes(internalRouter, dropletHandler)
-	SetUpBuildpackCacheRoutes(internalRouter, buildpackCacheHandler)
+	SetUpAppStashRoutes(internalResourceRouter, appstashHandler)
+	SetUpPackageRoutes(internalResourceRouter, packageHandler)
+	SetUpBuildpackRoutes(internalResourceRouter, buildpackHandler)
+	SetUpDropletRoutes(internalResourceRouter, dropletHandler)
+	SetUpBuildpackCacheRoutes(internalResourceRouter, buildpackCacheHandler)
 
 	publicRouter := mux.NewRouter()
 	rootRouter.Host(publicHost).Handler(negroni.New(
 		signatureVerificationMiddleware,
+		maintenanceModeMiddleware,
 		negroni.Wrap(publicRouter),
 	))
 	SetUpAppStashRoutes(publicRouter, appstashHandler)
@@ -92,7 +133,7 @@ func setUpDefaultMethodRoutes(router *mux.Router, handler *bitsgo.ResourceHandle
 }
 
 func SetUpSignRoute(router *mux.Router,
-	basicAuthMiddleware *middlewares.BasicAuthMiddleware,
+	authMiddleware negroni.Handler,
 	signPackageURLHandler,
 	signDropletURLHandler,
 	signBuildpackURLHandler,
@@ -101,24 +142,92 @@ func SetUpSignRoute(router *mux.Router,
 ) {
 	signRouter := router.PathPrefix("/sign").Subrouter()
 
-	signRouter.Path("/packages/{resource:[a-z0-9\\-]+}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signPackageURLHandler))
-	signRouter.Path("/droplets/{resource:.+}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signDropletURLHandler))
-	signRouter.Path("/buildpacks/{resource:.+}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signBuildpackURLHandler))
-	signRouter.Path("/buildpack_cache/entries/{resource:.*}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signBuildpackCacheURLHandler))
-	signRouter.Path("/app_stash/matches").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signAppStashURLHandler))
+	signRouter.Path("/packages/{resource:[a-z0-9\\-]+}").Methods("GET").Handler(wrapWith(authMiddleware, signPackageURLHandler))
+	signRouter.Path("/droplets/{resource:.+}").Methods("GET").Handler(wrapWith(authMiddleware, signDropletURLHandler))
+	signRouter.Path("/buildpacks/{resource:.+}").Methods("GET").Handler(wrapWith(authMiddleware, signBuildpackURLHandler))
+	signRouter.Path("/buildpack_cache/entries/{resource:.*}").Methods("GET").Handler(wrapWith(authMiddleware, signBuildpackCacheURLHandler))
+	signRouter.Path("/app_stash/matches").Methods("GET").Handler(wrapWith(authMiddleware, signAppStashURLHandler))
 
 	signRouter.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 	})
 }
 
-func wrapWith(basicAuthMiddleware *middlewares.BasicAuthMiddleware, handler *bitsgo.SignResourceHandler) http.Handler {
+func SetUpAdminRoutes(router *mux.Router, authMiddleware negroni.Handler, signingKeysHandler *bitsgo.SigningKeysHandler, configReloadHandler *bitsgo.ConfigReloadHandler, quotaHandler *bitsgo.QuotaHandler, maintenanceModeHandler *bitsgo.MaintenanceModeHandler, faultInjectionHandler *bitsgo.FaultInjectionHandler) {
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+
+	adminRouter.Path("/signing-keys").Methods("GET").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(signingKeysHandler.List))))
+	adminRouter.Path("/signing-keys/reload").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(signingKeysHandler.Reload))))
+	adminRouter.Path("/config/reload").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(configReloadHandler.Reload))))
+	adminRouter.Path("/maintenance").Methods("GET").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(maintenanceModeHandler.Get))))
+	adminRouter.Path("/maintenance/enable").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(maintenanceModeHandler.Enable))))
+	adminRouter.Path("/maintenance/disable").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(maintenanceModeHandler.Disable))))
+	adminRouter.Path("/maintenance/{resource_type:packages|droplets|buildpacks|buildpack_cache|app_stash}/enable").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(delegateTo(maintenanceModeHandler.EnableFor)))))
+	adminRouter.Path("/maintenance/{resource_type:packages|droplets|buildpacks|buildpack_cache|app_stash}/disable").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(delegateTo(maintenanceModeHandler.DisableFor)))))
+	if quotaHandler != nil {
+		adminRouter.Path("/quotas").Methods("GET").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(quotaHandler.List))))
+		adminRouter.Path("/quotas/reconcile").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(quotaHandler.Reconcile))))
+		adminRouter.Path("/quotas/{tenant}").Methods("GET").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(delegateTo(quotaHandler.Get)))))
+	}
+	if faultInjectionHandler != nil {
+		adminRouter.Path("/faults").Methods("GET").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(faultInjectionHandler.List))))
+		adminRouter.Path("/faults").Methods("POST").Handler(negroni.New(authMiddleware, negroni.Wrap(http.HandlerFunc(faultInjectionHandler.Set))))
+	}
+}
+
+func wrapWith(authMiddleware negroni.Handler, handler *bitsgo.SignResourceHandler) http.Handler {
 	return negroni.New(
-		basicAuthMiddleware,
+		authMiddleware,
 		negroni.Wrap(http.HandlerFunc(delegateWithQueryParamsExtractedTo(handler.Sign))),
 	)
 }
 
+// authMiddlewareFor chains the configured authentication methods for a route group requiring scope: client certificates
+// take precedence over bearer tokens, which take precedence over fallback. Without fallback, requests which carry neither
+// client certificate nor bearer token are only accepted if neither is configured.
+func authMiddlewareFor(scope string, fallback negroni.Handler,
+	jwtAuthMiddleware *middlewares.JWTAuthMiddleware,
+	clientCertAuthMiddleware *middlewares.ClientCertAuthMiddleware) negroni.Handler {
+
+	result := fallback
+	if jwtAuthMiddleware != nil {
+		jwtAuthMiddleware = jwtAuthMiddleware.RequiringScope(scope)
+		if result != nil {
+			jwtAuthMiddleware = jwtAuthMiddleware.WithFallback(result)
+		}
+		result = jwtAuthMiddleware
+	}
+	if clientCertAuthMiddleware != nil {
+		clientCertAuthMiddleware = clientCertAuthMiddleware.RequiringPermission(scope)
+		if result != nil {
+			clientCertAuthMiddleware = clientCertAuthMiddleware.WithFallback(result)
+		}
+		result = clientCertAuthMiddleware
+	}
+	return result
+}
+
+func requiringScopeForReadOrWrite(isRead func(*http.Request) bool, authMiddlewareFor func(scope string) negroni.Handler) negroni.Handler {
+	readAuthMiddleware := authMiddlewareFor(jwtauth.ReadScope)
+	writeAuthMiddleware := authMiddlewareFor(jwtauth.WriteScope)
+	return negroni.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+		if isRead(request) {
+			readAuthMiddleware.ServeHTTP(responseWriter, request, next)
+			return
+		}
+		writeAuthMiddleware.ServeHTTP(responseWriter, request, next)
+	})
+}
+
+func reads(request *http.Request) bool {
+	return request.Method == http.MethodGet || request.Method == http.MethodHead
+}
+
+func signsRead(request *http.Request) bool {
+	verb := request.URL.Query().Get("verb")
+	return verb == "" || verb == "get"
+}
+
 func setRouteNotFoundStatusCode(router *mux.Router, statusCode int) {
 	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(statusCode)
@@ -135,6 +244,10 @@ func delegateWithQueryParamsExtractedTo(delegate func(http.ResponseWriter, *http
 	return func(responseWriter http.ResponseWriter, request *http.Request) {
 		// TODO: make this more generic
 		mux.Vars(request)["verb"] = request.URL.Query().Get("verb")
+		mux.Vars(request)["max_content_length"] = request.URL.Query().Get("max_content_length")
+		mux.Vars(request)["content_type"] = request.URL.Query().Get("content_type")
+		mux.Vars(request)["expires_in"] = request.URL.Query().Get("expires_in")
+		mux.Vars(request)["tenant"] = request.URL.Query().Get("tenant")
 		delegate(responseWriter, request, mux.Vars(request))
 	}
 }
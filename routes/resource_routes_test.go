@@ -2,6 +2,9 @@ package routes_test
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"io"
 	"log"
 	"math"
@@ -11,15 +14,20 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"archive/zip"
 
 	"io/ioutil"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
 	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	"github.com/cloudfoundry-incubator/bits-service/jwtauth"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 	. "github.com/cloudfoundry-incubator/bits-service/routes"
 	"github.com/cloudfoundry-incubator/bits-service/statsd"
 	. "github.com/cloudfoundry-incubator/bits-service/testutil"
@@ -144,7 +152,7 @@ var _ = Describe("routes", func() {
 		BeforeEach(func() {
 			SetUpPackageRoutes(
 				router,
-				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "package", statsd.NewMetricsService(), 0, false))
+				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "package", statsd.NewMetricsService("", "", nil, ""), 0, false))
 		})
 		ItSupportsMethodsGetPutDeleteFor("/packages/theguid", "package", "th/eg/theguid")
 	})
@@ -153,7 +161,7 @@ var _ = Describe("routes", func() {
 		BeforeEach(func() {
 			SetUpDropletRoutes(
 				router,
-				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "droplet", statsd.NewMetricsService(), 0, false))
+				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "droplet", statsd.NewMetricsService("", "", nil, ""), 0, false))
 		})
 
 		Context("With digest in URL (/droplets/{guid}/{checksum})", func() {
@@ -188,7 +196,7 @@ var _ = Describe("routes", func() {
 		BeforeEach(func() {
 			SetUpBuildpackRoutes(
 				router,
-				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "buildpack", statsd.NewMetricsService(), 0, false))
+				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "buildpack", statsd.NewMetricsService("", "", nil, ""), 0, false))
 		})
 		ItSupportsMethodsGetPutDeleteFor("/buildpacks/theguid", "buildpack", "th/eg/theguid")
 	})
@@ -197,7 +205,7 @@ var _ = Describe("routes", func() {
 		BeforeEach(func() {
 			SetUpBuildpackCacheRoutes(
 				router,
-				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(decorator.ForBlobstoreWithPathPrefixing(blobstore, "buildpack_cache/")), appstashBlobstore, "buildpack_cache", statsd.NewMetricsService(), 0, false))
+				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(decorator.ForBlobstoreWithPathPrefixing(blobstore, "buildpack_cache/")), appstashBlobstore, "buildpack_cache", statsd.NewMetricsService("", "", nil, ""), 0, false))
 		})
 
 		Context("GET /buildpack_cache/entries/{app_guid}/{stack_name}", func() {
@@ -378,6 +386,270 @@ var _ = Describe("routes", func() {
 	})
 })
 
+type fakeResourceSigner struct{}
+
+func (signer *fakeResourceSigner) Sign(resource string, method string, expirationTime time.Time) string {
+	return "signed " + method + " " + resource
+}
+
+type fakeTokenValidator map[string][]string
+
+func (validator fakeTokenValidator) Validate(token string) (*jwtauth.Token, error) {
+	if scopes, exist := validator[token]; exist {
+		return &jwtauth.Token{Subject: token, Scopes: scopes}, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+type fakeQuotaReporter struct{}
+
+func (fakeQuotaReporter) QuotaUsage(tenant string) bitsgo.QuotaUsage {
+	return bitsgo.QuotaUsage{Tenant: tenant, UsedBytes: 7, QuotaBytes: 10, Blobs: 1}
+}
+
+func (reporter fakeQuotaReporter) AllQuotaUsage() []bitsgo.QuotaUsage {
+	return []bitsgo.QuotaUsage{reporter.QuotaUsage("some-space")}
+}
+
+func (fakeQuotaReporter) Reconcile() error { return nil }
+
+var _ = Describe("SetUpAllRoutes with JWT auth", func() {
+	var (
+		router         *mux.Router
+		responseWriter *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		maintenanceMode := bitsgo.NewMaintenanceMode(clock.New())
+		blobstore := inmemory_blobstore.NewBlobstoreWithEntries(map[string][]byte{"ab/cd/abcd": []byte("content")})
+		faultInjector := decorator.NewFaultInjector(clock.New())
+		resourceHandler := bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(decorator.ForBlobstoreWithFaultInjection(blobstore, faultInjector, "packages")), blobstore, "package", statsd.NewMetricsService("", "", nil, ""), 0, false)
+		signHandler := bitsgo.NewSignResourceHandler(&fakeResourceSigner{}, &fakeResourceSigner{})
+		router = SetUpAllRoutes("internal.example.com", "public.example.com",
+			middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "user", Password: "pass"}),
+			middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "admin-user", Password: "admin-pass"}),
+			middlewares.NewJWTAuthMiddleware(fakeTokenValidator{
+				"reader": {"bits.read"},
+				"writer": {"bits.read", "bits.write"},
+				"admin":  {"bits.admin"},
+			}),
+			middlewares.NewClientCertAuthMiddleware(false, middlewares.ClientCertRule{SAN: "reader.example.com", Permissions: []string{"bits.read"}}),
+			&middlewares.SignatureVerificationMiddleware{SignatureValidator: pathsigner.Validate(&pathsigner.PathSignerValidator{Secret: "secret", Clock: clock.New()})},
+			signHandler, signHandler, signHandler, signHandler, signHandler,
+			bitsgo.NewAppStashHandlerWithSizeThresholds(blobstore, 0, 0, math.MaxUint64, NewMockMetricsService()),
+			resourceHandler, resourceHandler, resourceHandler, resourceHandler,
+			bitsgo.NewSigningKeysHandler(pathsigner.Validate(&pathsigner.PathSignerValidator{Secret: "secret", Clock: clock.New()}), func() error { return nil }),
+			bitsgo.NewConfigReloadHandler(func() error { return nil }),
+			bitsgo.NewQuotaHandler(fakeQuotaReporter{}),
+			bitsgo.NewMaintenanceModeHandler(maintenanceMode),
+			&middlewares.MaintenanceModeMiddleware{Mode: maintenanceMode},
+			bitsgo.NewFaultInjectionHandler(faultInjector),
+			bitsgo.NewHealthHandler())
+		responseWriter = httptest.NewRecorder()
+	})
+
+	requestWithToken := func(method string, path string, token string) *http.Request {
+		request := httptest.NewRequest(method, "http://internal.example.com"+path, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return request
+	}
+
+	It("requires bits.read for reading resources", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/packages/abcd", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/packages/abcd", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/packages/abcd", ""))
+		Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("requires bits.write for modifying resources", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("DELETE", "/packages/abcd", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("DELETE", "/packages/abcd", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("requires the scope of the signed verb for signing URLs, but still accepts basic auth", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/sign/packages/abcd", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+		Expect(responseWriter.Body.String()).To(Equal("signed get abcd"))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/sign/packages/abcd?verb=put", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		request := requestWithToken("GET", "/sign/packages/abcd?verb=put", "")
+		request.SetBasicAuth("user", "pass")
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+	})
+
+	It("requires bits.admin for admin routes", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/admin/signing-keys", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/admin/signing-keys", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/config/reload", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/config/reload", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusNoContent))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/admin/quotas/some-space", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/admin/quotas/some-space", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+		Expect(responseWriter.Body.String()).To(MatchJSON(`{"tenant": "some-space", "used_bytes": 7, "quota_bytes": 10, "blobs": 1}`))
+	})
+
+	It("only accepts basic auth of admin users for admin routes", func() {
+		request := requestWithToken("GET", "/admin/signing-keys", "")
+		request.SetBasicAuth("user", "pass")
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+
+		responseWriter = httptest.NewRecorder()
+		request = requestWithToken("GET", "/admin/signing-keys", "")
+		request.SetBasicAuth("admin-user", "admin-pass")
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		request = requestWithToken("GET", "/sign/packages/abcd", "")
+		request.SetBasicAuth("admin-user", "admin-pass")
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects changes, but serves downloads in maintenance mode", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/maintenance/enable", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("DELETE", "/packages/abcd", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/packages/abcd", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/maintenance/disable", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("DELETE", "/packages/abcd", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("lets admins make single resource types read-only", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/maintenance/packages/enable", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/maintenance/unknown/enable", "admin"))
+		Expect(responseWriter.Code).NotTo(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/maintenance/packages/enable", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/admin/maintenance", "admin"))
+		Expect(responseWriter.Body.String()).To(ContainSubstring(`"resource_types":{"packages":{"enabled":true`))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("DELETE", "/packages/abcd", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("POST", "/admin/maintenance/packages/disable", "admin"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("DELETE", "/packages/abcd", "writer"))
+		Expect(responseWriter.Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("lets admins inject faults", func() {
+		request := requestWithToken("POST", "/admin/faults", "writer")
+		request.Body = ioutil.NopCloser(strings.NewReader(`[{"operation": "get_or_redirect", "not_found_rate": 1}]`))
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+
+		responseWriter = httptest.NewRecorder()
+		request = requestWithToken("POST", "/admin/faults", "admin")
+		request.Body = ioutil.NopCloser(strings.NewReader(`[{"operation": "get_or_redirect", "not_found_rate": 1}]`))
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+		Expect(responseWriter.Body.String()).To(MatchJSON(`[{"operation": "get_or_redirect", "not_found_rate": 1}]`))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/packages/abcd", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
+
+		responseWriter = httptest.NewRecorder()
+		request = requestWithToken("POST", "/admin/faults", "admin")
+		request.Body = ioutil.NopCloser(strings.NewReader(`[{"operation": "list"}]`))
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+
+		responseWriter = httptest.NewRecorder()
+		request = requestWithToken("POST", "/admin/faults", "admin")
+		request.Body = ioutil.NopCloser(strings.NewReader(`[]`))
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/packages/abcd", "reader"))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+	})
+
+	It("does not require authentication for the health route", func() {
+		router.ServeHTTP(responseWriter, requestWithToken("GET", "/health", ""))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+		Expect(responseWriter.Body.String()).To(MatchJSON(`{"status": "ok", "circuit_breakers": []}`))
+	})
+
+	It("accepts client certificates instead of tokens", func() {
+		request := requestWithToken("GET", "/packages/abcd", "")
+		request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"reader.example.com"}}}}}
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		request = requestWithToken("DELETE", "/packages/abcd", "writer")
+		request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"reader.example.com"}}}}}
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("does not require tokens on the public endpoint", func() {
+		request := httptest.NewRequest("GET", "http://public.example.com/packages/abcd", nil)
+		router.ServeHTTP(responseWriter, request)
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+		Expect(responseWriter.Header().Get("WWW-Authenticate")).To(BeEmpty())
+	})
+})
+
 func zipContentsOf(buffer *bytes.Buffer) map[string][]byte {
 	zipReader, e := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
 	Expect(e).NotTo(HaveOccurred())
@@ -3,25 +3,48 @@ package bitsgo
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
 )
 
 type ResourceSigner interface {
 	Sign(resource string, method string, expirationTime time.Time) (signedURL string)
 }
 
+// ConstrainedResourceSigner is implemented by ResourceSigners which can additionally bind
+// the content length, content type and tenant of uploads to the signed URL.
+type ConstrainedResourceSigner interface {
+	SignWithConstraints(resource string, method string, expirationTime time.Time, maxContentLength int64, contentType string, tenant string) (signedURL string)
+}
+
+// SigningAvailability is implemented by ResourceSigners which cannot always sign, e.g. because the
+// deployment only validates signed URLs.
+type SigningAvailability interface {
+	CanSign() bool
+}
+
 type SignResourceHandler struct {
 	clock                                clock.Clock
 	putResourceSigner, getResourceSigner ResourceSigner
+	expiry, maxExpiry                    time.Duration
 }
 
 func NewSignResourceHandler(getResourceSigner, putResourceSigner ResourceSigner) *SignResourceHandler {
+	return NewSignResourceHandlerWithExpiry(getResourceSigner, putResourceSigner, 1*time.Hour, 1*time.Hour)
+}
+
+// NewSignResourceHandlerWithExpiry signs URLs which expire after expiry, unless the request asks
+// for a different validity period via expires_in. That period must not exceed maxExpiry.
+func NewSignResourceHandlerWithExpiry(getResourceSigner, putResourceSigner ResourceSigner, expiry, maxExpiry time.Duration) *SignResourceHandler {
 	return &SignResourceHandler{
 		getResourceSigner: getResourceSigner,
 		putResourceSigner: putResourceSigner,
 		clock:             clock.New(),
+		expiry:            expiry,
+		maxExpiry:         maxExpiry,
 	}
 }
 
@@ -32,6 +55,7 @@ func (handler *SignResourceHandler) Sign(responseWriter http.ResponseWriter, req
 	if method == "" {
 		method = "get"
 	}
+	audit.From(request).Describe(audit.Sign, params["resource"]).WithSignedVerb(method)
 
 	switch method {
 	case "get":
@@ -43,7 +67,51 @@ func (handler *SignResourceHandler) Sign(responseWriter http.ResponseWriter, req
 		responseWriter.Write([]byte("Invalid verb: " + method))
 		return
 	}
+	if availability, ok := signer.(SigningAvailability); ok && !availability.CanSign() {
+		responseWriter.WriteHeader(http.StatusServiceUnavailable)
+		responseWriter.Write([]byte("This bits-service only validates signed URLs. It has no active key to sign them."))
+		return
+	}
+
+	expiry := handler.expiry
+	if params["expires_in"] != "" {
+		seconds, e := strconv.ParseInt(params["expires_in"], 10, 64)
+		if e != nil || seconds <= 0 || seconds > int64(handler.maxExpiry/time.Second) {
+			responseWriter.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(responseWriter, "Invalid expires_in: %v. Must be a number of seconds between 1 and %v", params["expires_in"], int64(handler.maxExpiry/time.Second))
+			return
+		}
+		expiry = time.Duration(seconds) * time.Second
+	}
+	expirationTime := handler.clock.Now().Add(expiry)
 
-	signature := signer.Sign(params["resource"], method, handler.clock.Now().Add(1*time.Hour))
-	fmt.Fprint(responseWriter, signature)
+	// Downloads are not accounted to tenants, so only uploads are bound to one. The tenant of the signing request
+	// itself is only bound where the signer supports it, so that signing for other blobstores keeps working.
+	tenant := params["tenant"]
+	if _, ok := signer.(ConstrainedResourceSigner); ok && tenant == "" && method != "get" {
+		tenant = TenantFrom(request.Context())
+	}
+
+	if params["max_content_length"] == "" && params["content_type"] == "" && tenant == "" {
+		fmt.Fprint(responseWriter, signer.Sign(params["resource"], method, expirationTime))
+		return
+	}
+
+	var maxContentLength int64
+	if params["max_content_length"] != "" {
+		var e error
+		maxContentLength, e = strconv.ParseInt(params["max_content_length"], 10, 64)
+		if e != nil || maxContentLength <= 0 {
+			responseWriter.WriteHeader(http.StatusBadRequest)
+			responseWriter.Write([]byte("Invalid max_content_length: " + params["max_content_length"]))
+			return
+		}
+	}
+	constrainedSigner, ok := signer.(ConstrainedResourceSigner)
+	if method == "get" || !ok {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		responseWriter.Write([]byte("max_content_length, content_type and tenant are only supported for uploads to this resource"))
+		return
+	}
+	fmt.Fprint(responseWriter, constrainedSigner.SignWithConstraints(params["resource"], method, expirationTime, maxContentLength, params["content_type"], tenant))
 }
@@ -1,13 +1,19 @@
 package bitsgo_test
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/local"
 	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 	. "github.com/petergtz/pegomock"
 )
 
@@ -60,4 +66,95 @@ var _ = Describe("SignResourceHandler", func() {
 		Expect(recorder.Code).To(Equal(http.StatusOK))
 		Expect(recorder.Body.String()).To(Equal("Some put signature"))
 	})
+
+	It("rejects upload constraints when the signer cannot bind them", func() {
+		handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
+		request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+
+		handler.Sign(recorder, request, map[string]string{"verb": "put", "resource": "foobar", "max_content_length": "1024"})
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects an invalid max_content_length", func() {
+		handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
+		request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+
+		handler.Sign(recorder, request, map[string]string{"verb": "put", "resource": "foobar", "max_content_length": "lots"})
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(Equal("Invalid max_content_length: lots"))
+	})
+
+	It("binds signed uploads to the tenant of the signing request", func() {
+		constrainedSigner := &fakeConstrainedResourceSigner{}
+		handler := bitsgo.NewSignResourceHandler(getSigner, constrainedSigner)
+		request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+		request = request.WithContext(bitsgo.ContextWithTenant(request.Context(), "some-space"))
+
+		handler.Sign(recorder, request, map[string]string{"verb": "put", "resource": "foobar"})
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(constrainedSigner.tenant).To(Equal("some-space"))
+
+		handler.Sign(recorder, request, map[string]string{"verb": "put", "resource": "foobar", "tenant": "other-space"})
+		Expect(constrainedSigner.tenant).To(Equal("other-space"))
+	})
+
+	It("responds with 503 when the signer only validates signed URLs", func() {
+		publicKey, _, e := ed25519.GenerateKey(rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+		localSigner := &local.LocalResourceSigner{
+			Signer: pathsigner.ValidateAsymmetric(&pathsigner.AsymmetricPathSignerValidator{
+				Clock:      clock.NewMock(),
+				PublicKeys: map[string]crypto.PublicKey{"ed": publicKey},
+			}),
+			ResourcePathPrefix: "/packages/",
+			DelegateEndpoint:   "https://bits.example.com",
+		}
+		handler := bitsgo.NewSignResourceHandler(localSigner, localSigner)
+		request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+
+		handler.Sign(recorder, request, map[string]string{"verb": "put", "resource": "foobar"})
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(recorder.Body.String()).To(ContainSubstring("only validates signed URLs"))
+	})
+
+	Context("expires_in", func() {
+		It("signs with the requested expiry", func() {
+			When(getSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some get signature")
+			handler := bitsgo.NewSignResourceHandlerWithExpiry(getSigner, putSigner, time.Hour, 2*time.Hour)
+			request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+
+			handler.Sign(recorder, request, map[string]string{"verb": "get", "resource": "foobar", "expires_in": "600"})
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+
+		It("rejects an expiry above the maximum", func() {
+			handler := bitsgo.NewSignResourceHandlerWithExpiry(getSigner, putSigner, time.Hour, 2*time.Hour)
+			request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+
+			handler.Sign(recorder, request, map[string]string{"verb": "get", "resource": "foobar", "expires_in": "7201"})
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(Equal("Invalid expires_in: 7201. Must be a number of seconds between 1 and 7200"))
+		})
+
+		It("rejects an expiry which would overflow when converted to a duration", func() {
+			handler := bitsgo.NewSignResourceHandlerWithExpiry(getSigner, putSigner, time.Hour, 2*time.Hour)
+			request := httputil.NewRequest("GET", "/sign/foobar", nil).Build()
+
+			handler.Sign(recorder, request, map[string]string{"verb": "get", "resource": "foobar", "expires_in": "9223372036854775807"})
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
 })
+
+type fakeConstrainedResourceSigner struct {
+	tenant string
+}
+
+func (signer *fakeConstrainedResourceSigner) Sign(resource string, method string, expirationTime time.Time) string {
+	return "signed " + resource
+}
+
+func (signer *fakeConstrainedResourceSigner) SignWithConstraints(resource string, method string, expirationTime time.Time, maxContentLength int64, contentType string, tenant string) string {
+	signer.tenant = tenant
+	return "signed " + resource + " for " + tenant
+}
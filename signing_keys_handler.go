@@ -0,0 +1,51 @@
+package bitsgo
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+type SigningKeysStatusReporter interface {
+	SigningKeysStatus() pathsigner.SigningKeysStatus
+}
+
+// SigningKeysHandler lets operators verify key rotations. It only ever exposes key IDs, never secrets.
+type SigningKeysHandler struct {
+	signer SigningKeysStatusReporter
+	reload func() error
+}
+
+// NewSigningKeysHandler creates a handler which reports the signing keys of signer. reload is
+// expected to reload the config, which hands the configured signing keys to signer.
+func NewSigningKeysHandler(signer SigningKeysStatusReporter, reload func() error) *SigningKeysHandler {
+	return &SigningKeysHandler{signer: signer, reload: reload}
+}
+
+func (handler *SigningKeysHandler) List(responseWriter http.ResponseWriter, request *http.Request) {
+	handler.writeStatus(responseWriter)
+}
+
+func (handler *SigningKeysHandler) Reload(responseWriter http.ResponseWriter, request *http.Request) {
+	audit.From(request).Describe(audit.ReloadSigningKeys, "")
+	e := handler.reload()
+	if e != nil {
+		logger.From(request).Errorw("Could not reload signing keys", "error", e)
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "Could not reload signing keys: %v", e.Error())
+		return
+	}
+	logger.From(request).Infow("Reloaded signing keys", "active-key-id", handler.signer.SigningKeysStatus().ActiveKeyID)
+	handler.writeStatus(responseWriter)
+}
+
+func (handler *SigningKeysHandler) writeStatus(responseWriter http.ResponseWriter) {
+	response, e := json.Marshal(handler.signer.SigningKeysStatus())
+	util.PanicOnError(e)
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(response)
+}
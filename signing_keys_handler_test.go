@@ -0,0 +1,57 @@
+package bitsgo_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
+)
+
+var _ = Describe("SigningKeysHandler", func() {
+	var (
+		signer   *pathsigner.PathSignerValidator
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		signer = pathsigner.Validate(&pathsigner.PathSignerValidator{
+			Clock:       clock.NewMock(),
+			SigningKeys: map[string]string{"key1": "secret1"},
+			ActiveKeyID: "key1",
+		})
+		recorder = httptest.NewRecorder()
+	})
+
+	It("lists key IDs but not their secrets", func() {
+		bitsgo.NewSigningKeysHandler(signer, nil).List(recorder, httputil.NewRequest("GET", "/admin/signing-keys", nil).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"active_key_id":"key1","keys":[{"key_id":"key1","status":"active"}],"secret_accepted":false}`))
+		Expect(recorder.Body.String()).NotTo(ContainSubstring("secret1"))
+	})
+
+	It("reloads the signing keys", func() {
+		handler := bitsgo.NewSigningKeysHandler(signer, func() error {
+			return signer.SetSigningKeys(map[string]string{"key2": "secret2"}, nil, "key2")
+		})
+
+		handler.Reload(recorder, httputil.NewRequest("POST", "/admin/signing-keys/reload", nil).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"active_key_id":"key2","keys":[{"key_id":"key2","status":"active"}],"secret_accepted":false}`))
+	})
+
+	It("keeps the current keys when reloading fails", func() {
+		handler := bitsgo.NewSigningKeysHandler(signer, func() error { return errors.New("invalid config") })
+
+		handler.Reload(recorder, httputil.NewRequest("POST", "/admin/signing-keys/reload", nil).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(recorder.Body.String()).To(ContainSubstring("invalid config"))
+		Expect(signer.SigningKeysStatus().ActiveKeyID).To(Equal("key1"))
+	})
+})
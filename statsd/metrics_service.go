@@ -1,6 +1,9 @@
 package statsd
 
 import (
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/tecnickcom/statsd"
@@ -9,22 +12,46 @@ import (
 type MetricsService struct {
 	statsdClient *statsd.Client
 	prefix       string
+	timingSuffix string
+
+	mutex sync.RWMutex
+	// clients with additional tags, by their flattened tags. Tag values come from a small set, e.g. operations.
+	taggedClients map[string]*statsd.Client
 }
 
-func NewMetricsService() *MetricsService {
-	statsdClient, e := statsd.New() // Connect to the UDP port 8125 by default.
+// NewMetricsService sends metrics to address, or to the UDP port 8125 if address is empty. An empty prefix means
+// metric names are not prefixed. tags are added to all metrics.
+func NewMetricsService(address string, prefix string, tags map[string]string, timingSuffix string) *MetricsService {
+	options := []statsd.Option{statsd.TagsFormat(statsd.Datadog)}
+	if address != "" {
+		options = append(options, statsd.Address(address))
+	}
+	if len(tags) > 0 {
+		options = append(options, statsd.Tags(flatten(tags)...))
+	}
+	statsdClient, e := statsd.New(options...)
 	if e != nil {
 		panic(e)
 	}
-	return &MetricsService{statsdClient: statsdClient, prefix: "bits."}
+	return &MetricsService{
+		statsdClient:  statsdClient,
+		prefix:        prefixFrom(prefix),
+		timingSuffix:  timingSuffix,
+		taggedClients: make(map[string]*statsd.Client),
+	}
+}
+
+func prefixFrom(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return strings.TrimSuffix(prefix, ".") + "."
 }
 
 func (service *MetricsService) SendTimingMetric(name string, duration time.Duration) {
-	service.statsdClient.Timing(service.prefix+name, duration.Seconds()*1000)
-	// we send this additional metric, because our test envs use metrics.ng.bluemix.net
-	// and for aggregation purposes this service needs this suffix.
-	service.statsdClient.Timing(service.prefix+name+".sparse-avg", duration.Seconds()*1000)
+	sendTimingMetric(service.statsdClient, service.prefix+name, service.timingSuffix, duration)
 }
+
 func (service *MetricsService) SendGaugeMetric(name string, value int64) {
 	service.statsdClient.Gauge(service.prefix+name, value)
 }
@@ -32,3 +59,60 @@ func (service *MetricsService) SendGaugeMetric(name string, value int64) {
 func (service *MetricsService) SendCounterMetric(name string, value int64) {
 	service.statsdClient.Count(service.prefix+name, value)
 }
+
+func (service *MetricsService) SendTimingMetricWithTags(name string, duration time.Duration, tags map[string]string) {
+	sendTimingMetric(service.clientWith(tags), service.prefix+name, service.timingSuffix, duration)
+}
+
+func (service *MetricsService) SendGaugeMetricWithTags(name string, value int64, tags map[string]string) {
+	service.clientWith(tags).Gauge(service.prefix+name, value)
+}
+
+func (service *MetricsService) SendCounterMetricWithTags(name string, value int64, tags map[string]string) {
+	service.clientWith(tags).Count(service.prefix+name, value)
+}
+
+func (service *MetricsService) clientWith(tags map[string]string) *statsd.Client {
+	if len(tags) == 0 {
+		return service.statsdClient
+	}
+	flattenedTags := flatten(tags)
+	key := strings.Join(flattenedTags, "\x00")
+
+	service.mutex.RLock()
+	client, exists := service.taggedClients[key]
+	service.mutex.RUnlock()
+	if exists {
+		return client
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if client, exists = service.taggedClients[key]; !exists {
+		client = service.statsdClient.Clone(statsd.Tags(flattenedTags...))
+		service.taggedClients[key] = client
+	}
+	return client
+}
+
+func sendTimingMetric(statsdClient *statsd.Client, name string, timingSuffix string, duration time.Duration) {
+	statsdClient.Timing(name, duration.Seconds()*1000)
+	if timingSuffix != "" {
+		// Some hosted metrics providers (e.g. metrics.ng.bluemix.net) need an additional
+		// metric with a specific suffix for aggregation purposes.
+		statsdClient.Timing(name+timingSuffix, duration.Seconds()*1000)
+	}
+}
+
+func flatten(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]string, 0, 2*len(tags))
+	for _, key := range keys {
+		result = append(result, key, tags[key])
+	}
+	return result
+}
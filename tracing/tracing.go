@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/cloudfoundry-incubator/bits-service/config"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/cloudfoundry-incubator/bits-service"
+
+// Tracer returns the tracer of the globally registered TracerProvider. As long as
+// SetUpTracerProvider has not been called, this is a no-op tracer.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// SetUpTracerProvider registers a global TracerProvider which exports spans as configured
+// and enables W3C trace context propagation. The returned function flushes and stops the exporter.
+func SetUpTracerProvider(tracingConfig config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	var spanProcessorOption sdktrace.TracerProviderOption
+	switch tracingConfig.Exporter {
+	case config.StdoutExporter:
+		exporter, e := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if e != nil {
+			return nil, errors.Wrap(e, "Could not create stdout trace exporter")
+		}
+		spanProcessorOption = sdktrace.WithSyncer(exporter)
+	default:
+		options := []otlptracehttp.Option{}
+		if tracingConfig.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(tracingConfig.OTLPEndpoint))
+		}
+		if tracingConfig.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, e := otlptracehttp.New(context.Background(), options...)
+		if e != nil {
+			return nil, errors.Wrap(e, "Could not create OTLP trace exporter")
+		}
+		spanProcessorOption = sdktrace.WithBatcher(exporter)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		spanProcessorOption,
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", tracingConfig.ServiceName))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tracerProvider.Shutdown, nil
+}
+
+// Extract returns a copy of ctx with the remote span context found in header, if any.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject writes the span context of ctx into header, so that the receiver can continue the trace.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+func RecordError(span trace.Span, e error) {
+	if e == nil {
+		return
+	}
+	span.RecordError(e)
+	span.SetStatus(codes.Error, e.Error())
+}
@@ -0,0 +1,76 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/cloudfoundry-incubator/bits-service/config"
+	"github.com/cloudfoundry-incubator/bits-service/tracing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	It("exports spans to the OTLP collector when shut down", func() {
+		var exportedBatches int32
+		collector := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			if request.URL.Path == "/v1/traces" {
+				atomic.AddInt32(&exportedBatches, 1)
+			}
+		}))
+		defer collector.Close()
+		collectorURL, e := url.Parse(collector.URL)
+		Expect(e).NotTo(HaveOccurred())
+
+		shutdown, e := tracing.SetUpTracerProvider(config.TracingConfig{
+			Enabled:      true,
+			Exporter:     config.OTLPExporter,
+			OTLPEndpoint: collectorURL.Host,
+			OTLPInsecure: true,
+			ServiceName:  "bits-service",
+		})
+		Expect(e).NotTo(HaveOccurred())
+
+		_, span := tracing.Tracer().Start(context.Background(), "some-span")
+		span.End()
+		Expect(atomic.LoadInt32(&exportedBatches)).To(BeZero())
+
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		Expect(atomic.LoadInt32(&exportedBatches)).To(Equal(int32(1)))
+	})
+
+	It("propagates the span context through headers", func() {
+		_, e := tracing.SetUpTracerProvider(config.TracingConfig{Exporter: config.StdoutExporter})
+		Expect(e).NotTo(HaveOccurred())
+
+		ctx, span := tracing.Tracer().Start(context.Background(), "some-span")
+		header := http.Header{}
+		tracing.Inject(ctx, header)
+
+		Expect(header.Get("traceparent")).To(ContainSubstring(span.SpanContext().TraceID().String()))
+		extracted := tracing.Extract(context.Background(), header)
+		_, child := tracing.Tracer().Start(extracted, "child-span")
+		Expect(child.SpanContext().TraceID()).To(Equal(span.SpanContext().TraceID()))
+	})
+
+	It("records errors on spans", func() {
+		recorder := tracetest.NewSpanRecorder()
+		_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "some-span")
+
+		tracing.RecordError(span, nil)
+		tracing.RecordError(span, errors.New("some error"))
+		span.End()
+
+		Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Error))
+		Expect(recorder.Ended()[0].Status().Description).To(Equal("some error"))
+		Expect(recorder.Ended()[0].Events()).To(HaveLen(1))
+	})
+})
@@ -16,3 +16,11 @@ func RequestWithContextValues(r *http.Request, keysAndValues ...interface{}) *ht
 	}
 	return r.WithContext(c)
 }
+
+// RequestIDFrom returns the ID of the request ctx belongs to, or "" if ctx does not belong to a request.
+func RequestIDFrom(ctx context.Context) string {
+	if requestID, ok := ctx.Value("request-id").(string); ok {
+		return requestID
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// VerifyPassword reports whether password matches hash, which is either a bcrypt hash or an argon2id hash
+// in PHC string format, e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>".
+func VerifyPassword(hash string, password string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, e := parseArgon2idHash(hash)
+		if e != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(key, params.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// ValidatePasswordHash returns an error if hash is neither a bcrypt nor an argon2id hash.
+func ValidatePasswordHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, e := parseArgon2idHash(hash)
+		return e
+	}
+	if _, e := bcrypt.Cost([]byte(hash)); e != nil {
+		return errors.New("must be a bcrypt or argon2id hash")
+	}
+	return nil
+}
+
+// maxArgon2idMemory bounds the memory in KiB a single verification may use, to 1 GiB.
+const maxArgon2idMemory = 1 << 20
+
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2idHash(hash string) (*argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("argon2id hash must have the format $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>")
+	}
+	var version int
+	if _, e := fmt.Sscanf(parts[2], "v=%d", &version); e != nil || version != argon2.Version {
+		return nil, errors.Errorf("unsupported argon2id version \"%v\"", parts[2])
+	}
+	var params argon2idParams
+	if _, e := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); e != nil {
+		return nil, errors.Errorf("invalid argon2id parameters \"%v\"", parts[3])
+	}
+	if params.time < 1 || params.threads < 1 {
+		return nil, errors.Errorf("argon2id time and threads must be at least 1 in \"%v\"", parts[3])
+	}
+	if params.memory < 8*uint32(params.threads) || params.memory > maxArgon2idMemory {
+		return nil, errors.Errorf("argon2id memory must be between 8 times the threads and %v KiB in \"%v\"", maxArgon2idMemory, parts[3])
+	}
+	var e error
+	params.salt, e = base64.RawStdEncoding.DecodeString(parts[4])
+	if e != nil {
+		return nil, errors.Wrap(e, "invalid argon2id salt")
+	}
+	params.key, e = base64.RawStdEncoding.DecodeString(parts[5])
+	if e != nil || len(params.key) == 0 {
+		return nil, errors.New("invalid argon2id key")
+	}
+	return &params, nil
+}
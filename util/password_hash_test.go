@@ -0,0 +1,74 @@
+package util_test
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ = Describe("Password hashes", func() {
+	var bcryptHash, argon2Hash string
+
+	BeforeEach(func() {
+		hash, e := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+		Expect(e).NotTo(HaveOccurred())
+		bcryptHash = string(hash)
+
+		salt := []byte("some-salt-value!")
+		argon2Hash = fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=1$%v$%v",
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("argon2-password"), salt, 1, 1024, 1, 32)))
+	})
+
+	Describe("VerifyPassword", func() {
+		It("verifies passwords against bcrypt hashes", func() {
+			Expect(util.VerifyPassword(bcryptHash, "bcrypt-password")).To(BeTrue())
+			Expect(util.VerifyPassword(bcryptHash, "wrong-password")).To(BeFalse())
+		})
+
+		It("verifies passwords against argon2id hashes", func() {
+			Expect(util.VerifyPassword(argon2Hash, "argon2-password")).To(BeTrue())
+			Expect(util.VerifyPassword(argon2Hash, "wrong-password")).To(BeFalse())
+		})
+
+		It("rejects every password for malformed hashes", func() {
+			Expect(util.VerifyPassword("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA", "")).To(BeFalse())
+			Expect(util.VerifyPassword("$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", "")).To(BeFalse())
+			Expect(util.VerifyPassword("not-a-hash", "not-a-hash")).To(BeFalse())
+			Expect(util.VerifyPassword("", "")).To(BeFalse())
+		})
+	})
+
+	Describe("ValidatePasswordHash", func() {
+		It("accepts bcrypt and argon2id hashes", func() {
+			Expect(util.ValidatePasswordHash(bcryptHash)).To(Succeed())
+			Expect(util.ValidatePasswordHash(argon2Hash)).To(Succeed())
+		})
+
+		It("rejects plain text passwords", func() {
+			Expect(util.ValidatePasswordHash("the-password")).To(MatchError("must be a bcrypt or argon2id hash"))
+		})
+
+		It("rejects malformed argon2id hashes", func() {
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA")).To(MatchError(ContainSubstring("must have the format")))
+			Expect(util.ValidatePasswordHash("$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5")).To(MatchError(`unsupported argon2id version "v=16"`))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=lots$c2FsdA$a2V5")).To(MatchError(`invalid argon2id parameters "m=lots"`))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1024,t=1,p=1$not base64$a2V5")).To(MatchError(ContainSubstring("invalid argon2id salt")))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$")).To(MatchError("invalid argon2id key"))
+		})
+
+		It("rejects argon2id parameters out of range", func() {
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5")).To(MatchError(ContainSubstring("time and threads must be at least 1")))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$a2V5")).To(MatchError(ContainSubstring("time and threads must be at least 1")))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=31,t=1,p=4$c2FsdA$a2V5")).To(MatchError(ContainSubstring("memory must be between")))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1048577,t=1,p=1$c2FsdA$a2V5")).To(MatchError(ContainSubstring("memory must be between")))
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=32,t=1,p=4$c2FsdA$a2V5")).To(Succeed())
+			Expect(util.ValidatePasswordHash("$argon2id$v=19$m=1048576,t=1,p=1$c2FsdA$a2V5")).To(Succeed())
+		})
+	})
+})
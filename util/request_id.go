@@ -0,0 +1,30 @@
+package util
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+)
+
+// RequestIDHeader is the header Cloud Foundry components use to correlate requests.
+const RequestIDHeader = "X-Vcap-Request-Id"
+
+// MaxRequestIDLength leaves room for request IDs which Cloud Foundry components compose from several UUIDs.
+const MaxRequestIDLength = 128
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// ValidRequestID tells whether id is safe to adopt from a client and to pass on to logs and other services.
+func ValidRequestID(id string) bool {
+	return len(id) <= MaxRequestIDLength && requestIDPattern.MatchString(id)
+}
+
+// NewRequestID returns a random (version 4) UUID.
+func NewRequestID() string {
+	var uuid [16]byte
+	_, e := rand.Read(uuid[:])
+	PanicOnError(e)
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}